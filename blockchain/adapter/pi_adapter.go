@@ -0,0 +1,206 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Chain adapters give interoperability and tooling code one view of the
+// Cosmos, Polkadot and Pi clients, whose protocols name and type the same
+// operations differently. Heights, hashes and amounts are chain-agnostic;
+// transactions are submitted in the chain's own signed encoding.
+
+// DefaultPollInterval is how often adapters without a native subscription
+// poll for new heads
+const DefaultPollInterval = 5 * time.Second
+
+// DefaultSubmissionWindow is how many blocks a submitted transaction reads
+// as pending before the adapter considers it dropped
+const DefaultSubmissionWindow = 1000
+
+var (
+	// ErrBlockNotFound is returned for heights the chain hasn't produced
+	ErrBlockNotFound = errors.New("adapter: block not found")
+	// ErrUnsupported is returned for operations a chain doesn't offer, such
+	// as balances on chains that keep no account state
+	ErrUnsupported = errors.New("adapter: unsupported by chain")
+)
+
+// ChainAdapter is a chain's client as seen by chain-agnostic code
+type ChainAdapter interface {
+	// ChainID identifies the chain
+	ChainID() string
+	// LatestHeight returns the height of the chain's best block
+	LatestHeight(ctx context.Context) (uint64, error)
+	// FinalizedHeight returns the height of the chain's latest final block
+	FinalizedHeight(ctx context.Context) (uint64, error)
+	// BlockByHeight returns the block at a height, or ErrBlockNotFound
+	BlockByHeight(ctx context.Context, height uint64) (*Block, error)
+	// SubscribeHeads sends the head of every new block, starting with the
+	// current one, until ctx is done and the channel is closed
+	SubscribeHeads(ctx context.Context) (<-chan *Head, error)
+	// SubmitTx submits a signed transaction in the chain's encoding and
+	// returns its hash
+	SubmitTx(ctx context.Context, tx []byte) (string, error)
+	// TxStatus reports how far a transaction has come
+	TxStatus(ctx context.Context, hash string) (*TxStatus, error)
+	// Balance returns an account's balance of a denomination. An empty denom
+	// is the chain's native token.
+	Balance(ctx context.Context, address string, denom string) (*big.Int, error)
+}
+
+// Head identifies a block
+type Head struct {
+	Height     uint64
+	Hash       string
+	ParentHash string
+	// Time is zero on chains whose headers don't carry it
+	Time time.Time
+}
+
+// Block is a block's head and the hashes of its transactions
+type Block struct {
+	Head
+	Txs []string
+}
+
+// TxState is a transaction's progress
+type TxState int
+
+const (
+	// TxUnknown is a transaction the chain and adapter don't know
+	TxUnknown TxState = iota
+	// TxPending is submitted and not in a block yet
+	TxPending
+	// TxIncluded is in a block that isn't final yet
+	TxIncluded
+	// TxFinalized is in a final block
+	TxFinalized
+	// TxFailed is in a block but its execution failed
+	TxFailed
+)
+
+func (s TxState) String() string {
+	switch s {
+	case TxPending:
+		return "pending"
+	case TxIncluded:
+		return "included"
+	case TxFinalized:
+		return "finalized"
+	case TxFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// TxStatus is a transaction's state and, once it is in a block, its height
+type TxStatus struct {
+	Hash   string
+	State  TxState
+	Height uint64
+}
+
+// pollHeads implements SubscribeHeads by polling the adapter's latest height
+func pollHeads(ctx context.Context, adapter ChainAdapter, interval time.Duration) (<-chan *Head, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	next, err := adapter.LatestHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if next == 0 {
+		next = 1
+	}
+	heads := make(chan *Head)
+	go func() {
+		defer close(heads)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			latest, err := adapter.LatestHeight(ctx)
+			for ; err == nil && next <= latest; next++ {
+				var block *Block
+				if block, err = adapter.BlockByHeight(ctx, next); err != nil {
+					break
+				}
+				select {
+				case heads <- &block.Head:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("adapter %s: heads: %s", adapter.ChainID(), err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return heads, nil
+}
+
+// submissions remembers the transactions an adapter submitted and the
+// first height they can be included at, so they read as pending rather than
+// unknown until they land in a block. Transactions still missing window
+// blocks after that height were most likely dropped, and are forgotten.
+type submissions struct {
+	heights map[string]uint64
+	mu      sync.Mutex
+}
+
+// add records a transaction first includable at height, and forgets and
+// returns the ones that expired by then
+func (s *submissions) add(hash string, height uint64, window uint64) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.heights == nil {
+		s.heights = make(map[string]uint64)
+	}
+	var expired []string
+	for submitted, from := range s.heights {
+		if expires(from, height, window) {
+			delete(s.heights, submitted)
+			expired = append(expired, submitted)
+		}
+	}
+	s.heights[hash] = height
+	return expired
+}
+
+// height returns the first height a submitted transaction can be included
+// at, unless it expired by the latest height
+func (s *submissions) height(hash string, latest uint64, window uint64) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	height, ok := s.heights[hash]
+	if ok && expires(height, latest, window) {
+		delete(s.heights, hash)
+		return 0, false
+	}
+	return height, ok
+}
+
+func (s *submissions) remove(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.heights, hash)
+}
+
+// expires reports whether a transaction first includable at from is past
+// the window at the latest height. A zero window is DefaultSubmissionWindow.
+func expires(from, latest, window uint64) bool {
+	if window == 0 {
+		window = DefaultSubmissionWindow
+	}
+	return latest >= from+window
+}
@@ -0,0 +1,142 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryChain is a ChainAdapter over blocks held in memory
+type memoryChain struct {
+	mu     sync.Mutex
+	blocks []*Block
+}
+
+func (c *memoryChain) produce() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	height := uint64(len(c.blocks)) + 1
+	c.blocks = append(c.blocks, &Block{Head: Head{Height: height, Hash: fmt.Sprintf("block-%d", height)}})
+}
+
+func (c *memoryChain) ChainID() string { return "memory" }
+
+func (c *memoryChain) LatestHeight(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return uint64(len(c.blocks)), nil
+}
+
+func (c *memoryChain) FinalizedHeight(ctx context.Context) (uint64, error) {
+	return c.LatestHeight(ctx)
+}
+
+func (c *memoryChain) BlockByHeight(ctx context.Context, height uint64) (*Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height == 0 || height > uint64(len(c.blocks)) {
+		return nil, ErrBlockNotFound
+	}
+	return c.blocks[height-1], nil
+}
+
+func (c *memoryChain) SubscribeHeads(ctx context.Context) (<-chan *Head, error) {
+	return pollHeads(ctx, c, time.Millisecond)
+}
+
+func (c *memoryChain) SubmitTx(ctx context.Context, tx []byte) (string, error) {
+	return "", ErrUnsupported
+}
+
+func (c *memoryChain) TxStatus(ctx context.Context, hash string) (*TxStatus, error) {
+	return &TxStatus{Hash: hash}, nil
+}
+
+func (c *memoryChain) Balance(ctx context.Context, address string, denom string) (*big.Int, error) {
+	return nil, ErrUnsupported
+}
+
+func TestPollHeads(t *testing.T) {
+	chain := &memoryChain{}
+	chain.produce()
+	chain.produce()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	heads, err := chain.SubscribeHeads(ctx)
+	if err != nil {
+		t.Fatalf("Expected SubscribeHeads to succeed, but got error: %s", err)
+	}
+
+	// The subscription starts at the current head and skips no height
+	head := <-heads
+	if head == nil || head.Height != 2 {
+		t.Fatalf("Expected the first head to be at height 2, but got %+v", head)
+	}
+	chain.produce()
+	chain.produce()
+	for want := uint64(3); want <= 4; want++ {
+		head := <-heads
+		if head == nil || head.Height != want || head.Hash != fmt.Sprintf("block-%d", want) {
+			t.Fatalf("Expected the head at height %d, but got %+v", want, head)
+		}
+	}
+
+	cancel()
+	for range heads {
+	}
+}
+
+func TestPollHeadsFromEmptyChain(t *testing.T) {
+	chain := &memoryChain{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	heads, err := chain.SubscribeHeads(ctx)
+	if err != nil {
+		t.Fatalf("Expected SubscribeHeads to succeed, but got error: %s", err)
+	}
+	chain.produce()
+	if head := <-heads; head == nil || head.Height != 1 {
+		t.Errorf("Expected the first block's head, but got %+v", head)
+	}
+}
+
+func TestTxStateString(t *testing.T) {
+	states := map[TxState]string{
+		TxUnknown:   "unknown",
+		TxPending:   "pending",
+		TxIncluded:  "included",
+		TxFinalized: "finalized",
+		TxFailed:    "failed",
+	}
+	for state, want := range states {
+		if state.String() != want {
+			t.Errorf("Expected %q, but got %q", want, state.String())
+		}
+	}
+}
+
+func TestSubmissionsExpire(t *testing.T) {
+	var s submissions
+	s.add("tx-1", 1, 10)
+	s.add("tx-2", 5, 10)
+	if from, ok := s.height("tx-1", 10, 10); !ok || from != 1 {
+		t.Errorf("Expected tx-1 to be pending from height 1, but got %d, %v", from, ok)
+	}
+	if _, ok := s.height("tx-1", 11, 10); ok {
+		t.Errorf("Expected tx-1 to expire past its window")
+	}
+
+	// Adding a transaction forgets the ones that expired, even if their
+	// status is never asked for again
+	expired := s.add("tx-3", 15, 10)
+	if len(expired) != 1 || expired[0] != "tx-2" || len(s.heights) != 1 {
+		t.Errorf("Expected only tx-2 to expire, but got %v and %d remaining", expired, len(s.heights))
+	}
+	if _, ok := s.height("tx-3", 15, 0); !ok {
+		t.Errorf("Expected tx-3 to be pending")
+	}
+}
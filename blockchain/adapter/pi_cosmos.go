@@ -0,0 +1,146 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	cosmosclient "pi/blockchain/cosmos/client"
+)
+
+// CosmosClient is the part of the Cosmos client the Cosmos adapter uses
+type CosmosClient interface {
+	Status(ctx context.Context) (*cosmosclient.Status, error)
+	Block(ctx context.Context, height int64) (*cosmosclient.Block, error)
+	Tx(ctx context.Context, hash string) (*cosmosclient.TxResult, error)
+	BroadcastTx(ctx context.Context, tx []byte) (string, error)
+	Balance(ctx context.Context, address string, denom string) (*big.Int, error)
+}
+
+var _ CosmosClient = (*cosmosclient.Client)(nil)
+
+// CosmosAdapter adapts a Cosmos SDK chain through CometBFT RPC and the
+// SDK's query services. CometBFT blocks are final once committed, so the
+// finalized height is the latest height. Transactions are TxRaw-encoded, as
+// built by cosmosclient.SignTx, and identified by CometBFT's hex hash.
+type CosmosAdapter struct {
+	Chain  string
+	Client CosmosClient
+	// Denom is the denomination Balance queries for an empty denom, e.g. uatom
+	Denom string
+	// PollInterval defaults to DefaultPollInterval
+	PollInterval time.Duration
+	// SubmissionWindow is how many blocks a submitted transaction reads as
+	// pending before it is considered dropped. Defaults to
+	// DefaultSubmissionWindow.
+	SubmissionWindow uint64
+
+	submitted submissions
+}
+
+var _ ChainAdapter = (*CosmosAdapter)(nil)
+
+// ChainID identifies the chain
+func (a *CosmosAdapter) ChainID() string {
+	return a.Chain
+}
+
+// LatestHeight returns the height of the latest block
+func (a *CosmosAdapter) LatestHeight(ctx context.Context) (uint64, error) {
+	status, err := a.Client.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(status.LatestBlockHeight), nil
+}
+
+// FinalizedHeight returns the height of the latest block
+func (a *CosmosAdapter) FinalizedHeight(ctx context.Context) (uint64, error) {
+	return a.LatestHeight(ctx)
+}
+
+// BlockByHeight returns the block at a height
+func (a *CosmosAdapter) BlockByHeight(ctx context.Context, height uint64) (*Block, error) {
+	latest, err := a.LatestHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Pruned nodes fail for heights below their earliest block instead
+	if height == 0 || height > latest {
+		return nil, fmt.Errorf("%w: %d", ErrBlockNotFound, height)
+	}
+	block, err := a.Client.Block(ctx, int64(height))
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]string, 0, len(block.Txs))
+	for _, tx := range block.Txs {
+		txs = append(txs, cosmosclient.TxHash(tx))
+	}
+	return &Block{
+		Head: Head{
+			Height:     uint64(block.Height),
+			Hash:       block.Hash,
+			ParentHash: block.ParentHash,
+			Time:       block.Time,
+		},
+		Txs: txs,
+	}, nil
+}
+
+// SubscribeHeads polls for new heads every PollInterval
+func (a *CosmosAdapter) SubscribeHeads(ctx context.Context) (<-chan *Head, error) {
+	return pollHeads(ctx, a, a.PollInterval)
+}
+
+// SubmitTx broadcasts a signed TxRaw and returns once it passed CheckTx
+func (a *CosmosAdapter) SubmitTx(ctx context.Context, tx []byte) (string, error) {
+	latest, err := a.LatestHeight(ctx)
+	if err != nil {
+		return "", err
+	}
+	hash, err := a.Client.BroadcastTx(ctx, tx)
+	if err != nil {
+		return "", err
+	}
+	a.submitted.add(hash, latest+1, a.SubmissionWindow)
+	return hash, nil
+}
+
+// TxStatus looks up the transaction's execution result
+func (a *CosmosAdapter) TxStatus(ctx context.Context, hash string) (*TxStatus, error) {
+	result, err := a.Client.Tx(ctx, hash)
+	if errors.Is(err, cosmosclient.ErrNotFound) {
+		latest, err := a.LatestHeight(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := a.submitted.height(hash, latest, a.SubmissionWindow); ok {
+			return &TxStatus{Hash: hash, State: TxPending}, nil
+		}
+		return &TxStatus{Hash: hash, State: TxUnknown}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.submitted.remove(hash)
+	status := &TxStatus{Hash: hash, State: TxFinalized, Height: uint64(result.Height)}
+	if result.Code != 0 {
+		status.State = TxFailed
+	}
+	return status, nil
+}
+
+// Balance queries an account's bank balance of a denomination, or of Denom
+// for an empty denom
+func (a *CosmosAdapter) Balance(ctx context.Context, address string, denom string) (*big.Int, error) {
+	if denom == "" {
+		denom = a.Denom
+	}
+	if denom == "" {
+		return nil, errors.New("adapter: no denom for the Cosmos balance")
+	}
+	return a.Client.Balance(ctx, address, denom)
+}
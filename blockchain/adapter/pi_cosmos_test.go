@@ -0,0 +1,167 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	cosmosclient "pi/blockchain/cosmos/client"
+)
+
+// fakeCosmosClient is a CosmosClient over an in-memory chain
+type fakeCosmosClient struct {
+	blocks   []*cosmosclient.Block
+	results  map[string]*cosmosclient.TxResult
+	balances map[string]*big.Int
+	mempool  [][]byte
+}
+
+func (c *fakeCosmosClient) Status(ctx context.Context) (*cosmosclient.Status, error) {
+	return &cosmosclient.Status{ChainID: "cosmoshub-4", LatestBlockHeight: int64(len(c.blocks))}, nil
+}
+
+func (c *fakeCosmosClient) Block(ctx context.Context, height int64) (*cosmosclient.Block, error) {
+	if height < 1 || height > int64(len(c.blocks)) {
+		return nil, fmt.Errorf("height %d is not available", height)
+	}
+	return c.blocks[height-1], nil
+}
+
+func (c *fakeCosmosClient) Tx(ctx context.Context, hash string) (*cosmosclient.TxResult, error) {
+	if result, ok := c.results[hash]; ok {
+		return result, nil
+	}
+	return nil, cosmosclient.ErrNotFound
+}
+
+func (c *fakeCosmosClient) BroadcastTx(ctx context.Context, tx []byte) (string, error) {
+	c.mempool = append(c.mempool, tx)
+	return cosmosclient.TxHash(tx), nil
+}
+
+func (c *fakeCosmosClient) Balance(ctx context.Context, address string, denom string) (*big.Int, error) {
+	if balance, ok := c.balances[address+"/"+denom]; ok {
+		return balance, nil
+	}
+	return new(big.Int), nil
+}
+
+// commit includes the mempool in a new block, executing it with code
+func (c *fakeCosmosClient) commit(code uint32) {
+	height := int64(len(c.blocks) + 1)
+	block := &cosmosclient.Block{
+		Height: height,
+		Hash:   fmt.Sprintf("%064X", height),
+		Time:   time.Unix(1700000000+height, 0).UTC(),
+		Txs:    c.mempool,
+	}
+	if height > 1 {
+		block.ParentHash = c.blocks[height-2].Hash
+	}
+	for _, tx := range c.mempool {
+		hash := cosmosclient.TxHash(tx)
+		c.results[hash] = &cosmosclient.TxResult{Hash: hash, Height: height, Code: code}
+	}
+	c.blocks = append(c.blocks, block)
+	c.mempool = nil
+}
+
+func newCosmosAdapter() (*CosmosAdapter, *fakeCosmosClient) {
+	client := &fakeCosmosClient{
+		results:  make(map[string]*cosmosclient.TxResult),
+		balances: make(map[string]*big.Int),
+	}
+	return &CosmosAdapter{Chain: "cosmoshub-4", Client: client, Denom: "uatom"}, client
+}
+
+func TestCosmosAdapterTransactions(t *testing.T) {
+	ctx := context.Background()
+	adapter, client := newCosmosAdapter()
+
+	hash, err := adapter.SubmitTx(ctx, []byte("tx-1"))
+	if err != nil {
+		t.Fatalf("Expected SubmitTx to succeed, but got error: %s", err)
+	}
+	status, err := adapter.TxStatus(ctx, hash)
+	if err != nil || status.State != TxPending {
+		t.Fatalf("Expected a pending transaction, but got %+v, %v", status, err)
+	}
+	client.commit(0)
+	status, err = adapter.TxStatus(ctx, hash)
+	if err != nil || status.State != TxFinalized || status.Height != 1 {
+		t.Errorf("Expected the transaction to be final at height 1, but got %+v, %v", status, err)
+	}
+
+	failed, err := adapter.SubmitTx(ctx, []byte("tx-2"))
+	if err != nil {
+		t.Fatalf("Expected SubmitTx to succeed, but got error: %s", err)
+	}
+	client.commit(5)
+	status, err = adapter.TxStatus(ctx, failed)
+	if err != nil || status.State != TxFailed || status.Height != 2 {
+		t.Errorf("Expected a failed transaction, but got %+v, %v", status, err)
+	}
+
+	status, err = adapter.TxStatus(ctx, cosmosclient.TxHash([]byte("tx-3")))
+	if err != nil || status.State != TxUnknown {
+		t.Errorf("Expected an unknown transaction, but got %+v, %v", status, err)
+	}
+}
+
+func TestCosmosAdapterBlocks(t *testing.T) {
+	ctx := context.Background()
+	adapter, client := newCosmosAdapter()
+	if _, err := adapter.SubmitTx(ctx, []byte("tx-1")); err != nil {
+		t.Fatalf("Expected SubmitTx to succeed, but got error: %s", err)
+	}
+	client.commit(0)
+	client.commit(0)
+
+	latest, err := adapter.LatestHeight(ctx)
+	if err != nil || latest != 2 {
+		t.Errorf("Expected latest height 2, but got %d, %v", latest, err)
+	}
+	finalized, err := adapter.FinalizedHeight(ctx)
+	if err != nil || finalized != latest {
+		t.Errorf("Expected the latest block to be final, but got %d, %v", finalized, err)
+	}
+	block, err := adapter.BlockByHeight(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected BlockByHeight to succeed, but got error: %s", err)
+	}
+	if block.Height != 2 || block.ParentHash != client.blocks[0].Hash || block.Time.Unix() != 1700000002 {
+		t.Errorf("Unexpected block head %+v", block.Head)
+	}
+	first, _ := adapter.BlockByHeight(ctx, 1)
+	if len(first.Txs) != 1 || first.Txs[0] != cosmosclient.TxHash([]byte("tx-1")) {
+		t.Errorf("Expected the block's transaction hash, but got %v", first.Txs)
+	}
+	for _, height := range []uint64{0, 3} {
+		if _, err := adapter.BlockByHeight(ctx, height); !errors.Is(err, ErrBlockNotFound) {
+			t.Errorf("Expected ErrBlockNotFound at height %d, but got %v", height, err)
+		}
+	}
+}
+
+func TestCosmosAdapterBalance(t *testing.T) {
+	ctx := context.Background()
+	adapter, client := newCosmosAdapter()
+	client.balances["cosmos1alice/uatom"] = big.NewInt(42)
+	client.balances["cosmos1alice/ibc/27394FB0"] = big.NewInt(7)
+
+	balance, err := adapter.Balance(ctx, "cosmos1alice", "")
+	if err != nil || balance.Int64() != 42 {
+		t.Errorf("Expected a balance of 42uatom, but got %v, %v", balance, err)
+	}
+	balance, err = adapter.Balance(ctx, "cosmos1alice", "ibc/27394FB0")
+	if err != nil || balance.Int64() != 7 {
+		t.Errorf("Expected a balance of 7 of the IBC denom, but got %v, %v", balance, err)
+	}
+	adapter.Denom = ""
+	if _, err := adapter.Balance(ctx, "cosmos1alice", ""); err == nil {
+		t.Error("Expected a balance query without a denom to fail")
+	}
+}
@@ -0,0 +1,128 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	pitypes "github.com/pi-network/pi-node/types"
+
+	piprotocol "pi/blockchain/pi_network/protocol"
+)
+
+// PiClient is the part of PiProtocol the Pi adapter uses
+type PiClient interface {
+	GetBlockChain() []*pitypes.Block
+	HandleMessage(message *pitypes.Message) error
+}
+
+var _ PiClient = (*piprotocol.PiProtocol)(nil)
+
+// PiAdapter adapts a Pi node. As for the bridge's PiSource, blocks are final
+// once committed to the node's chain and their height is their position in
+// it, starting at 1. Transactions are JSON-encoded and identified by their
+// ID. The node keeps no account state, so Balance is unsupported.
+type PiAdapter struct {
+	Chain  string
+	Client PiClient
+	// PollInterval defaults to DefaultPollInterval
+	PollInterval time.Duration
+	// SubmissionWindow is how many blocks a submitted transaction reads as
+	// pending before it is considered dropped. Defaults to
+	// DefaultSubmissionWindow.
+	SubmissionWindow uint64
+
+	submitted submissions
+}
+
+var _ ChainAdapter = (*PiAdapter)(nil)
+
+// ChainID identifies the chain
+func (a *PiAdapter) ChainID() string {
+	return a.Chain
+}
+
+// LatestHeight returns the height of the node's latest block
+func (a *PiAdapter) LatestHeight(ctx context.Context) (uint64, error) {
+	return uint64(len(a.Client.GetBlockChain())), nil
+}
+
+// FinalizedHeight returns the height of the node's latest block
+func (a *PiAdapter) FinalizedHeight(ctx context.Context) (uint64, error) {
+	return uint64(len(a.Client.GetBlockChain())), nil
+}
+
+// BlockByHeight returns the block at a height
+func (a *PiAdapter) BlockByHeight(ctx context.Context, height uint64) (*Block, error) {
+	blocks := a.Client.GetBlockChain()
+	if height == 0 || height > uint64(len(blocks)) {
+		return nil, fmt.Errorf("%w: %d", ErrBlockNotFound, height)
+	}
+	block := blocks[height-1]
+	txs := make([]string, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		txs = append(txs, tx.ID)
+	}
+	return &Block{
+		Head: Head{
+			Height:     height,
+			Hash:       block.Hash,
+			ParentHash: block.PreviousBlockHash,
+			Time:       time.Unix(block.Timestamp, 0).UTC(),
+		},
+		Txs: txs,
+	}, nil
+}
+
+// SubscribeHeads polls for new heads every PollInterval
+func (a *PiAdapter) SubscribeHeads(ctx context.Context) (<-chan *Head, error) {
+	return pollHeads(ctx, a, a.PollInterval)
+}
+
+// SubmitTx adds a JSON-encoded transaction to the node's pool
+func (a *PiAdapter) SubmitTx(ctx context.Context, raw []byte) (string, error) {
+	tx := &pitypes.Transaction{}
+	if err := json.Unmarshal(raw, tx); err != nil {
+		return "", fmt.Errorf("adapter: decoding transaction: %w", err)
+	}
+	if tx.ID == "" {
+		return "", errors.New("adapter: transaction has no ID")
+	}
+	next := uint64(len(a.Client.GetBlockChain())) + 1
+	err := a.Client.HandleMessage(&pitypes.Message{Type: pitypes.MessageTypeTransaction, Data: raw})
+	if err != nil {
+		return "", err
+	}
+	a.submitted.add(tx.ID, next, a.SubmissionWindow)
+	return tx.ID, nil
+}
+
+// TxStatus looks for the transaction in the node's chain, from the height
+// it was submitted at if it was submitted through the adapter
+func (a *PiAdapter) TxStatus(ctx context.Context, hash string) (*TxStatus, error) {
+	blocks := a.Client.GetBlockChain()
+	from, submitted := a.submitted.height(hash, uint64(len(blocks)), a.SubmissionWindow)
+	if !submitted {
+		from = 1
+	}
+	for height := from; height <= uint64(len(blocks)); height++ {
+		for _, tx := range blocks[height-1].Transactions {
+			if tx.ID == hash {
+				a.submitted.remove(hash)
+				return &TxStatus{Hash: hash, State: TxFinalized, Height: height}, nil
+			}
+		}
+	}
+	if submitted {
+		return &TxStatus{Hash: hash, State: TxPending}, nil
+	}
+	return &TxStatus{Hash: hash, State: TxUnknown}, nil
+}
+
+// Balance is unsupported, the node keeps no account state
+func (a *PiAdapter) Balance(ctx context.Context, address string, denom string) (*big.Int, error) {
+	return nil, fmt.Errorf("%w: balances on %s", ErrUnsupported, a.Chain)
+}
@@ -0,0 +1,95 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	pitypes "github.com/pi-network/pi-node/types"
+)
+
+// fakePiClient is a PiClient whose pooled transactions are committed in a
+// block on demand
+type fakePiClient struct {
+	blocks []*pitypes.Block
+	pool   []*pitypes.Transaction
+}
+
+func (c *fakePiClient) GetBlockChain() []*pitypes.Block {
+	return c.blocks
+}
+
+func (c *fakePiClient) HandleMessage(message *pitypes.Message) error {
+	tx := &pitypes.Transaction{}
+	if err := json.Unmarshal(message.Data, tx); err != nil {
+		return err
+	}
+	c.pool = append(c.pool, tx)
+	return nil
+}
+
+func (c *fakePiClient) commit() {
+	block := &pitypes.Block{Timestamp: 1700000000, Transactions: c.pool, Hash: "block-" + string(rune('a'+len(c.blocks)))}
+	if len(c.blocks) > 0 {
+		block.PreviousBlockHash = c.blocks[len(c.blocks)-1].Hash
+	}
+	c.blocks = append(c.blocks, block)
+	c.pool = nil
+}
+
+func TestPiAdapter(t *testing.T) {
+	ctx := context.Background()
+	client := &fakePiClient{}
+	adapter := &PiAdapter{Chain: "pi-1", Client: client}
+
+	id, err := adapter.SubmitTx(ctx, []byte(`{"id":"tx-1","from":"alice","to":"bob","amount":10}`))
+	if err != nil || id != "tx-1" {
+		t.Fatalf("Expected SubmitTx to return the transaction ID, but got %q, %v", id, err)
+	}
+	status, err := adapter.TxStatus(ctx, id)
+	if err != nil || status.State != TxPending {
+		t.Fatalf("Expected a pending transaction, but got %+v, %v", status, err)
+	}
+
+	client.commit()
+	client.commit()
+	status, err = adapter.TxStatus(ctx, id)
+	if err != nil || status.State != TxFinalized || status.Height != 1 {
+		t.Errorf("Expected the transaction to be final at height 1, but got %+v, %v", status, err)
+	}
+	if status, _ := adapter.TxStatus(ctx, "tx-2"); status.State != TxUnknown {
+		t.Errorf("Expected an unknown transaction, but got %+v", status)
+	}
+
+	latest, _ := adapter.LatestHeight(ctx)
+	finalized, _ := adapter.FinalizedHeight(ctx)
+	if latest != 2 || finalized != 2 {
+		t.Errorf("Expected latest and finalized height 2, but got %d and %d", latest, finalized)
+	}
+	block, err := adapter.BlockByHeight(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected BlockByHeight to succeed, but got error: %s", err)
+	}
+	if block.Hash != "block-b" || block.ParentHash != "block-a" || block.Time.Unix() != 1700000000 {
+		t.Errorf("Unexpected block head %+v", block.Head)
+	}
+	if first, _ := adapter.BlockByHeight(ctx, 1); len(first.Txs) != 1 || first.Txs[0] != "tx-1" {
+		t.Errorf("Expected the first block to hold tx-1, but got %+v", first)
+	}
+	for _, height := range []uint64{0, 3} {
+		if _, err := adapter.BlockByHeight(ctx, height); !errors.Is(err, ErrBlockNotFound) {
+			t.Errorf("Expected ErrBlockNotFound at height %d, but got %v", height, err)
+		}
+	}
+}
+
+func TestPiAdapterRejectsTransactionsWithoutID(t *testing.T) {
+	adapter := &PiAdapter{Chain: "pi-1", Client: &fakePiClient{}}
+	if _, err := adapter.SubmitTx(context.Background(), []byte(`{"from":"alice"}`)); err == nil {
+		t.Error("Expected a transaction without an ID to be rejected")
+	}
+	if _, err := adapter.Balance(context.Background(), "alice", ""); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for balances, but got %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	substrate "github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types/codec"
+	"golang.org/x/crypto/blake2b"
+
+	polkadotprotocol "pi/blockchain/polkadot/protocol"
+)
+
+// PolkadotClient is the part of PolkadotProtocol the Polkadot adapter uses
+type PolkadotClient interface {
+	GetBestNumber() (uint64, error)
+	GetFinalizedHead() (*substrate.Header, error)
+	GetBlockHash(height uint64) (string, error)
+	GetBlock(hash string) (*substrate.Block, error)
+	GetStorage(key string) (string, error)
+	SubmitExtrinsic(ext *substrate.Extrinsic) (string, error)
+}
+
+var _ PolkadotClient = (*polkadotprotocol.PolkadotProtocol)(nil)
+
+// systemAccountPrefix is twox128("System") ++ twox128("Account"), the
+// storage prefix of the System pallet's account map
+const systemAccountPrefix = "26aa394eea5630e07c48ae0c9558cef7b99d880ec681799c0cf30e8886371da9"
+
+// PolkadotAdapter adapts a Substrate chain. Finality comes from GRANDPA.
+// Headers carry no time, so heads and blocks have a zero Time.
+//
+// Transactions are SCALE-encoded signed extrinsics. Their status is found by
+// scanning the blocks since their submission, so only transactions submitted
+// through the adapter in the last SubmissionWindow blocks are known, and
+// dispatch failures, which are reported as events, aren't detected.
+type PolkadotAdapter struct {
+	Chain  string
+	Client PolkadotClient
+	// Denom is the native token's denomination, which Balance accepts as
+	// well as an empty denom
+	Denom string
+	// PollInterval defaults to DefaultPollInterval
+	PollInterval time.Duration
+	// SubmissionWindow is how many blocks a submitted transaction reads as
+	// pending before it is considered dropped. Defaults to
+	// DefaultSubmissionWindow.
+	SubmissionWindow uint64
+
+	submitted submissions
+	// included maps transactions found in a block that wasn't final yet to
+	// the block's height
+	included map[string]uint64
+	mu       sync.Mutex
+}
+
+var _ ChainAdapter = (*PolkadotAdapter)(nil)
+
+// ChainID identifies the chain
+func (a *PolkadotAdapter) ChainID() string {
+	return a.Chain
+}
+
+// LatestHeight returns the best block's height
+func (a *PolkadotAdapter) LatestHeight(ctx context.Context) (uint64, error) {
+	return a.Client.GetBestNumber()
+}
+
+// FinalizedHeight returns the height of the head GRANDPA finalized
+func (a *PolkadotAdapter) FinalizedHeight(ctx context.Context) (uint64, error) {
+	header, err := a.Client.GetFinalizedHead()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(header.Number), nil
+}
+
+// BlockByHeight returns the block at a height on the best chain
+func (a *PolkadotAdapter) BlockByHeight(ctx context.Context, height uint64) (*Block, error) {
+	best, err := a.Client.GetBestNumber()
+	if err != nil {
+		return nil, err
+	}
+	if height > best {
+		return nil, fmt.Errorf("%w: %d", ErrBlockNotFound, height)
+	}
+	hash, err := a.Client.GetBlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	block, err := a.Client.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]string, 0, len(block.Extrinsics))
+	for _, ext := range block.Extrinsics {
+		encoded, err := codec.Encode(ext)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, extrinsicHash(encoded))
+	}
+	return &Block{
+		Head: Head{
+			Height:     height,
+			Hash:       hash,
+			ParentHash: block.Header.ParentHash.Hex(),
+		},
+		Txs: txs,
+	}, nil
+}
+
+// SubscribeHeads polls for new heads every PollInterval
+func (a *PolkadotAdapter) SubscribeHeads(ctx context.Context) (<-chan *Head, error) {
+	return pollHeads(ctx, a, a.PollInterval)
+}
+
+// SubmitTx submits a SCALE-encoded signed extrinsic
+func (a *PolkadotAdapter) SubmitTx(ctx context.Context, raw []byte) (string, error) {
+	var ext substrate.Extrinsic
+	if err := codec.Decode(raw, &ext); err != nil {
+		return "", fmt.Errorf("adapter: decoding extrinsic: %w", err)
+	}
+	best, err := a.Client.GetBestNumber()
+	if err != nil {
+		return "", err
+	}
+	if _, err := a.Client.SubmitExtrinsic(&ext); err != nil {
+		return "", err
+	}
+	hash := extrinsicHash(raw)
+	expired := a.submitted.add(hash, best+1, a.SubmissionWindow)
+	a.mu.Lock()
+	for _, tx := range expired {
+		delete(a.included, tx)
+	}
+	a.mu.Unlock()
+	return hash, nil
+}
+
+// TxStatus scans the blocks since the transaction's submission for it
+func (a *PolkadotAdapter) TxStatus(ctx context.Context, hash string) (*TxStatus, error) {
+	hash = strings.ToLower(hash)
+	best, err := a.Client.GetBestNumber()
+	if err != nil {
+		return nil, err
+	}
+	from, ok := a.submitted.height(hash, best, a.SubmissionWindow)
+	if !ok {
+		a.mu.Lock()
+		delete(a.included, hash)
+		a.mu.Unlock()
+		return &TxStatus{Hash: hash, State: TxUnknown}, nil
+	}
+	finalized, err := a.FinalizedHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	height, found := a.included[hash]
+	a.mu.Unlock()
+	if found {
+		// Recheck the block, it may have been replaced by a reorg
+		block, err := a.BlockByHeight(ctx, height)
+		if err != nil && !errors.Is(err, ErrBlockNotFound) {
+			return nil, err
+		}
+		found = err == nil && containsTx(block, hash)
+	}
+	for h := from; !found && h <= best; h++ {
+		block, err := a.BlockByHeight(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		height, found = h, containsTx(block, hash)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case !found:
+		delete(a.included, hash)
+		return &TxStatus{Hash: hash, State: TxPending}, nil
+	case height <= finalized:
+		delete(a.included, hash)
+		a.submitted.remove(hash)
+		return &TxStatus{Hash: hash, State: TxFinalized, Height: height}, nil
+	default:
+		if a.included == nil {
+			a.included = make(map[string]uint64)
+		}
+		a.included[hash] = height
+		return &TxStatus{Hash: hash, State: TxIncluded, Height: height}, nil
+	}
+}
+
+// Balance returns the free balance of an account, given as an SS58 address
+// or a hex account ID, from the System pallet's account map
+func (a *PolkadotAdapter) Balance(ctx context.Context, address string, denom string) (*big.Int, error) {
+	if denom != "" && denom != a.Denom {
+		return nil, fmt.Errorf("%w: denom %s", ErrUnsupported, denom)
+	}
+	account, err := decodeAccountID(address)
+	if err != nil {
+		return nil, err
+	}
+	hasher, _ := blake2b.New(16, nil)
+	hasher.Write(account)
+	key := "0x" + systemAccountPrefix + hex.EncodeToString(hasher.Sum(nil)) + hex.EncodeToString(account)
+
+	value, err := a.Client.GetStorage(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("adapter: account storage: %w", err)
+	}
+	if len(data) == 0 {
+		return new(big.Int), nil
+	}
+	// AccountInfo is nonce, consumers, providers and sufficients as u32s,
+	// followed by AccountData, whose first field is the free balance as u128
+	if len(data) < 32 {
+		return nil, errors.New("adapter: account storage: short AccountInfo")
+	}
+	free := make([]byte, 16)
+	for i := range free {
+		free[i] = data[31-i]
+	}
+	return new(big.Int).SetBytes(free), nil
+}
+
+// extrinsicHash is the blake2b-256 hash Substrate identifies extrinsics by
+func extrinsicHash(encoded []byte) string {
+	hash := blake2b.Sum256(encoded)
+	return "0x" + hex.EncodeToString(hash[:])
+}
+
+func containsTx(block *Block, hash string) bool {
+	for _, tx := range block.Txs {
+		if tx == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeAccountID decodes a 32-byte account ID from a hex string or an SS58
+// address of any network
+func decodeAccountID(address string) ([]byte, error) {
+	if strings.HasPrefix(address, "0x") {
+		account, err := hex.DecodeString(address[2:])
+		if err != nil || len(account) != 32 {
+			return nil, fmt.Errorf("adapter: invalid account ID %q", address)
+		}
+		return account, nil
+	}
+	data, err := decodeBase58(address)
+	if err != nil || len(data) < 35 {
+		return nil, fmt.Errorf("adapter: invalid SS58 address %q", address)
+	}
+	// Network prefixes below 64 take one byte, the others two
+	prefixLength := 1
+	if data[0]&0x40 != 0 {
+		prefixLength = 2
+	}
+	if len(data) != prefixLength+32+2 {
+		return nil, fmt.Errorf("adapter: invalid SS58 address %q", address)
+	}
+	checksum := blake2b.Sum512(append([]byte("SS58PRE"), data[:len(data)-2]...))
+	if !bytes.Equal(checksum[:2], data[len(data)-2:]) {
+		return nil, fmt.Errorf("adapter: bad SS58 checksum in %q", address)
+	}
+	return data[prefixLength : prefixLength+32], nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func decodeBase58(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix).Add(n, big.NewInt(int64(digit)))
+	}
+	// Leading ones encode leading zero bytes
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
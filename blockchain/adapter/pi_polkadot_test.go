@@ -0,0 +1,216 @@
+package adapter
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	substrate "github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types/codec"
+)
+
+// The development account Alice, on the generic Substrate network
+const (
+	aliceSS58      = "5GrwvaEF5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKutQY"
+	aliceAccountID = "d43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d"
+	// aliceStorageKey is System.Account's key for Alice
+	aliceStorageKey = "0x" + systemAccountPrefix + "de1e86a9a8c739864cf3cc5ec2bea59f" + aliceAccountID
+)
+
+// fakePolkadotClient is a PolkadotClient over an in-memory chain
+type fakePolkadotClient struct {
+	blocks    []*substrate.Block
+	finalized uint64
+	storage   map[string]string
+	pool      []substrate.Extrinsic
+}
+
+func (c *fakePolkadotClient) GetBestNumber() (uint64, error) {
+	return uint64(len(c.blocks)), nil
+}
+
+func (c *fakePolkadotClient) GetFinalizedHead() (*substrate.Header, error) {
+	return &substrate.Header{Number: substrate.BlockNumber(c.finalized)}, nil
+}
+
+func (c *fakePolkadotClient) GetBlockHash(height uint64) (string, error) {
+	return fmt.Sprintf("0x%064x", height), nil
+}
+
+func (c *fakePolkadotClient) GetBlock(hash string) (*substrate.Block, error) {
+	var height uint64
+	if _, err := fmt.Sscanf(hash, "0x%x", &height); err != nil || height == 0 || height > uint64(len(c.blocks)) {
+		return nil, fmt.Errorf("unknown block %s", hash)
+	}
+	return c.blocks[height-1], nil
+}
+
+func (c *fakePolkadotClient) GetStorage(key string) (string, error) {
+	return c.storage[key], nil
+}
+
+func (c *fakePolkadotClient) SubmitExtrinsic(ext *substrate.Extrinsic) (string, error) {
+	c.pool = append(c.pool, *ext)
+	return "", nil
+}
+
+// author produces a block with the pooled extrinsics
+func (c *fakePolkadotClient) author() {
+	block := &substrate.Block{Extrinsics: c.pool}
+	block.Header.Number = substrate.BlockNumber(len(c.blocks) + 1)
+	block.Header.ParentHash[31] = byte(len(c.blocks))
+	c.blocks = append(c.blocks, block)
+	c.pool = nil
+}
+
+func encodedExtrinsic(t *testing.T, args byte) []byte {
+	ext := substrate.Extrinsic{Version: 4, Method: substrate.Call{CallIndex: substrate.CallIndex{SectionIndex: 5, MethodIndex: 0}, Args: substrate.Args{args}}}
+	raw, err := codec.Encode(ext)
+	if err != nil {
+		t.Fatalf("Expected encoding the extrinsic to succeed, but got error: %s", err)
+	}
+	return raw
+}
+
+func TestPolkadotAdapterTransactions(t *testing.T) {
+	ctx := context.Background()
+	client := &fakePolkadotClient{}
+	client.author()
+	adapter := &PolkadotAdapter{Chain: "polkadot", Client: client}
+
+	hash, err := adapter.SubmitTx(ctx, encodedExtrinsic(t, 1))
+	if err != nil {
+		t.Fatalf("Expected SubmitTx to succeed, but got error: %s", err)
+	}
+	status, err := adapter.TxStatus(ctx, hash)
+	if err != nil || status.State != TxPending {
+		t.Fatalf("Expected a pending transaction, but got %+v, %v", status, err)
+	}
+
+	client.author()
+	client.author()
+	status, err = adapter.TxStatus(ctx, hash)
+	if err != nil || status.State != TxIncluded || status.Height != 2 {
+		t.Fatalf("Expected the transaction to be included at height 2, but got %+v, %v", status, err)
+	}
+	client.finalized = 2
+	status, err = adapter.TxStatus(ctx, hash)
+	if err != nil || status.State != TxFinalized || status.Height != 2 {
+		t.Errorf("Expected the transaction to be final at height 2, but got %+v, %v", status, err)
+	}
+
+	status, err = adapter.TxStatus(ctx, extrinsicHash(encodedExtrinsic(t, 2)))
+	if err != nil || status.State != TxUnknown {
+		t.Errorf("Expected an unknown transaction, but got %+v, %v", status, err)
+	}
+}
+
+func TestPolkadotAdapterReorg(t *testing.T) {
+	ctx := context.Background()
+	client := &fakePolkadotClient{}
+	adapter := &PolkadotAdapter{Chain: "polkadot", Client: client}
+	hash, err := adapter.SubmitTx(ctx, encodedExtrinsic(t, 1))
+	if err != nil {
+		t.Fatalf("Expected SubmitTx to succeed, but got error: %s", err)
+	}
+	client.author()
+	if status, _ := adapter.TxStatus(ctx, hash); status.State != TxIncluded {
+		t.Fatalf("Expected the transaction to be included, but got %+v", status)
+	}
+
+	// The block is replaced by one without the transaction
+	client.blocks = nil
+	client.author()
+	if status, _ := adapter.TxStatus(ctx, hash); status.State != TxPending {
+		t.Errorf("Expected the transaction to be pending after the reorg, but got %+v", status)
+	}
+}
+
+func TestPolkadotAdapterDroppedTransaction(t *testing.T) {
+	ctx := context.Background()
+	client := &fakePolkadotClient{}
+	adapter := &PolkadotAdapter{Chain: "polkadot", Client: client, SubmissionWindow: 2}
+	hash, err := adapter.SubmitTx(ctx, encodedExtrinsic(t, 1))
+	if err != nil {
+		t.Fatalf("Expected SubmitTx to succeed, but got error: %s", err)
+	}
+	// The node drops the extrinsic instead of including it
+	client.pool = nil
+	client.author()
+	client.author()
+	if status, _ := adapter.TxStatus(ctx, hash); status.State != TxPending {
+		t.Fatalf("Expected the transaction to be pending within the window, but got %+v", status)
+	}
+	client.author()
+	if status, _ := adapter.TxStatus(ctx, hash); status.State != TxUnknown {
+		t.Errorf("Expected the transaction to be forgotten past the window, but got %+v", status)
+	}
+	if len(adapter.submitted.heights) != 0 {
+		t.Errorf("Expected no submissions to be remembered, but got %d", len(adapter.submitted.heights))
+	}
+}
+
+func TestPolkadotAdapterBlocks(t *testing.T) {
+	ctx := context.Background()
+	client := &fakePolkadotClient{finalized: 1}
+	adapter := &PolkadotAdapter{Chain: "polkadot", Client: client}
+	client.pool = []substrate.Extrinsic{{Version: 4, Method: substrate.Call{Args: substrate.Args{7}}}}
+	client.author()
+	client.author()
+
+	latest, err := adapter.LatestHeight(ctx)
+	if err != nil || latest != 2 {
+		t.Errorf("Expected latest height 2, but got %d, %v", latest, err)
+	}
+	finalized, err := adapter.FinalizedHeight(ctx)
+	if err != nil || finalized != 1 {
+		t.Errorf("Expected finalized height 1, but got %d, %v", finalized, err)
+	}
+	block, err := adapter.BlockByHeight(ctx, 1)
+	if err != nil {
+		t.Fatalf("Expected BlockByHeight to succeed, but got error: %s", err)
+	}
+	raw, _ := codec.Encode(client.blocks[0].Extrinsics[0])
+	if block.Hash != fmt.Sprintf("0x%064x", 1) || len(block.Txs) != 1 || block.Txs[0] != extrinsicHash(raw) {
+		t.Errorf("Unexpected block %+v", block)
+	}
+	if _, err := adapter.BlockByHeight(ctx, 3); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("Expected ErrBlockNotFound, but got %v", err)
+	}
+}
+
+func TestPolkadotAdapterBalance(t *testing.T) {
+	ctx := context.Background()
+	info := make([]byte, 16, 80)
+	binary.LittleEndian.PutUint32(info, 3)
+	free := make([]byte, 16)
+	binary.LittleEndian.PutUint64(free, 1_000_000_000_000)
+	info = append(info, free...)
+	info = append(info, make([]byte, 48)...)
+	client := &fakePolkadotClient{storage: map[string]string{aliceStorageKey: "0x" + hex.EncodeToString(info)}}
+	adapter := &PolkadotAdapter{Chain: "polkadot", Client: client, Denom: "DOT"}
+
+	for _, address := range []string{aliceSS58, "0x" + aliceAccountID} {
+		balance, err := adapter.Balance(ctx, address, "")
+		if err != nil || balance.Cmp(big.NewInt(1_000_000_000_000)) != 0 {
+			t.Errorf("Expected Alice's free balance for %s, but got %v, %v", address, balance, err)
+		}
+	}
+
+	bob := "0x" + hex.EncodeToString(make([]byte, 32))
+	balance, err := adapter.Balance(ctx, bob, "DOT")
+	if err != nil || balance.Sign() != 0 {
+		t.Errorf("Expected a zero balance for a missing account, but got %v, %v", balance, err)
+	}
+	if _, err := adapter.Balance(ctx, aliceSS58, "KSM"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for another denom, but got %v", err)
+	}
+	corrupted := aliceSS58[:len(aliceSS58)-1] + "Z"
+	if _, err := adapter.Balance(ctx, corrupted, ""); err == nil {
+		t.Error("Expected an address with a bad checksum to be rejected")
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// AccountAddress returns the bech32 account address of a secp256k1 public
+// key: ripemd160(sha256(compressed key)) with the chain's prefix
+func AccountAddress(prefix string, pub *ecdsa.PublicKey) (string, error) {
+	compressed, err := compressPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(compressed)
+	hasher := ripemd160.New()
+	hasher.Write(sum[:])
+	return Bech32Encode(prefix, hasher.Sum(nil))
+}
+
+// Address returns the account address of a key on the client's chain
+func (c *Client) Address(key *ecdsa.PrivateKey) (string, error) {
+	return AccountAddress(c.prefix, &key.PublicKey)
+}
+
+func compressPublicKey(pub *ecdsa.PublicKey) ([]byte, error) {
+	if pub.Curve.Params().N.Cmp(secp256k1.S256().Params().N) != 0 {
+		return nil, errors.New("cosmos: not a secp256k1 key")
+	}
+	var x, y secp256k1.FieldVal
+	x.SetByteSlice(pub.X.Bytes())
+	y.SetByteSlice(pub.Y.Bytes())
+	return secp256k1.NewPublicKey(&x, &y).SerializeCompressed(), nil
+}
+
+// Bech32 (BIP-173), which Cosmos chains encode addresses in
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	checksum := uint32(1)
+	for _, v := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				checksum ^= bech32Generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+func bech32ExpandPrefix(hrp string) []byte {
+	expanded := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// convertBits regroups bits, e.g. bytes into 5-bit groups
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxValue := uint(1)<<to - 1
+	var out []byte
+	for _, b := range data {
+		if uint(b)>>from != 0 {
+			return nil, errors.New("bech32: invalid data")
+		}
+		acc = acc<<from | uint(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxValue))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxValue != 0 {
+		return nil, errors.New("bech32: invalid padding")
+	}
+	return out, nil
+}
+
+// Bech32Encode encodes data with a human-readable prefix
+func Bech32Encode(hrp string, data []byte) (string, error) {
+	if hrp == "" || strings.ToLower(hrp) != hrp {
+		return "", fmt.Errorf("bech32: invalid prefix %q", hrp)
+	}
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	polymod := bech32Polymod(append(append(bech32ExpandPrefix(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>(5*(5-i)))&31])
+	}
+	return sb.String(), nil
+}
+
+// Bech32Decode decodes and checks a bech32 string
+func Bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("bech32: mixed case")
+	}
+	s = strings.ToLower(s)
+	separator := strings.LastIndexByte(s, '1')
+	if separator < 1 || separator+7 > len(s) {
+		return "", nil, errors.New("bech32: invalid separator position")
+	}
+	hrp := s[:separator]
+	values := make([]byte, 0, len(s)-separator-1)
+	for _, c := range s[separator+1:] {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return "", nil, fmt.Errorf("bech32: invalid character %q", c)
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32ExpandPrefix(hrp), values...)) != 1 {
+		return "", nil, errors.New("bech32: invalid checksum")
+	}
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func TestAccountAddress(t *testing.T) {
+	// The key with secret 1, whose public key is the generator
+	var one secp256k1.ModNScalar
+	one.SetInt(1)
+	key := secp256k1.NewPrivateKey(&one)
+	address, err := AccountAddress("cosmos", key.ToECDSA().Public().(*ecdsa.PublicKey))
+	if err != nil {
+		t.Fatalf("Expected AccountAddress to succeed, but got error: %s", err)
+	}
+	if address != "cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c" {
+		t.Errorf("Unexpected address %s", address)
+	}
+
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := AccountAddress("cosmos", &p256.PublicKey); err == nil {
+		t.Error("Expected a P-256 key to be rejected")
+	}
+}
+
+func TestBech32(t *testing.T) {
+	// BIP-173 test vectors
+	hrp, data, err := Bech32Decode("A12UEL5L")
+	if err != nil || hrp != "a" || len(data) != 0 {
+		t.Errorf("Expected an empty payload with prefix a, but got %q, %x, %v", hrp, data, err)
+	}
+	for _, invalid := range []string{"pzry9x0s0muk", "1pzry9x0s0muk", "x1b4n0q5v", "li1dgmt3", "A1G7SGD8", "a12UEL5L"} {
+		if _, _, err := Bech32Decode(invalid); err == nil {
+			t.Errorf("Expected %s to be rejected", invalid)
+		}
+	}
+
+	payload, _ := hex.DecodeString("751e76e8199196d454941c45d1b3a323f1433bd6")
+	encoded, err := Bech32Encode("cosmos", payload)
+	if err != nil {
+		t.Fatalf("Expected Bech32Encode to succeed, but got error: %s", err)
+	}
+	hrp, data, err = Bech32Decode(encoded)
+	if err != nil || hrp != "cosmos" || !bytes.Equal(data, payload) {
+		t.Errorf("Expected the payload back, but got %q, %x, %v", hrp, data, err)
+	}
+}
@@ -0,0 +1,308 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Client for Cosmos SDK chains. Chain state is read and transactions are
+// broadcast over CometBFT's JSON-RPC; module queries such as bank balances
+// and accounts go to the node's gRPC server, or through the RPC's ABCI
+// queries when no gRPC address is configured.
+
+var (
+	// ErrNotFound is returned for transactions, accounts and other objects
+	// the chain doesn't have
+	ErrNotFound = errors.New("cosmos: not found")
+	// ErrTxRejected is returned for transactions that fail CheckTx
+	ErrTxRejected = errors.New("cosmos: transaction rejected")
+)
+
+// Config configures a Client
+type Config struct {
+	// RPCURL is the node's CometBFT RPC endpoint, e.g. http://localhost:26657
+	RPCURL string
+	// GRPCAddress is the node's gRPC server, e.g. localhost:9090. Queries go
+	// through the RPC's abci_query without one.
+	GRPCAddress string
+	// GRPCInsecure disables TLS towards the gRPC server
+	GRPCInsecure bool
+	// Prefix is the chain's bech32 account prefix. Defaults to "cosmos".
+	Prefix string
+	// HTTPClient defaults to a client with a 30 second timeout
+	HTTPClient *http.Client
+}
+
+// Client talks to a Cosmos SDK node
+type Client struct {
+	url     string
+	http    *http.Client
+	prefix  string
+	querier Querier
+	ids     atomic.Int64
+}
+
+// Dial creates a client for a node. The gRPC connection, if configured, is
+// established lazily.
+func Dial(config *Config) (*Client, error) {
+	if config.RPCURL == "" {
+		return nil, errors.New("cosmos: no RPC URL")
+	}
+	c := &Client{
+		url:    strings.TrimSuffix(config.RPCURL, "/"),
+		http:   config.HTTPClient,
+		prefix: config.Prefix,
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: 30 * time.Second}
+	}
+	if c.prefix == "" {
+		c.prefix = "cosmos"
+	}
+	if config.GRPCAddress == "" {
+		c.querier = &abciQuerier{client: c}
+		return c, nil
+	}
+	querier, err := dialGRPC(config.GRPCAddress, config.GRPCInsecure)
+	if err != nil {
+		return nil, err
+	}
+	c.querier = querier
+	return c, nil
+}
+
+// Close closes the gRPC connection
+func (c *Client) Close() error {
+	if closer, ok := c.querier.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Prefix returns the chain's bech32 account prefix
+func (c *Client) Prefix() string {
+	return c.prefix
+}
+
+// Status is the node's view of the chain
+type Status struct {
+	ChainID           string
+	LatestBlockHeight int64
+	LatestBlockHash   string
+	LatestBlockTime   time.Time
+	CatchingUp        bool
+}
+
+// Status queries the node's status
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var result struct {
+		NodeInfo struct {
+			Network string `json:"network"`
+		} `json:"node_info"`
+		SyncInfo struct {
+			LatestBlockHash   string    `json:"latest_block_hash"`
+			LatestBlockHeight int64     `json:"latest_block_height,string"`
+			LatestBlockTime   time.Time `json:"latest_block_time"`
+			CatchingUp        bool      `json:"catching_up"`
+		} `json:"sync_info"`
+	}
+	if err := c.call(ctx, "status", struct{}{}, &result); err != nil {
+		return nil, err
+	}
+	return &Status{
+		ChainID:           result.NodeInfo.Network,
+		LatestBlockHeight: result.SyncInfo.LatestBlockHeight,
+		LatestBlockHash:   result.SyncInfo.LatestBlockHash,
+		LatestBlockTime:   result.SyncInfo.LatestBlockTime,
+		CatchingUp:        result.SyncInfo.CatchingUp,
+	}, nil
+}
+
+// Block is a committed block's header fields and transactions
+type Block struct {
+	ChainID    string
+	Height     int64
+	Hash       string
+	ParentHash string
+	Time       time.Time
+	// Txs are the encoded transactions
+	Txs [][]byte
+}
+
+// Block fetches the block at a height, or the latest block for height 0
+func (c *Client) Block(ctx context.Context, height int64) (*Block, error) {
+	params := map[string]string{}
+	if height > 0 {
+		params["height"] = fmt.Sprint(height)
+	}
+	var result struct {
+		BlockID struct {
+			Hash string `json:"hash"`
+		} `json:"block_id"`
+		Block struct {
+			Header struct {
+				ChainID     string    `json:"chain_id"`
+				Height      int64     `json:"height,string"`
+				Time        time.Time `json:"time"`
+				LastBlockID struct {
+					Hash string `json:"hash"`
+				} `json:"last_block_id"`
+			} `json:"header"`
+			Data struct {
+				Txs [][]byte `json:"txs"`
+			} `json:"data"`
+		} `json:"block"`
+	}
+	if err := c.call(ctx, "block", params, &result); err != nil {
+		return nil, err
+	}
+	header := result.Block.Header
+	return &Block{
+		ChainID:    header.ChainID,
+		Height:     header.Height,
+		Hash:       result.BlockID.Hash,
+		ParentHash: header.LastBlockID.Hash,
+		Time:       header.Time,
+		Txs:        result.Block.Data.Txs,
+	}, nil
+}
+
+// TxResult is a committed transaction's execution result. A zero Code is
+// success.
+type TxResult struct {
+	Hash      string
+	Height    int64
+	Code      uint32
+	Codespace string
+	Log       string
+	GasWanted int64
+	GasUsed   int64
+}
+
+// Tx looks up a committed transaction by its hex hash, returning
+// ErrNotFound for transactions not in a block
+func (c *Client) Tx(ctx context.Context, hash string) (*TxResult, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(hash, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("cosmos: invalid transaction hash %q", hash)
+	}
+	var result struct {
+		Hash     string `json:"hash"`
+		Height   int64  `json:"height,string"`
+		TxResult struct {
+			Code      uint32 `json:"code"`
+			Codespace string `json:"codespace"`
+			Log       string `json:"log"`
+			GasWanted int64  `json:"gas_wanted,string"`
+			GasUsed   int64  `json:"gas_used,string"`
+		} `json:"tx_result"`
+	}
+	if err := c.call(ctx, "tx", map[string]interface{}{"hash": raw, "prove": false}, &result); err != nil {
+		return nil, err
+	}
+	return &TxResult{
+		Hash:      result.Hash,
+		Height:    result.Height,
+		Code:      result.TxResult.Code,
+		Codespace: result.TxResult.Codespace,
+		Log:       result.TxResult.Log,
+		GasWanted: result.TxResult.GasWanted,
+		GasUsed:   result.TxResult.GasUsed,
+	}, nil
+}
+
+// BroadcastTx submits an encoded transaction and waits for CheckTx. It
+// returns the transaction's hash, or ErrTxRejected with the node's log.
+func (c *Client) BroadcastTx(ctx context.Context, tx []byte) (string, error) {
+	var result struct {
+		Code      uint32 `json:"code"`
+		Codespace string `json:"codespace"`
+		Log       string `json:"log"`
+		Hash      string `json:"hash"`
+	}
+	if err := c.call(ctx, "broadcast_tx_sync", map[string][]byte{"tx": tx}, &result); err != nil {
+		return "", err
+	}
+	if result.Code != 0 {
+		return "", fmt.Errorf("%w: %s (codespace %s, code %d)", ErrTxRejected, result.Log, result.Codespace, result.Code)
+	}
+	if result.Hash == "" {
+		result.Hash = TxHash(tx)
+	}
+	return result.Hash, nil
+}
+
+// TxHash is the hex hash CometBFT identifies an encoded transaction by
+func TxHash(tx []byte) string {
+	hash := sha256.Sum256(tx)
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+// rpcRequest and rpcResponse are JSON-RPC 2.0 messages
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data"`
+}
+
+func (e *rpcError) Error() string {
+	if e.Data != "" {
+		return fmt.Sprintf("cosmos rpc: %s: %s", e.Message, e.Data)
+	}
+	return "cosmos rpc: " + e.Message
+}
+
+// call makes a JSON-RPC call. Byte slices in params are sent base64-encoded,
+// as CometBFT expects in JSON-RPC bodies.
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(&rpcRequest{JSONRPC: "2.0", ID: c.ids.Add(1), Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("cosmos rpc: %s: %s", method, resp.Status)
+	}
+	if response.Error != nil {
+		// CometBFT reports missing transactions and heights as internal errors
+		if strings.Contains(response.Error.Data, "not found") {
+			return fmt.Errorf("%w: %s", ErrNotFound, response.Error.Data)
+		}
+		return response.Error
+	}
+	return json.Unmarshal(response.Result, result)
+}
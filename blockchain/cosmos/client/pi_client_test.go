@@ -0,0 +1,360 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// mockNode is a Cosmos SDK node serving CometBFT's JSON-RPC from memory. It
+// checks the SIGN_MODE_DIRECT signature and sequence of broadcast
+// transactions, and commits them to a block on commit.
+type mockNode struct {
+	t        *testing.T
+	chainID  string
+	mu       sync.Mutex
+	blocks   []*mockBlock
+	mempool  [][]byte
+	results  map[string]*mockResult
+	accounts map[string]*Account
+	balances map[string]*big.Int
+}
+
+type mockBlock struct {
+	hash string
+	time time.Time
+	txs  [][]byte
+}
+
+type mockResult struct {
+	height int64
+	code   uint32
+}
+
+func newMockNode(t *testing.T) (*mockNode, *Client) {
+	node := &mockNode{
+		t:        t,
+		chainID:  "testchain-1",
+		results:  make(map[string]*mockResult),
+		accounts: make(map[string]*Account),
+		balances: make(map[string]*big.Int),
+	}
+	server := httptest.NewServer(node)
+	t.Cleanup(server.Close)
+	client, err := Dial(&Config{RPCURL: server.URL})
+	if err != nil {
+		t.Fatalf("Expected Dial to succeed, but got error: %s", err)
+	}
+	return node, client
+}
+
+// commit includes the mempool in a new block
+func (n *mockNode) commit() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	height := int64(len(n.blocks) + 1)
+	block := &mockBlock{
+		hash: fmt.Sprintf("%064X", height),
+		time: time.Date(2024, 1, 1, 0, 0, int(height), 0, time.UTC),
+		txs:  n.mempool,
+	}
+	for _, tx := range n.mempool {
+		n.results[TxHash(tx)] = &mockResult{height: height}
+	}
+	n.blocks = append(n.blocks, block)
+	n.mempool = nil
+}
+
+func (n *mockNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ID     int64           `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	result, rpcErr := n.handle(request.Method, request.Params)
+	n.mu.Unlock()
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	if rpcErr != nil {
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (n *mockNode) handle(method string, raw json.RawMessage) (interface{}, *rpcError) {
+	switch method {
+	case "status":
+		latest := n.blocks[len(n.blocks)-1]
+		return map[string]interface{}{
+			"node_info": map[string]string{"network": n.chainID},
+			"sync_info": map[string]interface{}{
+				"latest_block_hash":   latest.hash,
+				"latest_block_height": fmt.Sprint(len(n.blocks)),
+				"latest_block_time":   latest.time,
+				"catching_up":         false,
+			},
+		}, nil
+
+	case "block":
+		var params struct {
+			Height string `json:"height"`
+		}
+		json.Unmarshal(raw, &params)
+		height := len(n.blocks)
+		if params.Height != "" {
+			fmt.Sscan(params.Height, &height)
+		}
+		if height < 1 || height > len(n.blocks) {
+			return nil, &rpcError{Code: -32603, Message: "Internal error", Data: fmt.Sprintf("height %d must be less than or equal to the current blockchain height %d", height, len(n.blocks))}
+		}
+		block := n.blocks[height-1]
+		parent := ""
+		if height > 1 {
+			parent = n.blocks[height-2].hash
+		}
+		txs := block.txs
+		if txs == nil {
+			txs = [][]byte{}
+		}
+		return map[string]interface{}{
+			"block_id": map[string]string{"hash": block.hash},
+			"block": map[string]interface{}{
+				"header": map[string]interface{}{
+					"chain_id":      n.chainID,
+					"height":        fmt.Sprint(height),
+					"time":          block.time,
+					"last_block_id": map[string]string{"hash": parent},
+				},
+				"data": map[string]interface{}{"txs": txs},
+			},
+		}, nil
+
+	case "tx":
+		var params struct {
+			Hash []byte `json:"hash"`
+		}
+		json.Unmarshal(raw, &params)
+		hash := strings.ToUpper(hex.EncodeToString(params.Hash))
+		result, ok := n.results[hash]
+		if !ok {
+			return nil, &rpcError{Code: -32603, Message: "Internal error", Data: fmt.Sprintf("tx (%s) not found", hash)}
+		}
+		return map[string]interface{}{
+			"hash":   hash,
+			"height": fmt.Sprint(result.height),
+			"tx_result": map[string]interface{}{
+				"code":       result.code,
+				"log":        "",
+				"gas_wanted": "200000",
+				"gas_used":   "61234",
+			},
+		}, nil
+
+	case "broadcast_tx_sync":
+		var params struct {
+			Tx []byte `json:"tx"`
+		}
+		json.Unmarshal(raw, &params)
+		if err := n.checkTx(params.Tx); err != nil {
+			return map[string]interface{}{"code": 32, "codespace": "sdk", "log": err.Error(), "hash": TxHash(params.Tx)}, nil
+		}
+		n.mempool = append(n.mempool, params.Tx)
+		return map[string]interface{}{"code": 0, "log": "[]", "hash": TxHash(params.Tx)}, nil
+
+	case "abci_query":
+		var params struct {
+			Path string `json:"path"`
+			Data string `json:"data"`
+		}
+		json.Unmarshal(raw, &params)
+		data, err := hex.DecodeString(params.Data)
+		if err != nil {
+			return nil, &rpcError{Code: -32602, Message: "Invalid params", Data: err.Error()}
+		}
+		value, code, log := n.query(params.Path, data)
+		return map[string]interface{}{
+			"response": map[string]interface{}{"code": code, "codespace": codespaceOf(code), "log": log, "value": value},
+		}, nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "Method not found"}
+}
+
+func codespaceOf(code uint32) string {
+	if code == 0 {
+		return ""
+	}
+	return sdkCodespace
+}
+
+// query serves the bank and auth queries as the SDK's gRPC handlers do
+func (n *mockNode) query(path string, request []byte) ([]byte, uint32, string) {
+	switch path {
+	case "/cosmos.bank.v1beta1.Query/Balance":
+		address, _ := fieldBytes(request, 1)
+		denom, _ := fieldBytes(request, 2)
+		amount := big.NewInt(0)
+		if balance, ok := n.balances[string(address)+"/"+string(denom)]; ok {
+			amount = balance
+		}
+		return appendMessage(nil, 1, Coin{Denom: string(denom), Amount: amount}.encode()), 0, ""
+	case "/cosmos.auth.v1beta1.Query/Account":
+		address, _ := fieldBytes(request, 1)
+		account, ok := n.accounts[string(address)]
+		if !ok {
+			return nil, errKeyNotFound, fmt.Sprintf("account %s not found: key not found", address)
+		}
+		return appendMessage(nil, 1, encodeBaseAccount(account)), 0, ""
+	}
+	return nil, 6, "unknown query path"
+}
+
+func encodeBaseAccount(account *Account) []byte {
+	var base []byte
+	base = appendString(base, 1, account.Address)
+	base = appendVarint(base, 3, account.AccountNumber)
+	base = appendVarint(base, 4, account.Sequence)
+	return Msg{TypeURL: baseAccountType, Value: base}.encode()
+}
+
+// checkTx verifies a transaction's signature against its signer's account
+// and increments the account's sequence
+func (n *mockNode) checkTx(tx []byte) error {
+	body, _ := fieldBytes(tx, 1)
+	authInfo, _ := fieldBytes(tx, 2)
+	signature, _ := fieldBytes(tx, 3)
+	signerInfo, _ := fieldBytes(authInfo, 1)
+	pubKeyAny, _ := fieldBytes(signerInfo, 1)
+	pubKeyType, _ := fieldBytes(pubKeyAny, 1)
+	pubKeyValue, _ := fieldBytes(pubKeyAny, 2)
+	modeInfo, _ := fieldBytes(signerInfo, 2)
+	single, _ := fieldBytes(modeInfo, 1)
+	mode, _ := fieldVarint(single, 1)
+	sequence, _ := fieldVarint(signerInfo, 3)
+	if string(pubKeyType) != secp256k1PubKeyType || mode != signModeDirect || len(signature) != 64 {
+		return errors.New("unsupported signer")
+	}
+	rawPub, _ := fieldBytes(pubKeyValue, 1)
+	pub, err := secp256k1.ParsePubKey(rawPub)
+	if err != nil {
+		return err
+	}
+	address, _ := AccountAddress("cosmos", pub.ToECDSA())
+	account, ok := n.accounts[address]
+	if !ok {
+		return errors.New("unknown account")
+	}
+	if sequence != account.Sequence {
+		return fmt.Errorf("account sequence mismatch, expected %d, got %d", account.Sequence, sequence)
+	}
+
+	var signDoc []byte
+	signDoc = appendBytes(signDoc, 1, body)
+	signDoc = appendBytes(signDoc, 2, authInfo)
+	signDoc = appendString(signDoc, 3, n.chainID)
+	signDoc = appendVarint(signDoc, 4, account.AccountNumber)
+	hash := sha256.Sum256(signDoc)
+	var r, s secp256k1.ModNScalar
+	r.SetByteSlice(signature[:32])
+	s.SetByteSlice(signature[32:])
+	if s.IsOverHalfOrder() || !secpecdsa.NewSignature(&r, &s).Verify(hash[:], pub) {
+		return errors.New("signature verification failed")
+	}
+	account.Sequence++
+	return nil
+}
+
+func TestClientStatusAndBlocks(t *testing.T) {
+	ctx := context.Background()
+	node, client := newMockNode(t)
+	node.commit()
+	node.mempool = [][]byte{[]byte("tx-1")}
+	node.commit()
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatalf("Expected Status to succeed, but got error: %s", err)
+	}
+	if status.ChainID != "testchain-1" || status.LatestBlockHeight != 2 || status.LatestBlockHash != node.blocks[1].hash {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	block, err := client.Block(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected Block to succeed, but got error: %s", err)
+	}
+	if block.Height != 2 || block.Hash != node.blocks[1].hash || block.ParentHash != node.blocks[0].hash || !block.Time.Equal(node.blocks[1].time) {
+		t.Errorf("Unexpected block %+v", block)
+	}
+	if len(block.Txs) != 1 || string(block.Txs[0]) != "tx-1" {
+		t.Errorf("Expected the block's transaction, but got %q", block.Txs)
+	}
+	latest, err := client.Block(ctx, 0)
+	if err != nil || latest.Height != 2 {
+		t.Errorf("Expected the latest block, but got %+v, %v", latest, err)
+	}
+	if _, err := client.Block(ctx, 3); err == nil {
+		t.Error("Expected a block above the chain's height to fail")
+	}
+}
+
+func TestClientTx(t *testing.T) {
+	ctx := context.Background()
+	node, client := newMockNode(t)
+	node.mempool = [][]byte{[]byte("tx-1")}
+	node.commit()
+	hash := TxHash([]byte("tx-1"))
+
+	result, err := client.Tx(ctx, hash)
+	if err != nil {
+		t.Fatalf("Expected Tx to succeed, but got error: %s", err)
+	}
+	if result.Hash != hash || result.Height != 1 || result.Code != 0 || result.GasUsed != 61234 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if _, err := client.Tx(ctx, TxHash([]byte("tx-2"))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, but got %v", err)
+	}
+	if _, err := client.Tx(ctx, "not hex"); err == nil {
+		t.Error("Expected an invalid hash to be rejected")
+	}
+}
+
+func TestClientRPCErrors(t *testing.T) {
+	_, client := newMockNode(t)
+	var result struct{}
+	err := client.call(context.Background(), "no_such_method", struct{}{}, &result)
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("Expected the node's JSON-RPC error, but got %v", err)
+	}
+	if _, err := Dial(&Config{}); err == nil {
+		t.Error("Expected Dial without an RPC URL to fail")
+	}
+}
+
+func TestTxHash(t *testing.T) {
+	// sha256 of the empty string
+	want := "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"
+	if hash := TxHash(nil); hash != want {
+		t.Errorf("Expected %s, but got %s", want, hash)
+	}
+}
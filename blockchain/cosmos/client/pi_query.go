@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Querier makes a module query: a gRPC method such as
+// "/cosmos.bank.v1beta1.Query/Balance" with a protobuf-encoded request,
+// returning the encoded response. Objects the chain doesn't have are
+// reported as ErrNotFound.
+type Querier interface {
+	Query(ctx context.Context, method string, request []byte) ([]byte, error)
+}
+
+// Query makes a module query through the client's querier
+func (c *Client) Query(ctx context.Context, method string, request []byte) ([]byte, error) {
+	return c.querier.Query(ctx, method, request)
+}
+
+// abciQuerier routes queries through CometBFT's abci_query, which the SDK
+// serves from the same gRPC query handlers
+type abciQuerier struct {
+	client *Client
+}
+
+// sdkCodespace and errKeyNotFound identify the SDK's not found errors. The
+// SDK reports gRPC NotFound statuses with this code over ABCI.
+const (
+	sdkCodespace   = "sdk"
+	errKeyNotFound = 22
+)
+
+func (q *abciQuerier) Query(ctx context.Context, method string, request []byte) ([]byte, error) {
+	params := map[string]interface{}{
+		"path":  method,
+		"data":  hexBytes(request),
+		"prove": false,
+	}
+	var result struct {
+		Response struct {
+			Code      uint32 `json:"code"`
+			Codespace string `json:"codespace"`
+			Log       string `json:"log"`
+			Value     []byte `json:"value"`
+		} `json:"response"`
+	}
+	if err := q.client.call(ctx, "abci_query", params, &result); err != nil {
+		return nil, err
+	}
+	response := result.Response
+	if response.Code == errKeyNotFound && response.Codespace == sdkCodespace {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, response.Log)
+	}
+	if response.Code != 0 {
+		return nil, fmt.Errorf("cosmos: query %s: %s (codespace %s, code %d)", method, response.Log, response.Codespace, response.Code)
+	}
+	return response.Value, nil
+}
+
+// hexBytes marshals to JSON as hex, as CometBFT's abci_query data parameter
+type hexBytes []byte
+
+func (b hexBytes) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%X", []byte(b))), nil
+}
+
+// grpcQuerier calls the node's gRPC query services with raw protobuf
+// messages
+type grpcQuerier struct {
+	conn *grpc.ClientConn
+}
+
+func dialGRPC(address string, insecureTransport bool) (*grpcQuerier, error) {
+	creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if insecureTransport {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcQuerier{conn: conn}, nil
+}
+
+func (q *grpcQuerier) Query(ctx context.Context, method string, request []byte) ([]byte, error) {
+	var response []byte
+	err := q.conn.Invoke(ctx, method, request, &response, grpc.ForceCodec(rawCodec{}))
+	if status.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, status.Convert(err).Message())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cosmos: query %s: %w", method, err)
+	}
+	return response, nil
+}
+
+func (q *grpcQuerier) Close() error {
+	return q.conn.Close()
+}
+
+// rawCodec passes already encoded protobuf messages through gRPC
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch message := v.(type) {
+	case []byte:
+		return message, nil
+	case *[]byte:
+		return *message, nil
+	}
+	return nil, fmt.Errorf("cosmos: cannot marshal %T", v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("cosmos: cannot unmarshal into %T", v)
+	}
+	*message = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// Balance queries an account's balance of a denomination from the bank module
+func (c *Client) Balance(ctx context.Context, address string, denom string) (*big.Int, error) {
+	var request []byte
+	request = appendString(request, 1, address)
+	request = appendString(request, 2, denom)
+	response, err := c.Query(ctx, "/cosmos.bank.v1beta1.Query/Balance", request)
+	if err != nil {
+		return nil, err
+	}
+	coin, err := fieldBytes(response, 1)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := fieldBytes(coin, 2)
+	if err != nil {
+		return nil, err
+	}
+	if len(amount) == 0 {
+		return new(big.Int), nil
+	}
+	balance, ok := new(big.Int).SetString(string(amount), 10)
+	if !ok {
+		return nil, fmt.Errorf("cosmos: invalid amount %q", amount)
+	}
+	return balance, nil
+}
+
+// Account is the part of an account needed to sign its transactions
+type Account struct {
+	Address       string
+	AccountNumber uint64
+	Sequence      uint64
+}
+
+// Account types whose BaseAccount is nested in field 1, or in field 1 of
+// field 1 for vesting accounts
+const (
+	baseAccountType          = "/cosmos.auth.v1beta1.BaseAccount"
+	moduleAccountType        = "/cosmos.auth.v1beta1.ModuleAccount"
+	vestingAccountTypePrefix = "/cosmos.vesting.v1beta1."
+)
+
+// Account queries an account's number and sequence from the auth module.
+// Accounts that never received funds don't exist and return ErrNotFound.
+func (c *Client) Account(ctx context.Context, address string) (*Account, error) {
+	response, err := c.Query(ctx, "/cosmos.auth.v1beta1.Query/Account", appendString(nil, 1, address))
+	if err != nil {
+		return nil, err
+	}
+	packed, err := fieldBytes(response, 1)
+	if err != nil {
+		return nil, err
+	}
+	typeURL, err := fieldBytes(packed, 1)
+	if err != nil {
+		return nil, err
+	}
+	account, err := fieldBytes(packed, 2)
+	if err != nil {
+		return nil, err
+	}
+	switch t := string(typeURL); {
+	case t == baseAccountType:
+	case t == moduleAccountType:
+		account, err = fieldBytes(account, 1)
+	case strings.HasPrefix(t, vestingAccountTypePrefix):
+		if account, err = fieldBytes(account, 1); err == nil {
+			account, err = fieldBytes(account, 1)
+		}
+	default:
+		return nil, fmt.Errorf("cosmos: unsupported account type %s", t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Account{}
+	addr, err := fieldBytes(account, 1)
+	if err != nil {
+		return nil, err
+	}
+	result.Address = string(addr)
+	if result.AccountNumber, err = fieldVarint(account, 3); err != nil {
+		return nil, err
+	}
+	if result.Sequence, err = fieldVarint(account, 4); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Protobuf encoding. Fields are appended in field number order and defaults
+// are omitted, matching the canonical encoding SIGN_MODE_DIRECT signs.
+
+func appendString(b []byte, field protowire.Number, v string) []byte {
+	return appendBytes(b, field, []byte(v))
+}
+
+func appendBytes(b []byte, field protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendVarint(b []byte, field protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendMessage appends an embedded message, even an empty one
+func appendMessage(b []byte, field protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+var errMalformed = errors.New("cosmos: malformed protobuf message")
+
+// rangeFields calls fn for each field of an encoded message, with the
+// value's bytes for length-delimited fields and its number for varints
+func rangeFields(b []byte, fn func(field protowire.Number, value []byte, varint uint64)) error {
+	for len(b) > 0 {
+		field, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errMalformed
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return errMalformed
+			}
+			fn(field, value, 0)
+			b = b[n:]
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return errMalformed
+			}
+			fn(field, nil, value)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(field, typ, b)
+			if n < 0 {
+				return errMalformed
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+// fieldBytes returns the last occurrence of a length-delimited field
+func fieldBytes(b []byte, field protowire.Number) ([]byte, error) {
+	var result []byte
+	err := rangeFields(b, func(f protowire.Number, value []byte, _ uint64) {
+		if f == field {
+			result = value
+		}
+	})
+	return result, err
+}
+
+// fieldVarint returns the last occurrence of a varint field
+func fieldVarint(b []byte, field protowire.Number) (uint64, error) {
+	var result uint64
+	err := rangeFields(b, func(f protowire.Number, _ []byte, varint uint64) {
+		if f == field {
+			result = varint
+		}
+	})
+	return result, err
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientBalance(t *testing.T) {
+	ctx := context.Background()
+	node, client := newMockNode(t)
+	node.balances["cosmos1alice/uatom"] = big.NewInt(1234567)
+
+	balance, err := client.Balance(ctx, "cosmos1alice", "uatom")
+	if err != nil {
+		t.Fatalf("Expected Balance to succeed, but got error: %s", err)
+	}
+	if balance.Int64() != 1234567 {
+		t.Errorf("Expected a balance of 1234567uatom, but got %s", balance)
+	}
+	balance, err = client.Balance(ctx, "cosmos1alice", "ustake")
+	if err != nil || balance.Sign() != 0 {
+		t.Errorf("Expected a zero balance of another denom, but got %v, %v", balance, err)
+	}
+}
+
+func TestClientAccount(t *testing.T) {
+	ctx := context.Background()
+	node, client := newMockNode(t)
+	node.accounts["cosmos1alice"] = &Account{Address: "cosmos1alice", AccountNumber: 7, Sequence: 42}
+
+	account, err := client.Account(ctx, "cosmos1alice")
+	if err != nil {
+		t.Fatalf("Expected Account to succeed, but got error: %s", err)
+	}
+	if *account != (Account{Address: "cosmos1alice", AccountNumber: 7, Sequence: 42}) {
+		t.Errorf("Unexpected account %+v", account)
+	}
+	if _, err := client.Account(ctx, "cosmos1bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a new account, but got %v", err)
+	}
+}
+
+func TestClientVestingAccount(t *testing.T) {
+	base := encodeBaseAccount(&Account{Address: "cosmos1vest", AccountNumber: 3, Sequence: 9})
+	baseValue, _ := fieldBytes(base, 2)
+	vesting := appendMessage(nil, 1, appendMessage(nil, 1, baseValue))
+	packed := Msg{TypeURL: "/cosmos.vesting.v1beta1.ContinuousVestingAccount", Value: vesting}.encode()
+	client := &Client{querier: querierFunc(func(ctx context.Context, method string, request []byte) ([]byte, error) {
+		return appendMessage(nil, 1, packed), nil
+	})}
+
+	account, err := client.Account(context.Background(), "cosmos1vest")
+	if err != nil {
+		t.Fatalf("Expected Account to succeed, but got error: %s", err)
+	}
+	if account.AccountNumber != 3 || account.Sequence != 9 {
+		t.Errorf("Expected the vesting account's base account, but got %+v", account)
+	}
+}
+
+type querierFunc func(ctx context.Context, method string, request []byte) ([]byte, error)
+
+func (f querierFunc) Query(ctx context.Context, method string, request []byte) ([]byte, error) {
+	return f(ctx, method, request)
+}
+
+func TestGRPCQuerier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected Listen to succeed, but got error: %s", err)
+	}
+	balances := map[string]*big.Int{"cosmos1alice/uatom": big.NewInt(99)}
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		var request []byte
+		if err := stream.RecvMsg(&request); err != nil {
+			return err
+		}
+		switch method {
+		case "/cosmos.bank.v1beta1.Query/Balance":
+			address, _ := fieldBytes(request, 1)
+			denom, _ := fieldBytes(request, 2)
+			amount := balances[string(address)+"/"+string(denom)]
+			if amount == nil {
+				amount = new(big.Int)
+			}
+			response := appendMessage(nil, 1, Coin{Denom: string(denom), Amount: amount}.encode())
+			return stream.SendMsg(&response)
+		case "/cosmos.auth.v1beta1.Query/Account":
+			return status.Error(codes.NotFound, "account not found")
+		}
+		return status.Error(codes.Unimplemented, method)
+	}))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	client, err := Dial(&Config{RPCURL: "http://127.0.0.1:1", GRPCAddress: listener.Addr().String(), GRPCInsecure: true})
+	if err != nil {
+		t.Fatalf("Expected Dial to succeed, but got error: %s", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	balance, err := client.Balance(ctx, "cosmos1alice", "uatom")
+	if err != nil || balance.Int64() != 99 {
+		t.Errorf("Expected a balance of 99uatom over gRPC, but got %v, %v", balance, err)
+	}
+	if _, err := client.Account(ctx, "cosmos1alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound over gRPC, but got %v", err)
+	}
+	if _, err := client.Query(ctx, "/cosmos.staking.v1beta1.Query/Params", nil); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected an unimplemented query to fail, but got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// Transactions are built as cosmos.tx.v1beta1 TxRaw messages and signed
+// with SIGN_MODE_DIRECT by a single secp256k1 key, which pays the fee.
+
+// DefaultGasLimit is used for transactions without a gas limit
+const DefaultGasLimit = 200000
+
+const (
+	signModeDirect      = 1
+	secp256k1PubKeyType = "/cosmos.crypto.secp256k1.PubKey"
+	msgSendType         = "/cosmos.bank.v1beta1.MsgSend"
+)
+
+// Coin is an amount of a denomination
+type Coin struct {
+	Denom  string
+	Amount *big.Int
+}
+
+func (c Coin) encode() []byte {
+	amount := "0"
+	if c.Amount != nil {
+		amount = c.Amount.String()
+	}
+	return appendString(appendString(nil, 1, c.Denom), 2, amount)
+}
+
+// Msg is a message packed in an Any: its type URL, e.g.
+// "/cosmos.bank.v1beta1.MsgSend", and its protobuf encoding
+type Msg struct {
+	TypeURL string
+	Value   []byte
+}
+
+func (m Msg) encode() []byte {
+	return appendBytes(appendString(nil, 1, m.TypeURL), 2, m.Value)
+}
+
+// NewMsgSend creates a bank transfer
+func NewMsgSend(from, to string, amount ...Coin) Msg {
+	value := appendString(appendString(nil, 1, from), 2, to)
+	for _, coin := range amount {
+		value = appendMessage(value, 3, coin.encode())
+	}
+	return Msg{TypeURL: msgSendType, Value: value}
+}
+
+// TxOptions are a transaction's optional fields
+type TxOptions struct {
+	Memo          string
+	TimeoutHeight uint64
+	// GasLimit defaults to DefaultGasLimit
+	GasLimit uint64
+	Fee      []Coin
+}
+
+// SignerData is the signer's account on the chain it signs for, which a
+// SIGN_MODE_DIRECT signature commits to
+type SignerData struct {
+	ChainID       string
+	AccountNumber uint64
+	Sequence      uint64
+}
+
+// SignTx builds and signs a transaction, returning its TxRaw encoding
+func SignTx(key *ecdsa.PrivateKey, signer SignerData, msgs []Msg, options *TxOptions) ([]byte, error) {
+	if len(msgs) == 0 {
+		return nil, errors.New("cosmos: transaction without messages")
+	}
+	if options == nil {
+		options = &TxOptions{}
+	}
+	pub, err := compressPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	for _, msg := range msgs {
+		body = appendMessage(body, 1, msg.encode())
+	}
+	body = appendString(body, 2, options.Memo)
+	body = appendVarint(body, 3, options.TimeoutHeight)
+
+	pubKey := Msg{TypeURL: secp256k1PubKeyType, Value: appendBytes(nil, 1, pub)}
+	single := appendVarint(nil, 1, signModeDirect)
+	var signerInfo []byte
+	signerInfo = appendMessage(signerInfo, 1, pubKey.encode())
+	signerInfo = appendMessage(signerInfo, 2, appendMessage(nil, 1, single))
+	signerInfo = appendVarint(signerInfo, 3, signer.Sequence)
+	gasLimit := options.GasLimit
+	if gasLimit == 0 {
+		gasLimit = DefaultGasLimit
+	}
+	var fee []byte
+	for _, coin := range options.Fee {
+		fee = appendMessage(fee, 1, coin.encode())
+	}
+	fee = appendVarint(fee, 2, gasLimit)
+	var authInfo []byte
+	authInfo = appendMessage(authInfo, 1, signerInfo)
+	authInfo = appendMessage(authInfo, 2, fee)
+
+	var signDoc []byte
+	signDoc = appendBytes(signDoc, 1, body)
+	signDoc = appendBytes(signDoc, 2, authInfo)
+	signDoc = appendString(signDoc, 3, signer.ChainID)
+	signDoc = appendVarint(signDoc, 4, signer.AccountNumber)
+	hash := sha256.Sum256(signDoc)
+	compact := secpecdsa.SignCompact(secp256k1.PrivKeyFromBytes(key.D.FillBytes(make([]byte, 32))), hash[:], true)
+
+	var tx []byte
+	tx = appendBytes(tx, 1, body)
+	tx = appendBytes(tx, 2, authInfo)
+	tx = appendBytes(tx, 3, compact[1:])
+	return tx, nil
+}
+
+// SignTx signs a transaction for the key's account, looking up the chain ID,
+// account number and sequence on the node
+func (c *Client) SignTx(ctx context.Context, key *ecdsa.PrivateKey, msgs []Msg, options *TxOptions) ([]byte, error) {
+	address, err := c.Address(key)
+	if err != nil {
+		return nil, err
+	}
+	status, err := c.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	account, err := c.Account(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return SignTx(key, SignerData{
+		ChainID:       status.ChainID,
+		AccountNumber: account.AccountNumber,
+		Sequence:      account.Sequence,
+	}, msgs, options)
+}
+
+// SendMsgs signs and broadcasts messages from the key's account and returns
+// the transaction's hash
+func (c *Client) SendMsgs(ctx context.Context, key *ecdsa.PrivateKey, msgs []Msg, options *TxOptions) (string, error) {
+	tx, err := c.SignTx(ctx, key, msgs, options)
+	if err != nil {
+		return "", err
+	}
+	return c.BroadcastTx(ctx, tx)
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func TestSendMsgs(t *testing.T) {
+	ctx := context.Background()
+	node, client := newMockNode(t)
+	node.commit()
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("Expected GeneratePrivateKey to succeed, but got error: %s", err)
+	}
+	from, err := client.Address(key.ToECDSA())
+	if err != nil {
+		t.Fatalf("Expected Address to succeed, but got error: %s", err)
+	}
+	node.accounts[from] = &Account{Address: from, AccountNumber: 12, Sequence: 3}
+
+	send := NewMsgSend(from, "cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c", Coin{Denom: "uatom", Amount: big.NewInt(1000)})
+	options := &TxOptions{Memo: "test", Fee: []Coin{{Denom: "uatom", Amount: big.NewInt(500)}}}
+	for i := 0; i < 2; i++ {
+		hash, err := client.SendMsgs(ctx, key.ToECDSA(), []Msg{send}, options)
+		if err != nil {
+			t.Fatalf("Expected SendMsgs to succeed, but got error: %s", err)
+		}
+		if hash != TxHash(node.mempool[i]) {
+			t.Errorf("Expected the broadcast transaction's hash, but got %s", hash)
+		}
+	}
+	if node.accounts[from].Sequence != 5 {
+		t.Errorf("Expected both transactions to be accepted in sequence, but the sequence is %d", node.accounts[from].Sequence)
+	}
+
+	// A transaction signed for another chain is rejected
+	tx, err := SignTx(key.ToECDSA(), SignerData{ChainID: "otherchain-1", AccountNumber: 12, Sequence: 5}, []Msg{send}, options)
+	if err != nil {
+		t.Fatalf("Expected SignTx to succeed, but got error: %s", err)
+	}
+	if _, err := client.BroadcastTx(ctx, tx); !errors.Is(err, ErrTxRejected) {
+		t.Errorf("Expected ErrTxRejected, but got %v", err)
+	}
+}
+
+func TestSignTxEncoding(t *testing.T) {
+	key, _ := secp256k1.GeneratePrivateKey()
+	send := NewMsgSend("cosmos1from", "cosmos1to", Coin{Denom: "uatom", Amount: big.NewInt(1)})
+	tx, err := SignTx(key.ToECDSA(), SignerData{ChainID: "testchain-1", AccountNumber: 1, Sequence: 2}, []Msg{send}, &TxOptions{Memo: "hello", TimeoutHeight: 100})
+	if err != nil {
+		t.Fatalf("Expected SignTx to succeed, but got error: %s", err)
+	}
+
+	body, _ := fieldBytes(tx, 1)
+	msg, _ := fieldBytes(body, 1)
+	typeURL, _ := fieldBytes(msg, 1)
+	memo, _ := fieldBytes(body, 2)
+	timeout, _ := fieldVarint(body, 3)
+	if string(typeURL) != msgSendType || string(memo) != "hello" || timeout != 100 {
+		t.Errorf("Unexpected body: type %s, memo %q, timeout %d", typeURL, memo, timeout)
+	}
+	value, _ := fieldBytes(msg, 2)
+	to, _ := fieldBytes(value, 2)
+	coin, _ := fieldBytes(value, 3)
+	amount, _ := fieldBytes(coin, 2)
+	if string(to) != "cosmos1to" || string(amount) != "1" {
+		t.Errorf("Unexpected MsgSend: to %s, amount %s", to, amount)
+	}
+
+	authInfo, _ := fieldBytes(tx, 2)
+	fee, _ := fieldBytes(authInfo, 2)
+	gasLimit, _ := fieldVarint(fee, 2)
+	if gasLimit != DefaultGasLimit {
+		t.Errorf("Expected the default gas limit, but got %d", gasLimit)
+	}
+	signerInfo, _ := fieldBytes(authInfo, 1)
+	if sequence, _ := fieldVarint(signerInfo, 3); sequence != 2 {
+		t.Errorf("Expected sequence 2 in the signer info, but got %d", sequence)
+	}
+	if signature, _ := fieldBytes(tx, 3); len(signature) != 64 {
+		t.Errorf("Expected a 64-byte signature, but got %d bytes", len(signature))
+	}
+}
+
+func TestSignTxRejectsInvalidInput(t *testing.T) {
+	key, _ := secp256k1.GeneratePrivateKey()
+	if _, err := SignTx(key.ToECDSA(), SignerData{ChainID: "testchain-1"}, nil, nil); err == nil {
+		t.Error("Expected a transaction without messages to be rejected")
+	}
+}
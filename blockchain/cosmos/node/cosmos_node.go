@@ -19,6 +19,10 @@ import (
 )
 
 // CosmosNode represents a Cosmos node
+//
+// Deprecated: CosmosNode talks Ethereum JSON-RPC, which Cosmos SDK nodes
+// don't serve. Use pi/blockchain/cosmos/client.Client for RPC, queries and
+// transactions, and pi/blockchain/adapter.CosmosAdapter to follow blocks.
 type CosmosNode struct {
 	client    *ethclient.Client
 	account   accounts.Account
@@ -27,6 +31,8 @@ type CosmosNode struct {
 }
 
 // NewCosmosNode creates a new Cosmos node
+//
+// Deprecated: Use pi/blockchain/cosmos/client.Dial instead.
 func NewCosmosNode(nodeURL string, privateKeyHex string) (*CosmosNode, error) {
 	privateKey, err := crypto.HexToECDSA(privateKeyHex)
 	if err!= nil {
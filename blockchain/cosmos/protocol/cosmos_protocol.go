@@ -19,6 +19,11 @@ import (
 )
 
 // CosmosProtocol represents the Cosmos protocol
+//
+// Deprecated: CosmosProtocol talks Ethereum JSON-RPC and sends Ethereum
+// transactions, neither of which Cosmos SDK nodes accept. Use
+// pi/blockchain/cosmos/client.Client, whose SendMsgs and BroadcastTx submit
+// signed Cosmos transactions, and pi/blockchain/adapter.CosmosAdapter.
 type CosmosProtocol struct {
 	node    *Node
 	client  *ethclient.Client
@@ -27,6 +32,8 @@ type CosmosProtocol struct {
 }
 
 // NewCosmosProtocol creates a new Cosmos protocol
+//
+// Deprecated: Use pi/blockchain/cosmos/client.Dial instead.
 func NewCosmosProtocol(nodeURL string, privateKeyHex string) (*CosmosProtocol, error) {
 	privateKey, err := crypto.HexToECDSA(privateKeyHex)
 	if err!= nil {
@@ -11,6 +11,8 @@ import (
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+
+	"pi/crypto/hdwallet"
 )
 
 // GeneratePrivateKey generates a new private key
@@ -18,6 +20,20 @@ func GeneratePrivateKey() (*ecdsa.PrivateKey, error) {
 	return crypto.GenerateKey()
 }
 
+// PrivateKeyFromMnemonic derives the key of a Cosmos account from a BIP-39
+// mnemonic at m/44'/118'/account'/0/0, matching other Cosmos wallets
+func PrivateKeyFromMnemonic(mnemonic string, passphrase string, account uint32) (*ecdsa.PrivateKey, error) {
+	seed, err := hdwallet.Seed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hdwallet.DeriveAccount(seed, hdwallet.ChainCosmos, account, 0)
+	if err != nil {
+		return nil, err
+	}
+	return key.PrivateKey().(*ecdsa.PrivateKey), nil
+}
+
 // GetAccountFromPrivateKey gets an account from a private key
 func GetAccountFromPrivateKey(privateKey *ecdsa.PrivateKey) (accounts.Account, error) {
 	return accounts.Account{
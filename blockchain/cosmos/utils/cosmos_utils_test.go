@@ -118,3 +118,17 @@ func TestSplitAddress(t *testing.T) {
 	}
 	fmt.Printf("Prefix: %s, Hex: %s\n", prefix, hex)
 }
+
+func TestPrivateKeyFromMnemonic(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	privateKey, err := PrivateKeyFromMnemonic(mnemonic, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetAccountFromPrivateKey(privateKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PrivateKeyFromMnemonic(mnemonic+" abandon", "", 0); err == nil {
+		t.Errorf("Expected an invalid mnemonic to be rejected")
+	}
+}
@@ -4,14 +4,20 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/pi-network/pi-node/types"
 	"github.com/pi-network/pi-node/utils"
+	"github.com/spf13/viper"
+
+	"pi/crypto/keystore"
 )
 
 // PiNode represents a node in the Pi Network
@@ -43,7 +49,7 @@ type PiNode struct {
 
 // NewPiNode creates a new Pi Node
 func NewPiNode(config *types.Config) (*PiNode, error) {
-	privateKey, err := utils.GeneratePrivateKey()
+	privateKey, err := loadPrivateKey()
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +84,52 @@ func NewPiNode(config *types.Config) (*PiNode, error) {
 	return node, nil
 }
 
+// KeystorePasswordEnv is the environment variable holding the keystore password
+const KeystorePasswordEnv = "PI_KEYSTORE_PASSWORD"
+
+// loadPrivateKey loads the node key from the keystore file configured under
+// keystore.file, creating it on first start. Without a keystore file a new key
+// is generated, so the node gets a different address on every start.
+func loadPrivateKey() (*ecdsa.PrivateKey, error) {
+	path := viper.GetString("keystore.file")
+	if path == "" {
+		log.Println("No keystore.file configured, using a throwaway node key")
+		return utils.GeneratePrivateKey()
+	}
+	password, err := keystorePassword()
+	if err != nil {
+		return nil, err
+	}
+	return keystore.LoadOrCreate(path, password)
+}
+
+// keystorePassword returns the keystore password from the PI_KEYSTORE_PASSWORD
+// environment variable or, if it is unset, from the file configured under
+// keystore.password_file, without its trailing newline. The password is
+// never read from the config itself: a plaintext password next to the
+// keystore would defeat its encryption.
+func keystorePassword() (string, error) {
+	if viper.GetString("keystore.password") != "" {
+		return "", fmt.Errorf("keystore.password must not be set in the config, use %s or keystore.password_file", KeystorePasswordEnv)
+	}
+	if password := os.Getenv(KeystorePasswordEnv); password != "" {
+		return password, nil
+	}
+	path := viper.GetString("keystore.password_file")
+	if path == "" {
+		return "", fmt.Errorf("no keystore password: set %s or keystore.password_file", KeystorePasswordEnv)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading keystore password: %w", err)
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", errors.New("keystore password file is empty")
+	}
+	return password, nil
+}
+
 // Start starts the Pi Node
 func (n *PiNode) Start() error {
 	log.Println("Starting Pi Node...")
@@ -1,10 +1,13 @@
 package node
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/pi-network/pi-node/types"
 	"github.com/pi-network/pi-node/utils"
+	"github.com/spf13/viper"
 )
 
 func TestNewPiNode(t *testing.T) {
@@ -162,3 +165,59 @@ func TestHandleTransactionsRequest(t *testing.T) {
 		t.Errorf("Expected transactions to be empty, but got %d transactions", len(transactions))
 	}
 }
+
+func TestNewPiNodeKeystore(t *testing.T) {
+	viper.Set("keystore.file", filepath.Join(t.TempDir(), "node.json"))
+	defer viper.Set("keystore.file", "")
+	t.Setenv(KeystorePasswordEnv, "password")
+
+	config := &types.Config{
+		Port: 8080,
+	}
+
+	first, err := NewPiNode(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := NewPiNode(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.address != second.address {
+		t.Errorf("Expected the node address to be kept across restarts, but got %s and %s", first.address, second.address)
+	}
+}
+
+func TestKeystorePassword(t *testing.T) {
+	t.Setenv(KeystorePasswordEnv, "")
+	if _, err := keystorePassword(); err == nil {
+		t.Errorf("Expected a missing password to fail")
+	}
+
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("keystore.password_file", path)
+	defer viper.Set("keystore.password_file", "")
+	password, err := keystorePassword()
+	if err != nil {
+		t.Fatalf("Expected keystorePassword to succeed, but got error: %s", err)
+	}
+	if password != "from-file" {
+		t.Errorf("Expected the password file's password, but got %q", password)
+	}
+
+	t.Setenv(KeystorePasswordEnv, "from-env")
+	if password, _ := keystorePassword(); password != "from-env" {
+		t.Errorf("Expected the environment to take precedence, but got %q", password)
+	}
+
+	viper.Set("keystore.password", "plaintext")
+	defer viper.Set("keystore.password", "")
+	if _, err := keystorePassword(); err == nil {
+		t.Errorf("Expected a password in the config to be rejected")
+	}
+}
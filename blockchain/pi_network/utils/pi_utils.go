@@ -2,11 +2,13 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
-	"math/big"
+
+	"pi/crypto/hdwallet"
+	cryptoutils "pi/crypto/utils"
 )
 
 // GeneratePrivateKey generates a new ECDSA private key
@@ -14,6 +16,20 @@ func GeneratePrivateKey() (*ecdsa.PrivateKey, error) {
 	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 }
 
+// PrivateKeyFromMnemonic derives the key of a Pi account from a BIP-39
+// mnemonic at m/44'/314159'/account'/0/0
+func PrivateKeyFromMnemonic(mnemonic string, passphrase string, account uint32) (*ecdsa.PrivateKey, error) {
+	seed, err := hdwallet.Seed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hdwallet.DeriveAccount(seed, hdwallet.ChainPi, account, 0)
+	if err != nil {
+		return nil, err
+	}
+	return key.PrivateKey().(*ecdsa.PrivateKey), nil
+}
+
 // GeneratePublicKey generates a new ECDSA public key from a private key
 func GeneratePublicKey(privateKey *ecdsa.PrivateKey) (*ecdsa.PublicKey, error) {
 	return &privateKey.PublicKey, nil
@@ -33,22 +49,20 @@ func GenerateHash(data []byte) (string, error) {
 	return hex.EncodeToString(hash[:]), nil
 }
 
-// Sign signs a byte slice with a private key
+// Sign signs a byte slice with a private key and returns the self-describing
+// signature encoding of crypto/utils
 func Sign(privateKey *ecdsa.PrivateKey, data []byte) ([]byte, error) {
-	r, s, err := ecdsa.Sign(rand.Reader, privateKey, data)
+	signer, err := cryptoutils.NewMemorySigner(privateKey)
 	if err != nil {
 		return nil, err
 	}
-	signature := append(r.Bytes(), s.Bytes()...)
-	return signature, nil
+	return cryptoutils.Sign(signer, data)
 }
 
 // Verify verifies a signature with a public key
 func Verify(publicKey *ecdsa.PublicKey, data []byte, signature []byte) (bool, error) {
-	r := big.NewInt(0).SetBytes(signature[:len(signature)/2])
-	s := big.NewInt(0).SetBytes(signature[len(signature)/2:])
-	if ecdsa.Verify(publicKey, data, r, s) {
-		return true, nil
+	if err := cryptoutils.Verify(publicKey, data, signature); err != nil {
+		return false, err
 	}
-	return false, fmt.Errorf("invalid signature")
+	return true, nil
 }
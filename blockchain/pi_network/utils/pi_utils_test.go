@@ -90,3 +90,29 @@ func TestSignAndVerify(t *testing.T) {
 		t.Errorf("Expected signature to be valid, but got invalid")
 	}
 }
+
+func TestPrivateKeyFromMnemonic(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	first, err := PrivateKeyFromMnemonic(mnemonic, "", 0)
+	if err != nil {
+		t.Errorf("Expected private key to be derived, but got error: %s", err)
+	}
+	again, err := PrivateKeyFromMnemonic(mnemonic, "", 0)
+	if err != nil {
+		t.Errorf("Expected private key to be derived, but got error: %s", err)
+	}
+	if !first.Equal(again) {
+		t.Errorf("Expected the same mnemonic to derive the same key")
+	}
+	second, err := PrivateKeyFromMnemonic(mnemonic, "", 1)
+	if err != nil {
+		t.Errorf("Expected private key to be derived, but got error: %s", err)
+	}
+	if first.Equal(second) {
+		t.Errorf("Expected different accounts to derive different keys")
+	}
+
+	if _, err := PrivateKeyFromMnemonic("abandon abandon abandon", "", 0); err == nil {
+		t.Errorf("Expected an invalid mnemonic to be rejected")
+	}
+}
@@ -14,6 +14,9 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+
+	"pi/crypto/hdwallet"
+	cryptoutils "pi/crypto/utils"
 )
 
 // HexToBytes converts a hex string to a byte slice
@@ -36,14 +39,39 @@ func BigIntToU256(bigInt *big.Int) types.U256 {
 	return types.U256(bigInt.Bytes())
 }
 
-// SignMessage signs a message with a private key
-func SignMessage(privateKey *ecdsa.PrivateKey, message []byte) ([]byte, error) {
-	return crypto.Sign(privateKey, message)
+// SignMessage signs a 32-byte message hash with a secp256k1 private key. The
+// signature is go-ethereum's 65-byte [R || S || V] format with V 0 or 1, as
+// expected by Ethereum-compatible Substrate chains; the caller chooses the
+// hash, usually Keccak-256.
+func SignMessage(privateKey *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	return crypto.Sign(hash, privateKey)
+}
+
+// VerifySignature verifies a signature produced by SignMessage over a 32-byte
+// message hash. The recovery id is optional, so 64-byte [R || S] signatures
+// are accepted as well.
+func VerifySignature(publicKey *ecdsa.PublicKey, hash []byte, signature []byte) bool {
+	if len(signature) == crypto.SignatureLength {
+		signature = signature[:crypto.SignatureLength-1]
+	}
+	return crypto.VerifySignature(crypto.FromECDSAPub(publicKey), hash, signature)
 }
 
-// VerifySignature verifies a signature with a public key
-func VerifySignature(publicKey *ecdsa.PublicKey, message []byte, signature []byte) bool {
-	return crypto.VerifySignature(publicKey, message, signature)
+// SignMessageEncoded signs a message with a secp256k1 private key and returns
+// the recoverable, self-describing signature encoding of crypto/utils, which
+// hashes the message with SHA-256. Unlike SignMessage the result can be
+// checked with cryptoutils.Verify alongside signatures from the other chains.
+func SignMessageEncoded(privateKey *ecdsa.PrivateKey, message []byte) ([]byte, error) {
+	signer, err := cryptoutils.NewMemorySigner(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return cryptoutils.Sign(signer, message)
+}
+
+// VerifySignatureEncoded verifies a signature produced by SignMessageEncoded
+func VerifySignatureEncoded(publicKey *ecdsa.PublicKey, message []byte, signature []byte) bool {
+	return cryptoutils.Verify(publicKey, message, signature) == nil
 }
 
 // GenerateKey generates a new ECDSA key pair
@@ -51,6 +79,23 @@ func GenerateKey() (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
 	return crypto.GenerateKey()
 }
 
+// KeyFromMnemonic derives the secp256k1 key of an Ethereum-compatible
+// account from a BIP-39 mnemonic at m/44'/60'/account'/0/0, so it works with
+// the signing and address helpers of this package. Account 0 is MetaMask's
+// first account; MetaMask derives further accounts at m/44'/60'/0'/0/i by
+// varying the last index, so other accounts do not match MetaMask's.
+func KeyFromMnemonic(mnemonic string, passphrase string, account uint32) (*ecdsa.PrivateKey, error) {
+	seed, err := hdwallet.Seed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hdwallet.DeriveAccount(seed, hdwallet.ChainEthereum, account, 0)
+	if err != nil {
+		return nil, err
+	}
+	return key.PrivateKey().(*ecdsa.PrivateKey), nil
+}
+
 // GetAccountAddressFromPrivateKey gets the account address from a private key
 func GetAccountAddressFromPrivateKey(privateKey *ecdsa.PrivateKey) common.Address {
 	return crypto.PubkeyToAddress(privateKey.PublicKey)
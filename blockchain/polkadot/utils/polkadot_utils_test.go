@@ -49,7 +49,7 @@ func TestSignMessage(t *testing.T) {
 	if err!= nil {
 		t.Fatal(err)
 	}
-	message := []byte("Hello, World!")
+	message := crypto.Keccak256([]byte("Hello, World!"))
 	signature, err := SignMessage(privateKey, message)
 	if err!= nil {
 		t.Fatal(err)
@@ -63,7 +63,7 @@ func TestVerifySignature(t *testing.T) {
 		t.Fatal(err)
 	}
 	publicKey := &privateKey.PublicKey
-	message := []byte("Hello, World!")
+	message := crypto.Keccak256([]byte("Hello, World!"))
 	signature, err := SignMessage(privateKey, message)
 	if err!= nil {
 		t.Fatal(err)
@@ -75,6 +75,58 @@ func TestVerifySignature(t *testing.T) {
 	fmt.Println("Signature is valid")
 }
 
+// TestSignMessageFormat pins the go-ethereum signature format SignMessage has
+// always produced, so signatures stored or sent by earlier versions keep verifying
+func TestSignMessageFormat(t *testing.T) {
+	privateKey, err := crypto.HexToECDSA("289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032")
+	if err!= nil {
+		t.Fatal(err)
+	}
+	hash, _ := hex.DecodeString("ce0677bb30baa8cf067c88db9811f4333d131bf8bcf12fe7065d211dce971008")
+	signature, err := SignMessage(privateKey, hash)
+	if err!= nil {
+		t.Fatalf("Expected SignMessage to succeed, but got error: %s", err)
+	}
+	expected := "9defa1c2b4651bb84078f886927d9437601f2fa7cab434321fee78463415b22501edb8bedea423ceefab7537ca516f25e9a1f24e34adc42ee9377a5d78e8534600"
+	if hex.EncodeToString(signature)!= expected {
+		t.Errorf("Expected signature %s, but got %x", expected, signature)
+	}
+
+	// The signature vector from go-ethereum's crypto package
+	publicKey, err := crypto.UnmarshalPubkey(common.FromHex("04e32df42865e97135acfb65f3bae71bdc86f4d49150ad6a440b6f15878109880a0a2b2667f7e725ceea70c673093bf67663e0312623c8e091b13cf2c0f11ef652"))
+	if err!= nil {
+		t.Fatal(err)
+	}
+	gethSignature := common.FromHex("90f27b8b488db00b00606796d2987f6a5f59ae62ea05effe84fef5b8b0e549984a691139ad57a3f0b906637673aa2f63d1f55cb1a69199d4009eea23ceaddc9301")
+	if!VerifySignature(publicKey, hash, gethSignature) {
+		t.Errorf("Expected the 65-byte go-ethereum signature to verify")
+	}
+	if!VerifySignature(publicKey, hash, gethSignature[:64]) {
+		t.Errorf("Expected the 64-byte go-ethereum signature to verify")
+	}
+	if VerifySignature(publicKey, crypto.Keccak256(hash), gethSignature) {
+		t.Errorf("Expected the signature not to verify for another hash")
+	}
+}
+
+func TestSignMessageEncoded(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	if err!= nil {
+		t.Fatal(err)
+	}
+	message := []byte("Hello, World!")
+	signature, err := SignMessageEncoded(privateKey, message)
+	if err!= nil {
+		t.Fatalf("Expected SignMessageEncoded to succeed, but got error: %s", err)
+	}
+	if!VerifySignatureEncoded(&privateKey.PublicKey, message, signature) {
+		t.Errorf("Expected the encoded signature to verify")
+	}
+	if VerifySignature(&privateKey.PublicKey, crypto.Keccak256(message), signature) {
+		t.Errorf("Expected the encoded signature not to be accepted as a go-ethereum signature")
+	}
+}
+
 func TestGenerateKey(t *testing.T) {
 	privateKey, publicKey, err := GenerateKey()
 	if err!= nil {
@@ -152,3 +204,23 @@ func TestDecodeBlock(t *testing.T) {
 	}
 	fmt.Printf("Decoded block: %+v\n", block)
 }
+
+func TestKeyFromMnemonic(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	key, err := KeyFromMnemonic(mnemonic, "", 0)
+	if err!= nil {
+		t.Fatal(err)
+	}
+	// The first MetaMask account of this mnemonic
+	address := GetAccountAddressFromPrivateKey(key)
+	if address != common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94") {
+		t.Errorf("Expected the derived account to match MetaMask, but got %s", address.Hex())
+	}
+	signature, err := SignMessage(key, crypto.Keccak256([]byte("hello world")))
+	if err!= nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature(&key.PublicKey, crypto.Keccak256([]byte("hello world")), signature) {
+		t.Errorf("Expected a signature by the derived key to verify")
+	}
+}
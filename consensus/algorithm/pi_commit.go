@@ -0,0 +1,174 @@
+package algorithm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"pi/crypto/bls"
+)
+
+var (
+	// ErrInvalidProofOfPossession is returned when a validator registers a BLS key it can't prove it owns
+	ErrInvalidProofOfPossession = errors.New("invalid proof of possession")
+
+	// ErrNoQuorum is returned when fewer than two thirds of the validators signed a commit
+	ErrNoQuorum = errors.New("commit does not have a two-thirds quorum")
+
+	// ErrInvalidCommit is returned when a commit's aggregate signature doesn't verify
+	ErrInvalidCommit = errors.New("invalid commit signature")
+
+	// ErrDuplicateValidator is returned when a BLS key is registered twice. A
+	// repeated key would count its holder's vote more than once.
+	ErrDuplicateValidator = errors.New("validator public key already registered")
+)
+
+// Validator is a member of the validator set with its BLS voting key
+type Validator struct {
+	Address   string
+	PublicKey *bls.PublicKey
+}
+
+// ValidatorSet holds the validators whose votes finalize blocks. Validators
+// are indexed by registration order, which is also their bit in a commit.
+type ValidatorSet struct {
+	validators []*Validator
+	mu         sync.RWMutex
+}
+
+// Vote is one validator's signature over a block hash
+type Vote struct {
+	BlockHash string
+	Validator int
+	Signature *bls.Signature
+}
+
+// Commit finalizes a block with a single aggregated signature. Signers is a
+// bitmap of the validators whose votes were aggregated.
+type Commit struct {
+	BlockHash string
+	Signers   []byte
+	Signature *bls.Signature
+}
+
+// NewValidatorSet creates an empty validator set
+func NewValidatorSet() *ValidatorSet {
+	return &ValidatorSet{validators: make([]*Validator, 0)}
+}
+
+// Register adds a validator after checking its proof of possession, and
+// returns its index
+func (vs *ValidatorSet) Register(address string, publicKey *bls.PublicKey, proof *bls.Signature) (int, error) {
+	if !bls.VerifyPossession(publicKey, proof) {
+		return 0, ErrInvalidProofOfPossession
+	}
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	for _, validator := range vs.validators {
+		if validator.PublicKey.Equal(publicKey) {
+			return 0, ErrDuplicateValidator
+		}
+	}
+	vs.validators = append(vs.validators, &Validator{Address: address, PublicKey: publicKey})
+	return len(vs.validators) - 1, nil
+}
+
+// Size returns the number of validators
+func (vs *ValidatorSet) Size() int {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return len(vs.validators)
+}
+
+// SignVote signs a vote for a block hash as the validator at index
+func SignVote(secretKey *bls.SecretKey, index int, blockHash string) (*Vote, error) {
+	signature, err := secretKey.Sign(voteMessage(blockHash))
+	if err != nil {
+		return nil, err
+	}
+	return &Vote{BlockHash: blockHash, Validator: index, Signature: signature}, nil
+}
+
+// VerifyVote verifies a single vote against the validator set
+func (vs *ValidatorSet) VerifyVote(vote *Vote) error {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return vs.verifyVote(vote)
+}
+
+func (vs *ValidatorSet) verifyVote(vote *Vote) error {
+	if vote.Validator < 0 || vote.Validator >= len(vs.validators) {
+		return fmt.Errorf("unknown validator %d", vote.Validator)
+	}
+	if !vs.validators[vote.Validator].PublicKey.Verify(voteMessage(vote.BlockHash), vote.Signature) {
+		return fmt.Errorf("invalid vote signature from validator %d", vote.Validator)
+	}
+	return nil
+}
+
+// NewCommit aggregates the votes for a block into a commit. Every vote is
+// verified first, so one bad vote can't spoil the aggregate. The set is read
+// locked throughout, so a validator registered meanwhile can't leave the
+// bitmap too short or change the quorum.
+func (vs *ValidatorSet) NewCommit(blockHash string, votes []*Vote) (*Commit, error) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	signers := make([]byte, (len(vs.validators)+7)/8)
+	signatures := make([]*bls.Signature, 0, len(votes))
+	for _, vote := range votes {
+		if vote.BlockHash != blockHash {
+			return nil, fmt.Errorf("vote from validator %d is for block %s", vote.Validator, vote.BlockHash)
+		}
+		if err := vs.verifyVote(vote); err != nil {
+			return nil, err
+		}
+		if signers[vote.Validator/8]&(1<<(vote.Validator%8)) != 0 {
+			continue
+		}
+		signers[vote.Validator/8] |= 1 << (vote.Validator % 8)
+		signatures = append(signatures, vote.Signature)
+	}
+	if 3*len(signatures) <= 2*len(vs.validators) {
+		return nil, ErrNoQuorum
+	}
+	signature, err := bls.AggregateSignatures(signatures...)
+	if err != nil {
+		return nil, err
+	}
+	return &Commit{BlockHash: blockHash, Signers: signers, Signature: signature}, nil
+}
+
+// VerifyCommit checks that a commit carries a two-thirds quorum and that its
+// aggregate signature verifies against the signers' keys
+func (vs *ValidatorSet) VerifyCommit(commit *Commit) error {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	if len(commit.Signers) != (len(vs.validators)+7)/8 {
+		return fmt.Errorf("commit signer bitmap has %d bytes for %d validators", len(commit.Signers), len(vs.validators))
+	}
+	// Padding bits past the last validator must be clear, so a commit has a
+	// single valid encoding
+	for i := len(vs.validators); i < 8*len(commit.Signers); i++ {
+		if commit.Signers[i/8]&(1<<(i%8)) != 0 {
+			return fmt.Errorf("commit signer bitmap sets bit %d for %d validators", i, len(vs.validators))
+		}
+	}
+	publicKeys := make([]*bls.PublicKey, 0, len(vs.validators))
+	for i, validator := range vs.validators {
+		if commit.Signers[i/8]&(1<<(i%8)) != 0 {
+			publicKeys = append(publicKeys, validator.PublicKey)
+		}
+	}
+	if 3*len(publicKeys) <= 2*len(vs.validators) {
+		return ErrNoQuorum
+	}
+	if !bls.FastAggregateVerify(publicKeys, voteMessage(commit.BlockHash), commit.Signature) {
+		return ErrInvalidCommit
+	}
+	return nil
+}
+
+// voteMessage is the message validators sign to vote for a block
+func voteMessage(blockHash string) []byte {
+	return []byte("pi/commit/v1:" + blockHash)
+}
@@ -0,0 +1,130 @@
+package algorithm
+
+import (
+	"fmt"
+	"testing"
+
+	"pi/crypto/bls"
+)
+
+func newTestValidatorSet(t *testing.T, n int) (*ValidatorSet, []*bls.SecretKey) {
+	vs := NewValidatorSet()
+	keys := make([]*bls.SecretKey, n)
+	for i := range keys {
+		sk, err := bls.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := sk.ProvePossession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := vs.Register(fmt.Sprintf("validator-%d", i), sk.PublicKey(), proof); err != nil {
+			t.Fatalf("Expected Register to succeed, but got error: %s", err)
+		}
+		keys[i] = sk
+	}
+	return vs, keys
+}
+
+func signVotes(t *testing.T, keys []*bls.SecretKey, blockHash string) []*Vote {
+	votes := make([]*Vote, len(keys))
+	for i, sk := range keys {
+		vote, err := SignVote(sk, i, blockHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		votes[i] = vote
+	}
+	return votes
+}
+
+func TestCommitAggregateSignature(t *testing.T) {
+	vs, keys := newTestValidatorSet(t, 4)
+	votes := signVotes(t, keys, "block-hash")
+
+	commit, err := vs.NewCommit("block-hash", votes[:3])
+	if err != nil {
+		t.Fatalf("Expected NewCommit to succeed, but got error: %s", err)
+	}
+	if err := vs.VerifyCommit(commit); err != nil {
+		t.Errorf("Expected VerifyCommit to succeed, but got error: %s", err)
+	}
+
+	commit.BlockHash = "other-hash"
+	if err := vs.VerifyCommit(commit); err != ErrInvalidCommit {
+		t.Errorf("Expected ErrInvalidCommit for a commit moved to another block, but got %v", err)
+	}
+}
+
+func TestCommitQuorum(t *testing.T) {
+	vs, keys := newTestValidatorSet(t, 4)
+	votes := signVotes(t, keys, "block-hash")
+	if _, err := vs.NewCommit("block-hash", votes[:2]); err != ErrNoQuorum {
+		t.Errorf("Expected ErrNoQuorum with 2 of 4 votes, but got %v", err)
+	}
+	// A repeated vote doesn't count twice
+	if _, err := vs.NewCommit("block-hash", []*Vote{votes[0], votes[1], votes[1]}); err != ErrNoQuorum {
+		t.Errorf("Expected ErrNoQuorum with a duplicated vote, but got %v", err)
+	}
+
+	commit, err := vs.NewCommit("block-hash", votes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit.Signers[0] = 0x03
+	if err := vs.VerifyCommit(commit); err != ErrNoQuorum {
+		t.Errorf("Expected ErrNoQuorum for a commit claiming 2 signers, but got %v", err)
+	}
+}
+
+func TestRegisterRejectsRogueKey(t *testing.T) {
+	vs, keys := newTestValidatorSet(t, 1)
+	rogue, err := bls.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A proof made with another validator's key doesn't prove ownership
+	proof, err := keys[0].ProvePossession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vs.Register("rogue", rogue.PublicKey(), proof); err != ErrInvalidProofOfPossession {
+		t.Errorf("Expected ErrInvalidProofOfPossession, but got %v", err)
+	}
+}
+
+func TestNewCommitRejectsBadVote(t *testing.T) {
+	vs, keys := newTestValidatorSet(t, 3)
+	votes := signVotes(t, keys, "block-hash")
+	votes[2].Signature = votes[1].Signature
+	if _, err := vs.NewCommit("block-hash", votes); err == nil {
+		t.Errorf("Expected NewCommit to reject a vote with another validator's signature, but got nil error")
+	}
+}
+
+func TestRegisterRejectsDuplicateKey(t *testing.T) {
+	vs, keys := newTestValidatorSet(t, 1)
+	proof, err := keys[0].ProvePossession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vs.Register("validator-0-again", keys[0].PublicKey(), proof); err != ErrDuplicateValidator {
+		t.Errorf("Expected ErrDuplicateValidator, but got %v", err)
+	}
+	if vs.Size() != 1 {
+		t.Errorf("Expected the duplicate key not to be added")
+	}
+}
+
+func TestVerifyCommitRejectsPaddingBits(t *testing.T) {
+	vs, keys := newTestValidatorSet(t, 4)
+	commit, err := vs.NewCommit("block-hash", signVotes(t, keys, "block-hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit.Signers[0] |= 1 << 6
+	if err := vs.VerifyCommit(commit); err == nil {
+		t.Errorf("Expected VerifyCommit to reject a bit past the last validator, but got nil error")
+	}
+}
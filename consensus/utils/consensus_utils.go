@@ -6,7 +6,8 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"math/big"
+
+	cryptoutils "pi/crypto/utils"
 )
 
 // GeneratePrivateKey generates a new ECDSA private key
@@ -25,22 +26,30 @@ func GenerateAddress(publicKey *ecdsa.PublicKey) (string, error) {
 	return fmt.Sprintf("0x%x", hash), nil
 }
 
-// Sign signs a message with a private key
+// Sign signs a message with a private key and returns the hex-encoded
+// self-describing signature of crypto/utils
 func Sign(privateKey *ecdsa.PrivateKey, message []byte) (string, error) {
-	r, s, err := ecdsa.Sign(rand.Reader, privateKey, message)
+	signer, err := cryptoutils.NewMemorySigner(privateKey)
+	if err!= nil {
+		return "", err
+	}
+	signature, err := cryptoutils.Sign(signer, message)
 	if err!= nil {
 		return "", err
 	}
-	return fmt.Sprintf("%x%x", r, s), nil
+	return hex.EncodeToString(signature), nil
 }
 
 // Verify verifies a signature with a public key
 func Verify(publicKey *ecdsa.PublicKey, message []byte, signature string) (bool, error) {
-	r, s, err := hex.DecodeString(signature)
+	sig, err := hex.DecodeString(signature)
 	if err!= nil {
 		return false, err
 	}
-	return ecdsa.Verify(&publicKey, message, r, s), nil
+	if err := cryptoutils.Verify(publicKey, message, sig); err!= nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // CalculateBlockHash calculates the hash of a block
@@ -0,0 +1,340 @@
+package bls
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/consensys/gurvy/bls381"
+	"github.com/consensys/gurvy/bls381/fr"
+)
+
+// BLS signatures over BLS12-381 with public keys in G1 and signatures in G2,
+// so that the keys stored per validator stay small and many signatures over
+// the same block can be aggregated into one.
+
+// Domain separation tags for messages and proofs of possession. Keeping them
+// apart means a proof of possession can never be replayed as a vote.
+var (
+	signatureDST  = []byte("PI_BLS_SIG_BLS12381G2_SVDW_POP_")
+	possessionDST = []byte("PI_BLS_POP_BLS12381G2_SVDW_POP_")
+)
+
+// Encoded sizes of keys and signatures
+const (
+	SecretKeySize = 32
+	PublicKeySize = bls381.SizeOfG1AffineCompressed
+	SignatureSize = bls381.SizeOfG2AffineCompressed
+)
+
+var (
+	// ErrInvalidSecretKey is returned for secret keys that are zero or not below the group order
+	ErrInvalidSecretKey = errors.New("bls: invalid secret key")
+	// ErrInvalidPublicKey is returned for public keys that are malformed, the identity or outside the subgroup
+	ErrInvalidPublicKey = errors.New("bls: invalid public key")
+	// ErrInvalidSignature is returned for signatures that are malformed or outside the subgroup
+	ErrInvalidSignature = errors.New("bls: invalid signature")
+	// ErrEmptyAggregate is returned when aggregating nothing
+	ErrEmptyAggregate = errors.New("bls: nothing to aggregate")
+)
+
+var g1Gen bls381.G1Affine
+
+func init() {
+	_, _, g1Gen, _ = bls381.Generators()
+}
+
+// SecretKey is a BLS secret scalar
+type SecretKey struct {
+	s *big.Int
+}
+
+// PublicKey is a BLS public key, a point in G1
+type PublicKey struct {
+	p bls381.G1Affine
+}
+
+// Signature is a BLS signature or aggregate signature, a point in G2
+type Signature struct {
+	p bls381.G2Affine
+}
+
+// GenerateKey generates a secret key from the given source of randomness, or
+// crypto/rand when r is nil
+func GenerateKey(r io.Reader) (*SecretKey, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	for {
+		s, err := rand.Int(r, fr.Modulus())
+		if err != nil {
+			return nil, err
+		}
+		if s.Sign() != 0 {
+			return &SecretKey{s: s}, nil
+		}
+	}
+}
+
+// SecretKeyFromBytes decodes a big-endian secret scalar
+func SecretKeyFromBytes(b []byte) (*SecretKey, error) {
+	if len(b) != SecretKeySize {
+		return nil, ErrInvalidSecretKey
+	}
+	s := new(big.Int).SetBytes(b)
+	if s.Sign() == 0 || s.Cmp(fr.Modulus()) >= 0 {
+		return nil, ErrInvalidSecretKey
+	}
+	return &SecretKey{s: s}, nil
+}
+
+// Bytes returns the big-endian encoding of the secret scalar
+func (sk *SecretKey) Bytes() []byte {
+	return sk.s.FillBytes(make([]byte, SecretKeySize))
+}
+
+// PublicKey returns the public key of the secret key
+func (sk *SecretKey) PublicKey() *PublicKey {
+	pk := &PublicKey{}
+	pk.p.ScalarMultiplication(&g1Gen, sk.s)
+	return pk
+}
+
+// Sign signs a message
+func (sk *SecretKey) Sign(message []byte) (*Signature, error) {
+	return sk.sign(message, signatureDST)
+}
+
+// ProvePossession signs the public key itself under a separate domain. Other
+// validators check it with VerifyPossession before accepting the key, which
+// rules out rogue-key attacks on aggregated public keys.
+func (sk *SecretKey) ProvePossession() (*Signature, error) {
+	return sk.sign(sk.PublicKey().Bytes(), possessionDST)
+}
+
+func (sk *SecretKey) sign(message []byte, dst []byte) (*Signature, error) {
+	h, err := bls381.HashToCurveG2Svdw(message, dst)
+	if err != nil {
+		return nil, err
+	}
+	sig := &Signature{}
+	sig.p.ScalarMultiplication(&h, sk.s)
+	return sig, nil
+}
+
+// Bytes returns the compressed encoding of the public key
+func (pk *PublicKey) Bytes() []byte {
+	b := pk.p.Bytes()
+	return b[:]
+}
+
+// PublicKeyFromBytes decodes a compressed public key and checks it is a valid,
+// non-identity point in the G1 subgroup
+func PublicKeyFromBytes(b []byte) (*PublicKey, error) {
+	pk := &PublicKey{}
+	if len(b) != PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+	if _, err := pk.p.SetBytes(b); err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	if pk.p.IsInfinity() || !pk.p.IsInSubGroup() {
+		return nil, ErrInvalidPublicKey
+	}
+	return pk, nil
+}
+
+// Equal reports whether two public keys are the same
+func (pk *PublicKey) Equal(other *PublicKey) bool {
+	return pk.p.Equal(&other.p)
+}
+
+// Verify checks a signature over message by this key
+func (pk *PublicKey) Verify(message []byte, sig *Signature) bool {
+	return verify([]*PublicKey{pk}, [][]byte{message}, sig, signatureDST)
+}
+
+// VerifyPossession checks a proof of possession produced by SecretKey.ProvePossession
+func VerifyPossession(pk *PublicKey, proof *Signature) bool {
+	if pk == nil {
+		return false
+	}
+	return verify([]*PublicKey{pk}, [][]byte{pk.Bytes()}, proof, possessionDST)
+}
+
+// Bytes returns the compressed encoding of the signature
+func (sig *Signature) Bytes() []byte {
+	b := sig.p.Bytes()
+	return b[:]
+}
+
+// SignatureFromBytes decodes a compressed signature and checks it is in the G2 subgroup
+func SignatureFromBytes(b []byte) (*Signature, error) {
+	sig := &Signature{}
+	if len(b) != SignatureSize {
+		return nil, ErrInvalidSignature
+	}
+	if _, err := sig.p.SetBytes(b); err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if !sig.p.IsInSubGroup() {
+		return nil, ErrInvalidSignature
+	}
+	return sig, nil
+}
+
+// AggregateSignatures combines signatures into a single signature
+func AggregateSignatures(sigs ...*Signature) (*Signature, error) {
+	if len(sigs) == 0 {
+		return nil, ErrEmptyAggregate
+	}
+	for _, sig := range sigs {
+		if sig == nil {
+			return nil, ErrInvalidSignature
+		}
+	}
+	var acc bls381.G2Jac
+	acc.FromAffine(&sigs[0].p)
+	for _, sig := range sigs[1:] {
+		acc.AddMixed(&sig.p)
+	}
+	agg := &Signature{}
+	agg.p.FromJacobian(&acc)
+	return agg, nil
+}
+
+// AggregatePublicKeys combines public keys into the key that verifies an
+// aggregate signature over a common message. The keys must have had their
+// proofs of possession checked.
+func AggregatePublicKeys(pks ...*PublicKey) (*PublicKey, error) {
+	if len(pks) == 0 {
+		return nil, ErrEmptyAggregate
+	}
+	for _, pk := range pks {
+		if pk == nil {
+			return nil, ErrInvalidPublicKey
+		}
+	}
+	var acc bls381.G1Jac
+	acc.FromAffine(&pks[0].p)
+	for _, pk := range pks[1:] {
+		acc.AddMixed(&pk.p)
+	}
+	agg := &PublicKey{}
+	agg.p.FromJacobian(&acc)
+	return agg, nil
+}
+
+// FastAggregateVerify checks an aggregate signature by all of pks over the
+// same message, using a single pairing check
+func FastAggregateVerify(pks []*PublicKey, message []byte, sig *Signature) bool {
+	agg, err := AggregatePublicKeys(pks...)
+	if err != nil {
+		return false
+	}
+	return agg.Verify(message, sig)
+}
+
+// AggregateVerify checks an aggregate signature where pks[i] signed messages[i].
+// The messages must be distinct unless every key has a verified proof of
+// possession.
+func AggregateVerify(pks []*PublicKey, messages [][]byte, sig *Signature) bool {
+	if len(pks) == 0 || len(pks) != len(messages) {
+		return false
+	}
+	return verify(pks, messages, sig, signatureDST)
+}
+
+// verify checks e(g1, sig) == prod e(pk_i, H(m_i)). Nil signatures and keys
+// and empty key sets never verify, since they come straight from the wire.
+func verify(pks []*PublicKey, messages [][]byte, sig *Signature, dst []byte) bool {
+	if sig == nil || len(pks) == 0 || len(pks) != len(messages) {
+		return false
+	}
+	if !sig.p.IsInSubGroup() {
+		return false
+	}
+	g1s := make([]bls381.G1Affine, len(pks))
+	g2s := make([]bls381.G2Affine, len(pks))
+	for i, pk := range pks {
+		if pk == nil || pk.p.IsInfinity() {
+			return false
+		}
+		h, err := bls381.HashToCurveG2Svdw(messages[i], dst)
+		if err != nil {
+			return false
+		}
+		g1s[i] = pk.p
+		g2s[i] = h
+	}
+	left, err := bls381.Pair([]bls381.G1Affine{g1Gen}, []bls381.G2Affine{sig.p})
+	if err != nil {
+		return false
+	}
+	right, err := bls381.Pair(g1s, g2s)
+	if err != nil {
+		return false
+	}
+	return left.Equal(&right)
+}
+
+// Order returns the order of the BLS12-381 groups, which secret keys and
+// threshold shares are reduced modulo
+func Order() *big.Int {
+	return fr.Modulus()
+}
+
+// SecretKeyFromInt creates a secret key from a scalar in [1, Order())
+func SecretKeyFromInt(s *big.Int) (*SecretKey, error) {
+	if s.Sign() <= 0 || s.Cmp(fr.Modulus()) >= 0 {
+		return nil, ErrInvalidSecretKey
+	}
+	return &SecretKey{s: new(big.Int).Set(s)}, nil
+}
+
+// Int returns a copy of the secret scalar
+func (sk *SecretKey) Int() *big.Int {
+	return new(big.Int).Set(sk.s)
+}
+
+// LinearCombinationPublicKeys returns sum(coeffs[i] * pks[i]). It is used to
+// check Feldman commitments and interpolate threshold keys; the result may
+// be the identity, which PublicKeyFromBytes would reject.
+func LinearCombinationPublicKeys(pks []*PublicKey, coeffs []*big.Int) (*PublicKey, error) {
+	if len(pks) == 0 || len(pks) != len(coeffs) {
+		return nil, ErrEmptyAggregate
+	}
+	var acc bls381.G1Jac
+	for i, pk := range pks {
+		if pk == nil {
+			return nil, ErrInvalidPublicKey
+		}
+		var term bls381.G1Affine
+		term.ScalarMultiplication(&pk.p, new(big.Int).Mod(coeffs[i], fr.Modulus()))
+		acc.AddMixed(&term)
+	}
+	out := &PublicKey{}
+	out.p.FromJacobian(&acc)
+	return out, nil
+}
+
+// LinearCombinationSignatures returns sum(coeffs[i] * sigs[i]), which
+// combines threshold signature shares with Lagrange coefficients
+func LinearCombinationSignatures(sigs []*Signature, coeffs []*big.Int) (*Signature, error) {
+	if len(sigs) == 0 || len(sigs) != len(coeffs) {
+		return nil, ErrEmptyAggregate
+	}
+	var acc bls381.G2Jac
+	for i, sig := range sigs {
+		if sig == nil {
+			return nil, ErrInvalidSignature
+		}
+		var term bls381.G2Affine
+		term.ScalarMultiplication(&sig.p, new(big.Int).Mod(coeffs[i], fr.Modulus()))
+		acc.AddMixed(&term)
+	}
+	out := &Signature{}
+	out.p.FromJacobian(&acc)
+	return out, nil
+}
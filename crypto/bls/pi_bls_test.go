@@ -0,0 +1,200 @@
+package bls
+
+import (
+	"math/big"
+	"testing"
+)
+
+func newTestKeys(t *testing.T, n int) []*SecretKey {
+	keys := make([]*SecretKey, n)
+	for i := range keys {
+		sk, err := GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = sk
+	}
+	return keys
+}
+
+func TestSignVerify(t *testing.T) {
+	sk := newTestKeys(t, 1)[0]
+	sig, err := sk.Sign([]byte("block 1"))
+	if err != nil {
+		t.Fatalf("Expected Sign to succeed, but got error: %s", err)
+	}
+	if !sk.PublicKey().Verify([]byte("block 1"), sig) {
+		t.Errorf("Expected signature to verify")
+	}
+	if sk.PublicKey().Verify([]byte("block 2"), sig) {
+		t.Errorf("Expected signature over another message to fail")
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	sk := newTestKeys(t, 1)[0]
+	decoded, err := SecretKeyFromBytes(sk.Bytes())
+	if err != nil {
+		t.Fatalf("Expected SecretKeyFromBytes to succeed, but got error: %s", err)
+	}
+	pk, err := PublicKeyFromBytes(decoded.PublicKey().Bytes())
+	if err != nil {
+		t.Fatalf("Expected PublicKeyFromBytes to succeed, but got error: %s", err)
+	}
+	if !pk.Equal(sk.PublicKey()) {
+		t.Errorf("Expected decoded public key to match")
+	}
+	sig, err := sk.Sign([]byte("block 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedSig, err := SignatureFromBytes(sig.Bytes())
+	if err != nil {
+		t.Fatalf("Expected SignatureFromBytes to succeed, but got error: %s", err)
+	}
+	if !pk.Verify([]byte("block 1"), decodedSig) {
+		t.Errorf("Expected decoded signature to verify")
+	}
+	if _, err := PublicKeyFromBytes(make([]byte, PublicKeySize)); err == nil {
+		t.Errorf("Expected PublicKeyFromBytes to reject an all-zero key")
+	}
+}
+
+func TestFastAggregateVerify(t *testing.T) {
+	keys := newTestKeys(t, 4)
+	message := []byte("block 1")
+	pks := make([]*PublicKey, len(keys))
+	sigs := make([]*Signature, len(keys))
+	for i, sk := range keys {
+		pks[i] = sk.PublicKey()
+		sig, err := sk.Sign(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigs[i] = sig
+	}
+	agg, err := AggregateSignatures(sigs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !FastAggregateVerify(pks, message, agg) {
+		t.Errorf("Expected aggregate signature to verify")
+	}
+	if FastAggregateVerify(pks[:3], message, agg) {
+		t.Errorf("Expected aggregate signature to fail with a missing signer")
+	}
+	if _, err := AggregateSignatures(); err != ErrEmptyAggregate {
+		t.Errorf("Expected ErrEmptyAggregate, but got %v", err)
+	}
+}
+
+func TestVerifyRejectsNil(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	message := []byte("block 1")
+	pks := []*PublicKey{keys[0].PublicKey(), keys[1].PublicKey()}
+	sig, err := keys[0].Sign(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pks[0].Verify(message, nil) {
+		t.Errorf("Expected a nil signature not to verify")
+	}
+	if FastAggregateVerify(pks, message, nil) {
+		t.Errorf("Expected a nil aggregate signature not to verify")
+	}
+	if FastAggregateVerify(nil, message, sig) {
+		t.Errorf("Expected an empty key set not to verify")
+	}
+	if FastAggregateVerify([]*PublicKey{pks[0], nil}, message, sig) {
+		t.Errorf("Expected a nil key not to verify")
+	}
+	if AggregateVerify([]*PublicKey{nil}, [][]byte{message}, sig) {
+		t.Errorf("Expected a nil key not to verify")
+	}
+	if VerifyPossession(nil, sig) {
+		t.Errorf("Expected a nil key not to verify a proof of possession")
+	}
+	if _, err := AggregateSignatures(sig, nil); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature, but got %v", err)
+	}
+}
+
+func TestAggregateVerifyDistinctMessages(t *testing.T) {
+	keys := newTestKeys(t, 3)
+	pks := make([]*PublicKey, len(keys))
+	messages := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	sigs := make([]*Signature, len(keys))
+	for i, sk := range keys {
+		pks[i] = sk.PublicKey()
+		sig, err := sk.Sign(messages[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigs[i] = sig
+	}
+	agg, err := AggregateSignatures(sigs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !AggregateVerify(pks, messages, agg) {
+		t.Errorf("Expected aggregate signature over distinct messages to verify")
+	}
+	messages[0], messages[1] = messages[1], messages[0]
+	if AggregateVerify(pks, messages, agg) {
+		t.Errorf("Expected aggregate signature to fail with swapped messages")
+	}
+}
+
+func TestProofOfPossession(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	proof, err := keys[0].ProvePossession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyPossession(keys[0].PublicKey(), proof) {
+		t.Errorf("Expected proof of possession to verify")
+	}
+	if VerifyPossession(keys[1].PublicKey(), proof) {
+		t.Errorf("Expected proof of possession to fail for another key")
+	}
+	// A proof of possession is not a signature over the key bytes
+	if keys[0].PublicKey().Verify(keys[0].PublicKey().Bytes(), proof) {
+		t.Errorf("Expected proof of possession not to verify as a message signature")
+	}
+}
+
+func TestLinearCombination(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	a, b := keys[0].Int(), keys[1].Int()
+	coeffs := []*big.Int{big.NewInt(3), big.NewInt(5)}
+
+	// 3*a + 5*b computed on scalars must match the same combination of points
+	sum := new(big.Int).Add(new(big.Int).Mul(a, coeffs[0]), new(big.Int).Mul(b, coeffs[1]))
+	combined, err := SecretKeyFromInt(sum.Mod(sum, Order()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := LinearCombinationPublicKeys([]*PublicKey{keys[0].PublicKey(), keys[1].PublicKey()}, coeffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pk.Equal(combined.PublicKey()) {
+		t.Errorf("Expected the linear combination of public keys to match the combined secret")
+	}
+
+	sigA, err := keys[0].Sign([]byte("block 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigB, err := keys[1].Sign([]byte("block 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := LinearCombinationSignatures([]*Signature{sigA, sigB}, coeffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !combined.PublicKey().Verify([]byte("block 1"), sig) {
+		t.Errorf("Expected the linear combination of signatures to verify under the combined key")
+	}
+}
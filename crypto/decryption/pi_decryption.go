@@ -1,17 +1,16 @@
 package decryption
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
 	"errors"
-	"io"
+
+	"pi/crypto/encryption"
 )
 
 // PiDecryption is a struct that holds the decryption key and other parameters
 type PiDecryption struct {
-	key []byte
+	key   []byte
+	suite *encryption.CipherSuite
 }
 
 // NewPiDecryption creates a new instance of PiDecryption
@@ -19,23 +18,28 @@ func NewPiDecryption(key []byte) (*PiDecryption, error) {
 	if len(key) != 32 {
 		return nil, errors.New("key must be 32 bytes long")
 	}
-	return &PiDecryption{key: key}, nil
-}
-
-// Decrypt decrypts a ciphertext message using AES-256-CBC
-func (pd *PiDecryption) Decrypt(ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(pd.key)
+	suite, err := encryption.NewCipherSuite(key)
 	if err != nil {
 		return nil, err
 	}
-	if len(ciphertext) < aes.BlockSize {
-		return nil, errors.New("ciphertext too short")
-	}
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-	cfb := cipher.NewCFBDecrypter(block, iv)
-	cfb.XORKeyStream(ciphertext, ciphertext)
-	return ciphertext, nil
+	return &PiDecryption{key: key, suite: suite}, nil
+}
+
+// Decrypt authenticates and decrypts a versioned AEAD ciphertext produced by
+// encryption.PiEncryption. Legacy AES-CFB ciphertexts are rejected with
+// encryption.ErrNotVersioned and need DecryptLegacy.
+func (pd *PiDecryption) Decrypt(ciphertext []byte) ([]byte, error) {
+	return encryption.Open(pd.key, ciphertext, nil)
+}
+
+// DecryptLegacy decrypts an unauthenticated legacy AES-CFB ciphertext, see encryption.DecryptLegacy
+func (pd *PiDecryption) DecryptLegacy(ciphertext []byte) ([]byte, error) {
+	return encryption.DecryptLegacy(pd.key, ciphertext)
+}
+
+// DecryptWithAD decrypts a versioned AEAD ciphertext that was encrypted with the given associated data
+func (pd *PiDecryption) DecryptWithAD(ciphertext []byte, ad []byte) ([]byte, error) {
+	return encryption.Open(pd.key, ciphertext, ad)
 }
 
 // DecryptBase64 decrypts a base64-encoded ciphertext message and returns the result as a plaintext byte slice
@@ -47,28 +51,8 @@ func (pd *PiDecryption) DecryptBase64(ciphertext string) ([]byte, error) {
 	return pd.Decrypt(ciphertextBytes)
 }
 
-// DecryptWithMAC decrypts a ciphertext message using AES-256-CBC and verifies the MAC (Message Authentication Code)
+// DecryptWithMAC verifies the MAC of a ciphertext produced by encryption.PiEncryption.EncryptWithMAC
+// and decrypts it. The MAC is checked in constant time before any decryption happens.
 func (pd *PiDecryption) DecryptWithMAC(ciphertext []byte, mac []byte) ([]byte, error) {
-	block, err := aes.NewCipher(pd.key)
-	if err != nil {
-		return nil, err
-	}
-	if len(ciphertext) < aes.BlockSize {
-		return nil, errors.New("ciphertext too short")
-	}
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-	cfb := cipher.NewCFBDecrypter(block, iv)
-	cfb.XORKeyStream(ciphertext, ciphertext)
-	expectedMAC := pd.calculateMAC(ciphertext)
-	if !hmac.Equal(expectedMAC, mac) {
-		return nil, errors.New("MAC verification failed")
-	}
-	return ciphertext, nil
-}
-
-func (pd *PiDecryption) calculateMAC(data []byte) []byte {
-	mac := hmac.New(sha256.New, pd.key)
-	mac.Write(data)
-	return mac.Sum(nil)
+	return pd.suite.Decrypt(ciphertext, mac)
 }
@@ -1,7 +1,10 @@
 package decryption
 
 import (
+	"crypto/rand"
 	"testing"
+
+	"pi/crypto/encryption"
 )
 
 func TestNewPiDecryption(t *testing.T) {
@@ -69,8 +72,14 @@ func TestDecryptWithMAC(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	ciphertext := []byte("encrypted data")
-	mac := pd.calculateMAC(ciphertext)
+	pe, err := encryption.NewPiEncryption(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, mac, err := pe.EncryptWithMAC([]byte("decrypted data"))
+	if err != nil {
+		t.Fatal(err)
+	}
 	decrypted, err := pd.DecryptWithMAC(ciphertext, mac)
 	if err != nil {
 		t.Errorf("Expected DecryptWithMAC to succeed, but got error: %s", err)
@@ -122,3 +131,59 @@ func TestInvalidMAC(t *testing.T) {
 		t.Errorf("Expected DecryptWithMAC to fail with invalid MAC, but got nil error")
 	}
 }
+
+func TestDecryptWithAD(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe, err := encryption.NewPiEncryption(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pd, err := NewPiDecryption(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := pe.EncryptWithAD([]byte("hello world"), []byte("header"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := pd.DecryptWithAD(ciphertext, []byte("header"))
+	if err != nil {
+		t.Errorf("Expected DecryptWithAD to succeed, but got error: %s", err)
+	}
+	if string(decrypted) != "hello world" {
+		t.Errorf("Expected decrypted text to match original plaintext, but got %s", decrypted)
+	}
+	_, err = pd.DecryptWithAD(ciphertext, []byte("other"))
+	if err == nil {
+		t.Errorf("Expected DecryptWithAD to fail with mismatched associated data, but got nil error")
+	}
+}
+
+func TestDecryptWithMACTampered(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe, err := encryption.NewPiEncryption(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pd, err := NewPiDecryption(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, mac, err := pe.EncryptWithMAC([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = pd.DecryptWithMAC(ciphertext, mac)
+	if err != encryption.ErrMACMismatch {
+		t.Errorf("Expected DecryptWithMAC to fail with ErrMACMismatch for tampered ciphertext, but got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Algorithm identifies the AEAD cipher used to produce a versioned ciphertext
+type Algorithm byte
+
+const (
+	// AlgorithmAES256GCM is AES-256 in Galois/Counter Mode
+	AlgorithmAES256GCM Algorithm = 1
+	// AlgorithmChaCha20Poly1305 is ChaCha20-Poly1305 as in RFC 8439
+	AlgorithmChaCha20Poly1305 Algorithm = 2
+)
+
+// HeaderVersion is the current version of the ciphertext header
+const HeaderVersion = 1
+
+// headerMagic marks a versioned ciphertext. Legacy CFB ciphertexts start
+// with a random IV and are told apart by the absence of this prefix.
+var headerMagic = []byte{'P', 'I', 'E'}
+
+// HeaderSize is the length of the versioned header: magic, version and algorithm
+const HeaderSize = 5
+
+var (
+	// ErrUnknownAlgorithm is returned for algorithm identifiers this package doesn't implement
+	ErrUnknownAlgorithm = errors.New("unknown encryption algorithm")
+	// ErrAuthentication is returned when a ciphertext or its associated data has been tampered with
+	ErrAuthentication = errors.New("message authentication failed")
+	// ErrNotVersioned is returned by Open for data without a versioned header,
+	// such as legacy AES-CFB ciphertexts, which only DecryptLegacy accepts
+	ErrNotVersioned = errors.New("ciphertext has no version header")
+)
+
+// String returns the name of the algorithm
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmAES256GCM:
+		return "AES-256-GCM"
+	case AlgorithmChaCha20Poly1305:
+		return "ChaCha20-Poly1305"
+	default:
+		return fmt.Sprintf("Algorithm(%d)", byte(a))
+	}
+}
+
+// NewAEAD returns the AEAD for the given algorithm and 32-byte key
+func NewAEAD(alg Algorithm, key []byte) (cipher.AEAD, error) {
+	switch alg {
+	case AlgorithmAES256GCM:
+		if len(key) != 32 {
+			return nil, errors.New("key must be 32 bytes long")
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AlgorithmChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+}
+
+// IsVersioned reports whether ciphertext starts with a versioned header.
+// A legacy ciphertext is only mistaken for a versioned one if its random IV
+// happens to begin with a valid header, which is vanishingly unlikely.
+func IsVersioned(ciphertext []byte) bool {
+	if len(ciphertext) < HeaderSize || !bytes.Equal(ciphertext[:len(headerMagic)], headerMagic) {
+		return false
+	}
+	switch Algorithm(ciphertext[4]) {
+	case AlgorithmAES256GCM, AlgorithmChaCha20Poly1305:
+		return ciphertext[3] == HeaderVersion
+	default:
+		return false
+	}
+}
+
+// Seal encrypts and authenticates plaintext together with the associated data.
+// The result is laid out as header | nonce | ciphertext+tag, and the header is
+// authenticated along with ad so the algorithm can't be swapped.
+func Seal(alg Algorithm, key []byte, plaintext []byte, ad []byte) ([]byte, error) {
+	aead, err := NewAEAD(alg, key)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append([]byte{}, headerMagic...), HeaderVersion, byte(alg))
+	out := make([]byte, HeaderSize+aead.NonceSize(), HeaderSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(out, header)
+	nonce := out[HeaderSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, plaintext, append(header, ad...)), nil
+}
+
+// Open authenticates and decrypts a ciphertext produced by Seal
+func Open(key []byte, ciphertext []byte, ad []byte) ([]byte, error) {
+	if !IsVersioned(ciphertext) {
+		return nil, ErrNotVersioned
+	}
+	header := ciphertext[:HeaderSize]
+	aead, err := NewAEAD(Algorithm(header[4]), key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < HeaderSize+aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce := ciphertext[HeaderSize : HeaderSize+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[HeaderSize+aead.NonceSize():], append(append([]byte{}, header...), ad...))
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return plaintext, nil
+}
+
+// DecryptLegacy decrypts ciphertexts written before versioned headers were
+// introduced, which are an IV followed by AES-CFB output. Legacy data is not
+// authenticated, so tampering goes undetected; it is only meant for migrating
+// old data to Seal and must be asked for explicitly.
+func DecryptLegacy(key []byte, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	iv := ciphertext[:aes.BlockSize]
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	cfb := cipher.NewCFBDecrypter(block, iv)
+	cfb.XORKeyStream(plaintext, ciphertext[aes.BlockSize:])
+	return plaintext, nil
+}
@@ -0,0 +1,119 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func newKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSealOpen(t *testing.T) {
+	key := newKey(t)
+	for _, alg := range []Algorithm{AlgorithmAES256GCM, AlgorithmChaCha20Poly1305} {
+		plaintext := []byte("hello world")
+		ad := []byte("block 42")
+		ciphertext, err := Seal(alg, key, plaintext, ad)
+		if err != nil {
+			t.Errorf("Expected Seal with %s to succeed, but got error: %s", alg, err)
+			continue
+		}
+		if !IsVersioned(ciphertext) || Algorithm(ciphertext[4]) != alg {
+			t.Errorf("Expected ciphertext to carry a %s header, but got %x", alg, ciphertext[:HeaderSize])
+		}
+		decrypted, err := Open(key, ciphertext, ad)
+		if err != nil {
+			t.Errorf("Expected Open with %s to succeed, but got error: %s", alg, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("Expected decrypted text to match original plaintext, but got %s", decrypted)
+		}
+	}
+}
+
+func TestOpenWrongAD(t *testing.T) {
+	key := newKey(t)
+	ciphertext, err := Seal(AlgorithmAES256GCM, key, []byte("hello world"), []byte("block 42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(key, ciphertext, []byte("block 43")); err != ErrAuthentication {
+		t.Errorf("Expected Open to fail with ErrAuthentication for mismatched associated data, but got %v", err)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	key := newKey(t)
+	pe, err := NewPiEncryptionWithAlgorithm(key, AlgorithmChaCha20Poly1305)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := pe.Encrypt([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := pe.Decrypt(ciphertext); err != ErrAuthentication {
+		t.Errorf("Expected Decrypt to fail with ErrAuthentication for tampered ciphertext, but got %v", err)
+	}
+}
+
+func TestOpenAlgorithmSwap(t *testing.T) {
+	key := newKey(t)
+	ciphertext, err := Seal(AlgorithmChaCha20Poly1305, key, []byte("hello world"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext[4] = byte(AlgorithmAES256GCM)
+	if _, err := Open(key, ciphertext, nil); err == nil {
+		t.Errorf("Expected Open to fail when the algorithm identifier is changed, but got nil error")
+	}
+}
+
+func TestDecryptLegacyCFB(t *testing.T) {
+	key := newKey(t)
+	plaintext := []byte("hello world")
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := make([]byte, aes.BlockSize+len(plaintext))
+	copy(legacy, "0123456789abcdef")
+	cipher.NewCFBEncrypter(block, legacy[:aes.BlockSize]).XORKeyStream(legacy[aes.BlockSize:], plaintext)
+
+	pe, err := NewPiEncryption(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := pe.DecryptLegacy(legacy)
+	if err != nil {
+		t.Errorf("Expected DecryptLegacy to accept legacy ciphertext, but got error: %s", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Expected decrypted text to match original plaintext, but got %s", decrypted)
+	}
+	if _, err := pe.Decrypt(legacy); !errors.Is(err, ErrNotVersioned) {
+		t.Errorf("Expected Decrypt to reject legacy ciphertext with ErrNotVersioned, but got %v", err)
+	}
+	if _, err := pe.DecryptWithAD(legacy, nil); err == nil {
+		t.Errorf("Expected DecryptWithAD to reject legacy ciphertext, but got nil error")
+	}
+	if _, err := pe.Decrypt([]byte("not a ciphertext at all")); !errors.Is(err, ErrNotVersioned) {
+		t.Errorf("Expected Decrypt to reject unversioned data, but got %v", err)
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	if _, err := NewPiEncryptionWithAlgorithm(newKey(t), Algorithm(9)); err != ErrUnknownAlgorithm {
+		t.Errorf("Expected ErrUnknownAlgorithm, but got %v", err)
+	}
+}
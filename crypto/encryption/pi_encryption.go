@@ -1,9 +1,6 @@
 package encryption
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"io"
@@ -11,47 +8,55 @@ import (
 
 // PiEncryption is a struct that holds the encryption key and other parameters
 type PiEncryption struct {
-	key []byte
+	key       []byte
+	algorithm Algorithm
+	suite     *CipherSuite
 }
 
-// NewPiEncryption creates a new instance of PiEncryption
+// NewPiEncryption creates a new instance of PiEncryption using AES-256-GCM
 func NewPiEncryption(key []byte) (*PiEncryption, error) {
+	return NewPiEncryptionWithAlgorithm(key, AlgorithmAES256GCM)
+}
+
+// NewPiEncryptionWithAlgorithm creates a new instance of PiEncryption using the given AEAD algorithm
+func NewPiEncryptionWithAlgorithm(key []byte, alg Algorithm) (*PiEncryption, error) {
 	if len(key) != 32 {
 		return nil, errors.New("key must be 32 bytes long")
 	}
-	return &PiEncryption{key: key}, nil
-}
-
-// Encrypt encrypts a plaintext message using AES-256-CBC
-func (pe *PiEncryption) Encrypt(plaintext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(pe.key)
-	if err != nil {
+	if _, err := NewAEAD(alg, key); err != nil {
 		return nil, err
 	}
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	suite, err := NewCipherSuite(key)
+	if err != nil {
 		return nil, err
 	}
-	cfb := cipher.NewCFBEncrypter(block, iv)
-	cfb.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
-	return ciphertext, nil
+	return &PiEncryption{key: key, algorithm: alg, suite: suite}, nil
 }
 
-// Decrypt decrypts a ciphertext message using AES-256-CBC
+// Encrypt encrypts and authenticates a plaintext message, producing a versioned ciphertext
+func (pe *PiEncryption) Encrypt(plaintext []byte) ([]byte, error) {
+	return pe.EncryptWithAD(plaintext, nil)
+}
+
+// EncryptWithAD encrypts a plaintext message and authenticates it together with associated data
+func (pe *PiEncryption) EncryptWithAD(plaintext []byte, ad []byte) ([]byte, error) {
+	return Seal(pe.algorithm, pe.key, plaintext, ad)
+}
+
+// Decrypt authenticates and decrypts a versioned ciphertext. Anything else,
+// including legacy AES-CFB ciphertexts, is rejected with ErrNotVersioned.
 func (pe *PiEncryption) Decrypt(ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(pe.key)
-	if err != nil {
-		return nil, err
-	}
-	if len(ciphertext) < aes.BlockSize {
-		return nil, errors.New("ciphertext too short")
-	}
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-	cfb := cipher.NewCFBDecrypter(block, iv)
-	cfb.XORKeyStream(ciphertext, ciphertext)
-	return ciphertext, nil
+	return Open(pe.key, ciphertext, nil)
+}
+
+// DecryptLegacy decrypts an unauthenticated legacy AES-CFB ciphertext, see DecryptLegacy
+func (pe *PiEncryption) DecryptLegacy(ciphertext []byte) ([]byte, error) {
+	return DecryptLegacy(pe.key, ciphertext)
+}
+
+// DecryptWithAD decrypts a versioned ciphertext that was encrypted with the given associated data
+func (pe *PiEncryption) DecryptWithAD(ciphertext []byte, ad []byte) ([]byte, error) {
+	return Open(pe.key, ciphertext, ad)
 }
 
 // EncryptBase64 encrypts a plaintext message and returns the result as a base64-encoded string
@@ -71,3 +76,20 @@ func (pe *PiEncryption) DecryptBase64(ciphertext string) ([]byte, error) {
 	}
 	return pe.Decrypt(ciphertextBytes)
 }
+
+// EncryptWithMAC encrypts a plaintext message with the encrypt-then-MAC cipher suite and
+// returns the ciphertext together with its MAC, as expected by decryption.PiDecryption.DecryptWithMAC
+func (pe *PiEncryption) EncryptWithMAC(plaintext []byte) ([]byte, []byte, error) {
+	return pe.suite.Encrypt(plaintext)
+}
+
+// EncryptStream returns a writer that encrypts everything written to it into w in authenticated chunks.
+// The returned writer must be closed to complete the stream.
+func (pe *PiEncryption) EncryptStream(w io.Writer) (*EncryptWriter, error) {
+	return NewEncryptWriter(w, pe.key, pe.algorithm)
+}
+
+// DecryptStream returns a reader that decrypts a stream produced by EncryptStream
+func (pe *PiEncryption) DecryptStream(r io.Reader) (*DecryptReader, error) {
+	return NewDecryptReader(r, pe.key)
+}
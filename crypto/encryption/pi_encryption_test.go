@@ -1,6 +1,7 @@
 package encryption
 
 import (
+	"crypto/rand"
 	"testing"
 )
 
@@ -0,0 +1,263 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// StreamChunkSize is the default amount of plaintext sealed in each chunk of a stream
+const StreamChunkSize = 64 << 10
+
+// maxStreamChunkSize bounds the chunk size accepted from a stream header
+const maxStreamChunkSize = 16 << 20
+
+// streamMagic marks an encrypted stream, as opposed to a single Seal ciphertext
+var streamMagic = []byte{'P', 'I', 'S'}
+
+// The stream header is magic, version, algorithm, chunk size and nonce prefix
+const (
+	streamPrefixSize = 7
+	streamHeaderSize = 3 + 1 + 1 + 4 + streamPrefixSize
+)
+
+var (
+	// ErrStreamTruncated is returned when an encrypted stream ends before its final chunk
+	ErrStreamTruncated = errors.New("encrypted stream truncated")
+	// ErrStreamTooLong is returned when a stream would exceed the chunk counter
+	ErrStreamTooLong = errors.New("encrypted stream too long")
+)
+
+// streamCipher seals and opens the chunks of a stream. Each chunk nonce is
+// the random prefix, a big-endian chunk counter and a flag set only on the
+// final chunk, so chunks can't be reordered, dropped or cut short without
+// failing authentication. The stream header is the associated data of every
+// chunk.
+type streamCipher struct {
+	aead    cipher.AEAD
+	header  []byte
+	nonce   []byte
+	counter uint32
+	done    bool
+}
+
+// nextNonce returns the nonce for the next chunk and advances the counter
+func (sc *streamCipher) nextNonce(last bool) ([]byte, error) {
+	if sc.done {
+		return nil, ErrStreamTooLong
+	}
+	nonce := sc.nonceAt(sc.counter, last)
+	sc.counter++
+	if sc.counter == 0 {
+		sc.done = true
+	}
+	return nonce, nil
+}
+
+func (sc *streamCipher) nonceAt(counter uint32, last bool) []byte {
+	binary.BigEndian.PutUint32(sc.nonce[streamPrefixSize:], counter)
+	sc.nonce[len(sc.nonce)-1] = 0
+	if last {
+		sc.nonce[len(sc.nonce)-1] = 1
+	}
+	return sc.nonce
+}
+
+// EncryptWriter encrypts everything written to it into an underlying writer.
+// Close must be called to write the final chunk; without it the stream is
+// rejected as truncated.
+type EncryptWriter struct {
+	w         io.Writer
+	sc        *streamCipher
+	chunkSize int
+	buf       []byte
+	out       []byte
+	err       error
+}
+
+// NewEncryptWriter returns a writer that encrypts into w with the given algorithm
+// and the default chunk size
+func NewEncryptWriter(w io.Writer, key []byte, alg Algorithm) (*EncryptWriter, error) {
+	return NewEncryptWriterSize(w, key, alg, StreamChunkSize)
+}
+
+// NewEncryptWriterSize returns a writer that encrypts into w, sealing chunkSize bytes of plaintext per chunk
+func NewEncryptWriterSize(w io.Writer, key []byte, alg Algorithm, chunkSize int) (*EncryptWriter, error) {
+	if chunkSize <= 0 || chunkSize > maxStreamChunkSize {
+		return nil, errors.New("invalid stream chunk size")
+	}
+	aead, err := NewAEAD(alg, key)
+	if err != nil {
+		return nil, err
+	}
+	if aead.NonceSize() != streamPrefixSize+5 {
+		return nil, ErrUnknownAlgorithm
+	}
+	header := make([]byte, streamHeaderSize)
+	copy(header, streamMagic)
+	header[3] = HeaderVersion
+	header[4] = byte(alg)
+	binary.BigEndian.PutUint32(header[5:9], uint32(chunkSize))
+	if _, err := io.ReadFull(rand.Reader, header[9:]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, header[9:])
+	return &EncryptWriter{
+		w:         w,
+		sc:        &streamCipher{aead: aead, header: header, nonce: nonce},
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+		out:       make([]byte, 0, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Write encrypts p. A full chunk is only sealed once more data follows it,
+// because the final chunk has to be marked as such.
+func (ew *EncryptWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(ew.buf) == ew.chunkSize {
+			if err := ew.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(ew.buf[len(ew.buf):ew.chunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close seals the final chunk. It does not close the underlying writer.
+func (ew *EncryptWriter) Close() error {
+	if ew.err != nil {
+		return ew.err
+	}
+	if err := ew.flush(true); err != nil {
+		return err
+	}
+	ew.err = errors.New("write to closed encrypted stream")
+	return nil
+}
+
+func (ew *EncryptWriter) flush(last bool) error {
+	nonce, err := ew.sc.nextNonce(last)
+	if err != nil {
+		ew.err = err
+		return err
+	}
+	ew.out = ew.sc.aead.Seal(ew.out[:0], nonce, ew.buf, ew.sc.header)
+	ew.buf = ew.buf[:0]
+	if _, err := ew.w.Write(ew.out); err != nil {
+		ew.err = err
+		return err
+	}
+	return nil
+}
+
+// DecryptReader decrypts a stream written by EncryptWriter. Every chunk is
+// authenticated before any of its plaintext is returned, and the end of the
+// underlying reader is only reported as io.EOF after the final chunk.
+type DecryptReader struct {
+	r     *bufio.Reader
+	sc    *streamCipher
+	in    []byte
+	out   []byte
+	plain []byte
+	err   error
+}
+
+// NewDecryptReader reads the stream header from r and returns a reader of the decrypted stream
+func NewDecryptReader(r io.Reader, key []byte) (*DecryptReader, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrStreamTruncated
+		}
+		return nil, err
+	}
+	if !bytes.Equal(header[:3], streamMagic) || header[3] != HeaderVersion {
+		return nil, errors.New("not an encrypted stream")
+	}
+	chunkSize := int(binary.BigEndian.Uint32(header[5:9]))
+	if chunkSize <= 0 || chunkSize > maxStreamChunkSize {
+		return nil, errors.New("invalid stream chunk size")
+	}
+	aead, err := NewAEAD(Algorithm(header[4]), key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, header[9:])
+	return &DecryptReader{
+		r:   bufio.NewReaderSize(r, chunkSize+aead.Overhead()+1),
+		sc:  &streamCipher{aead: aead, header: header, nonce: nonce},
+		in:  make([]byte, chunkSize+aead.Overhead()),
+		out: make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// Read reads decrypted data into p
+func (dr *DecryptReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		dr.err = dr.next()
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+// next reads, authenticates and decrypts the next chunk. A chunk is the last
+// one exactly when nothing follows it in the underlying reader.
+func (dr *DecryptReader) next() error {
+	n, err := io.ReadFull(dr.r, dr.in)
+	if err == io.EOF {
+		return ErrStreamTruncated
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		if _, err := dr.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	nonce, err := dr.sc.nextNonce(last)
+	if err != nil {
+		return err
+	}
+	dr.plain, err = dr.sc.aead.Open(dr.out[:0], nonce, dr.in[:n], dr.sc.header)
+	if err != nil {
+		// A stream cut at a chunk boundary ends in a chunk that was
+		// sealed without the final flag
+		if last {
+			middle := dr.sc.nonceAt(dr.sc.counter-1, false)
+			if _, err := dr.sc.aead.Open(nil, middle, dr.in[:n], dr.sc.header); err == nil {
+				return ErrStreamTruncated
+			}
+		}
+		return ErrAuthentication
+	}
+	if last {
+		return io.EOF
+	}
+	return nil
+}
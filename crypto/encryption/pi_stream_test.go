@@ -0,0 +1,221 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func encryptStream(t *testing.T, key []byte, alg Algorithm, chunkSize int, plaintext []byte) []byte {
+	var buf bytes.Buffer
+	ew, err := NewEncryptWriterSize(&buf, key, alg, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write in uneven pieces so chunk boundaries don't line up with writes
+	for p := plaintext; len(p) > 0; {
+		n := 7
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := ew.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStream(key []byte, ciphertext []byte) ([]byte, error) {
+	dr, err := NewDecryptReader(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(dr)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := newKey(t)
+	for _, alg := range []Algorithm{AlgorithmAES256GCM, AlgorithmChaCha20Poly1305} {
+		for _, size := range []int{0, 1, 63, 64, 65, 128, 1000} {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+			ciphertext := encryptStream(t, key, alg, 64, plaintext)
+			decrypted, err := decryptStream(key, ciphertext)
+			if err != nil {
+				t.Errorf("Expected %s stream of %d bytes to decrypt, but got error: %s", alg, size, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("Expected %s stream of %d bytes to match original plaintext", alg, size)
+			}
+		}
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	key := newKey(t)
+	plaintext := make([]byte, 256)
+	ciphertext := encryptStream(t, key, AlgorithmAES256GCM, 64, plaintext)
+	chunk := 64 + 16
+
+	// Dropping the final chunk leaves a stream that ends on a chunk boundary
+	_, err := decryptStream(key, ciphertext[:len(ciphertext)-chunk])
+	if err != ErrStreamTruncated {
+		t.Errorf("Expected ErrStreamTruncated when the final chunk is dropped, but got %v", err)
+	}
+	_, err = decryptStream(key, ciphertext[:streamHeaderSize])
+	if err != ErrStreamTruncated {
+		t.Errorf("Expected ErrStreamTruncated for a stream with no chunks, but got %v", err)
+	}
+	_, err = decryptStream(key, ciphertext[:len(ciphertext)-3])
+	if err == nil {
+		t.Errorf("Expected Decrypt to fail for a stream cut inside a chunk, but got nil error")
+	}
+}
+
+func TestStreamReordered(t *testing.T) {
+	key := newKey(t)
+	plaintext := make([]byte, 256)
+	rand.Read(plaintext)
+	ciphertext := encryptStream(t, key, AlgorithmChaCha20Poly1305, 64, plaintext)
+	chunk := 64 + 16
+
+	swapped := append([]byte{}, ciphertext...)
+	first := swapped[streamHeaderSize : streamHeaderSize+chunk]
+	second := append([]byte{}, swapped[streamHeaderSize+chunk:streamHeaderSize+2*chunk]...)
+	copy(swapped[streamHeaderSize+chunk:], first)
+	copy(swapped[streamHeaderSize:], second)
+	if _, err := decryptStream(key, swapped); err != ErrAuthentication {
+		t.Errorf("Expected ErrAuthentication for reordered chunks, but got %v", err)
+	}
+
+	tampered := append([]byte{}, ciphertext...)
+	tampered[5] ^= 1
+	if _, err := decryptStream(key, tampered); err == nil {
+		t.Errorf("Expected Decrypt to fail for a modified header, but got nil error")
+	}
+}
+
+func TestStreamUnclosed(t *testing.T) {
+	key := newKey(t)
+	var buf bytes.Buffer
+	ew, err := NewEncryptWriterSize(&buf, key, AlgorithmAES256GCM, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ew.Write(make([]byte, 200)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptStream(key, buf.Bytes()); err != ErrStreamTruncated {
+		t.Errorf("Expected ErrStreamTruncated for a writer that was never closed, but got %v", err)
+	}
+}
+
+func TestPiEncryptionStream(t *testing.T) {
+	pe, err := NewPiEncryption(newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := make([]byte, 3*StreamChunkSize+17)
+	rand.Read(plaintext)
+	var buf bytes.Buffer
+	ew, err := pe.EncryptStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ew, bytes.NewReader(plaintext)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dr, err := pe.DecryptStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := ioutil.ReadAll(dr)
+	if err != nil {
+		t.Errorf("Expected DecryptStream to succeed, but got error: %s", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Expected decrypted stream to match original plaintext")
+	}
+}
+
+// zeroReader is an endless source of zero bytes for benchmarks
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+var streamBenchmarkSizes = []int64{1 << 20, 64 << 20, 1 << 30, 4 << 30}
+
+func BenchmarkEncryptStream(b *testing.B) {
+	key := make([]byte, 32)
+	for _, alg := range []Algorithm{AlgorithmAES256GCM, AlgorithmChaCha20Poly1305} {
+		for _, size := range streamBenchmarkSizes {
+			b.Run(fmt.Sprintf("%s/%dMiB", alg, size>>20), func(b *testing.B) {
+				if size > 64<<20 && testing.Short() {
+					b.Skip("skipping multi-GB benchmark in short mode")
+				}
+				b.SetBytes(size)
+				for i := 0; i < b.N; i++ {
+					ew, err := NewEncryptWriter(ioutil.Discard, key, alg)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := io.Copy(ew, io.LimitReader(zeroReader{}, size)); err != nil {
+						b.Fatal(err)
+					}
+					if err := ew.Close(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecryptStream(b *testing.B) {
+	key := make([]byte, 32)
+	for _, size := range streamBenchmarkSizes {
+		b.Run(fmt.Sprintf("%dMiB", size>>20), func(b *testing.B) {
+			if size > 64<<20 && testing.Short() {
+				b.Skip("skipping multi-GB benchmark in short mode")
+			}
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				// Encrypt and decrypt through a pipe so multi-GB inputs never
+				// have to be held in memory
+				pr, pw := io.Pipe()
+				go func() {
+					ew, err := NewEncryptWriter(pw, key, AlgorithmAES256GCM)
+					if err == nil {
+						_, err = io.Copy(ew, io.LimitReader(zeroReader{}, size))
+					}
+					if err == nil {
+						err = ew.Close()
+					}
+					pw.CloseWithError(err)
+				}()
+				dr, err := NewDecryptReader(pr, key)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
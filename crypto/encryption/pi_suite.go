@@ -0,0 +1,98 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// MACSize is the length of the HMAC-SHA256 tag produced by CipherSuite
+const MACSize = sha256.Size
+
+// HKDF info strings separating the keys derived from the master key
+var (
+	suiteEncInfo = []byte("pi/crypto/suite/v1/enc")
+	suiteMACInfo = []byte("pi/crypto/suite/v1/mac")
+)
+
+// ErrMACMismatch is returned when a ciphertext doesn't match its MAC
+var ErrMACMismatch = errors.New("MAC verification failed")
+
+// CipherSuite implements encrypt-then-MAC with AES-256-CTR and HMAC-SHA256.
+// Independent encryption and MAC keys are derived from the master key with
+// HKDF, and the MAC covers the IV and ciphertext rather than the plaintext.
+// It is shared by PiEncryption and decryption.PiDecryption so both ends
+// agree on the construction.
+type CipherSuite struct {
+	encKey []byte
+	macKey []byte
+}
+
+// NewCipherSuite derives the encryption and MAC keys from a 32-byte master key
+func NewCipherSuite(key []byte) (*CipherSuite, error) {
+	if len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes long")
+	}
+	encKey, err := deriveKey(key, suiteEncInfo)
+	if err != nil {
+		return nil, err
+	}
+	macKey, err := deriveKey(key, suiteMACInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &CipherSuite{encKey: encKey, macKey: macKey}, nil
+}
+
+func deriveKey(master []byte, info []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, nil, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Encrypt encrypts plaintext and returns the IV-prefixed ciphertext and its MAC
+func (cs *CipherSuite) Encrypt(plaintext []byte) ([]byte, []byte, error) {
+	block, err := aes.NewCipher(cs.encKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
+	iv := ciphertext[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, err
+	}
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+	return ciphertext, cs.MAC(ciphertext), nil
+}
+
+// Decrypt verifies the MAC in constant time and only then decrypts the ciphertext
+func (cs *CipherSuite) Decrypt(ciphertext []byte, mac []byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	if !hmac.Equal(cs.MAC(ciphertext), mac) {
+		return nil, ErrMACMismatch
+	}
+	block, err := aes.NewCipher(cs.encKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	cipher.NewCTR(block, ciphertext[:aes.BlockSize]).XORKeyStream(plaintext, ciphertext[aes.BlockSize:])
+	return plaintext, nil
+}
+
+// MAC computes the HMAC-SHA256 tag of an IV-prefixed ciphertext
+func (cs *CipherSuite) MAC(ciphertext []byte) []byte {
+	mac := hmac.New(sha256.New, cs.macKey)
+	mac.Write(ciphertext)
+	return mac.Sum(nil)
+}
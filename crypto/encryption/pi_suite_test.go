@@ -0,0 +1,76 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCipherSuiteRoundTrip(t *testing.T) {
+	cs, err := NewCipherSuite(newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("hello world")
+	ciphertext, mac, err := cs.Encrypt(plaintext)
+	if err != nil {
+		t.Errorf("Expected Encrypt to succeed, but got error: %s", err)
+	}
+	if len(mac) != MACSize {
+		t.Errorf("Expected a %d byte MAC, but got %d bytes", MACSize, len(mac))
+	}
+	decrypted, err := cs.Decrypt(ciphertext, mac)
+	if err != nil {
+		t.Errorf("Expected Decrypt to succeed, but got error: %s", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Expected decrypted text to match original plaintext, but got %s", decrypted)
+	}
+}
+
+func TestCipherSuiteSeparateKeys(t *testing.T) {
+	cs, err := NewCipherSuite(newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(cs.encKey, cs.macKey) {
+		t.Errorf("Expected encryption and MAC keys to differ")
+	}
+}
+
+func TestCipherSuiteRejectsTampering(t *testing.T) {
+	cs, err := NewCipherSuite(newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, mac, err := cs.Encrypt([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext[0] ^= 1
+	if _, err := cs.Decrypt(ciphertext, mac); err != ErrMACMismatch {
+		t.Errorf("Expected Decrypt to fail with ErrMACMismatch for a modified IV, but got %v", err)
+	}
+	ciphertext[0] ^= 1
+	mac[0] ^= 1
+	if _, err := cs.Decrypt(ciphertext, mac); err != ErrMACMismatch {
+		t.Errorf("Expected Decrypt to fail with ErrMACMismatch for a modified MAC, but got %v", err)
+	}
+}
+
+func TestCipherSuiteWrongKey(t *testing.T) {
+	cs, err := NewCipherSuite(newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewCipherSuite(newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, mac, err := cs.Encrypt([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Decrypt(ciphertext, mac); err != ErrMACMismatch {
+		t.Errorf("Expected Decrypt with another key to fail with ErrMACMismatch, but got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package hdwallet
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Hierarchical deterministic keys. One BIP-39 mnemonic gives a seed, and
+// SLIP-10 derives keys for any curve from it. For secp256k1 SLIP-10 is the
+// same as BIP-32, so derived Cosmos keys match other wallets; Ed25519 only
+// supports hardened derivation.
+
+// Curve is an elliptic curve keys can be derived on
+type Curve int
+
+// Supported curves
+const (
+	Secp256k1 Curve = iota + 1
+	NIST256p1
+	Ed25519
+)
+
+// HardenedOffset is added to a child index for hardened derivation
+const HardenedOffset uint32 = 0x80000000
+
+var (
+	// ErrInvalidMnemonic is returned for mnemonics with unknown words or a bad checksum
+	ErrInvalidMnemonic = errors.New("hdwallet: invalid mnemonic")
+
+	// ErrNonHardenedDerivation is returned when deriving a non-hardened Ed25519 child
+	ErrNonHardenedDerivation = errors.New("hdwallet: ed25519 supports hardened derivation only")
+
+	// ErrUnsupportedCurve is returned for curves outside this package
+	ErrUnsupportedCurve = errors.New("hdwallet: unsupported curve")
+)
+
+// String returns the curve name
+func (c Curve) String() string {
+	switch c {
+	case Secp256k1:
+		return "secp256k1"
+	case NIST256p1:
+		return "nist256p1"
+	case Ed25519:
+		return "ed25519"
+	default:
+		return fmt.Sprintf("curve(%d)", int(c))
+	}
+}
+
+// masterSecret is the HMAC key used to derive a master key, from SLIP-10
+func (c Curve) masterSecret() []byte {
+	switch c {
+	case Secp256k1:
+		return []byte("Bitcoin seed")
+	case NIST256p1:
+		return []byte("Nist256p1 seed")
+	default:
+		return []byte("ed25519 seed")
+	}
+}
+
+// ecdsa returns the curve of an ECDSA key, or nil for Ed25519
+func (c Curve) ecdsa() elliptic.Curve {
+	switch c {
+	case Secp256k1:
+		return secp256k1.S256()
+	case NIST256p1:
+		return elliptic.P256()
+	default:
+		return nil
+	}
+}
+
+// NewMnemonic generates a BIP-39 mnemonic with the given entropy in bits,
+// which must be a multiple of 32 between 128 and 256. 256 bits give 24 words.
+func NewMnemonic(bits int) (string, error) {
+	entropy, err := bip39.NewEntropy(bits)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// ValidateMnemonic checks that every word is in the English wordlist and the checksum matches
+func ValidateMnemonic(mnemonic string) error {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return ErrInvalidMnemonic
+	}
+	return nil
+}
+
+// Seed validates a mnemonic and returns its 64-byte BIP-39 seed. The
+// passphrase is optional; a different passphrase gives a different wallet.
+func Seed(mnemonic string, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	return bip39.NewSeed(mnemonic, passphrase), nil
+}
+
+// Key is an extended private key: a private key and the chain code needed to
+// derive its children
+type Key struct {
+	Curve     Curve
+	Depth     uint8
+	Index     uint32
+	key       []byte
+	chainCode []byte
+}
+
+// NewMasterKey derives the master key of a seed on curve
+func NewMasterKey(seed []byte, curve Curve) (*Key, error) {
+	if curve != Secp256k1 && curve != NIST256p1 && curve != Ed25519 {
+		return nil, ErrUnsupportedCurve
+	}
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, curve.masterSecret())
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		k := &Key{Curve: curve, key: sum[:32], chainCode: sum[32:]}
+		if curve == Ed25519 || validScalar(curve, new(big.Int).SetBytes(k.key)) {
+			return k, nil
+		}
+		data = sum
+	}
+}
+
+// Child derives the child key at index. Indices from HardenedOffset up are
+// hardened: their public keys can't be derived from the parent public key.
+func (k *Key) Child(index uint32) (*Key, error) {
+	hardened := index >= HardenedOffset
+	if k.Curve == Ed25519 && !hardened {
+		return nil, ErrNonHardenedDerivation
+	}
+	data := make([]byte, 0, 37)
+	if hardened {
+		data = append(append(data, 0), k.key...)
+	} else {
+		data = append(data, k.publicKey()...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	child := &Key{Curve: k.Curve, Depth: k.Depth + 1, Index: index}
+	for {
+		mac := hmac.New(sha512.New, k.chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		child.chainCode = sum[32:]
+		if k.Curve == Ed25519 {
+			child.key = sum[:32]
+			return child, nil
+		}
+		n := k.Curve.ecdsa().Params().N
+		il := new(big.Int).SetBytes(sum[:32])
+		if il.Cmp(n) < 0 {
+			scalar := il.Add(il, new(big.Int).SetBytes(k.key))
+			scalar.Mod(scalar, n)
+			if scalar.Sign() != 0 {
+				child.key = scalar.FillBytes(make([]byte, 32))
+				return child, nil
+			}
+		}
+		// Out of range, which is astronomically unlikely: retry as SLIP-10 specifies
+		data = append(append([]byte{1}, sum[32:]...), data[len(data)-4:]...)
+	}
+}
+
+// Derive follows a derivation path such as "m/44'/118'/0'/0/0" from this
+// key, which must be the master key
+func (k *Key) Derive(path string) (*Key, error) {
+	indices, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	key := k
+	for _, index := range indices {
+		key, err = key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// ChainCode returns the chain code of the key
+func (k *Key) ChainCode() []byte {
+	return append([]byte(nil), k.chainCode...)
+}
+
+// PublicKeyBytes returns the compressed public key for ECDSA curves, or the
+// 32-byte public key for Ed25519
+func (k *Key) PublicKeyBytes() []byte {
+	return k.publicKey()
+}
+
+// PrivateKey returns the key as an *ecdsa.PrivateKey or ed25519.PrivateKey,
+// ready for crypto/utils.NewMemorySigner
+func (k *Key) PrivateKey() crypto.Signer {
+	if k.Curve == Ed25519 {
+		return ed25519.NewKeyFromSeed(k.key)
+	}
+	if k.Curve == Secp256k1 {
+		return secp256k1.PrivKeyFromBytes(k.key).ToECDSA()
+	}
+	curve := k.Curve.ecdsa()
+	priv := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(k.key)}
+	priv.Curve = curve
+	priv.X, priv.Y = curve.ScalarBaseMult(k.key)
+	return priv
+}
+
+func (k *Key) publicKey() []byte {
+	switch k.Curve {
+	case Ed25519:
+		return ed25519.NewKeyFromSeed(k.key).Public().(ed25519.PublicKey)
+	case Secp256k1:
+		return secp256k1.PrivKeyFromBytes(k.key).PubKey().SerializeCompressed()
+	default:
+		x, y := elliptic.P256().ScalarBaseMult(k.key)
+		return elliptic.MarshalCompressed(elliptic.P256(), x, y)
+	}
+}
+
+func validScalar(curve Curve, s *big.Int) bool {
+	return s.Sign() != 0 && s.Cmp(curve.ecdsa().Params().N) < 0
+}
@@ -0,0 +1,146 @@
+package hdwallet
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	cryptoutils "pi/crypto/utils"
+)
+
+// Test vector 1 from BIP-32 and SLIP-10
+var testSeed, _ = hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+func TestNewMasterKey(t *testing.T) {
+	tests := []struct {
+		curve     Curve
+		chainCode string
+		key       string
+		publicKey string
+	}{
+		{Secp256k1, "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35", "0339a36013301597daef41fbe593a02cc513d0b55527ec2df1050e2e8ff49c85c2"},
+		{NIST256p1, "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2", "0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8"},
+		{Ed25519, "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb", "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7", "a4b2856bfec510abab89753fac1ac0e1112364e7d250545963f135f2a33188ed"},
+	}
+	for _, test := range tests {
+		master, err := NewMasterKey(testSeed, test.curve)
+		if err != nil {
+			t.Errorf("Expected NewMasterKey on %s to succeed, but got error: %s", test.curve, err)
+			continue
+		}
+		if got := hex.EncodeToString(master.ChainCode()); got != test.chainCode {
+			t.Errorf("Expected %s master chain code %s, but got %s", test.curve, test.chainCode, got)
+		}
+		if got := hex.EncodeToString(master.key); got != test.key {
+			t.Errorf("Expected %s master key %s, but got %s", test.curve, test.key, got)
+		}
+		if got := hex.EncodeToString(master.PublicKeyBytes()); got != test.publicKey {
+			t.Errorf("Expected %s master public key %s, but got %s", test.curve, test.publicKey, got)
+		}
+	}
+}
+
+func TestDerive(t *testing.T) {
+	tests := []struct {
+		curve     Curve
+		path      string
+		chainCode string
+		key       string
+	}{
+		{Secp256k1, "m/0'/1/2'/2/1000000000", "c783e67b921d2beb8f6b389cc646d7263b4145701dadd2161548a8b078e65e9e", "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8"},
+		{NIST256p1, "m/0'/1/2'/2/1000000000", "b9b7b82d326bb9cb5b5b121066feea4eb93d5241103c9e7a18aad40f1dde8059", "21c4f269ef0a5fd1badf47eeacebeeaa3de22eb8e5b0adcd0f27dd99d34d0119"},
+		{Ed25519, "m/0'/1'/2'/2'/1000000000'", "68789923a0cac2cd5a29172a475fe9e0fb14cd6adb5ad98a3fa70333e7afa230", "8f94d394a8e8fd6b1bc2f3f49f5c47e385281d5c17e65324b0f62483e37e8793"},
+	}
+	for _, test := range tests {
+		master, err := NewMasterKey(testSeed, test.curve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := master.Derive(test.path)
+		if err != nil {
+			t.Errorf("Expected Derive %s on %s to succeed, but got error: %s", test.path, test.curve, err)
+			continue
+		}
+		if key.Depth != 5 {
+			t.Errorf("Expected depth 5, but got %d", key.Depth)
+		}
+		if got := hex.EncodeToString(key.ChainCode()); got != test.chainCode {
+			t.Errorf("Expected %s chain code %s at %s, but got %s", test.curve, test.chainCode, test.path, got)
+		}
+		if got := hex.EncodeToString(key.key); got != test.key {
+			t.Errorf("Expected %s key %s at %s, but got %s", test.curve, test.key, test.path, got)
+		}
+	}
+}
+
+func TestDeriveEd25519NonHardened(t *testing.T) {
+	master, err := NewMasterKey(testSeed, Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := master.Derive("m/0'/1"); err != ErrNonHardenedDerivation {
+		t.Errorf("Expected ErrNonHardenedDerivation, but got %v", err)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	// BIP-39 test vector with passphrase TREZOR
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	seed, err := Seed(mnemonic, "TREZOR")
+	if err != nil {
+		t.Fatalf("Expected Seed to succeed, but got error: %s", err)
+	}
+	expected := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if got := hex.EncodeToString(seed); got != expected {
+		t.Errorf("Expected seed %s, but got %s", expected, got)
+	}
+
+	// Swapping the last word breaks the checksum
+	if _, err := Seed(strings.Replace(mnemonic, "about", "abandon", 1), ""); err != ErrInvalidMnemonic {
+		t.Errorf("Expected ErrInvalidMnemonic for a bad checksum, but got %v", err)
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	mnemonic, err := NewMnemonic(256)
+	if err != nil {
+		t.Fatalf("Expected NewMnemonic to succeed, but got error: %s", err)
+	}
+	if words := len(strings.Fields(mnemonic)); words != 24 {
+		t.Errorf("Expected 24 words, but got %d", words)
+	}
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		t.Errorf("Expected a generated mnemonic to be valid, but got error: %s", err)
+	}
+	if _, err := NewMnemonic(100); err == nil {
+		t.Errorf("Expected NewMnemonic to reject 100 bits of entropy")
+	}
+}
+
+func TestPrivateKeySigns(t *testing.T) {
+	for _, curve := range []Curve{Secp256k1, NIST256p1, Ed25519} {
+		master, err := NewMasterKey(testSeed, curve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := cryptoutils.NewMemorySigner(master.PrivateKey())
+		if err != nil {
+			t.Errorf("Expected a %s key to make a signer, but got error: %s", curve, err)
+			continue
+		}
+		signature, err := cryptoutils.Sign(signer, []byte("hello world"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cryptoutils.Verify(signer.PublicKey(), []byte("hello world"), signature); err != nil {
+			t.Errorf("Expected a %s signature to verify, but got error: %s", curve, err)
+		}
+		encoded, err := cryptoutils.EncodePublicKey(signer.PublicKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curve != NIST256p1 && hex.EncodeToString(encoded[1:]) != hex.EncodeToString(master.PublicKeyBytes()) {
+			t.Errorf("Expected the signer's %s public key to match PublicKeyBytes", curve)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package hdwallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPath is returned for derivation paths that don't parse
+var ErrInvalidPath = errors.New("hdwallet: invalid derivation path")
+
+// Chain is a blockchain with its BIP-44 coin type and the curve its accounts use
+type Chain struct {
+	Name     string
+	CoinType uint32
+	Curve    Curve
+	// hardenedLeaf is set when change and index must be hardened too, as for Ed25519
+	hardenedLeaf bool
+}
+
+// Chains our accounts live on. Pi keys are NIST P-256 as used by the Pi
+// network node. Ethereum keys follow BIP-44 like MetaMask does, which is also
+// how Ethereum-compatible Substrate chains derive their secp256k1 accounts.
+//
+// Polkadot keys are SLIP-10 Ed25519 keys on the fully hardened BIP-44 path
+// of coin type 354. Neither polkadot.js, which derives sr25519 keys with
+// substrate-bip39, nor the Ledger app, which uses BIP32-Ed25519, derives the
+// same accounts from a mnemonic, so they can't be used to restore them.
+var (
+	ChainPi       = Chain{Name: "pi", CoinType: 314159, Curve: NIST256p1}
+	ChainCosmos   = Chain{Name: "cosmos", CoinType: 118, Curve: Secp256k1}
+	ChainEthereum = Chain{Name: "ethereum", CoinType: 60, Curve: Secp256k1}
+	ChainPolkadot = Chain{Name: "polkadot", CoinType: 354, Curve: Ed25519, hardenedLeaf: true}
+)
+
+// Path returns the BIP-44 path of an account's key, m/44'/coin'/account'/0/index
+func (c Chain) Path(account uint32, index uint32) string {
+	if c.hardenedLeaf {
+		return fmt.Sprintf("m/44'/%d'/%d'/0'/%d'", c.CoinType, account, index)
+	}
+	return fmt.Sprintf("m/44'/%d'/%d'/0/%d", c.CoinType, account, index)
+}
+
+// DeriveAccount derives the key of an account on chain from a BIP-39 seed
+func DeriveAccount(seed []byte, chain Chain, account uint32, index uint32) (*Key, error) {
+	master, err := NewMasterKey(seed, chain.Curve)
+	if err != nil {
+		return nil, err
+	}
+	return master.Derive(chain.Path(account, index))
+}
+
+// ParsePath parses a derivation path such as "m/44'/118'/0'/0/0" into child
+// indices. Hardened components are marked with ' or h.
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("%w: %q must start with m", ErrInvalidPath, path)
+	}
+	indices := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		offset := uint32(0)
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") {
+			offset = HardenedOffset
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedOffset {
+			return nil, fmt.Errorf("%w: bad component %q in %q", ErrInvalidPath, part, path)
+		}
+		indices = append(indices, uint32(index)+offset)
+	}
+	return indices, nil
+}
@@ -0,0 +1,115 @@
+package hdwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	indices, err := ParsePath("m/44'/118h/0'/0/7")
+	if err != nil {
+		t.Fatalf("Expected ParsePath to succeed, but got error: %s", err)
+	}
+	expected := []uint32{44 + HardenedOffset, 118 + HardenedOffset, HardenedOffset, 0, 7}
+	if len(indices) != len(expected) {
+		t.Fatalf("Expected %d indices, but got %d", len(expected), len(indices))
+	}
+	for i := range expected {
+		if indices[i] != expected[i] {
+			t.Errorf("Expected index %d to be %d, but got %d", i, expected[i], indices[i])
+		}
+	}
+
+	if indices, err := ParsePath("m"); err != nil || len(indices) != 0 {
+		t.Errorf("Expected m to be the empty path, but got %v, %v", indices, err)
+	}
+	for _, path := range []string{"", "44'/0'", "m/", "m/x", "m/2147483648", "m/-1"} {
+		if _, err := ParsePath(path); err == nil {
+			t.Errorf("Expected ParsePath to reject %q", path)
+		}
+	}
+}
+
+func TestChainPath(t *testing.T) {
+	tests := map[string]string{
+		ChainPi.Path(0, 0):       "m/44'/314159'/0'/0/0",
+		ChainCosmos.Path(0, 0):   "m/44'/118'/0'/0/0",
+		ChainEthereum.Path(0, 3): "m/44'/60'/0'/0/3",
+		ChainPolkadot.Path(1, 2): "m/44'/354'/1'/0'/2'",
+	}
+	for got, expected := range tests {
+		if got != expected {
+			t.Errorf("Expected path %s, but got %s", expected, got)
+		}
+	}
+}
+
+func TestDeriveAccount(t *testing.T) {
+	seed, err := Seed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DeriveAccount(seed, ChainCosmos, 0, 0)
+	if err != nil {
+		t.Fatalf("Expected DeriveAccount to succeed, but got error: %s", err)
+	}
+	master, err := NewMasterKey(seed, Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := master.Derive("m/44'/118'/0'/0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key.key, expected.key) {
+		t.Errorf("Expected the Cosmos account to be derived at m/44'/118'/0'/0/0")
+	}
+
+	// Each chain gets its own key from the same seed
+	seen := make(map[string]string)
+	for _, chain := range []Chain{ChainPi, ChainCosmos, ChainEthereum, ChainPolkadot} {
+		key, err := DeriveAccount(seed, chain, 0, 0)
+		if err != nil {
+			t.Errorf("Expected DeriveAccount on %s to succeed, but got error: %s", chain.Name, err)
+			continue
+		}
+		if key.Curve != chain.Curve {
+			t.Errorf("Expected a %s key for %s, but got %s", chain.Curve, chain.Name, key.Curve)
+		}
+		if other, ok := seen[string(key.key)]; ok {
+			t.Errorf("Expected %s and %s to get different keys", chain.Name, other)
+		}
+		seen[string(key.key)] = chain.Name
+	}
+}
+
+func TestDeriveAccountVectors(t *testing.T) {
+	seed, err := Seed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		chain     Chain
+		key       string
+		publicKey string
+	}{
+		// The first MetaMask account of this mnemonic, address 0x9858EfFD232B4033E47d90003D41EC34EcaEda94
+		{ChainEthereum, "1ab42cc412b618bdea3a599e3c9bae199ebf030895b039e9db1e30dafb12b727", "0237b0bb7a8288d38ed49a524b5dc98cff3eb5ca824c9f9dc0dfdb3d9cd600f299"},
+		// SLIP-10 Ed25519 at m/44'/354'/0'/0'/0'
+		{ChainPolkadot, "19361288ec9af79fd1ad38c5ed65418ca9f435367b174e6ac9cdde85dacb42d4", "8ebb52da3030f06e0c0c5f7d0fbacf6a22cedb1229bb4824a230fbe84bf89304"},
+	}
+	for _, test := range tests {
+		key, err := DeriveAccount(seed, test.chain, 0, 0)
+		if err != nil {
+			t.Errorf("Expected DeriveAccount on %s to succeed, but got error: %s", test.chain.Name, err)
+			continue
+		}
+		if got := hex.EncodeToString(key.key); got != test.key {
+			t.Errorf("Expected %s key %s, but got %s", test.chain.Name, test.key, got)
+		}
+		if got := hex.EncodeToString(key.PublicKeyBytes()); got != test.publicKey {
+			t.Errorf("Expected %s public key %s, but got %s", test.chain.Name, test.publicKey, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Supported key derivation functions
+const (
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+)
+
+// KeySize is the length of derived keys, as expected by encryption.NewPiEncryption
+const KeySize = 32
+
+// SaltSize is the length of freshly generated salts
+const SaltSize = 16
+
+// Upper bounds on parameters read from files, so a crafted keystore can't
+// make the node allocate unbounded memory or spin for hours while unlocking it
+const (
+	maxArgon2Time   = 32
+	maxArgon2Memory = 4 << 20 // KiB
+	maxScryptN      = 1 << 22
+)
+
+var (
+	// ErrUnsupportedKDF is returned for key derivation functions this package doesn't implement
+	ErrUnsupportedKDF = errors.New("unsupported key derivation function")
+	// ErrInvalidKDFParams is returned when stored parameters are missing or out of range
+	ErrInvalidKDFParams = errors.New("invalid key derivation parameters")
+)
+
+// KDFParams holds the function, salt and cost parameters needed to derive
+// the same key from a password again. It is stored alongside the data it
+// protects.
+type KDFParams struct {
+	Name string `json:"name"`
+	Salt string `json:"salt"`
+
+	// Argon2id parameters, Memory is in KiB
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+
+	// scrypt parameters
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+}
+
+// NewArgon2idParams returns the recommended Argon2id parameters with a fresh salt
+func NewArgon2idParams() (*KDFParams, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return nil, err
+	}
+	return &KDFParams{Name: KDFArgon2id, Salt: salt, Time: 3, Memory: 64 << 10, Threads: 4}, nil
+}
+
+// NewScryptParams returns the recommended scrypt parameters with a fresh salt
+func NewScryptParams() (*KDFParams, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return nil, err
+	}
+	return &KDFParams{Name: KDFScrypt, Salt: salt, N: 1 << 18, R: 8, P: 1}, nil
+}
+
+func newSalt() (string, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// DeriveKey derives a KeySize-byte key from the password
+func (p *KDFParams) DeriveKey(password []byte) ([]byte, error) {
+	salt, err := hex.DecodeString(p.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("%w: bad salt", ErrInvalidKDFParams)
+	}
+	switch p.Name {
+	case KDFArgon2id:
+		if p.Time == 0 || p.Time > maxArgon2Time || p.Memory == 0 || p.Threads == 0 || p.Memory > maxArgon2Memory {
+			return nil, ErrInvalidKDFParams
+		}
+		return argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, KeySize), nil
+	case KDFScrypt:
+		if p.N <= 1 || p.N > maxScryptN || p.R <= 0 || p.P <= 0 {
+			return nil, ErrInvalidKDFParams
+		}
+		return scrypt.Key(password, salt, p.N, p.R, p.P, KeySize)
+	default:
+		return nil, ErrUnsupportedKDF
+	}
+}
+
+// DeriveKey derives a fresh key from the password with the default Argon2id
+// parameters. The returned parameters must be stored to derive it again.
+func DeriveKey(password []byte) ([]byte, *KDFParams, error) {
+	params, err := NewArgon2idParams()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := params.DeriveKey(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, params, nil
+}
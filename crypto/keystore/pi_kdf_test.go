@@ -0,0 +1,78 @@
+package keystore
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Cheap parameters so the tests don't spend seconds deriving keys
+func testArgon2idParams() *KDFParams {
+	return &KDFParams{Name: KDFArgon2id, Salt: "000102030405060708090a0b0c0d0e0f", Time: 1, Memory: 64, Threads: 1}
+}
+
+func testScryptParams() *KDFParams {
+	return &KDFParams{Name: KDFScrypt, Salt: "000102030405060708090a0b0c0d0e0f", N: 16, R: 8, P: 1}
+}
+
+func TestDeriveKeyDeterministic(t *testing.T) {
+	for _, params := range []*KDFParams{testArgon2idParams(), testScryptParams()} {
+		key1, err := params.DeriveKey([]byte("password"))
+		if err != nil {
+			t.Errorf("Expected DeriveKey with %s to succeed, but got error: %s", params.Name, err)
+			continue
+		}
+		if len(key1) != KeySize {
+			t.Errorf("Expected a %d byte key, but got %d bytes", KeySize, len(key1))
+		}
+		key2, err := params.DeriveKey([]byte("password"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key1, key2) {
+			t.Errorf("Expected %s to derive the same key twice", params.Name)
+		}
+		key3, err := params.DeriveKey([]byte("other"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(key1, key3) {
+			t.Errorf("Expected %s to derive different keys for different passwords", params.Name)
+		}
+	}
+}
+
+func TestDeriveKeySalt(t *testing.T) {
+	params1, err := NewArgon2idParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params2, err := NewArgon2idParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params1.Salt == params2.Salt {
+		t.Errorf("Expected fresh parameters to have different salts")
+	}
+}
+
+func TestDeriveKeyInvalidParams(t *testing.T) {
+	params := testArgon2idParams()
+	params.Threads = 0
+	if _, err := params.DeriveKey([]byte("password")); err != ErrInvalidKDFParams {
+		t.Errorf("Expected ErrInvalidKDFParams for zero threads, but got %v", err)
+	}
+	params = testArgon2idParams()
+	params.Time = maxArgon2Time + 1
+	if _, err := params.DeriveKey([]byte("password")); err != ErrInvalidKDFParams {
+		t.Errorf("Expected ErrInvalidKDFParams for an oversized Argon2 time, but got %v", err)
+	}
+	params = testScryptParams()
+	params.N = 1 << 30
+	if _, err := params.DeriveKey([]byte("password")); err != ErrInvalidKDFParams {
+		t.Errorf("Expected ErrInvalidKDFParams for an oversized scrypt N, but got %v", err)
+	}
+	params = &KDFParams{Name: "pbkdf2", Salt: "00"}
+	if _, err := params.DeriveKey([]byte("password")); err != ErrUnsupportedKDF {
+		t.Errorf("Expected ErrUnsupportedKDF, but got %v", err)
+	}
+}
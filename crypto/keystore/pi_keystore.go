@@ -0,0 +1,175 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"pi/crypto/encryption"
+)
+
+// Version is the keystore file format version
+const Version = 1
+
+// cipherName identifies the cipher the key is sealed with
+const cipherName = "aes-256-gcm"
+
+var (
+	// ErrInvalidPassword is returned when a keystore can't be unlocked with the given password
+	ErrInvalidPassword = errors.New("could not decrypt key with given password")
+	// ErrUnsupportedVersion is returned for keystore files written by an unknown format version
+	ErrUnsupportedVersion = errors.New("unsupported keystore version")
+)
+
+// keyFile is the JSON layout of a keystore file. It follows the shape of the
+// Ethereum v3 keystore, but seals the key with an AEAD instead of CTR + MAC.
+type keyFile struct {
+	Version   int        `json:"version"`
+	ID        string     `json:"id"`
+	PublicKey string     `json:"public_key"`
+	Crypto    cryptoJSON `json:"crypto"`
+}
+
+type cryptoJSON struct {
+	Cipher     string     `json:"cipher"`
+	Ciphertext string     `json:"ciphertext"`
+	KDF        string     `json:"kdf"`
+	KDFParams  *KDFParams `json:"kdfparams"`
+}
+
+// EncryptKey encrypts a private key with a password-derived key and returns
+// the keystore JSON. When params is nil the default Argon2id parameters are
+// used.
+func EncryptKey(key *ecdsa.PrivateKey, password string, params *KDFParams) ([]byte, error) {
+	if params == nil {
+		var err error
+		params, err = NewArgon2idParams()
+		if err != nil {
+			return nil, err
+		}
+	}
+	derived, err := params.DeriveKey([]byte(password))
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	publicKey := hex.EncodeToString(elliptic.MarshalCompressed(key.Curve, key.X, key.Y))
+	// The public key is authenticated with the private key so the two can't
+	// be mixed and matched between files
+	ciphertext, err := encryption.Seal(encryption.AlgorithmAES256GCM, derived, der, []byte(publicKey))
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(&keyFile{
+		Version:   Version,
+		ID:        id,
+		PublicKey: publicKey,
+		Crypto: cryptoJSON{
+			Cipher:     cipherName,
+			Ciphertext: hex.EncodeToString(ciphertext),
+			KDF:        params.Name,
+			KDFParams:  params,
+		},
+	}, "", "  ")
+}
+
+// DecryptKey decrypts the private key in the keystore JSON with the password
+func DecryptKey(data []byte, password string) (*ecdsa.PrivateKey, error) {
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, err
+	}
+	if kf.Version != Version {
+		return nil, ErrUnsupportedVersion
+	}
+	if kf.Crypto.Cipher != cipherName {
+		return nil, fmt.Errorf("unsupported keystore cipher %q", kf.Crypto.Cipher)
+	}
+	if kf.Crypto.KDFParams == nil || kf.Crypto.KDFParams.Name != kf.Crypto.KDF {
+		return nil, ErrInvalidKDFParams
+	}
+	ciphertext, err := hex.DecodeString(kf.Crypto.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := kf.Crypto.KDFParams.DeriveKey([]byte(password))
+	if err != nil {
+		return nil, err
+	}
+	der, err := encryption.Open(derived, ciphertext, []byte(kf.PublicKey))
+	if err == encryption.ErrAuthentication {
+		return nil, ErrInvalidPassword
+	}
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// StoreKey writes an encrypted keystore file readable only by the current user
+func StoreKey(path string, key *ecdsa.PrivateKey, password string) error {
+	data, err := EncryptKey(key, password, nil)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadKey reads and decrypts a keystore file
+func LoadKey(path string, password string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptKey(data, password)
+}
+
+// LoadOrCreate loads the node key from the keystore file at path, or
+// generates a new P-256 key and stores it there if the file doesn't exist
+func LoadOrCreate(path string, password string) (*ecdsa.PrivateKey, error) {
+	key, err := LoadKey(path, password)
+	if err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := StoreKey(path, key, password); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// newID returns a random version 4 UUID
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
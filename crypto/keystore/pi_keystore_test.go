@@ -0,0 +1,89 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecryptKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, params := range []*KDFParams{testArgon2idParams(), testScryptParams()} {
+		data, err := EncryptKey(key, "password", params)
+		if err != nil {
+			t.Errorf("Expected EncryptKey with %s to succeed, but got error: %s", params.Name, err)
+			continue
+		}
+		decrypted, err := DecryptKey(data, "password")
+		if err != nil {
+			t.Errorf("Expected DecryptKey with %s to succeed, but got error: %s", params.Name, err)
+			continue
+		}
+		if !decrypted.Equal(key) {
+			t.Errorf("Expected decrypted key to match the original key")
+		}
+		if _, err := DecryptKey(data, "wrong"); err != ErrInvalidPassword {
+			t.Errorf("Expected ErrInvalidPassword for a wrong password, but got %v", err)
+		}
+	}
+}
+
+func TestDecryptKeySwappedPublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := EncryptKey(key, "password", testArgon2idParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kf.PublicKey = hex.EncodeToString(elliptic.MarshalCompressed(other.Curve, other.X, other.Y))
+	data, err = json.Marshal(&kf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptKey(data, "password"); err == nil {
+		t.Errorf("Expected DecryptKey to fail when the public key was changed, but got nil error")
+	}
+}
+
+func TestLoadOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "node.json")
+	key, err := LoadOrCreate(path, "password")
+	if err != nil {
+		t.Fatalf("Expected LoadOrCreate to create a key, but got error: %s", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected keystore file mode 0600, but got %v", info.Mode().Perm())
+	}
+	loaded, err := LoadOrCreate(path, "password")
+	if err != nil {
+		t.Errorf("Expected LoadOrCreate to load the existing key, but got error: %s", err)
+	}
+	if loaded == nil || !loaded.Equal(key) {
+		t.Errorf("Expected the same key to be loaded on the second start")
+	}
+	if _, err := LoadOrCreate(path, "wrong"); err != ErrInvalidPassword {
+		t.Errorf("Expected ErrInvalidPassword instead of a new key, but got %v", err)
+	}
+}
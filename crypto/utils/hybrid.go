@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+
+	"pi/crypto/encryption"
+)
+
+// Hybrid public-key encryption. SealTo encrypts a message to a recipient's
+// public key so that only the holder of the private key can open it; the
+// sender stays anonymous, like a NaCl sealed box. A fresh AES-256-GCM key is
+// either agreed with an ephemeral ECDH key (ECIES over X25519 or P-256) or
+// wrapped with RSA-OAEP for older RSA node keys.
+//
+// A sealed box is laid out as code | ephemeral public key or wrapped key |
+// versioned AEAD ciphertext from crypto/encryption.
+
+// Sealed box codes, one per key agreement
+const (
+	boxX25519  byte = 0x01
+	boxP256    byte = 0x02
+	boxRSAOAEP byte = 0x03
+)
+
+// hybridInfo binds derived keys and OAEP labels to this scheme
+var hybridInfo = []byte("pi/crypto/hybrid/v1")
+
+// ErrDecryption is returned when a sealed box can't be opened with the given key
+var ErrDecryption = errors.New("hybrid decryption failed")
+
+// GenerateX25519Key generates a key pair for receiving sealed boxes
+func GenerateX25519Key() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// SealTo encrypts plaintext to publicKey, which may be an X25519 or P-256
+// *ecdh.PublicKey, a P-256 *ecdsa.PublicKey or an *rsa.PublicKey. The
+// associated data is authenticated but not encrypted, and must be passed
+// to OpenSealed unchanged.
+func SealTo(publicKey crypto.PublicKey, plaintext []byte, ad []byte) ([]byte, error) {
+	if pub, ok := publicKey.(*rsa.PublicKey); ok {
+		return sealRSA(pub, plaintext, ad)
+	}
+	pub, code, err := toECDHPublic(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := pub.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveBoxKey(shared, ephemeral.PublicKey().Bytes(), pub.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	prefix := append([]byte{code}, ephemeral.PublicKey().Bytes()...)
+	ciphertext, err := encryption.Seal(encryption.AlgorithmAES256GCM, key, plaintext, append(append([]byte{}, prefix...), ad...))
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, ciphertext...), nil
+}
+
+// OpenSealed decrypts a box produced by SealTo with the recipient's
+// *ecdh.PrivateKey, P-256 *ecdsa.PrivateKey or *rsa.PrivateKey
+func OpenSealed(privateKey crypto.PrivateKey, box []byte, ad []byte) ([]byte, error) {
+	if len(box) == 0 {
+		return nil, ErrDecryption
+	}
+	if priv, ok := privateKey.(*rsa.PrivateKey); ok {
+		if box[0] != boxRSAOAEP {
+			return nil, ErrDecryption
+		}
+		return openRSA(priv, box, ad)
+	}
+	priv, err := toECDHPrivate(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	_, code, err := toECDHPublic(priv.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	if box[0] != code {
+		return nil, ErrDecryption
+	}
+	size := len(priv.PublicKey().Bytes())
+	if len(box) < 1+size {
+		return nil, ErrDecryption
+	}
+	ephemeral, err := priv.Curve().NewPublicKey(box[1 : 1+size])
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	shared, err := priv.ECDH(ephemeral)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	key, err := deriveBoxKey(shared, box[1:1+size], priv.PublicKey().Bytes())
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	plaintext, err := encryption.Open(key, box[1+size:], append(append([]byte{}, box[:1+size]...), ad...))
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+// EncryptOAEP encrypts a short message directly with RSA-OAEP and SHA-256.
+// Use SealTo for messages of any length.
+func EncryptOAEP(publicKey *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, plaintext, hybridInfo)
+}
+
+// DecryptOAEP decrypts a message encrypted with EncryptOAEP
+func DecryptOAEP(privateKey *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	plaintext, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, ciphertext, hybridInfo)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+// deriveBoxKey derives the AES key from the ECDH shared secret with HKDF,
+// salted with both public keys so a box can't be redirected to another
+// recipient
+func deriveBoxKey(shared []byte, ephemeral []byte, recipient []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, hybridInfo), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func sealRSA(pub *rsa.PublicKey, plaintext []byte, ad []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	wrapped, err := EncryptOAEP(pub, key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := append([]byte{boxRSAOAEP}, wrapped...)
+	ciphertext, err := encryption.Seal(encryption.AlgorithmAES256GCM, key, plaintext, append(append([]byte{}, prefix...), ad...))
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, ciphertext...), nil
+}
+
+func openRSA(priv *rsa.PrivateKey, box []byte, ad []byte) ([]byte, error) {
+	size := priv.Size()
+	if len(box) < 1+size {
+		return nil, ErrDecryption
+	}
+	key, err := DecryptOAEP(priv, box[1:1+size])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := encryption.Open(key, box[1+size:], append(append([]byte{}, box[:1+size]...), ad...))
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+func toECDHPublic(publicKey crypto.PublicKey) (*ecdh.PublicKey, byte, error) {
+	var pub *ecdh.PublicKey
+	switch k := publicKey.(type) {
+	case *ecdh.PublicKey:
+		pub = k
+	case *ecdsa.PublicKey:
+		converted, err := k.ECDH()
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %s", ErrUnsupportedKey, err)
+		}
+		pub = converted
+	default:
+		return nil, 0, fmt.Errorf("%w: %T", ErrUnsupportedKey, publicKey)
+	}
+	switch pub.Curve() {
+	case ecdh.X25519():
+		return pub, boxX25519, nil
+	case ecdh.P256():
+		return pub, boxP256, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: ECDH curve %s", ErrUnsupportedKey, pub.Curve())
+	}
+}
+
+func toECDHPrivate(privateKey crypto.PrivateKey) (*ecdh.PrivateKey, error) {
+	switch k := privateKey.(type) {
+	case *ecdh.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		converted, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, err)
+		}
+		return converted, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, privateKey)
+	}
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+type hybridKey struct {
+	name       string
+	privateKey crypto.PrivateKey
+	publicKey  crypto.PublicKey
+}
+
+func newHybridKeys(t *testing.T) []hybridKey {
+	x25519Key, err := GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []hybridKey{
+		{"x25519", x25519Key, x25519Key.PublicKey()},
+		{"p256", p256Key, p256Key.PublicKey()},
+		{"ecdsa-p256", ecdsaKey, &ecdsaKey.PublicKey},
+		{"rsa", rsaKey, &rsaKey.PublicKey},
+	}
+}
+
+func TestSealToOpenSealed(t *testing.T) {
+	plaintext := []byte("transfer 10 PI to node-2")
+	ad := []byte("node-2")
+	for _, key := range newHybridKeys(t) {
+		box, err := SealTo(key.publicKey, plaintext, ad)
+		if err != nil {
+			t.Errorf("Expected SealTo with %s to succeed, but got error: %s", key.name, err)
+			continue
+		}
+		opened, err := OpenSealed(key.privateKey, box, ad)
+		if err != nil {
+			t.Errorf("Expected OpenSealed with %s to succeed, but got error: %s", key.name, err)
+			continue
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Errorf("Expected %s to open to %q, but got %q", key.name, plaintext, opened)
+		}
+
+		// Sealing twice gives unrelated boxes
+		again, err := SealTo(key.publicKey, plaintext, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(box, again) {
+			t.Errorf("Expected %s boxes of the same message to differ", key.name)
+		}
+	}
+}
+
+func TestOpenSealedTampered(t *testing.T) {
+	for _, key := range newHybridKeys(t) {
+		box, err := SealTo(key.publicKey, []byte("secret"), []byte("ad"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenSealed(key.privateKey, box, []byte("other ad")); !errors.Is(err, ErrDecryption) {
+			t.Errorf("Expected %s box with other associated data to fail, but got %v", key.name, err)
+		}
+		for _, i := range []int{1, len(box) / 2, len(box) - 1} {
+			tampered := append([]byte{}, box...)
+			tampered[i] ^= 1
+			if _, err := OpenSealed(key.privateKey, tampered, []byte("ad")); err == nil {
+				t.Errorf("Expected %s box tampered at byte %d to fail", key.name, i)
+			}
+		}
+		if _, err := OpenSealed(key.privateKey, box[:len(box)-1], []byte("ad")); err == nil {
+			t.Errorf("Expected truncated %s box to fail", key.name)
+		}
+	}
+}
+
+func TestOpenSealedWrongKey(t *testing.T) {
+	keys := newHybridKeys(t)
+	other := newHybridKeys(t)
+	for i, key := range keys {
+		box, err := SealTo(key.publicKey, []byte("secret"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenSealed(other[i].privateKey, box, nil); err == nil {
+			t.Errorf("Expected a %s box to fail with another recipient's key", key.name)
+		}
+		if _, err := OpenSealed(keys[(i+1)%len(keys)].privateKey, box, nil); err == nil {
+			t.Errorf("Expected a %s box to fail with a key of another type", key.name)
+		}
+	}
+}
+
+func TestSealToUnsupportedKey(t *testing.T) {
+	secpKey, err := GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SealTo(&secpKey.PublicKey, []byte("secret"), nil); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("Expected ErrUnsupportedKey for a secp256k1 key, but got %v", err)
+	}
+}
+
+func TestEncryptDecryptOAEP(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := EncryptOAEP(&rsaKey.PublicKey, []byte("session key"))
+	if err != nil {
+		t.Fatalf("Expected EncryptOAEP to succeed, but got error: %s", err)
+	}
+	plaintext, err := DecryptOAEP(rsaKey, ciphertext)
+	if err != nil {
+		t.Fatalf("Expected DecryptOAEP to succeed, but got error: %s", err)
+	}
+	if string(plaintext) != "session key" {
+		t.Errorf("Expected %q, but got %q", "session key", plaintext)
+	}
+	ciphertext[0] ^= 1
+	if _, err := DecryptOAEP(rsaKey, ciphertext); err != ErrDecryption {
+		t.Errorf("Expected ErrDecryption for a tampered ciphertext, but got %v", err)
+	}
+}
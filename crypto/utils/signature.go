@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// AlgorithmSecp256k1SHA256 signs the SHA-256 hash of the data with a
+// secp256k1 key. Signatures are recoverable.
+const AlgorithmSecp256k1SHA256 SignatureAlgorithm = "secp256k1-sha256"
+
+// Encoded signatures and public keys start with one of these codes, so they
+// can be verified without knowing out of band which chain produced them
+const (
+	codeEd25519   byte = 0x01
+	codeSecp256k1 byte = 0x02
+	codeP256      byte = 0x03
+	codeRSA       byte = 0x04
+)
+
+var algorithmCodes = map[SignatureAlgorithm]byte{
+	AlgorithmEd25519:         codeEd25519,
+	AlgorithmSecp256k1SHA256: codeSecp256k1,
+	AlgorithmECDSAP256SHA256: codeP256,
+	AlgorithmRSAPKCS1SHA256:  codeRSA,
+}
+
+// signatureSizes are the fixed raw signature lengths. RSA signatures are as
+// long as the modulus and are checked against the key instead.
+var signatureSizes = map[SignatureAlgorithm]int{
+	AlgorithmEd25519:         ed25519.SignatureSize,
+	AlgorithmSecp256k1SHA256: 65,
+	AlgorithmECDSAP256SHA256: 64,
+}
+
+var (
+	// ErrInvalidSignature is returned when a signature is malformed or doesn't verify
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrAlgorithmMismatch is returned when a signature was made with a different algorithm than the key
+	ErrAlgorithmMismatch = errors.New("signature algorithm does not match public key")
+)
+
+// Signature is a raw signature tagged with the algorithm that produced it
+type Signature struct {
+	Algorithm SignatureAlgorithm
+	Data      []byte
+}
+
+// Bytes returns the self-describing encoding: the algorithm code followed by
+// the raw signature. Ed25519 and P-256 signatures are 64 bytes, secp256k1
+// signatures are 65 bytes (r, s and the recovery id).
+func (s *Signature) Bytes() []byte {
+	return append([]byte{algorithmCodes[s.Algorithm]}, s.Data...)
+}
+
+// ParseSignature decodes a signature produced by Signature.Bytes
+func ParseSignature(b []byte) (*Signature, error) {
+	if len(b) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	alg, err := algorithmForCode(b[0])
+	if err != nil {
+		return nil, err
+	}
+	if size, ok := signatureSizes[alg]; ok && len(b)-1 != size {
+		return nil, fmt.Errorf("%w: %s signature must be %d bytes", ErrInvalidSignature, alg, size)
+	}
+	return &Signature{Algorithm: alg, Data: b[1:]}, nil
+}
+
+func algorithmForCode(code byte) (SignatureAlgorithm, error) {
+	for alg, c := range algorithmCodes {
+		if c == code {
+			return alg, nil
+		}
+	}
+	return "", fmt.Errorf("%w: unknown algorithm code %#x", ErrInvalidSignature, code)
+}
+
+// Sign signs message with signer and returns the self-describing encoding
+func Sign(signer Signer, message []byte) ([]byte, error) {
+	data, err := signer.Sign(message)
+	if err != nil {
+		return nil, err
+	}
+	sig := &Signature{Algorithm: signer.Algorithm(), Data: data}
+	if _, ok := algorithmCodes[sig.Algorithm]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, sig.Algorithm)
+	}
+	return sig.Bytes(), nil
+}
+
+// Verify checks an encoded signature over message against any supported
+// public key. ECDSA signatures with a high S value are rejected so that
+// signatures can't be altered into another valid encoding.
+func Verify(publicKey crypto.PublicKey, message []byte, signature []byte) error {
+	sig, err := ParseSignature(signature)
+	if err != nil {
+		return err
+	}
+	alg, err := PublicKeyAlgorithm(publicKey)
+	if err != nil {
+		return err
+	}
+	if alg != sig.Algorithm {
+		return ErrAlgorithmMismatch
+	}
+	hash := sha256.Sum256(message)
+	switch alg {
+	case AlgorithmEd25519:
+		if !ed25519.Verify(publicKey.(ed25519.PublicKey), message, sig.Data) {
+			return ErrInvalidSignature
+		}
+	case AlgorithmECDSAP256SHA256:
+		pub := publicKey.(*ecdsa.PublicKey)
+		r := new(big.Int).SetBytes(sig.Data[:32])
+		s := new(big.Int).SetBytes(sig.Data[32:])
+		if s.Cmp(p256HalfOrder) > 0 || !ecdsa.Verify(pub, hash[:], r, s) {
+			return ErrInvalidSignature
+		}
+	case AlgorithmSecp256k1SHA256:
+		recovered, err := recoverSecp256k1(hash[:], sig.Data)
+		if err != nil {
+			return err
+		}
+		if !recovered.ToECDSA().Equal(toSecp256k1Public(publicKey.(*ecdsa.PublicKey))) {
+			return ErrInvalidSignature
+		}
+	case AlgorithmRSAPKCS1SHA256:
+		if rsa.VerifyPKCS1v15(publicKey.(*rsa.PublicKey), crypto.SHA256, hash[:], sig.Data) != nil {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+// RecoverPublicKey returns the secp256k1 public key that produced an encoded signature over message
+func RecoverPublicKey(message []byte, signature []byte) (*ecdsa.PublicKey, error) {
+	sig, err := ParseSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	if sig.Algorithm != AlgorithmSecp256k1SHA256 {
+		return nil, fmt.Errorf("%w: %s signatures are not recoverable", ErrInvalidSignature, sig.Algorithm)
+	}
+	hash := sha256.Sum256(message)
+	pub, err := recoverSecp256k1(hash[:], sig.Data)
+	if err != nil {
+		return nil, err
+	}
+	return pub.ToECDSA(), nil
+}
+
+// PublicKeyAlgorithm returns the signature algorithm used with a public key
+func PublicKeyAlgorithm(publicKey crypto.PublicKey) (SignatureAlgorithm, error) {
+	switch pub := publicKey.(type) {
+	case ed25519.PublicKey:
+		return AlgorithmEd25519, nil
+	case *ecdsa.PublicKey:
+		switch {
+		case pub.Curve == elliptic.P256():
+			return AlgorithmECDSAP256SHA256, nil
+		case isSecp256k1(pub.Curve):
+			return AlgorithmSecp256k1SHA256, nil
+		}
+		return "", fmt.Errorf("%w: ECDSA curve %s", ErrUnsupportedKey, pub.Curve.Params().Name)
+	case *rsa.PublicKey:
+		return AlgorithmRSAPKCS1SHA256, nil
+	default:
+		return "", fmt.Errorf("%w: %T", ErrUnsupportedKey, publicKey)
+	}
+}
+
+// EncodePublicKey returns the self-describing encoding of a public key: the
+// algorithm code followed by the raw Ed25519 key, the compressed ECDSA point
+// or, for RSA, the PKIX DER encoding
+func EncodePublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	alg, err := PublicKeyAlgorithm(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	var raw []byte
+	switch alg {
+	case AlgorithmEd25519:
+		raw = publicKey.(ed25519.PublicKey)
+	case AlgorithmECDSAP256SHA256:
+		pub := publicKey.(*ecdsa.PublicKey)
+		raw = elliptic.MarshalCompressed(pub.Curve, pub.X, pub.Y)
+	case AlgorithmSecp256k1SHA256:
+		raw = toSecp256k1(publicKey.(*ecdsa.PublicKey)).SerializeCompressed()
+	case AlgorithmRSAPKCS1SHA256:
+		raw, err = x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append([]byte{algorithmCodes[alg]}, raw...), nil
+}
+
+// ParsePublicKey decodes a public key produced by EncodePublicKey
+func ParsePublicKey(b []byte) (crypto.PublicKey, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty public key")
+	}
+	alg, err := algorithmForCode(b[0])
+	if err != nil {
+		return nil, err
+	}
+	raw := b[1:]
+	switch alg {
+	case AlgorithmEd25519:
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(append([]byte{}, raw...)), nil
+	case AlgorithmECDSAP256SHA256:
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), raw)
+		if x == nil {
+			return nil, errors.New("invalid P-256 public key")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case AlgorithmSecp256k1SHA256:
+		pub, err := secp256k1.ParsePubKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		return pub.ToECDSA(), nil
+	default:
+		pub, err := x509.ParsePKIXPublicKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := pub.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+		}
+		return pub, nil
+	}
+}
+
+// GenerateSecp256k1Key generates a secp256k1 key usable with NewMemorySigner
+func GenerateSecp256k1Key() (*ecdsa.PrivateKey, error) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.ToECDSA(), nil
+}
+
+var p256HalfOrder = new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+// signP256 produces a 64-byte r||s signature, normalized to low S
+func signP256(key *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash)
+	if err != nil {
+		return nil, err
+	}
+	if s.Cmp(p256HalfOrder) > 0 {
+		s.Sub(key.Curve.Params().N, s)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature, nil
+}
+
+// signSecp256k1 produces a 65-byte r||s||v signature with low S, where v is
+// the recovery id
+func signSecp256k1(key *ecdsa.PrivateKey, hash []byte) []byte {
+	compact := secpecdsa.SignCompact(secp256k1.PrivKeyFromBytes(key.D.FillBytes(make([]byte, 32))), hash, false)
+	return append(compact[1:], compact[0]-27)
+}
+
+func recoverSecp256k1(hash []byte, signature []byte) (*secp256k1.PublicKey, error) {
+	var s secp256k1.ModNScalar
+	if s.SetByteSlice(signature[32:64]) || s.IsOverHalfOrder() || signature[64] > 3 {
+		return nil, ErrInvalidSignature
+	}
+	compact := append([]byte{27 + signature[64]}, signature[:64]...)
+	pub, _, err := secpecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	return pub, nil
+}
+
+// isSecp256k1 recognizes secp256k1 keys from any library implementing
+// elliptic.Curve, such as go-ethereum's
+func isSecp256k1(curve elliptic.Curve) bool {
+	params, secp := curve.Params(), secp256k1.S256().Params()
+	return params.P.Cmp(secp.P) == 0 && params.N.Cmp(secp.N) == 0 && params.B.Cmp(secp.B) == 0
+}
+
+func toSecp256k1(pub *ecdsa.PublicKey) *secp256k1.PublicKey {
+	var x, y secp256k1.FieldVal
+	x.SetByteSlice(pub.X.Bytes())
+	y.SetByteSlice(pub.Y.Bytes())
+	return secp256k1.NewPublicKey(&x, &y)
+}
+
+// toSecp256k1Public rebinds a secp256k1 key from another library to this package's curve
+func toSecp256k1Public(pub *ecdsa.PublicKey) *ecdsa.PublicKey {
+	return toSecp256k1(pub).ToECDSA()
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func newTestSigners(t *testing.T) []*MemorySigner {
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secpKey, err := GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signers []*MemorySigner
+	for _, key := range []crypto.Signer{edKey, secpKey, p256Key} {
+		signer, err := NewMemorySigner(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
+
+func TestSignVerify(t *testing.T) {
+	message := []byte("hello world")
+	for _, signer := range newTestSigners(t) {
+		signature, err := Sign(signer, message)
+		if err != nil {
+			t.Errorf("Expected Sign with %s to succeed, but got error: %s", signer.Algorithm(), err)
+			continue
+		}
+		if len(signature) != 1+signatureSizes[signer.Algorithm()] {
+			t.Errorf("Expected a fixed-length %s signature, but got %d bytes", signer.Algorithm(), len(signature))
+		}
+		if err := Verify(signer.PublicKey(), message, signature); err != nil {
+			t.Errorf("Expected %s signature to verify, but got error: %s", signer.Algorithm(), err)
+		}
+		if err := Verify(signer.PublicKey(), []byte("other"), signature); err == nil {
+			t.Errorf("Expected %s signature over another message to fail", signer.Algorithm())
+		}
+	}
+}
+
+func TestVerifyAlgorithmMismatch(t *testing.T) {
+	signers := newTestSigners(t)
+	signature, err := Sign(signers[0], []byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(signers[1].PublicKey(), []byte("hello world"), signature); err != ErrAlgorithmMismatch {
+		t.Errorf("Expected ErrAlgorithmMismatch, but got %v", err)
+	}
+}
+
+func TestVerifyRejectsHighS(t *testing.T) {
+	for _, signer := range newTestSigners(t)[1:] {
+		signature, err := Sign(signer, []byte("hello world"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Replace s with n - s, which is also a valid ECDSA signature
+		n := signer.PublicKey().(*ecdsa.PublicKey).Curve.Params().N
+		s := new(big.Int).SetBytes(signature[33:65])
+		new(big.Int).Sub(n, s).FillBytes(signature[33:65])
+		if signer.Algorithm() == AlgorithmSecp256k1SHA256 {
+			signature[65] ^= 1
+		}
+		if err := Verify(signer.PublicKey(), []byte("hello world"), signature); err == nil {
+			t.Errorf("Expected %s signature with high S to be rejected", signer.Algorithm())
+		}
+	}
+}
+
+func TestRecoverPublicKey(t *testing.T) {
+	signer := newTestSigners(t)[1]
+	signature, err := Sign(signer, []byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := RecoverPublicKey([]byte("hello world"), signature)
+	if err != nil {
+		t.Fatalf("Expected RecoverPublicKey to succeed, but got error: %s", err)
+	}
+	if !pub.Equal(signer.PublicKey()) {
+		t.Errorf("Expected the recovered key to match the signing key")
+	}
+}
+
+func TestEncodeParsePublicKey(t *testing.T) {
+	for _, signer := range newTestSigners(t) {
+		encoded, err := EncodePublicKey(signer.PublicKey())
+		if err != nil {
+			t.Errorf("Expected EncodePublicKey with %s to succeed, but got error: %s", signer.Algorithm(), err)
+			continue
+		}
+		pub, err := ParsePublicKey(encoded)
+		if err != nil {
+			t.Errorf("Expected ParsePublicKey with %s to succeed, but got error: %s", signer.Algorithm(), err)
+			continue
+		}
+		if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(signer.PublicKey()) {
+			t.Errorf("Expected the parsed %s key to match the original key", signer.Algorithm())
+		}
+	}
+}
+
+func TestParseSignatureInvalid(t *testing.T) {
+	if _, err := ParseSignature([]byte{codeEd25519, 1, 2, 3}); err == nil {
+		t.Errorf("Expected ParseSignature to reject a short Ed25519 signature")
+	}
+	if _, err := ParseSignature([]byte{0x7f, 1, 2, 3}); err == nil {
+		t.Errorf("Expected ParseSignature to reject an unknown algorithm code")
+	}
+}
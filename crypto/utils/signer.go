@@ -0,0 +1,477 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"pi/crypto/keystore"
+)
+
+// SignatureAlgorithm identifies how a Signer hashes and signs data
+type SignatureAlgorithm string
+
+// Signature algorithms supported by the signers in this package
+const (
+	AlgorithmECDSAP256SHA256 SignatureAlgorithm = "ecdsa-p256-sha256"
+	AlgorithmRSAPKCS1SHA256  SignatureAlgorithm = "rsa-pkcs1-sha256"
+	AlgorithmEd25519         SignatureAlgorithm = "ed25519"
+)
+
+// ErrUnsupportedKey is returned for key types no signer implementation handles
+var ErrUnsupportedKey = errors.New("unsupported key type")
+
+// Signer signs data with a private key it doesn't expose. Nodes and protocols
+// hold a Signer instead of the raw key, so the key can live in memory, in an
+// encrypted file or in a separate signer process.
+type Signer interface {
+	// Sign hashes data as required by the algorithm and signs it
+	Sign(data []byte) ([]byte, error)
+	// PublicKey returns the public key matching the signing key
+	PublicKey() crypto.PublicKey
+	// Algorithm returns the signature algorithm
+	Algorithm() SignatureAlgorithm
+}
+
+// MemorySigner signs with a private key held in process memory
+type MemorySigner struct {
+	key       crypto.Signer
+	algorithm SignatureAlgorithm
+}
+
+// NewMemorySigner creates a signer for a P-256 or secp256k1 ECDSA, RSA or Ed25519 private key
+func NewMemorySigner(key crypto.Signer) (*MemorySigner, error) {
+	var algorithm SignatureAlgorithm
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		switch {
+		case k.Curve == elliptic.P256():
+			algorithm = AlgorithmECDSAP256SHA256
+		case isSecp256k1(k.Curve):
+			algorithm = AlgorithmSecp256k1SHA256
+		default:
+			return nil, fmt.Errorf("%w: ECDSA curve %s", ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+	case *rsa.PrivateKey:
+		algorithm = AlgorithmRSAPKCS1SHA256
+	case ed25519.PrivateKey:
+		algorithm = AlgorithmEd25519
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+	return &MemorySigner{key: key, algorithm: algorithm}, nil
+}
+
+// Sign signs data. P-256 signatures are the 32-byte big-endian r and s
+// concatenated, secp256k1 signatures append the recovery id, and RSA
+// signatures are PKCS #1 v1.5 over SHA-256.
+func (s *MemorySigner) Sign(data []byte) ([]byte, error) {
+	switch s.algorithm {
+	case AlgorithmECDSAP256SHA256:
+		hash := sha256.Sum256(data)
+		return signP256(s.key.(*ecdsa.PrivateKey), hash[:])
+	case AlgorithmSecp256k1SHA256:
+		hash := sha256.Sum256(data)
+		return signSecp256k1(s.key.(*ecdsa.PrivateKey), hash[:]), nil
+	case AlgorithmRSAPKCS1SHA256:
+		hash := sha256.Sum256(data)
+		return s.key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	default:
+		return s.key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+}
+
+// PublicKey returns the public key of the signer
+func (s *MemorySigner) PublicKey() crypto.PublicKey {
+	return s.key.Public()
+}
+
+// Algorithm returns the signature algorithm of the signer
+func (s *MemorySigner) Algorithm() SignatureAlgorithm {
+	return s.algorithm
+}
+
+// NewFileSigner creates a signer for the node key in an encrypted keystore
+// file, as written by keystore.StoreKey. The key is decrypted once and kept
+// in memory.
+func NewFileSigner(path string, password string) (*MemorySigner, error) {
+	key, err := keystore.LoadKey(path, password)
+	if err != nil {
+		return nil, err
+	}
+	return NewMemorySigner(key)
+}
+
+const (
+	// maxSignerMessageSize bounds the frames exchanged with a remote signer
+	maxSignerMessageSize = 1 << 20
+
+	// MinSignerSecretSize is the minimum length of the secret shared by a
+	// remote signer and its clients
+	MinSignerSecretSize = 32
+
+	// signerTimeout bounds the handshake and each request to a remote signer
+	signerTimeout = 10 * time.Second
+
+	signerNonceSize = 32
+)
+
+var (
+	// ErrSignerSecret is returned when the remote signer secret is too short
+	ErrSignerSecret = fmt.Errorf("remote signer secret must be at least %d bytes", MinSignerSecretSize)
+
+	// ErrSignerAuth is returned when the other side of a remote signer
+	// connection doesn't prove knowledge of the shared secret
+	ErrSignerAuth = errors.New("remote signer authentication failed")
+)
+
+// Remote signer methods
+const (
+	signerMethodPublicKey = "public_key"
+	signerMethodSign      = "sign"
+)
+
+// signerRequest and signerResponse are the frames of the remote signer
+// protocol. Each is JSON preceded by its big-endian uint32 length.
+type signerRequest struct {
+	Method string `json:"method"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+type signerResponse struct {
+	Algorithm SignatureAlgorithm `json:"algorithm,omitempty"`
+	PublicKey []byte             `json:"public_key,omitempty"`
+	Signature []byte             `json:"signature,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// RemoteSigner forwards signing requests to a signer process over a local
+// socket, so validator keys never enter the node process. Both ends prove
+// knowledge of a shared secret before any request is sent, see ServeSigner
+// for the trust model.
+type RemoteSigner struct {
+	dial      func() (net.Conn, error)
+	secret    []byte
+	timeout   time.Duration
+	publicKey crypto.PublicKey
+	algorithm SignatureAlgorithm
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewRemoteSigner connects to the signer listening on address, usually a unix
+// socket path created by ListenSigner, and fetches its public key
+func NewRemoteSigner(network string, address string, secret []byte) (*RemoteSigner, error) {
+	dialer := &net.Dialer{Timeout: signerTimeout}
+	return newRemoteSigner(func() (net.Conn, error) {
+		return dialer.Dial(network, address)
+	}, secret)
+}
+
+// NewRemoteSignerTLS connects to a signer on another host over TLS. config
+// should pin the signer's certificate and carry the client certificate the
+// signer requires.
+func NewRemoteSignerTLS(address string, config *tls.Config, secret []byte) (*RemoteSigner, error) {
+	dialer := &net.Dialer{Timeout: signerTimeout}
+	return newRemoteSigner(func() (net.Conn, error) {
+		return tls.DialWithDialer(dialer, "tcp", address, config)
+	}, secret)
+}
+
+func newRemoteSigner(dial func() (net.Conn, error), secret []byte) (*RemoteSigner, error) {
+	if len(secret) < MinSignerSecretSize {
+		return nil, ErrSignerSecret
+	}
+	s := &RemoteSigner{dial: dial, secret: secret, timeout: signerTimeout}
+	resp, err := s.call(&signerRequest{Method: signerMethodPublicKey})
+	if err != nil {
+		return nil, err
+	}
+	s.publicKey, err = ParsePublicKey(resp.PublicKey)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.algorithm = resp.Algorithm
+	return s, nil
+}
+
+// Sign asks the remote signer to sign data
+func (s *RemoteSigner) Sign(data []byte) ([]byte, error) {
+	resp, err := s.call(&signerRequest{Method: signerMethodSign, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+// PublicKey returns the public key reported by the remote signer
+func (s *RemoteSigner) PublicKey() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Algorithm returns the signature algorithm reported by the remote signer
+func (s *RemoteSigner) Algorithm() SignatureAlgorithm {
+	return s.algorithm
+}
+
+// Close closes the connection to the remote signer
+func (s *RemoteSigner) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// call sends a request and waits for the response. If the signer was
+// restarted since the last request the stale connection fails before the
+// request is written and the call is retried once on a new connection. A
+// request that may have reached the signer is only retried if it is
+// idempotent, so a sign request is never performed twice.
+func (s *RemoteSigner) call(req *signerRequest) (*signerResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var resp *signerResponse
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			s.conn, err = s.connect()
+			if err != nil {
+				return nil, err
+			}
+		}
+		var sent bool
+		resp, sent, err = roundTrip(s.conn, req, s.timeout)
+		if err == nil {
+			break
+		}
+		s.conn.Close()
+		s.conn = nil
+		if sent && req.Method != signerMethodPublicKey {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("remote signer: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// connect dials the signer and runs the authentication handshake
+func (s *RemoteSigner) connect() (net.Conn, error) {
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(s.timeout))
+	err = signerClientHandshake(conn, s.secret)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// roundTrip sends req and reads the response within timeout. sent reports
+// whether any part of the request may have reached the signer.
+func roundTrip(conn net.Conn, req *signerRequest, timeout time.Duration) (resp *signerResponse, sent bool, err error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	n, err := writeSignerFrame(conn, req)
+	if err != nil {
+		return nil, n > 0, err
+	}
+	resp = &signerResponse{}
+	if err := readSignerFrame(conn, resp); err != nil {
+		return nil, true, err
+	}
+	return resp, true, nil
+}
+
+// ListenSigner creates the unix socket at path for ServeSigner, readable and
+// writable by the owner only
+func ListenSigner(path string) (net.Listener, error) {
+	// Remove a socket left behind by a signer that didn't shut down cleanly
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// ServeSigner answers remote signer requests on l with signer until l is
+// closed. It is run by the process that holds the key.
+//
+// Anyone who completes the handshake can have arbitrary data signed, so the
+// secret is the only thing standing between a local process and the
+// validator key. Each connection starts with a challenge-response in which
+// both sides prove knowledge of secret; connections that fail it are closed
+// before any request is read. The frames that follow are neither encrypted
+// nor authenticated, so l should be a unix socket from ListenSigner, or a TLS
+// listener requiring client certificates (tls.RequireAndVerifyClientCert)
+// when the node and the signer run on different hosts.
+func ServeSigner(l net.Listener, signer Signer, secret []byte) error {
+	if len(secret) < MinSignerSecretSize {
+		return ErrSignerSecret
+	}
+	publicKey, err := EncodePublicKey(signer.PublicKey())
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveSignerConn(conn, signer, publicKey, secret)
+	}
+}
+
+func serveSignerConn(conn net.Conn, signer Signer, publicKey []byte, secret []byte) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(signerTimeout))
+	if err := signerServerHandshake(conn, secret); err != nil {
+		return
+	}
+	// Requests arrive whenever the node needs a signature
+	conn.SetDeadline(time.Time{})
+	for {
+		var req signerRequest
+		if err := readSignerFrame(conn, &req); err != nil {
+			return
+		}
+		resp := &signerResponse{Algorithm: signer.Algorithm()}
+		switch req.Method {
+		case signerMethodPublicKey:
+			resp.PublicKey = publicKey
+		case signerMethodSign:
+			signature, err := signer.Sign(req.Data)
+			if err != nil {
+				resp.Error = err.Error()
+			}
+			resp.Signature = signature
+		default:
+			resp.Error = fmt.Sprintf("unknown method %q", req.Method)
+		}
+		if _, err := writeSignerFrame(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// The handshake authenticates both ends with the shared secret. The signer
+// sends a nonce, the client answers with its own nonce and a MAC over both,
+// and the signer proves itself with a MAC under a different label, so
+// neither side's proof can be replayed as the other's.
+//
+//	signer -> client: nonceS
+//	client -> signer: nonceC || HMAC(secret, "client" || nonceS || nonceC)
+//	signer -> client: HMAC(secret, "server" || nonceS || nonceC)
+func signerClientHandshake(conn net.Conn, secret []byte) error {
+	nonceS := make([]byte, signerNonceSize)
+	if _, err := io.ReadFull(conn, nonceS); err != nil {
+		return err
+	}
+	nonceC := make([]byte, signerNonceSize)
+	if _, err := rand.Read(nonceC); err != nil {
+		return err
+	}
+	msg := append(nonceC, signerHandshakeMAC(secret, "client", nonceS, nonceC)...)
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	proof := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, proof); err != nil {
+		return err
+	}
+	if !hmac.Equal(proof, signerHandshakeMAC(secret, "server", nonceS, nonceC)) {
+		return ErrSignerAuth
+	}
+	return nil
+}
+
+func signerServerHandshake(conn net.Conn, secret []byte) error {
+	nonceS := make([]byte, signerNonceSize)
+	if _, err := rand.Read(nonceS); err != nil {
+		return err
+	}
+	if _, err := conn.Write(nonceS); err != nil {
+		return err
+	}
+	msg := make([]byte, signerNonceSize+sha256.Size)
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return err
+	}
+	nonceC, proof := msg[:signerNonceSize], msg[signerNonceSize:]
+	if !hmac.Equal(proof, signerHandshakeMAC(secret, "client", nonceS, nonceC)) {
+		return ErrSignerAuth
+	}
+	_, err := conn.Write(signerHandshakeMAC(secret, "server", nonceS, nonceC))
+	return err
+}
+
+func signerHandshakeMAC(secret []byte, label string, nonceS []byte, nonceC []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("pi-remote-signer " + label))
+	mac.Write(nonceS)
+	mac.Write(nonceC)
+	return mac.Sum(nil)
+}
+
+// writeSignerFrame writes v as one frame and returns the number of bytes written
+func writeSignerFrame(w io.Writer, v interface{}) (int, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	return w.Write(frame)
+}
+
+func readSignerFrame(r io.Reader, v interface{}) error {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxSignerMessageSize {
+		return errors.New("remote signer message too large")
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pi/crypto/keystore"
+)
+
+// verifySignerSignature checks a signature the way a verifier without access to the signer would
+func verifySignerSignature(t *testing.T, s Signer, data []byte, signature []byte) bool {
+	hash := sha256.Sum256(data)
+	switch pub := s.PublicKey().(type) {
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			t.Errorf("Expected a 64 byte ECDSA signature, but got %d bytes", len(signature))
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		ss := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, hash[:], r, ss)
+	case *rsa.PublicKey:
+		return VerifyRSA(data, signature, pub) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, data, signature)
+	default:
+		t.Fatalf("unexpected public key type %T", pub)
+		return false
+	}
+}
+
+func TestMemorySigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("hello world")
+	for _, key := range []crypto.Signer{ecKey, rsaKey, edKey} {
+		signer, err := NewMemorySigner(key)
+		if err != nil {
+			t.Errorf("Expected NewMemorySigner to succeed for %T, but got error: %s", key, err)
+			continue
+		}
+		signature, err := signer.Sign(data)
+		if err != nil {
+			t.Errorf("Expected Sign with %s to succeed, but got error: %s", signer.Algorithm(), err)
+			continue
+		}
+		if !verifySignerSignature(t, signer, data, signature) {
+			t.Errorf("Expected %s signature to verify", signer.Algorithm())
+		}
+	}
+}
+
+func TestMemorySignerUnsupportedCurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMemorySigner(key); err == nil {
+		t.Errorf("Expected NewMemorySigner to reject a P-384 key, but got nil error")
+	}
+}
+
+func TestFileSigner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.json")
+	key, err := keystore.LoadOrCreate(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewFileSigner(path, "password")
+	if err != nil {
+		t.Fatalf("Expected NewFileSigner to succeed, but got error: %s", err)
+	}
+	if !key.PublicKey.Equal(signer.PublicKey()) {
+		t.Errorf("Expected the file signer to use the stored key")
+	}
+	signature, err := signer.Sign([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifySignerSignature(t, signer, []byte("hello world"), signature) {
+		t.Errorf("Expected file signer signature to verify")
+	}
+	if _, err := NewFileSigner(path, "wrong"); err == nil {
+		t.Errorf("Expected NewFileSigner to fail with a wrong password, but got nil error")
+	}
+}
+
+func TestRemoteSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewMemorySigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(t.TempDir(), "signer.sock")
+	l, err := ListenSigner(socket)
+	if err != nil {
+		t.Fatalf("Expected ListenSigner to succeed, but got error: %s", err)
+	}
+	defer l.Close()
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the signer socket to be owner-only")
+	}
+	secret := testSignerSecret(t)
+	go ServeSigner(l, local, secret)
+
+	remote, err := NewRemoteSigner("unix", socket, secret)
+	if err != nil {
+		t.Fatalf("Expected NewRemoteSigner to succeed, but got error: %s", err)
+	}
+	defer remote.Close()
+	if remote.Algorithm() != AlgorithmECDSAP256SHA256 {
+		t.Errorf("Expected remote algorithm %s, but got %s", AlgorithmECDSAP256SHA256, remote.Algorithm())
+	}
+	if !key.PublicKey.Equal(remote.PublicKey()) {
+		t.Errorf("Expected the remote signer to report the signing key")
+	}
+	for i := 0; i < 3; i++ {
+		signature, err := remote.Sign([]byte("hello world"))
+		if err != nil {
+			t.Fatalf("Expected Sign to succeed, but got error: %s", err)
+		}
+		if !verifySignerSignature(t, remote, []byte("hello world"), signature) {
+			t.Errorf("Expected remote signature to verify")
+		}
+	}
+}
+
+func testSignerSecret(t *testing.T) []byte {
+	secret := make([]byte, MinSignerSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestRemoteSignerWrongSecret(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewMemorySigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(t.TempDir(), "signer.sock")
+	l, err := ListenSigner(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go ServeSigner(l, local, testSignerSecret(t))
+
+	if _, err := NewRemoteSigner("unix", socket, testSignerSecret(t)); err == nil {
+		t.Errorf("Expected NewRemoteSigner to fail with the wrong secret, but got nil error")
+	}
+	if _, err := NewRemoteSigner("unix", socket, []byte("short")); err != ErrSignerSecret {
+		t.Errorf("Expected ErrSignerSecret for a short secret, but got %v", err)
+	}
+	if err := ServeSigner(l, local, nil); err != ErrSignerSecret {
+		t.Errorf("Expected ServeSigner to refuse an empty secret, but got %v", err)
+	}
+}
+
+// fakeSigner completes the handshake and answers the public key request, then
+// passes every further request to handle on its own connection
+func fakeSigner(t *testing.T, secret []byte, handle func(conn net.Conn, req *signerRequest)) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := EncodePublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(t.TempDir(), "signer.sock")
+	l, err := ListenSigner(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if signerServerHandshake(conn, secret) != nil {
+					return
+				}
+				for {
+					var req signerRequest
+					if readSignerFrame(conn, &req) != nil {
+						return
+					}
+					if req.Method == signerMethodPublicKey {
+						writeSignerFrame(conn, &signerResponse{Algorithm: AlgorithmECDSAP256SHA256, PublicKey: publicKey})
+						continue
+					}
+					handle(conn, &req)
+				}
+			}()
+		}
+	}()
+	return socket
+}
+
+func TestRemoteSignerSignNotRetried(t *testing.T) {
+	secret := testSignerSecret(t)
+	var requests int32
+	socket := fakeSigner(t, secret, func(conn net.Conn, req *signerRequest) {
+		// The request reached the signer, which dies before answering
+		atomic.AddInt32(&requests, 1)
+		conn.Close()
+	})
+	remote, err := NewRemoteSigner("unix", socket, secret)
+	if err != nil {
+		t.Fatalf("Expected NewRemoteSigner to succeed, but got error: %s", err)
+	}
+	defer remote.Close()
+	if _, err := remote.Sign([]byte("hello world")); err == nil {
+		t.Errorf("Expected Sign to fail when the signer drops the request, but got nil error")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected the sign request to be sent once, but it was sent %d times", n)
+	}
+}
+
+func TestRemoteSignerTimeout(t *testing.T) {
+	secret := testSignerSecret(t)
+	socket := fakeSigner(t, secret, func(conn net.Conn, req *signerRequest) {
+		// Never answer, but keep the connection open
+		io.Copy(io.Discard, conn)
+	})
+	remote, err := NewRemoteSigner("unix", socket, secret)
+	if err != nil {
+		t.Fatalf("Expected NewRemoteSigner to succeed, but got error: %s", err)
+	}
+	defer remote.Close()
+	remote.timeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err = remote.Sign([]byte("hello world"))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Expected Sign to time out, but got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected Sign to give up after the timeout")
+	}
+}
@@ -0,0 +1,322 @@
+package bridge
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+
+	substrate "github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	pitypes "github.com/pi-network/pi-node/types"
+
+	"pi/blockchain/adapter"
+	cosmosclient "pi/blockchain/cosmos/client"
+	polkadotprotocol "pi/blockchain/polkadot/protocol"
+)
+
+// ReleasedFunc reports whether a destination chain released an event,
+// usually by querying the bridge contract or pallet
+type ReleasedFunc func(ctx context.Context, id string) (bool, error)
+
+// CosmosSender signs and broadcasts messages on a Cosmos chain
+type CosmosSender interface {
+	SendMsgs(ctx context.Context, key *ecdsa.PrivateKey, msgs []cosmosclient.Msg, options *cosmosclient.TxOptions) (string, error)
+}
+
+var _ CosmosSender = (*cosmosclient.Client)(nil)
+
+// CosmosDestination releases events on a Cosmos chain by sending the mint
+// or unlock messages with cosmosclient.Client.SendMsgs
+type CosmosDestination struct {
+	Chain  string
+	Client CosmosSender
+	// Key signs the release transactions and pays their fees
+	Key *ecdsa.PrivateKey
+	// Build creates the mint or unlock messages for an attestation, e.g. a
+	// MsgExecuteContract for a CosmWasm bridge contract. The bridge module
+	// or contract must verify the attestation and reject event IDs it has
+	// released before.
+	Build func(attestation *Attestation) ([]cosmosclient.Msg, error)
+	// Options are the release transactions' optional fields, e.g. the fee
+	Options *cosmosclient.TxOptions
+	// IsReleased is optional; without it the relayer relies on its Store and
+	// the contract's replay check
+	IsReleased ReleasedFunc
+}
+
+// ChainID identifies the chain
+func (d *CosmosDestination) ChainID() string {
+	return d.Chain
+}
+
+// Released reports whether the chain already released the event
+func (d *CosmosDestination) Released(ctx context.Context, id string) (bool, error) {
+	if d.IsReleased == nil {
+		return false, nil
+	}
+	return d.IsReleased(ctx, id)
+}
+
+// Release builds the release messages and sends them in one transaction
+func (d *CosmosDestination) Release(ctx context.Context, attestation *Attestation) (string, error) {
+	if attestation.Event.DestinationChain != d.Chain {
+		return "", ErrUnknownDestination
+	}
+	msgs, err := d.Build(attestation)
+	if err != nil {
+		return "", err
+	}
+	return d.Client.SendMsgs(ctx, d.Key, msgs, d.Options)
+}
+
+// PolkadotDestination releases events on a Polkadot chain through
+// PolkadotProtocol.SubmitExtrinsic
+type PolkadotDestination struct {
+	Chain    string
+	Protocol *polkadotprotocol.PolkadotProtocol
+	// Build creates the signed mint or unlock extrinsic for an attestation.
+	// The bridge pallet must verify the attestation and reject event IDs it
+	// has released before.
+	Build func(attestation *Attestation) (*substrate.Extrinsic, error)
+	// IsReleased is optional, as for CosmosDestination
+	IsReleased ReleasedFunc
+}
+
+// ChainID identifies the chain
+func (d *PolkadotDestination) ChainID() string {
+	return d.Chain
+}
+
+// Released reports whether the chain already released the event
+func (d *PolkadotDestination) Released(ctx context.Context, id string) (bool, error) {
+	if d.IsReleased == nil {
+		return false, nil
+	}
+	return d.IsReleased(ctx, id)
+}
+
+// Release builds and submits the release extrinsic
+func (d *PolkadotDestination) Release(ctx context.Context, attestation *Attestation) (string, error) {
+	if attestation.Event.DestinationChain != d.Chain {
+		return "", ErrUnknownDestination
+	}
+	ext, err := d.Build(attestation)
+	if err != nil {
+		return "", err
+	}
+	return d.Protocol.SubmitExtrinsic(ext)
+}
+
+// PiDestination releases events on a Pi chain by submitting transactions
+// to the node through its chain adapter
+type PiDestination struct {
+	Adapter *adapter.PiAdapter
+	// Build creates the signed unlock or mint transaction for an attestation.
+	// The node's bridge module must verify the attestation and reject event
+	// IDs it has released before.
+	Build func(attestation *Attestation) (*pitypes.Transaction, error)
+	// IsReleased is optional, as for CosmosDestination
+	IsReleased ReleasedFunc
+}
+
+// ChainID identifies the chain
+func (d *PiDestination) ChainID() string {
+	return d.Adapter.ChainID()
+}
+
+// Released reports whether the chain already released the event
+func (d *PiDestination) Released(ctx context.Context, id string) (bool, error) {
+	if d.IsReleased == nil {
+		return false, nil
+	}
+	return d.IsReleased(ctx, id)
+}
+
+// Release builds and submits the release transaction
+func (d *PiDestination) Release(ctx context.Context, attestation *Attestation) (string, error) {
+	if attestation.Event.DestinationChain != d.ChainID() {
+		return "", ErrUnknownDestination
+	}
+	tx, err := d.Build(attestation)
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(tx)
+	if err != nil {
+		return "", err
+	}
+	return d.Adapter.SubmitTx(ctx, raw)
+}
+
+// PiSource watches the blocks of a Pi node for bridge events through its
+// chain adapter. Blocks are final once committed to the node's chain, and
+// their height is their position in it, starting at 1.
+type PiSource struct {
+	Adapter *adapter.PiAdapter
+	// Decode returns the bridge events of a transaction, if any
+	Decode func(tx *pitypes.Transaction) ([]*Event, error)
+}
+
+// ChainID identifies the chain
+func (s *PiSource) ChainID() string {
+	return s.Adapter.ChainID()
+}
+
+// FinalizedHeight returns the height of the node's latest block
+func (s *PiSource) FinalizedHeight(ctx context.Context) (uint64, error) {
+	return s.Adapter.FinalizedHeight(ctx)
+}
+
+// Events decodes the bridge events in blocks from and to, inclusive
+func (s *PiSource) Events(ctx context.Context, from, to uint64) ([]*Event, error) {
+	if from == 0 {
+		from = 1
+	}
+	blocks := s.Adapter.Client.GetBlockChain()
+	var events []*Event
+	for height := from; height <= to && height <= uint64(len(blocks)); height++ {
+		for _, tx := range blocks[height-1].Transactions {
+			decoded, err := s.Decode(tx)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, sourceEvents(decoded, s.ChainID(), height, tx.ID)...)
+		}
+	}
+	return events, nil
+}
+
+// CosmosSource watches a Cosmos chain for bridge events through its chain
+// adapter. CometBFT blocks are final once committed.
+type CosmosSource struct {
+	Adapter *adapter.CosmosAdapter
+	// Decode returns the bridge events of an encoded transaction, if any.
+	// Events of transactions whose execution failed are dropped.
+	Decode func(tx []byte) ([]*Event, error)
+}
+
+// ChainID identifies the chain
+func (s *CosmosSource) ChainID() string {
+	return s.Adapter.ChainID()
+}
+
+// FinalizedHeight returns the height of the latest block
+func (s *CosmosSource) FinalizedHeight(ctx context.Context) (uint64, error) {
+	return s.Adapter.FinalizedHeight(ctx)
+}
+
+// Events decodes the bridge events in blocks from and to, inclusive
+func (s *CosmosSource) Events(ctx context.Context, from, to uint64) ([]*Event, error) {
+	if from == 0 {
+		from = 1
+	}
+	var events []*Event
+	for height := from; height <= to; height++ {
+		block, err := s.Adapter.Client.Block(ctx, int64(height))
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Txs {
+			decoded, err := s.Decode(tx)
+			if err != nil {
+				return nil, err
+			}
+			if len(decoded) == 0 {
+				continue
+			}
+			// A failed burn is in the block but burned nothing
+			hash := cosmosclient.TxHash(tx)
+			result, err := s.Adapter.Client.Tx(ctx, hash)
+			if err != nil {
+				return nil, err
+			}
+			if result.Code != 0 {
+				continue
+			}
+			events = append(events, sourceEvents(decoded, s.ChainID(), height, hash)...)
+		}
+	}
+	return events, nil
+}
+
+// PolkadotSource watches a Substrate chain for bridge events through its
+// chain adapter. Blocks are final once GRANDPA finalized them.
+type PolkadotSource struct {
+	Adapter *adapter.PolkadotAdapter
+	// Decode returns the bridge events of an extrinsic, if any
+	Decode func(ext *substrate.Extrinsic) ([]*Event, error)
+	// Dispatched reports whether the extrinsic at an index of a block
+	// dispatched successfully, usually from the block's System events.
+	// Failed extrinsics are in blocks too, so their events are dropped.
+	Dispatched func(ctx context.Context, blockHash string, index int) (bool, error)
+}
+
+// ChainID identifies the chain
+func (s *PolkadotSource) ChainID() string {
+	return s.Adapter.ChainID()
+}
+
+// FinalizedHeight returns the height of the head GRANDPA finalized
+func (s *PolkadotSource) FinalizedHeight(ctx context.Context) (uint64, error) {
+	return s.Adapter.FinalizedHeight(ctx)
+}
+
+// Events decodes the bridge events in blocks from and to, inclusive
+func (s *PolkadotSource) Events(ctx context.Context, from, to uint64) ([]*Event, error) {
+	if s.Dispatched == nil {
+		return nil, errors.New("bridge: PolkadotSource needs Dispatched")
+	}
+	if from == 0 {
+		from = 1
+	}
+	var events []*Event
+	for height := from; height <= to; height++ {
+		block, err := s.Adapter.BlockByHeight(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+		body, err := s.Adapter.Client.GetBlock(block.Hash)
+		if err != nil {
+			return nil, err
+		}
+		for i := range body.Extrinsics {
+			decoded, err := s.Decode(&body.Extrinsics[i])
+			if err != nil {
+				return nil, err
+			}
+			if len(decoded) == 0 {
+				continue
+			}
+			dispatched, err := s.Dispatched(ctx, block.Hash, i)
+			if err != nil {
+				return nil, err
+			}
+			if !dispatched {
+				continue
+			}
+			events = append(events, sourceEvents(decoded, s.ChainID(), height, block.Txs[i])...)
+		}
+	}
+	return events, nil
+}
+
+// sourceEvents stamps decoded events with where they were found. Decoders
+// may set their own transaction hash and indexes; if they leave every index
+// at zero, events are indexed by their position in the transaction, so the
+// events of one transaction never share an ID.
+func sourceEvents(events []*Event, chain string, height uint64, txHash string) []*Event {
+	indexed := false
+	for _, event := range events {
+		indexed = indexed || event.Index != 0
+	}
+	for i, event := range events {
+		event.SourceChain, event.Height = chain, height
+		if event.TxHash == "" {
+			event.TxHash = txHash
+		}
+		if !indexed {
+			event.Index = uint32(i)
+		}
+	}
+	return events
+}
@@ -0,0 +1,442 @@
+package bridge
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	substrate "github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	pitypes "github.com/pi-network/pi-node/types"
+
+	"pi/blockchain/adapter"
+	cosmosclient "pi/blockchain/cosmos/client"
+	"pi/crypto/bls"
+)
+
+// piBridgeAccount is where the fake Pi chain locks tokens; locks are sent
+// to "bridge:<destination chain>:<recipient>"
+const piBridgeAccount = "bridge"
+
+// fakePiChain is a Pi node whose transactions each go in their own block
+type fakePiChain struct {
+	mu     sync.Mutex
+	blocks []*pitypes.Block
+}
+
+func (c *fakePiChain) GetBlockChain() []*pitypes.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*pitypes.Block(nil), c.blocks...)
+}
+
+func (c *fakePiChain) HandleMessage(message *pitypes.Message) error {
+	tx := &pitypes.Transaction{}
+	if err := json.Unmarshal(message.Data, tx); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, block := range c.blocks {
+		if block.Transactions[0].ID == tx.ID {
+			return fmt.Errorf("duplicate transaction %s", tx.ID)
+		}
+	}
+	c.blocks = append(c.blocks, &pitypes.Block{Transactions: []*pitypes.Transaction{tx}, Hash: fmt.Sprintf("pi-block-%d", len(c.blocks)+1)})
+	return nil
+}
+
+func (c *fakePiChain) send(tx *pitypes.Transaction) {
+	data, _ := json.Marshal(tx)
+	c.HandleMessage(&pitypes.Message{Type: pitypes.MessageTypeTransaction, Data: data})
+}
+
+func (c *fakePiChain) balance(account string) int64 {
+	var balance int64
+	for _, block := range c.GetBlockChain() {
+		for _, tx := range block.Transactions {
+			if tx.From == account {
+				balance -= tx.Amount
+			}
+			if tx.To == account {
+				balance += tx.Amount
+			}
+		}
+	}
+	return balance
+}
+
+// unlocks counts the unlock transactions the bridge submitted
+func (c *fakePiChain) unlocks() int {
+	count := 0
+	for _, block := range c.GetBlockChain() {
+		if block.Transactions[0].From == piBridgeAccount {
+			count++
+		}
+	}
+	return count
+}
+
+func decodePiTx(tx *pitypes.Transaction) ([]*Event, error) {
+	parts := strings.Split(tx.To, ":")
+	if len(parts) != 3 || parts[0] != piBridgeAccount {
+		return nil, nil
+	}
+	return []*Event{{
+		Kind: EventLock, DestinationChain: parts[1], Asset: "upi",
+		Amount: big.NewInt(tx.Amount), Sender: tx.From, Recipient: parts[2],
+	}}, nil
+}
+
+// unlockTx pays the recipient of a burn out of the bridge account
+func unlockTx(attestation *Attestation) (*pitypes.Transaction, error) {
+	event := attestation.Event
+	return &pitypes.Transaction{ID: "unlock-" + event.ID(), From: piBridgeAccount, To: event.Recipient, Amount: event.Amount.Int64()}, nil
+}
+
+// cosmosBurn is the fake Cosmos chain's bridge message
+type cosmosBurn struct {
+	Sender      string `json:"sender"`
+	Destination string `json:"destination"`
+	Recipient   string `json:"recipient"`
+	Amount      int64  `json:"amount"`
+}
+
+// fakeCosmosChain is a Cosmos node with a bridge module that mints wrapped
+// tokens for attested locks and burns them on request
+type fakeCosmosChain struct {
+	groupKey *bls.PublicKey
+
+	mu       sync.Mutex
+	blocks   []*cosmosclient.Block
+	results  map[string]*cosmosclient.TxResult
+	balances map[string]int64
+	released map[string]bool
+	releases int
+}
+
+func newFakeCosmosChain(groupKey *bls.PublicKey) *fakeCosmosChain {
+	return &fakeCosmosChain{
+		groupKey: groupKey,
+		results:  make(map[string]*cosmosclient.TxResult),
+		balances: make(map[string]int64),
+		released: make(map[string]bool),
+	}
+}
+
+func (c *fakeCosmosChain) Status(ctx context.Context) (*cosmosclient.Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &cosmosclient.Status{ChainID: "cosmoshub-4", LatestBlockHeight: int64(len(c.blocks))}, nil
+}
+
+func (c *fakeCosmosChain) Block(ctx context.Context, height int64) (*cosmosclient.Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height < 1 || height > int64(len(c.blocks)) {
+		return nil, fmt.Errorf("height %d is not available", height)
+	}
+	return c.blocks[height-1], nil
+}
+
+func (c *fakeCosmosChain) Tx(ctx context.Context, hash string) (*cosmosclient.TxResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if result, ok := c.results[hash]; ok {
+		return result, nil
+	}
+	return nil, cosmosclient.ErrNotFound
+}
+
+func (c *fakeCosmosChain) BroadcastTx(ctx context.Context, tx []byte) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (c *fakeCosmosChain) Balance(ctx context.Context, address string, denom string) (*big.Int, error) {
+	return big.NewInt(c.balance(address)), nil
+}
+
+// burn burns wrapped tokens in a new block; a burn executed with a non-zero
+// code fails and burns nothing
+func (c *fakeCosmosChain) burn(burn cosmosBurn, code uint32) {
+	tx, _ := json.Marshal(burn)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	height := int64(len(c.blocks) + 1)
+	hash := cosmosclient.TxHash(tx)
+	c.blocks = append(c.blocks, &cosmosclient.Block{Height: height, Hash: fmt.Sprintf("%064X", height), Txs: [][]byte{tx}})
+	c.results[hash] = &cosmosclient.TxResult{Hash: hash, Height: height, Code: code}
+	if code == 0 {
+		c.balances[burn.Sender] -= burn.Amount
+	}
+}
+
+func (c *fakeCosmosChain) balance(account string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.balances[account]
+}
+
+func (c *fakeCosmosChain) releaseCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.releases
+}
+
+func (c *fakeCosmosChain) ChainID() string {
+	return "cosmoshub-4"
+}
+
+func (c *fakeCosmosChain) Released(ctx context.Context, id string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.released[id], nil
+}
+
+func (c *fakeCosmosChain) Release(ctx context.Context, attestation *Attestation) (string, error) {
+	if err := attestation.Verify(c.groupKey); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := attestation.Event.ID()
+	if c.released[id] {
+		return "", ErrAlreadyReleased
+	}
+	c.released[id] = true
+	c.releases++
+	c.balances[attestation.Event.Recipient] += attestation.Event.Amount.Int64()
+	return "0x" + id, nil
+}
+
+func decodeCosmosTx(tx []byte) ([]*Event, error) {
+	var burn cosmosBurn
+	if err := json.Unmarshal(tx, &burn); err != nil {
+		return nil, nil
+	}
+	return []*Event{{
+		Kind: EventBurn, DestinationChain: burn.Destination, Asset: "upi",
+		Amount: big.NewInt(burn.Amount), Sender: burn.Sender, Recipient: burn.Recipient,
+	}}, nil
+}
+
+func TestBridgeAdaptersRoundTrip(t *testing.T) {
+	shares := runCommittee(t, 3, 2)
+	pi := &fakePiChain{}
+	pi.send(&pitypes.Transaction{ID: "genesis", To: "alice", Amount: 100})
+	cosmos := newFakeCosmosChain(shares[0].GroupKey)
+	piAdapter := &adapter.PiAdapter{Chain: "pi-1", Client: pi}
+	cosmosAdapter := &adapter.CosmosAdapter{Chain: "cosmoshub-4", Client: cosmos}
+
+	sources := []Source{
+		&PiSource{Adapter: piAdapter, Decode: decodePiTx},
+		&CosmosSource{Adapter: cosmosAdapter, Decode: decodeCosmosTx},
+	}
+	destinations := []Destination{
+		cosmos,
+		&PiDestination{
+			Adapter: piAdapter,
+			Build:   unlockTx,
+			IsReleased: func(ctx context.Context, id string) (bool, error) {
+				status, err := piAdapter.TxStatus(ctx, "unlock-"+id)
+				if err != nil {
+					return false, err
+				}
+				return status.State != adapter.TxUnknown, nil
+			},
+		},
+	}
+	runRelayers(t, shares, []int{1, 2, 3}, sources, destinations)
+
+	// Alice locks 10 on Pi and bob gets 10 wrapped tokens on Cosmos
+	pi.send(&pitypes.Transaction{ID: "lock-1", From: "alice", To: "bridge:cosmoshub-4:bob", Amount: 10})
+	waitFor(t, "the mint on cosmoshub-4", func() bool { return cosmos.balance("bob") == 10 })
+
+	// A failed burn releases nothing, the burn after it unlocks 4 on Pi
+	cosmos.burn(cosmosBurn{Sender: "bob", Destination: "pi-1", Recipient: "alice", Amount: 6}, 5)
+	cosmos.burn(cosmosBurn{Sender: "bob", Destination: "pi-1", Recipient: "alice", Amount: 4}, 0)
+	waitFor(t, "the unlock on pi-1", func() bool { return pi.balance("alice") == 94 })
+
+	// Give the other relayers time to try to release again
+	time.Sleep(100 * time.Millisecond)
+	if pi.unlocks() != 1 || cosmos.releaseCount() != 1 {
+		t.Errorf("Expected each event to be released once, but got %d unlocks and %d mints", pi.unlocks(), cosmos.releaseCount())
+	}
+	if pi.balance("alice") != 94 || cosmos.balance("bob") != 6 {
+		t.Errorf("Expected alice=94 and bob=6 after the round trip, but got alice=%d bob=%d", pi.balance("alice"), cosmos.balance("bob"))
+	}
+}
+
+func TestSourceIndexesEventsOfOneTx(t *testing.T) {
+	cosmos := newFakeCosmosChain(nil)
+	cosmos.burn(cosmosBurn{Sender: "bob", Destination: "pi-1", Recipient: "alice", Amount: 4}, 0)
+	source := &CosmosSource{
+		Adapter: &adapter.CosmosAdapter{Chain: "cosmoshub-4", Client: cosmos},
+		// Every burn pays two recipients
+		Decode: func(tx []byte) ([]*Event, error) {
+			first, err := decodeCosmosTx(tx)
+			if err != nil {
+				return nil, err
+			}
+			second, err := decodeCosmosTx(tx)
+			if err != nil {
+				return nil, err
+			}
+			return append(first, second...), nil
+		},
+	}
+	events, err := source.Events(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatalf("Expected Events to succeed, but got error: %s", err)
+	}
+	if len(events) != 2 || events[0].TxHash != events[1].TxHash {
+		t.Fatalf("Expected two events of one transaction, but got %d", len(events))
+	}
+	if events[0].Index != 0 || events[1].Index != 1 || events[0].ID() == events[1].ID() {
+		t.Errorf("Expected the events to be indexed by position, but got indexes %d and %d", events[0].Index, events[1].Index)
+	}
+
+	// Indexes set by the decoder are kept
+	decoded := []*Event{{Index: 3}, {Index: 7}}
+	sourceEvents(decoded, "cosmoshub-4", 1, "tx")
+	if decoded[0].Index != 3 || decoded[1].Index != 7 {
+		t.Errorf("Expected the decoder's indexes to be kept, but got %d and %d", decoded[0].Index, decoded[1].Index)
+	}
+}
+
+// recordingSender records the messages sent through it
+type recordingSender struct {
+	key  *ecdsa.PrivateKey
+	msgs []cosmosclient.Msg
+}
+
+func (s *recordingSender) SendMsgs(ctx context.Context, key *ecdsa.PrivateKey, msgs []cosmosclient.Msg, options *cosmosclient.TxOptions) (string, error) {
+	s.key = key
+	s.msgs = append(s.msgs, msgs...)
+	return "ABCDEF", nil
+}
+
+func TestCosmosDestination(t *testing.T) {
+	sender := &recordingSender{}
+	key := &ecdsa.PrivateKey{}
+	destination := &CosmosDestination{
+		Chain:  "cosmoshub-4",
+		Client: sender,
+		Key:    key,
+		Build: func(attestation *Attestation) ([]cosmosclient.Msg, error) {
+			return []cosmosclient.Msg{{TypeURL: "/pi.bridge.v1.MsgMint", Value: []byte(attestation.Event.ID())}}, nil
+		},
+	}
+	event := &Event{Kind: EventLock, SourceChain: "pi-1", DestinationChain: "cosmoshub-4", TxHash: "tx-1", Asset: "pi", Amount: big.NewInt(1), Recipient: "bob"}
+	hash, err := destination.Release(context.Background(), &Attestation{Event: event})
+	if err != nil {
+		t.Fatalf("Expected Release to succeed, but got error: %s", err)
+	}
+	if hash != "ABCDEF" || sender.key != key || len(sender.msgs) != 1 || string(sender.msgs[0].Value) != event.ID() {
+		t.Errorf("Expected the mint to be sent with the destination's key, but got %s and %+v", hash, sender.msgs)
+	}
+
+	other := *event
+	other.DestinationChain = "osmosis-1"
+	if _, err := destination.Release(context.Background(), &Attestation{Event: &other}); !errors.Is(err, ErrUnknownDestination) {
+		t.Errorf("Expected ErrUnknownDestination, but got %v", err)
+	}
+}
+
+// fakePolkadotChain is a Substrate node whose extrinsics are tagged by
+// their first argument
+type fakePolkadotChain struct {
+	blocks    []*substrate.Block
+	finalized uint64
+}
+
+func (c *fakePolkadotChain) GetBestNumber() (uint64, error) {
+	return uint64(len(c.blocks)), nil
+}
+
+func (c *fakePolkadotChain) GetFinalizedHead() (*substrate.Header, error) {
+	return &substrate.Header{Number: substrate.BlockNumber(c.finalized)}, nil
+}
+
+func (c *fakePolkadotChain) GetBlockHash(height uint64) (string, error) {
+	return fmt.Sprintf("0x%064x", height), nil
+}
+
+func (c *fakePolkadotChain) GetBlock(hash string) (*substrate.Block, error) {
+	var height uint64
+	if _, err := fmt.Sscanf(hash, "0x%x", &height); err != nil || height == 0 || height > uint64(len(c.blocks)) {
+		return nil, fmt.Errorf("unknown block %s", hash)
+	}
+	return c.blocks[height-1], nil
+}
+
+func (c *fakePolkadotChain) GetStorage(key string) (string, error) {
+	return "", nil
+}
+
+func (c *fakePolkadotChain) SubmitExtrinsic(ext *substrate.Extrinsic) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (c *fakePolkadotChain) author(tags ...byte) {
+	block := &substrate.Block{}
+	for _, tag := range tags {
+		block.Extrinsics = append(block.Extrinsics, substrate.Extrinsic{Version: 4, Method: substrate.Call{Args: substrate.Args{tag}}})
+	}
+	block.Header.Number = substrate.BlockNumber(len(c.blocks) + 1)
+	c.blocks = append(c.blocks, block)
+}
+
+func TestPolkadotSource(t *testing.T) {
+	chain := &fakePolkadotChain{}
+	// Tag 0 is not a bridge extrinsic, 1 is a burn, 2 is a burn whose dispatch failed
+	chain.author(0, 1)
+	chain.author(2, 1)
+	chain.author(1)
+	chain.finalized = 2
+	source := &PolkadotSource{
+		Adapter: &adapter.PolkadotAdapter{Chain: "polkadot", Client: chain},
+		Decode: func(ext *substrate.Extrinsic) ([]*Event, error) {
+			if ext.Method.Args[0] == 0 {
+				return nil, nil
+			}
+			return []*Event{{Kind: EventBurn, DestinationChain: "pi-1", Asset: "upi", Amount: big.NewInt(1), Recipient: "alice"}}, nil
+		},
+		Dispatched: func(ctx context.Context, blockHash string, index int) (bool, error) {
+			block, err := chain.GetBlock(blockHash)
+			if err != nil {
+				return false, err
+			}
+			return block.Extrinsics[index].Method.Args[0] != 2, nil
+		},
+	}
+
+	ctx := context.Background()
+	finalized, err := source.FinalizedHeight(ctx)
+	if err != nil || finalized != 2 {
+		t.Fatalf("Expected the GRANDPA finalized height 2, but got %d, %v", finalized, err)
+	}
+	events, err := source.Events(ctx, 1, finalized)
+	if err != nil {
+		t.Fatalf("Expected Events to succeed, but got error: %s", err)
+	}
+	if len(events) != 2 || events[0].Height != 1 || events[1].Height != 2 {
+		t.Fatalf("Expected the dispatched burns of blocks 1 and 2, but got %d events", len(events))
+	}
+	for _, event := range events {
+		if event.SourceChain != "polkadot" || !strings.HasPrefix(event.TxHash, "0x") || event.Validate() != nil {
+			t.Errorf("Expected a valid event with the extrinsic hash, but got %+v", event)
+		}
+	}
+
+	source.Dispatched = nil
+	if _, err := source.Events(ctx, 1, finalized); err == nil {
+		t.Errorf("Expected Events without Dispatched to fail")
+	}
+}
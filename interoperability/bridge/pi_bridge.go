@@ -0,0 +1,371 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"pi/crypto/bls"
+	"pi/interoperability/tss"
+)
+
+// Lock-and-mint bridge between chains. Relayers watch the source chains for
+// lock and burn events and wait until they are final. Each relayer signs
+// the events it observed with its share of the committee's threshold BLS
+// key and broadcasts its vote; once any relayer holds votes from Threshold
+// relayers it combines them into an attestation and submits the mint or
+// unlock to the destination chain, which verifies the attestation against
+// the group key. Several relayers may submit the same attestation, so
+// destinations must release each event ID at most once.
+
+// voteSession tags bridge votes; relayers ignore messages of other sessions
+const voteSession = "pi/bridge/votes"
+
+// DefaultPollInterval is how often source chains are polled for new events
+const DefaultPollInterval = 5 * time.Second
+
+// DefaultVoteTTL is how long votes for an event are kept without reaching
+// the threshold
+const DefaultVoteTTL = time.Hour
+
+var (
+	// ErrAlreadyReleased is returned by destinations for events they released before
+	ErrAlreadyReleased = errors.New("bridge: event already released")
+
+	// ErrUnknownDestination is returned for events to a chain the relayer doesn't submit to
+	ErrUnknownDestination = errors.New("bridge: unknown destination chain")
+)
+
+// Source is a chain whose lock and burn events the bridge relays
+type Source interface {
+	// ChainID identifies the chain
+	ChainID() string
+	// FinalizedHeight returns the height of the latest final block
+	FinalizedHeight(ctx context.Context) (uint64, error)
+	// Events returns the bridge events in blocks from and to, inclusive
+	Events(ctx context.Context, from, to uint64) ([]*Event, error)
+}
+
+// Destination is a chain the bridge mints or unlocks tokens on
+type Destination interface {
+	// ChainID identifies the chain
+	ChainID() string
+	// Released reports whether the chain already released the event
+	Released(ctx context.Context, id string) (bool, error)
+	// Release submits the mint or unlock for an attested event and returns
+	// the transaction hash, or ErrAlreadyReleased
+	Release(ctx context.Context, attestation *Attestation) (string, error)
+}
+
+// Config configures a Relayer
+type Config struct {
+	// Share is the relayer's share of the committee key, from tss.RunDKG
+	Share *tss.KeyShare
+	// Transport exchanges votes with the other relayers of the committee
+	Transport tss.Transport
+	// Sources are watched for events
+	Sources []Source
+	// Destinations are where this relayer submits releases
+	Destinations []Destination
+	// Store remembers released events. Defaults to a MemoryStore.
+	Store Store
+	// Confirmations is how many blocks past finality to wait before
+	// relaying an event, for chains whose finality can't be fully trusted
+	Confirmations uint64
+	// StartHeights is the first height to watch on each source chain.
+	// Sources without one are watched from height 1.
+	StartHeights map[string]uint64
+	// PollInterval defaults to DefaultPollInterval
+	PollInterval time.Duration
+	// VoteTTL is how long a tally waits for Threshold votes before it is
+	// dropped, e.g. for events other relayers never observed. Defaults to
+	// DefaultVoteTTL. Attested events are kept until they are released.
+	VoteTTL time.Duration
+}
+
+// Relayer is one member of the bridge committee
+type Relayer struct {
+	config       Config
+	destinations map[string]Destination
+
+	votes map[string]*tally
+	mu    sync.Mutex
+	// releasing serializes releases, so concurrent attestations of an
+	// event are submitted once
+	releasing sync.Mutex
+}
+
+// tally collects the votes for one event digest
+type tally struct {
+	key         string
+	event       *Event
+	shares      []*tss.SignatureShare
+	voted       map[int]bool
+	attestation *Attestation
+	released    bool
+	// started is when the first vote was counted
+	started time.Time
+}
+
+// vote is the wire form of a relayer's signature share over an event
+type vote struct {
+	Event     *Event `json:"event"`
+	Signature []byte `json:"signature"`
+}
+
+// NewRelayer creates a relayer
+func NewRelayer(config *Config) (*Relayer, error) {
+	cfg := *config
+	if cfg.Share == nil || cfg.Transport == nil {
+		return nil, errors.New("bridge: relayer needs a key share and a transport")
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.VoteTTL <= 0 {
+		cfg.VoteTTL = DefaultVoteTTL
+	}
+	destinations := make(map[string]Destination)
+	for _, destination := range cfg.Destinations {
+		destinations[destination.ChainID()] = destination
+	}
+	return &Relayer{
+		config:       cfg,
+		destinations: destinations,
+		votes:        make(map[string]*tally),
+	}, nil
+}
+
+// Run relays events until ctx is done
+func (r *Relayer) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, source := range r.config.Sources {
+		wg.Add(1)
+		go func(source Source) {
+			defer wg.Done()
+			r.watch(ctx, source)
+		}(source)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.receive(ctx)
+	}()
+	wg.Wait()
+	return ctx.Err()
+}
+
+// watch polls a source chain for final events and votes on them
+func (r *Relayer) watch(ctx context.Context, source Source) {
+	next := r.config.StartHeights[source.ChainID()]
+	if next == 0 {
+		next = 1
+	}
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		if height, err := r.poll(ctx, source, next); err != nil {
+			log.Printf("bridge: polling %s: %s", source.ChainID(), err)
+		} else {
+			next = height
+		}
+		r.retry(ctx)
+		r.expire()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// poll votes on the events from height next up to the confirmed height and
+// returns the next height to poll from
+func (r *Relayer) poll(ctx context.Context, source Source, next uint64) (uint64, error) {
+	finalized, err := source.FinalizedHeight(ctx)
+	if err != nil {
+		return next, err
+	}
+	if finalized < next+r.config.Confirmations {
+		return next, nil
+	}
+	confirmed := finalized - r.config.Confirmations
+	events, err := source.Events(ctx, next, confirmed)
+	if err != nil {
+		return next, err
+	}
+	for _, event := range events {
+		if event.SourceChain != source.ChainID() || event.Validate() != nil {
+			log.Printf("bridge: skipping invalid event %s from %s", event.TxHash, source.ChainID())
+			continue
+		}
+		if err := r.vote(ctx, event); err != nil {
+			return next, err
+		}
+	}
+	return confirmed + 1, nil
+}
+
+// vote signs an observed event and broadcasts the signature share
+func (r *Relayer) vote(ctx context.Context, event *Event) error {
+	share, err := r.config.Share.Sign(event.Digest())
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(&vote{Event: event, Signature: share.Signature.Bytes()})
+	if err != nil {
+		return err
+	}
+	err = r.config.Transport.Send(ctx, &tss.Message{
+		Session: voteSession,
+		From:    r.config.Share.Index,
+		To:      tss.Broadcast,
+		Payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+	r.count(ctx, event, share)
+	return nil
+}
+
+// receive counts the votes of the other relayers
+func (r *Relayer) receive(ctx context.Context) {
+	for {
+		msg, err := r.config.Transport.Receive(ctx)
+		if err != nil {
+			return
+		}
+		if msg.Session != voteSession {
+			continue
+		}
+		var v vote
+		if err := json.Unmarshal(msg.Payload, &v); err != nil || v.Event == nil || v.Event.Validate() != nil {
+			continue
+		}
+		signature, err := bls.SignatureFromBytes(v.Signature)
+		if err != nil {
+			continue
+		}
+		r.count(ctx, v.Event, &tss.SignatureShare{Index: msg.From, Signature: signature})
+	}
+}
+
+// count adds a vote to its event's tally and releases the event once it
+// has votes from Threshold relayers
+func (r *Relayer) count(ctx context.Context, event *Event, share *tss.SignatureShare) {
+	if _, ok := r.destinations[event.DestinationChain]; !ok {
+		return
+	}
+	digest := event.Digest()
+	if r.config.Share.VerifyShare(digest, share) != nil {
+		return
+	}
+	// Late votes for a released event don't start a new tally
+	if released, err := r.config.Store.Has(event.ID()); err != nil || released {
+		return
+	}
+
+	r.mu.Lock()
+	key := string(digest)
+	t, ok := r.votes[key]
+	if !ok {
+		t = &tally{key: key, event: event, voted: make(map[int]bool), started: time.Now()}
+		r.votes[key] = t
+	}
+	if t.voted[share.Index] || t.attestation != nil {
+		r.mu.Unlock()
+		return
+	}
+	t.voted[share.Index] = true
+	t.shares = append(t.shares, share)
+	if len(t.shares) < r.config.Share.Threshold {
+		r.mu.Unlock()
+		return
+	}
+	signature, err := r.config.Share.Combine(digest, t.shares)
+	if err != nil {
+		r.mu.Unlock()
+		log.Printf("bridge: combining votes for %s: %s", event.ID(), err)
+		return
+	}
+	t.attestation = &Attestation{Event: t.event, Signature: signature}
+	r.mu.Unlock()
+
+	r.release(ctx, t)
+}
+
+// retry releases attested events whose release failed before
+func (r *Relayer) retry(ctx context.Context) {
+	r.mu.Lock()
+	var pending []*tally
+	for _, t := range r.votes {
+		if t.attestation != nil && !t.released {
+			pending = append(pending, t)
+		}
+	}
+	r.mu.Unlock()
+	for _, t := range pending {
+		r.release(ctx, t)
+	}
+}
+
+// expire drops the tallies that didn't reach the threshold within VoteTTL
+func (r *Relayer) expire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, t := range r.votes {
+		if t.attestation == nil && time.Since(t.started) > r.config.VoteTTL {
+			delete(r.votes, key)
+		}
+	}
+}
+
+func (r *Relayer) release(ctx context.Context, t *tally) {
+	if err := r.Release(ctx, t.attestation); err != nil {
+		log.Printf("bridge: releasing %s: %s", t.event.ID(), err)
+		return
+	}
+	r.mu.Lock()
+	t.released = true
+	delete(r.votes, t.key)
+	r.mu.Unlock()
+}
+
+// Release submits an attested event to its destination chain unless it
+// was released already, by this relayer or another
+func (r *Relayer) Release(ctx context.Context, attestation *Attestation) error {
+	destination, ok := r.destinations[attestation.Event.DestinationChain]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownDestination, attestation.Event.DestinationChain)
+	}
+	if err := attestation.Verify(r.config.Share.GroupKey); err != nil {
+		return err
+	}
+
+	r.releasing.Lock()
+	defer r.releasing.Unlock()
+	id := attestation.Event.ID()
+	released, err := r.config.Store.Has(id)
+	if err != nil || released {
+		return err
+	}
+	released, err = destination.Released(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !released {
+		_, err = destination.Release(ctx, attestation)
+		if err != nil && !errors.Is(err, ErrAlreadyReleased) {
+			return err
+		}
+	}
+	return r.config.Store.Add(id)
+}
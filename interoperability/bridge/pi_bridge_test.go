@@ -0,0 +1,400 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"pi/crypto/bls"
+	"pi/interoperability/tss"
+)
+
+// memoryTransport connects parties running in the same process
+type memoryTransport struct {
+	index   int
+	inboxes []chan *tss.Message
+}
+
+func newMemoryNetwork(n int) []*memoryTransport {
+	inboxes := make([]chan *tss.Message, n+1)
+	for i := range inboxes {
+		inboxes[i] = make(chan *tss.Message, 64*n)
+	}
+	transports := make([]*memoryTransport, n)
+	for i := range transports {
+		transports[i] = &memoryTransport{index: i + 1, inboxes: inboxes}
+	}
+	return transports
+}
+
+func (t *memoryTransport) Send(ctx context.Context, msg *tss.Message) error {
+	for to := 1; to < len(t.inboxes); to++ {
+		if to == t.index || (msg.To != tss.Broadcast && msg.To != to) {
+			continue
+		}
+		copied := *msg
+		copied.From, copied.To = t.index, to
+		select {
+		case t.inboxes[to] <- &copied:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (t *memoryTransport) Receive(ctx context.Context) (*tss.Message, error) {
+	select {
+	case msg := <-t.inboxes[t.index]:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runCommittee runs the DKG for a committee of n relayers
+func runCommittee(t *testing.T, n, threshold int) []*tss.KeyShare {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	transports := newMemoryNetwork(n)
+	shares := make([]*tss.KeyShare, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, transport := range transports {
+		wg.Add(1)
+		go func(i int, transport *memoryTransport) {
+			defer wg.Done()
+			shares[i], errs[i] = tss.RunDKG(ctx, transport, tss.Params{Session: "bridge", Index: i + 1, Parties: n, Threshold: threshold})
+		}(i, transport)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Expected the DKG to succeed for relayer %d, but got error: %s", i+1, err)
+		}
+	}
+	return shares
+}
+
+// mockChain is a chain with a bridge contract that verifies attestations
+// against the committee's group key and releases each event once
+type mockChain struct {
+	id       string
+	groupKey *bls.PublicKey
+
+	mu        sync.Mutex
+	height    uint64
+	finalized uint64
+	events    []*Event
+	balances  map[string]int64
+	released  map[string]bool
+	releases  int
+	down      bool
+}
+
+func newMockChain(id string, groupKey *bls.PublicKey) *mockChain {
+	return &mockChain{id: id, groupKey: groupKey, balances: make(map[string]int64), released: make(map[string]bool)}
+}
+
+func (c *mockChain) ChainID() string {
+	return c.id
+}
+
+// send locks or burns tokens in a new block
+func (c *mockChain) send(kind EventKind, sender, destination, recipient string, amount int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.height++
+	c.balances[sender] -= amount
+	c.events = append(c.events, &Event{
+		Kind:             kind,
+		SourceChain:      c.id,
+		DestinationChain: destination,
+		TxHash:           fmt.Sprintf("%s-tx-%d", c.id, c.height),
+		Height:           c.height,
+		Asset:            "upi",
+		Amount:           big.NewInt(amount),
+		Sender:           sender,
+		Recipient:        recipient,
+	})
+}
+
+// finalize makes every block final
+func (c *mockChain) finalize() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finalized = c.height
+}
+
+func (c *mockChain) balance(account string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.balances[account]
+}
+
+func (c *mockChain) releaseCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.releases
+}
+
+func (c *mockChain) FinalizedHeight(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.finalized, nil
+}
+
+func (c *mockChain) Events(ctx context.Context, from, to uint64) ([]*Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var events []*Event
+	for _, event := range c.events {
+		if event.Height >= from && event.Height <= to {
+			copied := *event
+			events = append(events, &copied)
+		}
+	}
+	return events, nil
+}
+
+func (c *mockChain) Released(ctx context.Context, id string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return false, errors.New("chain unavailable")
+	}
+	return c.released[id], nil
+}
+
+func (c *mockChain) Release(ctx context.Context, attestation *Attestation) (string, error) {
+	if err := attestation.Verify(c.groupKey); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return "", errors.New("chain unavailable")
+	}
+	id := attestation.Event.ID()
+	if c.released[id] {
+		return "", ErrAlreadyReleased
+	}
+	c.released[id] = true
+	c.releases++
+	c.balances[attestation.Event.Recipient] += attestation.Event.Amount.Int64()
+	return "0x" + id, nil
+}
+
+// startRelayers runs a relayer for each of the given committee members
+func startRelayers(t *testing.T, shares []*tss.KeyShare, members []int, chains ...*mockChain) []*Relayer {
+	var sources []Source
+	var destinations []Destination
+	for _, chain := range chains {
+		sources = append(sources, chain)
+		destinations = append(destinations, chain)
+	}
+	return runRelayers(t, shares, members, sources, destinations)
+}
+
+// runRelayers runs a relayer for each of the given committee members,
+// watching sources and releasing on destinations
+func runRelayers(t *testing.T, shares []*tss.KeyShare, members []int, sources []Source, destinations []Destination) []*Relayer {
+	ctx, cancel := context.WithCancel(context.Background())
+	transports := newMemoryNetwork(len(shares))
+	var relayers []*Relayer
+	var wg sync.WaitGroup
+	for _, member := range members {
+		relayer, err := NewRelayer(&Config{
+			Share:        shares[member-1],
+			Transport:    transports[member-1],
+			Sources:      sources,
+			Destinations: destinations,
+			PollInterval: 10 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Expected NewRelayer to succeed, but got error: %s", err)
+		}
+		relayers = append(relayers, relayer)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			relayer.Run(ctx)
+		}()
+	}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	return relayers
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBridgeEndToEnd(t *testing.T) {
+	shares := runCommittee(t, 3, 2)
+	pi := newMockChain("pi-1", shares[0].GroupKey)
+	cosmos := newMockChain("cosmoshub-4", shares[0].GroupKey)
+	pi.balances["alice"] = 100
+	startRelayers(t, shares, []int{1, 2, 3}, pi, cosmos)
+
+	pi.send(EventLock, "alice", "cosmoshub-4", "bob", 10)
+	time.Sleep(100 * time.Millisecond)
+	if cosmos.balance("bob") != 0 {
+		t.Fatalf("Expected nothing to be minted before the lock is final")
+	}
+	pi.finalize()
+	waitFor(t, "the mint on cosmoshub-4", func() bool { return cosmos.balance("bob") == 10 })
+
+	cosmos.send(EventBurn, "bob", "pi-1", "alice", 4)
+	cosmos.finalize()
+	waitFor(t, "the unlock on pi-1", func() bool { return pi.balance("alice") == 94 })
+
+	// Give the other relayers time to try to release again
+	time.Sleep(100 * time.Millisecond)
+	if cosmos.releaseCount() != 1 || pi.releaseCount() != 1 {
+		t.Errorf("Expected each event to be released once, but got %d and %d releases", cosmos.releaseCount(), pi.releaseCount())
+	}
+	if cosmos.balance("bob") != 6 {
+		t.Errorf("Expected bob to keep 6 wrapped tokens, but got %d", cosmos.balance("bob"))
+	}
+}
+
+func TestBridgeNeedsThreshold(t *testing.T) {
+	shares := runCommittee(t, 3, 2)
+	pi := newMockChain("pi-1", shares[0].GroupKey)
+	cosmos := newMockChain("cosmoshub-4", shares[0].GroupKey)
+	startRelayers(t, shares, []int{1}, pi, cosmos)
+
+	pi.send(EventLock, "alice", "cosmoshub-4", "bob", 10)
+	pi.finalize()
+	time.Sleep(200 * time.Millisecond)
+	if cosmos.balance("bob") != 0 {
+		t.Errorf("Expected a single relayer not to be able to mint")
+	}
+}
+
+func TestBridgeToleratesOfflineRelayer(t *testing.T) {
+	shares := runCommittee(t, 3, 2)
+	pi := newMockChain("pi-1", shares[0].GroupKey)
+	cosmos := newMockChain("cosmoshub-4", shares[0].GroupKey)
+	startRelayers(t, shares, []int{1, 3}, pi, cosmos)
+
+	pi.send(EventLock, "alice", "cosmoshub-4", "bob", 10)
+	pi.finalize()
+	waitFor(t, "the mint with one relayer offline", func() bool { return cosmos.balance("bob") == 10 })
+}
+
+func TestBridgeRetriesUnavailableDestination(t *testing.T) {
+	shares := runCommittee(t, 3, 2)
+	pi := newMockChain("pi-1", shares[0].GroupKey)
+	cosmos := newMockChain("cosmoshub-4", shares[0].GroupKey)
+	cosmos.down = true
+	startRelayers(t, shares, []int{1, 2, 3}, pi, cosmos)
+
+	pi.send(EventLock, "alice", "cosmoshub-4", "bob", 10)
+	pi.finalize()
+	time.Sleep(100 * time.Millisecond)
+	cosmos.mu.Lock()
+	cosmos.down = false
+	cosmos.mu.Unlock()
+	waitFor(t, "the mint once the destination is back", func() bool { return cosmos.balance("bob") == 10 })
+}
+
+func TestRelayerReplayProtection(t *testing.T) {
+	shares := runCommittee(t, 3, 2)
+	cosmos := newMockChain("cosmoshub-4", shares[0].GroupKey)
+	event := &Event{
+		Kind: EventLock, SourceChain: "pi-1", DestinationChain: "cosmoshub-4",
+		TxHash: "0xabc", Asset: "upi", Amount: big.NewInt(10), Recipient: "bob",
+	}
+	var signatureShares []*tss.SignatureShare
+	for _, share := range shares[:2] {
+		signatureShare, err := share.Sign(event.Digest())
+		if err != nil {
+			t.Fatal(err)
+		}
+		signatureShares = append(signatureShares, signatureShare)
+	}
+	signature, err := shares[0].Combine(event.Digest(), signatureShares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation := &Attestation{Event: event, Signature: signature}
+
+	newRelayer := func() *Relayer {
+		relayer, err := NewRelayer(&Config{Share: shares[2], Transport: newMemoryNetwork(1)[0], Destinations: []Destination{cosmos}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return relayer
+	}
+	ctx := context.Background()
+	relayer := newRelayer()
+	for i := 0; i < 2; i++ {
+		if err := relayer.Release(ctx, attestation); err != nil {
+			t.Errorf("Expected Release to succeed, but got error: %s", err)
+		}
+	}
+	// A relayer that lost its store still finds the event released on chain
+	if err := newRelayer().Release(ctx, attestation); err != nil {
+		t.Errorf("Expected Release by another relayer to succeed, but got error: %s", err)
+	}
+	if cosmos.releaseCount() != 1 || cosmos.balance("bob") != 10 {
+		t.Errorf("Expected one release of 10, but got %d releases and %d", cosmos.releaseCount(), cosmos.balance("bob"))
+	}
+
+	forged := &Attestation{Event: &Event{}, Signature: signature}
+	*forged.Event = *event
+	forged.Event.TxHash = "0xdef"
+	if err := relayer.Release(ctx, forged); !errors.Is(err, ErrInvalidAttestation) {
+		t.Errorf("Expected an attestation reused for another event to be rejected, but got %v", err)
+	}
+	unknown := &Attestation{Event: &Event{}, Signature: signature}
+	*unknown.Event = *event
+	unknown.Event.DestinationChain = "polkadot"
+	if err := relayer.Release(ctx, unknown); !errors.Is(err, ErrUnknownDestination) {
+		t.Errorf("Expected ErrUnknownDestination, but got %v", err)
+	}
+}
+
+func TestRelayerExpiresVotes(t *testing.T) {
+	shares := runCommittee(t, 3, 2)
+	cosmos := newMockChain("cosmoshub-4", shares[0].GroupKey)
+	relayer, err := NewRelayer(&Config{
+		Share:        shares[0],
+		Transport:    newMemoryNetwork(1)[0],
+		Destinations: []Destination{cosmos},
+		VoteTTL:      20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &Event{
+		Kind: EventLock, SourceChain: "pi-1", DestinationChain: "cosmoshub-4",
+		TxHash: "0xabc", Asset: "upi", Amount: big.NewInt(10), Recipient: "bob",
+	}
+	if err := relayer.vote(context.Background(), event); err != nil {
+		t.Fatalf("Expected vote to succeed, but got error: %s", err)
+	}
+	relayer.expire()
+	if len(relayer.votes) != 1 {
+		t.Fatalf("Expected the tally to be kept within VoteTTL, but got %d tallies", len(relayer.votes))
+	}
+	time.Sleep(30 * time.Millisecond)
+	relayer.expire()
+	if len(relayer.votes) != 0 {
+		t.Errorf("Expected the tally to expire without the threshold, but got %d tallies", len(relayer.votes))
+	}
+}
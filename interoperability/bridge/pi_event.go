@@ -0,0 +1,170 @@
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"pi/crypto/bls"
+)
+
+// EventKind is what happened on the source chain
+type EventKind string
+
+// Tokens native to the source chain are locked there and minted as wrapped
+// tokens on the destination; wrapped tokens are burned to unlock the
+// originals on their home chain.
+const (
+	EventLock EventKind = "lock"
+	EventBurn EventKind = "burn"
+)
+
+// Action is what an attested event releases on the destination chain
+type Action string
+
+const (
+	ActionMint   Action = "mint"
+	ActionUnlock Action = "unlock"
+)
+
+// digestDomain separates bridge attestations from other uses of the
+// relayers' group key
+const digestDomain = "pi/bridge/v1"
+
+var (
+	// ErrInvalidEvent is returned for events missing a required field
+	ErrInvalidEvent = errors.New("bridge: invalid event")
+
+	// ErrInvalidAttestation is returned for attestations whose signature
+	// doesn't verify against the relayers' group key
+	ErrInvalidAttestation = errors.New("bridge: invalid attestation")
+)
+
+// Event is a lock or burn observed on a source chain
+type Event struct {
+	Kind             EventKind `json:"kind"`
+	SourceChain      string    `json:"source_chain"`
+	DestinationChain string    `json:"destination_chain"`
+	// TxHash and Index locate the event on the source chain: the transaction
+	// and the position of the event within it
+	TxHash string `json:"tx_hash"`
+	Index  uint32 `json:"index"`
+	Height uint64 `json:"height"`
+
+	Asset     string   `json:"asset"`
+	Amount    *big.Int `json:"amount"`
+	Sender    string   `json:"sender"`
+	Recipient string   `json:"recipient"`
+}
+
+// Validate checks that the event can be released
+func (e *Event) Validate() error {
+	switch {
+	case e.Kind != EventLock && e.Kind != EventBurn:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidEvent, e.Kind)
+	case e.SourceChain == "" || e.DestinationChain == "" || e.SourceChain == e.DestinationChain:
+		return fmt.Errorf("%w: invalid route from %q to %q", ErrInvalidEvent, e.SourceChain, e.DestinationChain)
+	case e.TxHash == "":
+		return fmt.Errorf("%w: missing transaction hash", ErrInvalidEvent)
+	case e.Asset == "" || e.Recipient == "":
+		return fmt.Errorf("%w: missing asset or recipient", ErrInvalidEvent)
+	case e.Amount == nil || e.Amount.Sign() <= 0:
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidEvent)
+	}
+	return nil
+}
+
+// Action returns what the event releases on the destination chain
+func (e *Event) Action() Action {
+	if e.Kind == EventBurn {
+		return ActionUnlock
+	}
+	return ActionMint
+}
+
+// ID identifies the event by where it happened. Destinations release each
+// ID at most once, which is what protects the bridge against replays.
+func (e *Event) ID() string {
+	h := sha256.New()
+	h.Write(appendField(nil, []byte(e.SourceChain)))
+	h.Write(appendField(nil, []byte(e.TxHash)))
+	h.Write(binary.BigEndian.AppendUint32(nil, e.Index))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Digest is the message relayers sign to attest the event. It covers every
+// field, so an attestation can't be reused for a different amount or
+// recipient under the same ID.
+func (e *Event) Digest() []byte {
+	b := appendField(nil, []byte(digestDomain))
+	b = appendField(b, []byte(e.Kind))
+	b = appendField(b, []byte(e.SourceChain))
+	b = appendField(b, []byte(e.DestinationChain))
+	b = appendField(b, []byte(e.TxHash))
+	b = binary.BigEndian.AppendUint32(b, e.Index)
+	b = binary.BigEndian.AppendUint64(b, e.Height)
+	b = appendField(b, []byte(e.Asset))
+	amount := []byte(nil)
+	if e.Amount != nil {
+		amount = e.Amount.Bytes()
+	}
+	b = appendField(b, amount)
+	b = appendField(b, []byte(e.Sender))
+	b = appendField(b, []byte(e.Recipient))
+	digest := sha256.Sum256(b)
+	return digest[:]
+}
+
+// appendField appends a length-prefixed field, so fields can't run into each other
+func appendField(b []byte, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+// Attestation is an event signed by a threshold of relayers with their
+// group key. Destination chains release the event only with a valid
+// attestation.
+type Attestation struct {
+	Event     *Event
+	Signature *bls.Signature
+}
+
+// Verify checks the attestation against the relayers' group key
+func (a *Attestation) Verify(groupKey *bls.PublicKey) error {
+	if err := a.Event.Validate(); err != nil {
+		return err
+	}
+	if a.Signature == nil || !groupKey.Verify(a.Event.Digest(), a.Signature) {
+		return ErrInvalidAttestation
+	}
+	return nil
+}
+
+// attestationJSON is the wire form of an Attestation
+type attestationJSON struct {
+	Event     *Event `json:"event"`
+	Signature []byte `json:"signature"`
+}
+
+// MarshalJSON encodes the attestation with its signature in compressed form
+func (a *Attestation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&attestationJSON{Event: a.Event, Signature: a.Signature.Bytes()})
+}
+
+// UnmarshalJSON decodes an attestation encoded by MarshalJSON
+func (a *Attestation) UnmarshalJSON(data []byte) error {
+	var encoded attestationJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	signature, err := bls.SignatureFromBytes(encoded.Signature)
+	if err != nil {
+		return err
+	}
+	a.Event, a.Signature = encoded.Event, signature
+	return nil
+}
@@ -0,0 +1,106 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"pi/crypto/bls"
+)
+
+func testEvent() *Event {
+	return &Event{
+		Kind:             EventLock,
+		SourceChain:      "pi-1",
+		DestinationChain: "cosmoshub-4",
+		TxHash:           "0xabc",
+		Index:            0,
+		Height:           7,
+		Asset:            "upi",
+		Amount:           big.NewInt(10),
+		Sender:           "alice",
+		Recipient:        "bob",
+	}
+}
+
+func TestEventValidate(t *testing.T) {
+	if err := testEvent().Validate(); err != nil {
+		t.Errorf("Expected Validate to succeed, but got error: %s", err)
+	}
+	for i, change := range []func(*Event){
+		func(e *Event) { e.Kind = "steal" },
+		func(e *Event) { e.DestinationChain = e.SourceChain },
+		func(e *Event) { e.TxHash = "" },
+		func(e *Event) { e.Recipient = "" },
+		func(e *Event) { e.Amount = big.NewInt(0) },
+		func(e *Event) { e.Amount = nil },
+	} {
+		event := testEvent()
+		change(event)
+		if err := event.Validate(); !errors.Is(err, ErrInvalidEvent) {
+			t.Errorf("Expected event %d to be invalid, but got %v", i, err)
+		}
+	}
+}
+
+func TestEventIDAndDigest(t *testing.T) {
+	event := testEvent()
+	altered := testEvent()
+	altered.Amount = big.NewInt(1000)
+	if event.ID() != altered.ID() {
+		t.Errorf("Expected the ID to depend only on where the event happened")
+	}
+	if string(event.Digest()) == string(altered.Digest()) {
+		t.Errorf("Expected the digest to cover the amount")
+	}
+	other := testEvent()
+	other.Index = 1
+	if event.ID() == other.ID() {
+		t.Errorf("Expected events at different indices to have different IDs")
+	}
+	if event.Action() != ActionMint {
+		t.Errorf("Expected a lock to mint")
+	}
+	other.Kind = EventBurn
+	if other.Action() != ActionUnlock {
+		t.Errorf("Expected a burn to unlock")
+	}
+}
+
+func TestAttestation(t *testing.T) {
+	key, err := bls.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := testEvent()
+	signature, err := key.Sign(event.Digest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation := &Attestation{Event: event, Signature: signature}
+	if err := attestation.Verify(key.PublicKey()); err != nil {
+		t.Errorf("Expected Verify to succeed, but got error: %s", err)
+	}
+
+	data, err := json.Marshal(attestation)
+	if err != nil {
+		t.Fatalf("Expected Marshal to succeed, but got error: %s", err)
+	}
+	var decoded Attestation
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Expected Unmarshal to succeed, but got error: %s", err)
+	}
+	if err := decoded.Verify(key.PublicKey()); err != nil {
+		t.Errorf("Expected the decoded attestation to verify, but got error: %s", err)
+	}
+
+	decoded.Event.Amount = big.NewInt(1000)
+	if err := decoded.Verify(key.PublicKey()); !errors.Is(err, ErrInvalidAttestation) {
+		t.Errorf("Expected an altered event to fail verification, but got %v", err)
+	}
+	other, _ := bls.GenerateKey(nil)
+	if err := attestation.Verify(other.PublicKey()); !errors.Is(err, ErrInvalidAttestation) {
+		t.Errorf("Expected verification with another key to fail, but got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package bridge
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store records the IDs of events a relayer has released, so it doesn't
+// release them again after a restart
+type Store interface {
+	// Has reports whether the event was released
+	Has(id string) (bool, error)
+	// Add records that the event was released
+	Add(id string) error
+}
+
+// MemoryStore is a Store that lasts as long as the process
+type MemoryStore struct {
+	ids map[string]bool
+	mu  sync.Mutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ids: make(map[string]bool)}
+}
+
+// Has reports whether the event was released
+func (s *MemoryStore) Has(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ids[id], nil
+}
+
+// Add records that the event was released
+func (s *MemoryStore) Add(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[id] = true
+	return nil
+}
+
+// FileStore is a Store that survives restarts. IDs are appended to a file,
+// one per line, and synced before Add returns.
+type FileStore struct {
+	file *os.File
+	ids  map[string]bool
+	mu   sync.Mutex
+}
+
+// NewFileStore opens the store at path, creating it if needed
+func NewFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// A partial last line from a crash is ignored; the event is checked
+		// against the destination chain before it is released again
+		if id := strings.TrimSpace(scanner.Text()); len(id) == 64 {
+			ids[id] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileStore{file: file, ids: ids}, nil
+}
+
+// Has reports whether the event was released
+func (s *FileStore) Has(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ids[id], nil
+}
+
+// Add records that the event was released
+func (s *FileStore) Add(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids[id] {
+		return nil
+	}
+	if _, err := s.file.WriteString("\n" + id + "\n"); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.ids[id] = true
+	return nil
+}
+
+// Close closes the store's file
+func (s *FileStore) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,68 @@
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testID1 = "1111111111111111111111111111111111111111111111111111111111111111"
+	testID2 = "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func testStore(t *testing.T, store Store) {
+	if has, err := store.Has(testID1); err != nil || has {
+		t.Errorf("Expected an empty store, but got %v, %v", has, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Add(testID1); err != nil {
+			t.Errorf("Expected Add to succeed, but got error: %s", err)
+		}
+	}
+	if has, err := store.Has(testID1); err != nil || !has {
+		t.Errorf("Expected the added ID to be found, but got %v, %v", has, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge", "released")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected NewFileStore to succeed, but got error: %s", err)
+	}
+	testStore(t, store)
+	store.Close()
+
+	// Simulate a crash in the middle of writing an ID
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(testID2[:10])
+	file.Close()
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected reopening to succeed, but got error: %s", err)
+	}
+	defer reopened.Close()
+	if has, _ := reopened.Has(testID1); !has {
+		t.Errorf("Expected the ID to survive reopening")
+	}
+	if has, _ := reopened.Has(testID2); has {
+		t.Errorf("Expected a partially written ID to be ignored")
+	}
+	if err := reopened.Add(testID2); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "\n"+testID2+"\n") {
+		t.Errorf("Expected the new ID on a line of its own, but got %q", data)
+	}
+}
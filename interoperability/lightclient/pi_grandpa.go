@@ -0,0 +1,419 @@
+package lightclient
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// GRANDPA light client for Polkadot and other Substrate chains. A header is
+// final once a justification carries precommits for it, or a descendant,
+// from authorities holding more than two thirds of the current authority
+// set's weight. Authority set changes are scheduled in header digests and
+// enacted a number of blocks later.
+
+// Digest item, consensus log and vote variants
+const (
+	digestOther          = 0
+	digestConsensus      = 4
+	digestSeal           = 5
+	digestPreRuntime     = 6
+	digestRuntimeUpdated = 8
+
+	grandpaScheduledChange = 1
+	grandpaForcedChange    = 2
+
+	grandpaPrecommit = 1
+)
+
+// grandpaEngineID tags GRANDPA's consensus digests
+var grandpaEngineID = [4]byte{'F', 'R', 'N', 'K'}
+
+// ErrMissingAuthorityChange is returned for headers past a scheduled
+// authority set change that hasn't been enacted by updating the client with
+// the header at which it takes effect
+var ErrMissingAuthorityChange = errors.New("lightclient: header enacting authority set change required first")
+
+// SubstrateHeader is a Substrate block header. Digest holds the SCALE
+// encoded digest items.
+type SubstrateHeader struct {
+	ParentHash     [32]byte `json:"parent_hash"`
+	Number         uint32   `json:"number"`
+	StateRoot      [32]byte `json:"state_root"`
+	ExtrinsicsRoot [32]byte `json:"extrinsics_root"`
+	Digest         [][]byte `json:"digest"`
+}
+
+// Encode returns the SCALE encoding of the header
+func (h *SubstrateHeader) Encode() []byte {
+	b := append([]byte(nil), h.ParentHash[:]...)
+	b = appendCompact(b, uint64(h.Number))
+	b = append(b, h.StateRoot[:]...)
+	b = append(b, h.ExtrinsicsRoot[:]...)
+	b = appendCompact(b, uint64(len(h.Digest)))
+	for _, item := range h.Digest {
+		b = append(b, item...)
+	}
+	return b
+}
+
+// Hash is the BLAKE2b-256 hash of the encoded header
+func (h *SubstrateHeader) Hash() [32]byte {
+	return blake2b.Sum256(h.Encode())
+}
+
+// DecodeSubstrateHeader decodes a SCALE encoded header
+func DecodeSubstrateHeader(data []byte) (*SubstrateHeader, error) {
+	r := &scaleReader{data: data}
+	header, err := decodeSubstrateHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.data) != 0 {
+		return nil, fmt.Errorf("%w: trailing bytes after header", ErrInvalidHeader)
+	}
+	return header, nil
+}
+
+func decodeSubstrateHeader(r *scaleReader) (*SubstrateHeader, error) {
+	header := &SubstrateHeader{}
+	copy(header.ParentHash[:], r.take(32))
+	header.Number = uint32(r.compact())
+	copy(header.StateRoot[:], r.take(32))
+	copy(header.ExtrinsicsRoot[:], r.take(32))
+	items := r.compact()
+	for i := uint64(0); i < items && r.err == nil; i++ {
+		start := r.data
+		switch kind := r.u8(); kind {
+		case digestConsensus, digestSeal, digestPreRuntime:
+			r.take(4)
+			r.vec()
+		case digestOther:
+			r.vec()
+		case digestRuntimeUpdated:
+		default:
+			return nil, fmt.Errorf("%w: unknown digest item %d", ErrInvalidHeader, kind)
+		}
+		header.Digest = append(header.Digest, start[:len(start)-len(r.data)])
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHeader, r.err)
+	}
+	return header, nil
+}
+
+// GrandpaAuthority is a member of an authority set with its voting weight
+type GrandpaAuthority struct {
+	ID     ed25519.PublicKey `json:"id"`
+	Weight uint64            `json:"weight"`
+}
+
+// scheduledChange returns the authority set change scheduled by the header,
+// and the number of blocks until it takes effect
+func (h *SubstrateHeader) scheduledChange() ([]GrandpaAuthority, uint32, bool, error) {
+	for _, item := range h.Digest {
+		r := &scaleReader{data: item}
+		if r.u8() != digestConsensus {
+			continue
+		}
+		if engine := r.take(4); !bytes.Equal(engine, grandpaEngineID[:]) {
+			continue
+		}
+		log := &scaleReader{data: r.vec()}
+		// Forced changes are only used to recover from stalled finality by
+		// governance, which a light client can't verify
+		if log.u8() != grandpaScheduledChange {
+			continue
+		}
+		n := log.compact()
+		if n > uint64(len(log.data))/40 {
+			return nil, 0, false, fmt.Errorf("%w: malformed authority set change", ErrInvalidHeader)
+		}
+		authorities := make([]GrandpaAuthority, n)
+		for i := range authorities {
+			authorities[i].ID = ed25519.PublicKey(append([]byte(nil), log.take(32)...))
+			authorities[i].Weight = log.u64()
+		}
+		delay := log.u32()
+		if log.err != nil || r.err != nil {
+			return nil, 0, false, fmt.Errorf("%w: malformed authority set change", ErrInvalidHeader)
+		}
+		return authorities, delay, true, nil
+	}
+	return nil, 0, false, nil
+}
+
+// SignedPrecommit is an authority's precommit for a block
+type SignedPrecommit struct {
+	TargetHash   [32]byte `json:"target_hash"`
+	TargetNumber uint32   `json:"target_number"`
+	Signature    [64]byte `json:"signature"`
+	ID           [32]byte `json:"id"`
+}
+
+// GrandpaJustification proves a block final. Precommits may be for
+// descendants of the target, whose headers are in VotesAncestries.
+type GrandpaJustification struct {
+	Round           uint64             `json:"round"`
+	TargetHash      [32]byte           `json:"target_hash"`
+	TargetNumber    uint32             `json:"target_number"`
+	Precommits      []SignedPrecommit  `json:"precommits"`
+	VotesAncestries []*SubstrateHeader `json:"votes_ancestries"`
+}
+
+// DecodeGrandpaJustification decodes a SCALE encoded justification, as
+// returned by the grandpa_proveFinality RPC
+func DecodeGrandpaJustification(data []byte) (*GrandpaJustification, error) {
+	r := &scaleReader{data: data}
+	j := &GrandpaJustification{Round: r.u64()}
+	copy(j.TargetHash[:], r.take(32))
+	j.TargetNumber = r.u32()
+	n := r.compact()
+	if n > uint64(len(r.data))/132 {
+		return nil, fmt.Errorf("%w: malformed justification", ErrInvalidHeader)
+	}
+	j.Precommits = make([]SignedPrecommit, n)
+	for i := range j.Precommits {
+		p := &j.Precommits[i]
+		copy(p.TargetHash[:], r.take(32))
+		p.TargetNumber = r.u32()
+		copy(p.Signature[:], r.take(64))
+		copy(p.ID[:], r.take(32))
+	}
+	ancestries := r.compact()
+	for i := uint64(0); i < ancestries && r.err == nil; i++ {
+		header, err := decodeSubstrateHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		j.VotesAncestries = append(j.VotesAncestries, header)
+	}
+	if r.err != nil || len(r.data) != 0 {
+		return nil, fmt.Errorf("%w: malformed justification", ErrInvalidHeader)
+	}
+	return j, nil
+}
+
+// precommitSignBytes is the message an authority signs for a precommit:
+// the encoded Message::Precommit, round and authority set ID
+func precommitSignBytes(precommit *SignedPrecommit, round, setID uint64) []byte {
+	b := []byte{grandpaPrecommit}
+	b = append(b, precommit.TargetHash[:]...)
+	b = binary.LittleEndian.AppendUint32(b, precommit.TargetNumber)
+	b = binary.LittleEndian.AppendUint64(b, round)
+	return binary.LittleEndian.AppendUint64(b, setID)
+}
+
+// Verify checks that authorities of the set with more than two thirds of
+// its weight precommitted to the target or its descendants
+func (j *GrandpaJustification) Verify(setID uint64, authorities []GrandpaAuthority) error {
+	weights := make(map[[32]byte]uint64)
+	total := uint64(0)
+	for _, authority := range authorities {
+		var id [32]byte
+		copy(id[:], authority.ID)
+		weights[id] += authority.Weight
+		total += authority.Weight
+	}
+	ancestry := make(map[[32]byte]*SubstrateHeader)
+	for _, header := range j.VotesAncestries {
+		ancestry[header.Hash()] = header
+	}
+
+	voted := make(map[[32]byte]bool)
+	weight := uint64(0)
+	for i := range j.Precommits {
+		precommit := &j.Precommits[i]
+		authorityWeight, ok := weights[precommit.ID]
+		if !ok || voted[precommit.ID] {
+			continue
+		}
+		if !ed25519.Verify(precommit.ID[:], precommitSignBytes(precommit, j.Round, setID), precommit.Signature[:]) {
+			return fmt.Errorf("%w: invalid precommit signature", ErrInvalidHeader)
+		}
+		if !j.descends(precommit, ancestry) {
+			return fmt.Errorf("%w: precommit isn't for a descendant of the target", ErrInvalidHeader)
+		}
+		voted[precommit.ID] = true
+		weight += authorityWeight
+	}
+	// GRANDPA tolerates f faulty weight out of 3f+1
+	if weight < total-(total-1)/3 {
+		return ErrNotEnoughVotingPower
+	}
+	return nil
+}
+
+// descends reports whether the precommit's block is the target or descends
+// from it through the ancestry headers
+func (j *GrandpaJustification) descends(precommit *SignedPrecommit, ancestry map[[32]byte]*SubstrateHeader) bool {
+	hash := precommit.TargetHash
+	for steps := 0; steps <= len(ancestry); steps++ {
+		if hash == j.TargetHash {
+			return true
+		}
+		header, ok := ancestry[hash]
+		if !ok {
+			return false
+		}
+		hash = header.ParentHash
+	}
+	return false
+}
+
+// pendingChange is an authority set change waiting to be enacted
+type pendingChange struct {
+	at          uint32
+	authorities []GrandpaAuthority
+}
+
+// GrandpaClient tracks a Substrate chain finalized by GRANDPA
+type GrandpaClient struct {
+	*consensusStates
+	chainID string
+
+	setID       uint64
+	authorities []GrandpaAuthority
+	pending     *pendingChange
+	latest      uint32
+	latestHash  [32]byte
+	mu          sync.Mutex
+}
+
+// NewGrandpaClient creates a client trusting a finalized header and the
+// authority set that finalizes its successors, both obtained out of band
+func NewGrandpaClient(chainID string, trusted *SubstrateHeader, setID uint64, authorities []GrandpaAuthority) *GrandpaClient {
+	return &GrandpaClient{
+		consensusStates: newConsensusStates(&ConsensusState{Height: uint64(trusted.Number), Root: trusted.StateRoot[:]}),
+		chainID:         chainID,
+		setID:           setID,
+		authorities:     authorities,
+		latest:          trusted.Number,
+		latestHash:      trusted.Hash(),
+	}
+}
+
+// ChainID identifies the tracked chain
+func (c *GrandpaClient) ChainID() string {
+	return c.chainID
+}
+
+// SetID returns the ID of the authority set the client currently trusts
+func (c *GrandpaClient) SetID() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setID
+}
+
+// Update verifies a header finalized by the justification. Ancestry holds
+// the headers between the latest trusted header and this one, so the client
+// sees the authority set changes scheduled in the blocks it skips. A header
+// at which a change takes effect can't be skipped: it is the last header the
+// old set finalizes, and the client rejects later headers until it is given.
+func (c *GrandpaClient) Update(header *SubstrateHeader, justification *GrandpaJustification, ancestry ...*SubstrateHeader) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case header == nil || justification == nil:
+		return fmt.Errorf("%w: missing header or justification", ErrInvalidHeader)
+	case justification.TargetHash != header.Hash() || justification.TargetNumber != header.Number:
+		return fmt.Errorf("%w: justification is for another block", ErrInvalidHeader)
+	case header.Number <= c.latest:
+		return fmt.Errorf("%w: block %d isn't after trusted block %d", ErrInvalidHeader, header.Number, c.latest)
+	}
+	skipped, err := c.skipped(header, ancestry)
+	if err != nil {
+		return err
+	}
+	pending := c.pending
+	for _, skippedHeader := range skipped {
+		authorities, delay, scheduled, err := skippedHeader.scheduledChange()
+		if err != nil {
+			return err
+		}
+		if scheduled {
+			pending = &pendingChange{at: skippedHeader.Number + delay, authorities: authorities}
+		}
+		if pending != nil && pending.at <= skippedHeader.Number {
+			return fmt.Errorf("%w at block %d", ErrMissingAuthorityChange, pending.at)
+		}
+	}
+	if pending != nil && header.Number > pending.at {
+		return fmt.Errorf("%w at block %d", ErrMissingAuthorityChange, pending.at)
+	}
+	if err := justification.Verify(c.setID, c.authorities); err != nil {
+		return err
+	}
+	authorities, delay, scheduled, err := header.scheduledChange()
+	if err != nil {
+		return err
+	}
+
+	c.latest, c.latestHash = header.Number, header.Hash()
+	c.add(&ConsensusState{Height: uint64(header.Number), Root: header.StateRoot[:]})
+	c.pending = pending
+	if scheduled {
+		c.pending = &pendingChange{at: header.Number + delay, authorities: authorities}
+	}
+	if c.pending != nil && c.pending.at == header.Number {
+		c.authorities = c.pending.authorities
+		c.setID++
+		c.pending = nil
+	}
+	return nil
+}
+
+// skipped links header to the latest trusted header through the ancestry
+// and returns the headers in between, oldest first
+func (c *GrandpaClient) skipped(header *SubstrateHeader, ancestry []*SubstrateHeader) ([]*SubstrateHeader, error) {
+	byHash := make(map[[32]byte]*SubstrateHeader, len(ancestry))
+	for _, ancestor := range ancestry {
+		if ancestor != nil {
+			byHash[ancestor.Hash()] = ancestor
+		}
+	}
+	if uint64(header.Number-c.latest-1) > uint64(len(ancestry)) {
+		return nil, fmt.Errorf("%w: ancestry is missing blocks after %d", ErrInvalidHeader, c.latest)
+	}
+	skipped := make([]*SubstrateHeader, header.Number-c.latest-1)
+	parent := header.ParentHash
+	for number := header.Number - 1; number > c.latest; number-- {
+		ancestor, ok := byHash[parent]
+		if !ok || ancestor.Number != number {
+			return nil, fmt.Errorf("%w: ancestry is missing block %d", ErrInvalidHeader, number)
+		}
+		skipped[number-c.latest-1] = ancestor
+		parent = ancestor.ParentHash
+	}
+	if parent != c.latestHash {
+		return nil, fmt.Errorf("%w: block %d doesn't descend from trusted block %d", ErrInvalidHeader, header.Number, c.latest)
+	}
+	return skipped, nil
+}
+
+// VerifyMembership checks a storage proof: the JSON encoding of the trie
+// nodes returned by the state_getReadProof RPC. Root is the header's state root.
+func (c *GrandpaClient) VerifyMembership(height uint64, proof []byte, key, value []byte) error {
+	state, err := c.ConsensusState(height)
+	if err != nil {
+		return err
+	}
+	var nodes [][]byte
+	if err := json.Unmarshal(proof, &nodes); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidProof, err)
+	}
+	stored, err := ReadTrieProof(state.Root, nodes, key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stored, value) {
+		return fmt.Errorf("%w: stored value differs", ErrInvalidProof)
+	}
+	return nil
+}
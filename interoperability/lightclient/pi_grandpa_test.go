@@ -0,0 +1,314 @@
+package lightclient
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// grandpaAuthorities creates n authorities with one unit of weight each
+func grandpaAuthorities(seed byte, n int) ([]GrandpaAuthority, []ed25519.PrivateKey) {
+	authorities := make([]GrandpaAuthority, n)
+	keys := make([]ed25519.PrivateKey, n)
+	for i := range keys {
+		keys[i] = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed + byte(i)}, ed25519.SeedSize))
+		authorities[i] = GrandpaAuthority{ID: keys[i].Public().(ed25519.PublicKey), Weight: 1}
+	}
+	return authorities, keys
+}
+
+// scheduledChangeDigest encodes a GRANDPA consensus digest scheduling a
+// change to the authorities after delay blocks
+func scheduledChangeDigest(authorities []GrandpaAuthority, delay uint32) []byte {
+	log := appendCompact([]byte{grandpaScheduledChange}, uint64(len(authorities)))
+	for _, authority := range authorities {
+		log = append(log, authority.ID...)
+		log = binary.LittleEndian.AppendUint64(log, authority.Weight)
+	}
+	log = binary.LittleEndian.AppendUint32(log, delay)
+	item := append([]byte{digestConsensus}, grandpaEngineID[:]...)
+	return appendScaleBytes(item, log)
+}
+
+// substrateChain builds a chain of n headers after parent
+func substrateChain(parent *SubstrateHeader, n int) []*SubstrateHeader {
+	headers := make([]*SubstrateHeader, n)
+	for i := range headers {
+		header := &SubstrateHeader{ParentHash: parent.Hash(), Number: parent.Number + 1}
+		header.StateRoot[0] = byte(header.Number)
+		// A BABE pre-runtime digest and a seal, as on Polkadot
+		header.Digest = [][]byte{
+			appendScaleBytes([]byte{digestPreRuntime, 'B', 'A', 'B', 'E'}, []byte{1, 2, 3}),
+			appendScaleBytes([]byte{digestSeal, 'B', 'A', 'B', 'E'}, bytes.Repeat([]byte{9}, 64)),
+		}
+		headers[i], parent = header, header
+	}
+	return headers
+}
+
+// justify finalizes target with precommits from the keys at the given
+// indices, each for the block at the same index in votes
+func justify(target *SubstrateHeader, setID uint64, keys []ed25519.PrivateKey, votes []*SubstrateHeader, signers ...int) *GrandpaJustification {
+	j := &GrandpaJustification{Round: 7, TargetHash: target.Hash(), TargetNumber: target.Number}
+	for _, i := range signers {
+		vote := target
+		if votes != nil {
+			vote = votes[i]
+		}
+		precommit := SignedPrecommit{TargetHash: vote.Hash(), TargetNumber: vote.Number}
+		copy(precommit.ID[:], keys[i].Public().(ed25519.PublicKey))
+		copy(precommit.Signature[:], ed25519.Sign(keys[i], precommitSignBytes(&precommit, j.Round, setID)))
+		j.Precommits = append(j.Precommits, precommit)
+	}
+	return j
+}
+
+func encodeJustification(j *GrandpaJustification) []byte {
+	b := binary.LittleEndian.AppendUint64(nil, j.Round)
+	b = append(b, j.TargetHash[:]...)
+	b = binary.LittleEndian.AppendUint32(b, j.TargetNumber)
+	b = appendCompact(b, uint64(len(j.Precommits)))
+	for _, p := range j.Precommits {
+		b = append(b, p.TargetHash[:]...)
+		b = binary.LittleEndian.AppendUint32(b, p.TargetNumber)
+		b = append(b, p.Signature[:]...)
+		b = append(b, p.ID[:]...)
+	}
+	b = appendCompact(b, uint64(len(j.VotesAncestries)))
+	for _, header := range j.VotesAncestries {
+		b = append(b, header.Encode()...)
+	}
+	return b
+}
+
+func TestSubstrateHeaderEncoding(t *testing.T) {
+	genesis := &SubstrateHeader{Number: 1 << 20}
+	header := substrateChain(genesis, 1)[0]
+	header.Digest = append(header.Digest, scheduledChangeDigest(nil, 0), appendScaleBytes([]byte{digestOther}, []byte("other")), []byte{digestRuntimeUpdated})
+
+	decoded, err := DecodeSubstrateHeader(header.Encode())
+	if err != nil {
+		t.Fatalf("Expected DecodeSubstrateHeader to succeed, but got error: %s", err)
+	}
+	if decoded.Hash() != header.Hash() || decoded.Number != header.Number || len(decoded.Digest) != len(header.Digest) {
+		t.Errorf("Expected the decoded header to equal the original, got %+v", decoded)
+	}
+	if _, err := DecodeSubstrateHeader(header.Encode()[:70]); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected DecodeSubstrateHeader of a truncated header to fail, but got: %v", err)
+	}
+	if _, err := DecodeSubstrateHeader(append(header.Encode(), 0)); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected DecodeSubstrateHeader with trailing bytes to fail, but got: %v", err)
+	}
+}
+
+func TestGrandpaJustificationEncoding(t *testing.T) {
+	_, keys := grandpaAuthorities(1, 4)
+	headers := substrateChain(&SubstrateHeader{}, 3)
+	j := justify(headers[0], 0, keys, nil, 0, 1, 2)
+	j.VotesAncestries = headers[1:]
+
+	decoded, err := DecodeGrandpaJustification(encodeJustification(j))
+	if err != nil {
+		t.Fatalf("Expected DecodeGrandpaJustification to succeed, but got error: %s", err)
+	}
+	if decoded.Round != j.Round || decoded.TargetHash != j.TargetHash || len(decoded.Precommits) != 3 ||
+		decoded.Precommits[2] != j.Precommits[2] || len(decoded.VotesAncestries) != 2 ||
+		decoded.VotesAncestries[1].Hash() != headers[2].Hash() {
+		t.Errorf("Expected the decoded justification to equal the original, got %+v", decoded)
+	}
+	if _, err := DecodeGrandpaJustification(encodeJustification(j)[:100]); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected DecodeGrandpaJustification of a truncated justification to fail, but got: %v", err)
+	}
+}
+
+func TestGrandpaJustificationVerify(t *testing.T) {
+	authorities, keys := grandpaAuthorities(1, 4)
+	headers := substrateChain(&SubstrateHeader{}, 3)
+	target := headers[0]
+
+	if err := justify(target, 3, keys, nil, 0, 1, 2).Verify(3, authorities); err != nil {
+		t.Errorf("Expected Verify to succeed, but got error: %s", err)
+	}
+	// Two thirds of the weight isn't enough, nor are repeated votes
+	if err := justify(target, 3, keys, nil, 0, 1).Verify(3, authorities); !errors.Is(err, ErrNotEnoughVotingPower) {
+		t.Errorf("Expected Verify with two of four votes to fail, but got: %v", err)
+	}
+	if err := justify(target, 3, keys, nil, 0, 1, 1).Verify(3, authorities); !errors.Is(err, ErrNotEnoughVotingPower) {
+		t.Errorf("Expected Verify with a repeated vote to fail, but got: %v", err)
+	}
+	// Votes are bound to the authority set
+	if err := justify(target, 3, keys, nil, 0, 1, 2).Verify(4, authorities); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected Verify for another set ID to fail, but got: %v", err)
+	}
+	others, otherKeys := grandpaAuthorities(20, 4)
+	if err := justify(target, 3, otherKeys, nil, 0, 1, 2).Verify(3, authorities); !errors.Is(err, ErrNotEnoughVotingPower) {
+		t.Errorf("Expected Verify by other authorities to fail, but got: %v", err)
+	}
+	if err := justify(target, 3, otherKeys, nil, 0, 1, 2).Verify(3, others); err != nil {
+		t.Errorf("Expected Verify to succeed, but got error: %s", err)
+	}
+
+	// Votes for descendants count once their ancestry is shown
+	votes := []*SubstrateHeader{headers[0], headers[2], headers[1], headers[0]}
+	j := justify(target, 3, keys, votes, 0, 1, 2)
+	if err := j.Verify(3, authorities); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected Verify without ancestry to fail, but got: %v", err)
+	}
+	j.VotesAncestries = headers[1:]
+	if err := j.Verify(3, authorities); err != nil {
+		t.Errorf("Expected Verify with ancestry to succeed, but got error: %s", err)
+	}
+}
+
+func TestGrandpaClientUpdate(t *testing.T) {
+	authorities, keys := grandpaAuthorities(1, 4)
+	trusted := &SubstrateHeader{Number: 100}
+	client := NewGrandpaClient("polkadot", trusted, 3, authorities)
+	headers := substrateChain(trusted, 5)
+
+	// Headers may be skipped while the authority set doesn't change, given
+	// the skipped headers
+	if err := client.Update(headers[1], justify(headers[1], 3, keys, nil, 0, 1, 2)); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected Update without the skipped header to fail, but got: %v", err)
+	}
+	if err := client.Update(headers[1], justify(headers[1], 3, keys, nil, 0, 1, 2), headers[0]); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+	if client.LatestHeight() != 102 {
+		t.Errorf("Expected latest height 102, got %d", client.LatestHeight())
+	}
+	state, err := client.ConsensusState(102)
+	if err != nil {
+		t.Fatalf("Expected ConsensusState to succeed, but got error: %s", err)
+	}
+	if !bytes.Equal(state.Root, headers[1].StateRoot[:]) {
+		t.Errorf("Expected the state root of block 102, got %x", state.Root)
+	}
+
+	tests := []struct {
+		name          string
+		header        *SubstrateHeader
+		justification *GrandpaJustification
+		err           error
+	}{
+		{"old header", headers[0], justify(headers[0], 3, keys, nil, 0, 1, 2), ErrInvalidHeader},
+		{"justification of another block", headers[2], justify(headers[3], 3, keys, nil, 0, 1, 2), ErrInvalidHeader},
+		{"too few votes", headers[2], justify(headers[2], 3, keys, nil, 0), ErrNotEnoughVotingPower},
+		{"votes of another set", headers[2], justify(headers[2], 2, keys, nil, 0, 1, 2), ErrInvalidHeader},
+		{"block of another fork", substrateChain(headers[0], 1)[0], justify(substrateChain(headers[0], 1)[0], 3, keys, nil, 0, 1, 2), ErrInvalidHeader},
+	}
+	for _, test := range tests {
+		if err := client.Update(test.header, test.justification); !errors.Is(err, test.err) {
+			t.Errorf("Expected Update with %s to fail with %v, but got: %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestGrandpaClientAuthoritySetChange(t *testing.T) {
+	authorities, keys := grandpaAuthorities(1, 4)
+	next, nextKeys := grandpaAuthorities(10, 5)
+	trusted := &SubstrateHeader{Number: 100}
+	client := NewGrandpaClient("polkadot", trusted, 3, authorities)
+
+	// Block 101 schedules the next set for block 103
+	headers := substrateChain(trusted, 1)
+	headers[0].Digest = append(headers[0].Digest, scheduledChangeDigest(next, 2))
+	headers = append(headers, substrateChain(headers[0], 3)...)
+
+	if err := client.Update(headers[0], justify(headers[0], 3, keys, nil, 0, 1, 2)); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+	// The change can't be skipped over
+	if err := client.Update(headers[3], justify(headers[3], 4, nextKeys, nil, 0, 1, 2, 3), headers[1:3]...); !errors.Is(err, ErrMissingAuthorityChange) {
+		t.Errorf("Expected Update past the change to fail, but got: %v", err)
+	}
+	// The old set finalizes the block enacting the change, after which only
+	// the new set is trusted
+	if err := client.Update(headers[2], justify(headers[2], 3, keys, nil, 0, 1, 2), headers[1]); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+	if client.SetID() != 4 {
+		t.Errorf("Expected set ID 4, got %d", client.SetID())
+	}
+	if err := client.Update(headers[3], justify(headers[3], 4, keys, nil, 0, 1, 2, 3)); !errors.Is(err, ErrNotEnoughVotingPower) {
+		t.Errorf("Expected Update by the old set to fail, but got: %v", err)
+	}
+	if err := client.Update(headers[3], justify(headers[3], 4, nextKeys, nil, 0, 1, 2, 3)); err != nil {
+		t.Errorf("Expected Update by the new set to succeed, but got error: %s", err)
+	}
+}
+
+func TestGrandpaClientSkippedAuthoritySetChange(t *testing.T) {
+	authorities, keys := grandpaAuthorities(1, 4)
+	next, _ := grandpaAuthorities(10, 5)
+	trusted := &SubstrateHeader{Number: 100}
+
+	// Block 101 schedules the next set for block 103, so the retired set
+	// must not finalize block 104
+	headers := substrateChain(trusted, 1)
+	headers[0].Digest = append(headers[0].Digest, scheduledChangeDigest(next, 2))
+	headers = append(headers, substrateChain(headers[0], 3)...)
+
+	client := NewGrandpaClient("polkadot", trusted, 3, authorities)
+	if err := client.Update(headers[3], justify(headers[3], 3, keys, nil, 0, 1, 2, 3), headers[:3]...); !errors.Is(err, ErrMissingAuthorityChange) {
+		t.Errorf("Expected Update past a skipped change to fail, but got: %v", err)
+	}
+	// The change may be skipped up to the block enacting it
+	if err := client.Update(headers[2], justify(headers[2], 3, keys, nil, 0, 1, 2), headers[:2]...); err != nil {
+		t.Fatalf("Expected Update of the enacting block to succeed, but got error: %s", err)
+	}
+	if client.SetID() != 4 {
+		t.Errorf("Expected set ID 4, got %d", client.SetID())
+	}
+	if err := client.Update(headers[3], justify(headers[3], 4, keys, nil, 0, 1, 2, 3)); !errors.Is(err, ErrNotEnoughVotingPower) {
+		t.Errorf("Expected Update by the retired set to fail, but got: %v", err)
+	}
+
+	// A change scheduled in a skipped block is pending afterwards
+	client = NewGrandpaClient("polkadot", trusted, 3, authorities)
+	if err := client.Update(headers[1], justify(headers[1], 3, keys, nil, 0, 1, 2), headers[0]); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+	if err := client.Update(headers[3], justify(headers[3], 3, keys, nil, 0, 1, 2, 3), headers[2]); !errors.Is(err, ErrMissingAuthorityChange) {
+		t.Errorf("Expected Update past the pending change to fail, but got: %v", err)
+	}
+}
+
+func TestGrandpaClientVerifyMembership(t *testing.T) {
+	key, value := []byte("commitment key"), []byte("commitment")
+	nibbles := make([]byte, 0, len(key)*2)
+	for _, b := range key {
+		nibbles = append(nibbles, b>>4, b&0x0f)
+	}
+	leaf := trieLeafNode(nibbles[1:], value)
+	root := trieBranchNode(nil, map[byte][]byte{nibbles[0]: leaf, 0: trieLeafNode([]byte{1}, []byte("x"))}, nil)
+	proof, err := json.Marshal([][]byte{root, leaf})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorities, keys := grandpaAuthorities(1, 4)
+	trusted := &SubstrateHeader{Number: 100}
+	client := NewGrandpaClient("polkadot", trusted, 0, authorities)
+	header := substrateChain(trusted, 1)[0]
+	copy(header.StateRoot[:], trieHash(root))
+	if err := client.Update(header, justify(header, 0, keys, nil, 0, 1, 2, 3)); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+
+	if err := client.VerifyMembership(101, proof, key, value); err != nil {
+		t.Errorf("Expected VerifyMembership to succeed, but got error: %s", err)
+	}
+	if err := client.VerifyMembership(101, proof, key, []byte("other")); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyMembership of another value to fail, but got: %v", err)
+	}
+	if err := client.VerifyMembership(100, proof, key, value); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyMembership against another root to fail, but got: %v", err)
+	}
+	if err := client.VerifyMembership(102, proof, key, value); !errors.Is(err, ErrUnknownHeight) {
+		t.Errorf("Expected VerifyMembership at an unknown height to fail, but got: %v", err)
+	}
+}
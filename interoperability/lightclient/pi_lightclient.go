@@ -0,0 +1,131 @@
+package lightclient
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"pi/interoperability/protocol"
+)
+
+// Light clients track the headers of a counterparty chain, verifying each
+// against the validators or authorities trusted from the previous one, so
+// that state on that chain can be proven against a header's state root
+// instead of being taken on trust from an RPC endpoint.
+
+var (
+	// ErrUnknownHeight is returned for heights the client has no verified header for
+	ErrUnknownHeight = errors.New("lightclient: no verified header at height")
+
+	// ErrInvalidHeader is returned for headers that don't follow from the trusted ones
+	ErrInvalidHeader = errors.New("lightclient: invalid header")
+
+	// ErrNotEnoughVotingPower is returned when too few trusted validators signed a header
+	ErrNotEnoughVotingPower = errors.New("lightclient: not enough voting power")
+)
+
+// ConsensusState is what the client keeps of a verified header
+type ConsensusState struct {
+	Height    uint64
+	Timestamp time.Time
+	// Root is the state root that membership proofs at this height are verified against
+	Root []byte
+}
+
+// Client is a light client of one chain
+type Client interface {
+	// ChainID identifies the tracked chain
+	ChainID() string
+	// LatestHeight returns the height of the latest verified header
+	LatestHeight() uint64
+	// ConsensusState returns the verified header at height
+	ConsensusState(height uint64) (*ConsensusState, error)
+	// VerifyMembership checks that key has value in the state at height,
+	// using a proof in the chain's own format
+	VerifyMembership(height uint64, proof []byte, key, value []byte) error
+}
+
+// consensusStates holds the verified headers of a client
+type consensusStates struct {
+	states map[uint64]*ConsensusState
+	latest uint64
+	mu     sync.RWMutex
+}
+
+func newConsensusStates(trusted *ConsensusState) *consensusStates {
+	return &consensusStates{
+		states: map[uint64]*ConsensusState{trusted.Height: trusted},
+		latest: trusted.Height,
+	}
+}
+
+// LatestHeight returns the height of the latest verified header
+func (s *consensusStates) LatestHeight() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.latest
+}
+
+// ConsensusState returns the verified header at height
+func (s *consensusStates) ConsensusState(height uint64) (*ConsensusState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.states[height]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownHeight, height)
+	}
+	return state, nil
+}
+
+func (s *consensusStates) add(state *ConsensusState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.Height] = state
+	if state.Height > s.latest {
+		s.latest = state.Height
+	}
+}
+
+// CommitmentPath is the ICS-24 path under which a chain stores the
+// commitment of a packet it sent
+func CommitmentPath(packet *protocol.Packet) string {
+	return fmt.Sprintf("commitments/ports/%s/channels/%s/sequences/%d", packet.SourcePort, packet.SourceChannel, packet.Sequence)
+}
+
+// AcknowledgementPath is the ICS-24 path under which a chain stores the
+// commitment of its acknowledgement of a packet it received
+func AcknowledgementPath(packet *protocol.Packet) string {
+	return fmt.Sprintf("acks/ports/%s/channels/%s/sequences/%d", packet.DestinationPort, packet.DestinationChannel, packet.Sequence)
+}
+
+// PacketVerifier checks packet and acknowledgement proofs against a light
+// client of the chain that wrote them. It is registered with a
+// protocol.Router for that chain.
+type PacketVerifier struct {
+	Client Client
+	// Prefix is prepended to the commitment and acknowledgement paths to get
+	// the storage key, e.g. the key of the IBC pallet's commitment map on a
+	// Substrate chain
+	Prefix []byte
+}
+
+// VerifyPacket checks that the packet's commitment is stored on its source
+// chain at the proof height
+func (v *PacketVerifier) VerifyPacket(packet *protocol.Packet, proof *protocol.PacketProof) error {
+	if packet.SourceChain != v.Client.ChainID() {
+		return fmt.Errorf("%w: packet from %s checked against %s", ErrInvalidProof, packet.SourceChain, v.Client.ChainID())
+	}
+	key := append(append([]byte(nil), v.Prefix...), CommitmentPath(packet)...)
+	return v.Client.VerifyMembership(proof.Height, proof.Proof, key, packet.Commitment())
+}
+
+// VerifyAcknowledgement checks that the acknowledgement's commitment is
+// stored on the packet's destination chain at the proof height
+func (v *PacketVerifier) VerifyAcknowledgement(packet *protocol.Packet, ack *protocol.Acknowledgement, proof *protocol.PacketProof) error {
+	if packet.DestinationChain != v.Client.ChainID() {
+		return fmt.Errorf("%w: acknowledgement from %s checked against %s", ErrInvalidProof, packet.DestinationChain, v.Client.ChainID())
+	}
+	key := append(append([]byte(nil), v.Prefix...), AcknowledgementPath(packet)...)
+	return v.Client.VerifyMembership(proof.Height, proof.Proof, key, ack.Commitment())
+}
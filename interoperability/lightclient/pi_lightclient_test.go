@@ -0,0 +1,146 @@
+package lightclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"pi/interoperability/protocol"
+)
+
+func TestCommitmentPath(t *testing.T) {
+	packet := &protocol.Packet{Sequence: 7, SourcePort: "transfer", SourceChannel: "channel-3"}
+	if path := CommitmentPath(packet); path != "commitments/ports/transfer/channels/channel-3/sequences/7" {
+		t.Errorf("Expected the ICS-24 commitment path, got %s", path)
+	}
+	packet = &protocol.Packet{Sequence: 7, DestinationPort: "transfer", DestinationChannel: "channel-5"}
+	if path := AcknowledgementPath(packet); path != "acks/ports/transfer/channels/channel-5/sequences/7" {
+		t.Errorf("Expected the ICS-24 acknowledgement path, got %s", path)
+	}
+}
+
+// recordingApp records the packets it receives
+type recordingApp struct {
+	received []*protocol.Packet
+}
+
+func (a *recordingApp) OnRecvPacket(ctx context.Context, packet *protocol.Packet) *protocol.Acknowledgement {
+	a.received = append(a.received, packet)
+	return protocol.NewResultAcknowledgement(nil)
+}
+
+func (a *recordingApp) OnAcknowledgementPacket(ctx context.Context, packet *protocol.Packet, ack *protocol.Acknowledgement) error {
+	return nil
+}
+
+func (a *recordingApp) OnTimeoutPacket(ctx context.Context, packet *protocol.Packet) error {
+	return nil
+}
+
+func TestPacketVerifier(t *testing.T) {
+	packet := &protocol.Packet{
+		Sequence:           1,
+		SourceChain:        "pi-1",
+		SourcePort:         "transfer",
+		SourceChannel:      "channel-0",
+		DestinationChain:   "cosmoshub-4",
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-0",
+		TimeoutHeight:      100,
+		Data:               []byte("payload"),
+	}
+	prefix := []byte("ibc/")
+	keys := [][]byte{[]byte("accounts/alice"), append(append([]byte(nil), prefix...), CommitmentPath(packet)...)}
+	root, proofs := simpleMerkleProofs(t, keys, [][]byte{[]byte("100"), packet.Commitment()})
+	proof, err := json.Marshal(proofs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Track the Pi chain from Cosmos
+	validators, secretKeys := piValidators(t, 4)
+	client := NewPiClient(piHeader(1, nil), validators)
+	header := piHeader(2, root)
+	if err := client.Update(header, piCommit(t, validators, secretKeys, header.Hash(), 0, 1, 2)); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+	verifier := &PacketVerifier{Client: client, Prefix: prefix}
+
+	app := &recordingApp{}
+	router := protocol.NewRouter("cosmoshub-4", func(ctx context.Context) (*protocol.ChainStatus, error) {
+		return &protocol.ChainStatus{ChainID: "cosmoshub-4", Height: 10}, nil
+	})
+	router.BindPort("transfer", app)
+	router.SetVerifier("pi-1", verifier)
+
+	forged := *packet
+	forged.Data = []byte("forged")
+	forged.Proof = &protocol.PacketProof{Height: 2, Proof: proof}
+	if _, err := router.ReceivePacket(context.Background(), &forged); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected ReceivePacket of a forged packet to fail, but got: %v", err)
+	}
+	packet.Proof = &protocol.PacketProof{Height: 3, Proof: proof}
+	if _, err := router.ReceivePacket(context.Background(), packet); !errors.Is(err, ErrUnknownHeight) {
+		t.Errorf("Expected ReceivePacket with a proof at an unverified height to fail, but got: %v", err)
+	}
+	packet.Proof.Height = 2
+	ack, err := router.ReceivePacket(context.Background(), packet)
+	if err != nil {
+		t.Fatalf("Expected ReceivePacket to succeed, but got error: %s", err)
+	}
+	if !ack.Success() || len(app.received) != 1 {
+		t.Errorf("Expected the proven packet to be processed once, got ack %+v and %d packets", ack, len(app.received))
+	}
+
+	// Proofs are checked against the client of the packet's source chain
+	other := *packet
+	other.SourceChain = "polkadot"
+	if err := verifier.VerifyPacket(&other, packet.Proof); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyPacket of another chain's packet to fail, but got: %v", err)
+	}
+}
+
+func TestAcknowledgementVerifier(t *testing.T) {
+	packet := &protocol.Packet{
+		Sequence:           1,
+		SourceChain:        "cosmoshub-4",
+		SourcePort:         "transfer",
+		SourceChannel:      "channel-0",
+		DestinationChain:   "pi-1",
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-0",
+		TimeoutHeight:      100,
+		Data:               []byte("payload"),
+	}
+	ack := protocol.NewResultAcknowledgement([]byte("ok"))
+	prefix := []byte("ibc/")
+	keys := [][]byte{[]byte("accounts/alice"), append(append([]byte(nil), prefix...), AcknowledgementPath(packet)...)}
+	root, proofs := simpleMerkleProofs(t, keys, [][]byte{[]byte("100"), ack.Commitment()})
+	proof, err := json.Marshal(proofs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Track the Pi chain, the packet's destination, from Cosmos
+	validators, secretKeys := piValidators(t, 4)
+	client := NewPiClient(piHeader(1, nil), validators)
+	header := piHeader(2, root)
+	if err := client.Update(header, piCommit(t, validators, secretKeys, header.Hash(), 0, 1, 2)); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+	verifier := &PacketVerifier{Client: client, Prefix: prefix}
+
+	if err := verifier.VerifyAcknowledgement(packet, ack, &protocol.PacketProof{Height: 2, Proof: proof}); err != nil {
+		t.Errorf("Expected VerifyAcknowledgement to succeed, but got error: %s", err)
+	}
+	forged := protocol.NewErrorAcknowledgement(errors.New("failed"))
+	if err := verifier.VerifyAcknowledgement(packet, forged, &protocol.PacketProof{Height: 2, Proof: proof}); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyAcknowledgement of a forged acknowledgement to fail, but got: %v", err)
+	}
+	other := *packet
+	other.DestinationChain = "polkadot"
+	if err := verifier.VerifyAcknowledgement(&other, ack, &protocol.PacketProof{Height: 2, Proof: proof}); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyAcknowledgement of another chain's acknowledgement to fail, but got: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package lightclient
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"pi/consensus/algorithm"
+)
+
+// PiHeader is a Pi Network block header, finalized by a commit of the
+// validator set's aggregated BLS votes for its hash
+type PiHeader struct {
+	ChainID    string    `json:"chain_id"`
+	Height     uint64    `json:"height"`
+	Time       time.Time `json:"time"`
+	ParentHash string    `json:"parent_hash"`
+	StateRoot  []byte    `json:"state_root"`
+}
+
+// Hash is the hex SHA-256 of the header's fields, each length-prefixed, and
+// is what validators vote for
+func (h *PiHeader) Hash() string {
+	b := make([]byte, 0, 128)
+	for _, field := range [][]byte{
+		[]byte(h.ChainID),
+		binary.BigEndian.AppendUint64(nil, h.Height),
+		binary.BigEndian.AppendUint64(nil, uint64(h.Time.UnixNano())),
+		[]byte(h.ParentHash),
+		h.StateRoot,
+	} {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+		b = append(b, field...)
+	}
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:])
+}
+
+// PiClient tracks a Pi Network chain. Every header it accepts must carry a
+// commit from the trusted validator set, which is fixed: a validator set
+// change requires a new client.
+type PiClient struct {
+	*consensusStates
+	chainID    string
+	validators *algorithm.ValidatorSet
+
+	latest *PiHeader
+	mu     sync.Mutex
+}
+
+// NewPiClient creates a client trusting header and the validator set that
+// commits its successors, both obtained out of band
+func NewPiClient(trusted *PiHeader, validators *algorithm.ValidatorSet) *PiClient {
+	return &PiClient{
+		consensusStates: newConsensusStates(piConsensusState(trusted)),
+		chainID:         trusted.ChainID,
+		validators:      validators,
+		latest:          trusted,
+	}
+}
+
+func piConsensusState(header *PiHeader) *ConsensusState {
+	return &ConsensusState{Height: header.Height, Timestamp: header.Time, Root: header.StateRoot}
+}
+
+// ChainID identifies the tracked chain
+func (c *PiClient) ChainID() string {
+	return c.chainID
+}
+
+// Update verifies a header against its commit. Headers may be skipped,
+// since every commit is checked against the same validator set.
+func (c *PiClient) Update(header *PiHeader, commit *algorithm.Commit) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case header == nil || commit == nil:
+		return fmt.Errorf("%w: missing header or commit", ErrInvalidHeader)
+	case commit.Signature == nil || len(commit.Signers) == 0:
+		return fmt.Errorf("%w: commit without signatures", ErrInvalidHeader)
+	case header.ChainID != c.chainID:
+		return fmt.Errorf("%w: header is for chain %s", ErrInvalidHeader, header.ChainID)
+	case header.Height <= c.latest.Height:
+		return fmt.Errorf("%w: height %d isn't after trusted height %d", ErrInvalidHeader, header.Height, c.latest.Height)
+	case !header.Time.After(c.latest.Time):
+		return fmt.Errorf("%w: time isn't after the trusted header's", ErrInvalidHeader)
+	case commit.BlockHash != header.Hash():
+		return fmt.Errorf("%w: commit is for block %s", ErrInvalidHeader, commit.BlockHash)
+	}
+	if err := c.validators.VerifyCommit(commit); err != nil {
+		if errors.Is(err, algorithm.ErrNoQuorum) {
+			return ErrNotEnoughVotingPower
+		}
+		return fmt.Errorf("%w: %s", ErrInvalidHeader, err)
+	}
+	c.latest = header
+	c.add(piConsensusState(header))
+	return nil
+}
+
+// VerifyMembership checks a proof that is the JSON encoding of an
+// ExistenceProof into the simple Merkle tree whose root is the state root
+func (c *PiClient) VerifyMembership(height uint64, proof []byte, key, value []byte) error {
+	state, err := c.ConsensusState(height)
+	if err != nil {
+		return err
+	}
+	var existence ExistenceProof
+	if err := json.Unmarshal(proof, &existence); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidProof, err)
+	}
+	return existence.Verify(SimpleMerkleSpec, state.Root, key, value)
+}
@@ -0,0 +1,170 @@
+package lightclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"pi/consensus/algorithm"
+	"pi/crypto/bls"
+)
+
+var piGenesis = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func piValidators(t *testing.T, n int) (*algorithm.ValidatorSet, []*bls.SecretKey) {
+	validators := algorithm.NewValidatorSet()
+	keys := make([]*bls.SecretKey, n)
+	for i := range keys {
+		key, err := bls.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := key.ProvePossession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := validators.Register(fmt.Sprintf("validator-%d", i), key.PublicKey(), proof); err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	return validators, keys
+}
+
+func piHeader(height uint64, stateRoot []byte) *PiHeader {
+	return &PiHeader{
+		ChainID:    "pi-1",
+		Height:     height,
+		Time:       piGenesis.Add(time.Duration(height) * time.Second),
+		ParentHash: fmt.Sprintf("parent-%d", height-1),
+		StateRoot:  stateRoot,
+	}
+}
+
+// piCommit commits blockHash with the votes of the validators at the given indices
+func piCommit(t *testing.T, validators *algorithm.ValidatorSet, keys []*bls.SecretKey, blockHash string, signers ...int) *algorithm.Commit {
+	votes := make([]*algorithm.Vote, 0, len(signers))
+	for _, i := range signers {
+		vote, err := algorithm.SignVote(keys[i], i, blockHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		votes = append(votes, vote)
+	}
+	commit, err := validators.NewCommit(blockHash, votes)
+	if err != nil {
+		t.Fatalf("Expected NewCommit to succeed, but got error: %s", err)
+	}
+	return commit
+}
+
+func TestPiHeaderHash(t *testing.T) {
+	header := piHeader(5, []byte("root"))
+	hash := header.Hash()
+	for _, change := range []func(*PiHeader){
+		func(h *PiHeader) { h.ChainID = "pi-2" },
+		func(h *PiHeader) { h.Height++ },
+		func(h *PiHeader) { h.Time = h.Time.Add(time.Nanosecond) },
+		func(h *PiHeader) { h.ParentHash = "other" },
+		func(h *PiHeader) { h.StateRoot = []byte("other") },
+	} {
+		changed := *header
+		change(&changed)
+		if changed.Hash() == hash {
+			t.Errorf("Expected a header change to change the hash")
+		}
+	}
+}
+
+func TestPiClientUpdate(t *testing.T) {
+	validators, keys := piValidators(t, 4)
+	client := NewPiClient(piHeader(1, nil), validators)
+
+	header := piHeader(10, []byte("root 10"))
+	if err := client.Update(header, piCommit(t, validators, keys, header.Hash(), 0, 1, 3)); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+	if client.LatestHeight() != 10 {
+		t.Errorf("Expected latest height 10, got %d", client.LatestHeight())
+	}
+	state, err := client.ConsensusState(10)
+	if err != nil {
+		t.Fatalf("Expected ConsensusState to succeed, but got error: %s", err)
+	}
+	if string(state.Root) != "root 10" || !state.Timestamp.Equal(header.Time) {
+		t.Errorf("Expected the consensus state of header 10, got %+v", state)
+	}
+
+	other := piHeader(11, nil)
+	other.ChainID = "pi-2"
+	forged := piCommit(t, validators, keys, piHeader(11, nil).Hash(), 0, 1, 2)
+	forged.Signature = piCommit(t, validators, keys, "other", 0, 1, 2).Signature
+	unsigned := piCommit(t, validators, keys, piHeader(11, nil).Hash(), 0, 1, 2)
+	unsigned.Signature = nil
+	noSigners := piCommit(t, validators, keys, piHeader(11, nil).Hash(), 0, 1, 2)
+	noSigners.Signers = nil
+
+	tests := []struct {
+		name   string
+		header *PiHeader
+		commit *algorithm.Commit
+		err    error
+	}{
+		{"old header", piHeader(9, nil), piCommit(t, validators, keys, piHeader(9, nil).Hash(), 0, 1, 2), ErrInvalidHeader},
+		{"commit of another block", piHeader(11, nil), piCommit(t, validators, keys, piHeader(12, nil).Hash(), 0, 1, 2), ErrInvalidHeader},
+		{"other chain", other, piCommit(t, validators, keys, other.Hash(), 0, 1, 2), ErrInvalidHeader},
+		{"forged signature", piHeader(11, nil), forged, ErrInvalidHeader},
+		{"missing header", nil, piCommit(t, validators, keys, piHeader(11, nil).Hash(), 0, 1, 2), ErrInvalidHeader},
+		{"missing commit", piHeader(11, nil), nil, ErrInvalidHeader},
+		{"commit without signature", piHeader(11, nil), unsigned, ErrInvalidHeader},
+		{"commit without signers", piHeader(11, nil), noSigners, ErrInvalidHeader},
+	}
+	for _, test := range tests {
+		if err := client.Update(test.header, test.commit); !errors.Is(err, test.err) {
+			t.Errorf("Expected Update with %s to fail with %v, but got: %v", test.name, test.err, err)
+		}
+	}
+
+	// A commit without a quorum can't be built by NewCommit, so drop a signer
+	header = piHeader(11, nil)
+	commit := piCommit(t, validators, keys, header.Hash(), 0, 1, 2)
+	commit.Signers[0] &^= 1
+	if err := client.Update(header, commit); !errors.Is(err, ErrNotEnoughVotingPower) {
+		t.Errorf("Expected Update without a quorum to fail, but got: %v", err)
+	}
+	if client.LatestHeight() != 10 {
+		t.Errorf("Expected rejected updates to leave the client at height 10, got %d", client.LatestHeight())
+	}
+}
+
+func TestPiClientVerifyMembership(t *testing.T) {
+	keys := [][]byte{[]byte("accounts/alice"), []byte("commitments/ports/transfer/channels/channel-0/sequences/1")}
+	values := [][]byte{[]byte("100"), []byte("commitment")}
+	root, proofs := simpleMerkleProofs(t, keys, values)
+	proof, err := json.Marshal(proofs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validators, secretKeys := piValidators(t, 4)
+	client := NewPiClient(piHeader(1, nil), validators)
+	header := piHeader(2, root)
+	if err := client.Update(header, piCommit(t, validators, secretKeys, header.Hash(), 0, 1, 2, 3)); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+
+	if err := client.VerifyMembership(2, proof, keys[1], values[1]); err != nil {
+		t.Errorf("Expected VerifyMembership to succeed, but got error: %s", err)
+	}
+	if err := client.VerifyMembership(2, proof, keys[0], values[0]); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyMembership of another key to fail, but got: %v", err)
+	}
+	if err := client.VerifyMembership(1, proof, keys[1], values[1]); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyMembership against another root to fail, but got: %v", err)
+	}
+	if err := client.VerifyMembership(3, proof, keys[1], values[1]); !errors.Is(err, ErrUnknownHeight) {
+		t.Errorf("Expected VerifyMembership at an unknown height to fail, but got: %v", err)
+	}
+}
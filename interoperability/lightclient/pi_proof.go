@@ -0,0 +1,259 @@
+package lightclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Membership proofs in the ICS-23 format used by Cosmos SDK stores. A proof
+// rebuilds the path from a key-value leaf to the root: the leaf is hashed
+// with LeafOp, then each InnerOp hashes the result together with its
+// sibling hashes, which are carried in the op's prefix and suffix.
+
+// ErrInvalidProof is returned for proofs that don't prove the key and value
+// against the trusted root
+var ErrInvalidProof = errors.New("lightclient: invalid proof")
+
+// HashOp is a hash function applied by a proof step
+type HashOp int32
+
+// Hash functions, numbered as in ICS-23. Only the ones used by Cosmos and Pi
+// stores are supported.
+const (
+	HashNone   HashOp = 0
+	HashSHA256 HashOp = 1
+)
+
+// LengthOp is how a proof step prefixes data with its length
+type LengthOp int32
+
+// Length prefixes, numbered as in ICS-23
+const (
+	LengthNone     LengthOp = 0
+	LengthVarProto LengthOp = 1
+)
+
+// LeafOp hashes a key and value into a leaf
+type LeafOp struct {
+	Hash         HashOp   `json:"hash"`
+	PrehashKey   HashOp   `json:"prehash_key"`
+	PrehashValue HashOp   `json:"prehash_value"`
+	Length       LengthOp `json:"length"`
+	Prefix       []byte   `json:"prefix"`
+}
+
+// InnerOp hashes a child with its siblings into their parent
+type InnerOp struct {
+	Hash   HashOp `json:"hash"`
+	Prefix []byte `json:"prefix"`
+	Suffix []byte `json:"suffix"`
+}
+
+// ExistenceProof proves that a key has a value in a tree
+type ExistenceProof struct {
+	Key   []byte     `json:"key"`
+	Value []byte     `json:"value"`
+	Leaf  *LeafOp    `json:"leaf"`
+	Path  []*InnerOp `json:"path"`
+}
+
+// ProofSpec describes the tree a proof must have been made for, so a proof
+// can't pass off an inner node as a leaf or the other way round
+type ProofSpec struct {
+	Leaf            LeafOp
+	ChildOrder      []int
+	ChildSize       int
+	MinPrefixLength int
+	MaxPrefixLength int
+	Hash            HashOp
+}
+
+// IAVLSpec is the spec of the IAVL trees of Cosmos SDK module stores
+var IAVLSpec = &ProofSpec{
+	Leaf:            LeafOp{Hash: HashSHA256, PrehashKey: HashNone, PrehashValue: HashSHA256, Length: LengthVarProto, Prefix: []byte{0}},
+	ChildOrder:      []int{0, 1},
+	ChildSize:       33,
+	MinPrefixLength: 4,
+	MaxPrefixLength: 12,
+	Hash:            HashSHA256,
+}
+
+// SimpleMerkleSpec is the spec of the simple Merkle trees over the Cosmos
+// SDK multistore and over Pi state
+var SimpleMerkleSpec = &ProofSpec{
+	Leaf:            LeafOp{Hash: HashSHA256, PrehashKey: HashNone, PrehashValue: HashSHA256, Length: LengthVarProto, Prefix: []byte{0}},
+	ChildOrder:      []int{0, 1},
+	ChildSize:       32,
+	MinPrefixLength: 1,
+	MaxPrefixLength: 1,
+	Hash:            HashSHA256,
+}
+
+func doHash(op HashOp, data []byte) ([]byte, error) {
+	switch op {
+	case HashNone:
+		return data, nil
+	case HashSHA256:
+		sum := sha256.Sum256(data)
+		return sum[:], nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported hash %d", ErrInvalidProof, op)
+	}
+}
+
+func doLength(op LengthOp, data []byte) ([]byte, error) {
+	switch op {
+	case LengthNone:
+		return data, nil
+	case LengthVarProto:
+		return append(binary.AppendUvarint(nil, uint64(len(data))), data...), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported length prefix %d", ErrInvalidProof, op)
+	}
+}
+
+// Apply hashes a key and value into a leaf
+func (op *LeafOp) Apply(key, value []byte) ([]byte, error) {
+	if len(key) == 0 || len(value) == 0 {
+		return nil, fmt.Errorf("%w: empty key or value", ErrInvalidProof)
+	}
+	data := append([]byte(nil), op.Prefix...)
+	for _, field := range []struct {
+		prehash HashOp
+		data    []byte
+	}{{op.PrehashKey, key}, {op.PrehashValue, value}} {
+		hashed, err := doHash(field.prehash, field.data)
+		if err != nil {
+			return nil, err
+		}
+		prefixed, err := doLength(op.Length, hashed)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, prefixed...)
+	}
+	return doHash(op.Hash, data)
+}
+
+// Apply hashes a child into its parent
+func (op *InnerOp) Apply(child []byte) ([]byte, error) {
+	data := append(append(append([]byte(nil), op.Prefix...), child...), op.Suffix...)
+	return doHash(op.Hash, data)
+}
+
+// Calculate returns the root the proof leads to
+func (p *ExistenceProof) Calculate() ([]byte, error) {
+	if p.Leaf == nil {
+		return nil, fmt.Errorf("%w: missing leaf", ErrInvalidProof)
+	}
+	hash, err := p.Leaf.Apply(p.Key, p.Value)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range p.Path {
+		if hash, err = step.Apply(hash); err != nil {
+			return nil, err
+		}
+	}
+	return hash, nil
+}
+
+// check checks the proof's steps against the spec
+func (p *ExistenceProof) check(spec *ProofSpec) error {
+	leaf := p.Leaf
+	if leaf == nil || leaf.Hash != spec.Leaf.Hash || leaf.PrehashKey != spec.Leaf.PrehashKey ||
+		leaf.PrehashValue != spec.Leaf.PrehashValue || leaf.Length != spec.Leaf.Length ||
+		!bytes.HasPrefix(leaf.Prefix, spec.Leaf.Prefix) {
+		return fmt.Errorf("%w: leaf doesn't match spec", ErrInvalidProof)
+	}
+	maxPrefix := spec.MaxPrefixLength + (len(spec.ChildOrder)-1)*spec.ChildSize
+	for _, step := range p.Path {
+		switch {
+		case step.Hash != spec.Hash:
+			return fmt.Errorf("%w: inner hash doesn't match spec", ErrInvalidProof)
+		case bytes.HasPrefix(step.Prefix, spec.Leaf.Prefix):
+			// An inner node that looks like a leaf could fake a key
+			return fmt.Errorf("%w: inner node with leaf prefix", ErrInvalidProof)
+		case len(step.Prefix) < spec.MinPrefixLength || len(step.Prefix) > maxPrefix:
+			return fmt.Errorf("%w: inner prefix length %d out of range", ErrInvalidProof, len(step.Prefix))
+		case len(step.Suffix)%spec.ChildSize != 0:
+			return fmt.Errorf("%w: inner suffix length %d", ErrInvalidProof, len(step.Suffix))
+		}
+	}
+	return nil
+}
+
+// Verify checks that the proof proves key has value under root
+func (p *ExistenceProof) Verify(spec *ProofSpec, root, key, value []byte) error {
+	if !bytes.Equal(p.Key, key) || !bytes.Equal(p.Value, value) {
+		return fmt.Errorf("%w: proof is for another key or value", ErrInvalidProof)
+	}
+	if err := p.check(spec); err != nil {
+		return err
+	}
+	calculated, err := p.Calculate()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(calculated, root) {
+		return fmt.Errorf("%w: root mismatch", ErrInvalidProof)
+	}
+	return nil
+}
+
+// VerifyChained checks proofs through nested trees, innermost first. Each
+// proof shows its key has the root of the previous tree as value, so keys
+// holds the innermost key first, then the key of each subtree.
+func VerifyChained(specs []*ProofSpec, proofs []*ExistenceProof, root []byte, keys [][]byte, value []byte) error {
+	if len(proofs) != len(specs) || len(keys) != len(specs) {
+		return fmt.Errorf("%w: expected %d chained proofs, got %d", ErrInvalidProof, len(specs), len(proofs))
+	}
+	for i, proof := range proofs {
+		if proof == nil {
+			return fmt.Errorf("%w: missing proof", ErrInvalidProof)
+		}
+		subroot, err := proof.Calculate()
+		if err != nil {
+			return err
+		}
+		expected := subroot
+		if i == len(proofs)-1 {
+			expected = root
+		}
+		if err := proof.Verify(specs[i], expected, keys[i], value); err != nil {
+			return err
+		}
+		value = subroot
+	}
+	return nil
+}
+
+// simpleHashFromByteSlices computes the root of the RFC 6962 Merkle tree
+// over items, which Tendermint uses for header and validator set hashes
+func simpleHashFromByteSlices(items [][]byte) []byte {
+	switch len(items) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		sum := sha256.Sum256(append([]byte{0}, items[0]...))
+		return sum[:]
+	}
+	k := splitPoint(len(items))
+	left := simpleHashFromByteSlices(items[:k])
+	right := simpleHashFromByteSlices(items[k:])
+	sum := sha256.Sum256(append(append([]byte{1}, left...), right...))
+	return sum[:]
+}
+
+// splitPoint returns the largest power of two less than n
+func splitPoint(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
@@ -0,0 +1,157 @@
+package lightclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+// simpleMerkleProofs builds a simple Merkle tree over the key-value pairs,
+// in order, and returns its root and a proof for each pair
+func simpleMerkleProofs(t *testing.T, keys, values [][]byte) ([]byte, []*ExistenceProof) {
+	leaf := SimpleMerkleSpec.Leaf
+	leaves := make([][]byte, len(keys))
+	for i := range keys {
+		hash, err := leaf.Apply(keys[i], values[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves[i] = hash
+	}
+	root, paths := simpleMerklePaths(leaves)
+	proofs := make([]*ExistenceProof, len(keys))
+	for i := range keys {
+		proofs[i] = &ExistenceProof{Key: keys[i], Value: values[i], Leaf: &leaf, Path: paths[i]}
+	}
+	return root, proofs
+}
+
+func simpleMerklePaths(leaves [][]byte) ([]byte, [][]*InnerOp) {
+	if len(leaves) == 1 {
+		return leaves[0], [][]*InnerOp{nil}
+	}
+	k := splitPoint(len(leaves))
+	left, leftPaths := simpleMerklePaths(leaves[:k])
+	right, rightPaths := simpleMerklePaths(leaves[k:])
+	for i := range leftPaths {
+		leftPaths[i] = append(leftPaths[i], &InnerOp{Hash: HashSHA256, Prefix: []byte{1}, Suffix: right})
+	}
+	for i := range rightPaths {
+		rightPaths[i] = append(rightPaths[i], &InnerOp{Hash: HashSHA256, Prefix: append([]byte{1}, left...)})
+	}
+	root := sha256.Sum256(append(append([]byte{1}, left...), right...))
+	return root[:], append(leftPaths, rightPaths...)
+}
+
+// iavlProof builds a two-leaf IAVL tree of the key-value pair and a sibling
+// leaf hash, and returns its root and the proof for the pair
+func iavlProof(t *testing.T, key, value, sibling []byte, left bool) ([]byte, *ExistenceProof) {
+	leaf := IAVLSpec.Leaf
+	// Leaf height 0, size 1 and version 1, zigzag encoded
+	leaf.Prefix = []byte{0, 2, 2}
+	hash, err := leaf.Apply(key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Inner height 1, size 2 and version 1
+	inner := &InnerOp{Hash: HashSHA256, Prefix: []byte{2, 4, 2, 32}}
+	var root [32]byte
+	if left {
+		inner.Suffix = append([]byte{32}, sibling...)
+		root = sha256.Sum256(append(append(append([]byte(nil), inner.Prefix...), hash...), inner.Suffix...))
+	} else {
+		inner.Prefix = append(append(inner.Prefix, sibling...), 32)
+		root = sha256.Sum256(append(append([]byte(nil), inner.Prefix...), hash...))
+	}
+	return root[:], &ExistenceProof{Key: key, Value: value, Leaf: &leaf, Path: []*InnerOp{inner}}
+}
+
+func TestSimpleMerkleProofs(t *testing.T) {
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	values := [][]byte{[]byte("1"), []byte("2"), []byte("3"), []byte("4"), []byte("5")}
+	root, proofs := simpleMerkleProofs(t, keys, values)
+
+	leaves := make([][]byte, len(keys))
+	for i := range keys {
+		// The leaf op hashes the prefix byte with the length-prefixed key and
+		// value hash, which simpleHashFromByteSlices prefixes and hashes again
+		valueHash := sha256.Sum256(values[i])
+		leaves[i] = append(append([]byte{byte(len(keys[i]))}, keys[i]...), append([]byte{32}, valueHash[:]...)...)
+	}
+	if !bytes.Equal(root, simpleHashFromByteSlices(leaves)) {
+		t.Fatalf("Expected proof root to match the tree root")
+	}
+
+	for i, proof := range proofs {
+		if err := proof.Verify(SimpleMerkleSpec, root, keys[i], values[i]); err != nil {
+			t.Errorf("Expected Verify of key %s to succeed, but got error: %s", keys[i], err)
+		}
+	}
+	if err := proofs[0].Verify(SimpleMerkleSpec, root, keys[0], []byte("other")); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected Verify of another value to fail, but got: %v", err)
+	}
+	if err := proofs[0].Verify(SimpleMerkleSpec, root, keys[1], values[1]); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected Verify of another key to fail, but got: %v", err)
+	}
+	proofs[1].Value = []byte("9")
+	if err := proofs[1].Verify(SimpleMerkleSpec, root, keys[1], []byte("9")); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected Verify of a forged value to fail, but got: %v", err)
+	}
+}
+
+func TestIAVLProof(t *testing.T) {
+	sibling := sha256.Sum256([]byte("sibling"))
+	for _, left := range []bool{true, false} {
+		root, proof := iavlProof(t, []byte("key"), []byte("value"), sibling[:], left)
+		if err := proof.Verify(IAVLSpec, root, []byte("key"), []byte("value")); err != nil {
+			t.Errorf("Expected Verify to succeed, but got error: %s", err)
+		}
+		// An IAVL proof isn't a valid simple Merkle proof
+		if err := proof.Verify(SimpleMerkleSpec, root, []byte("key"), []byte("value")); !errors.Is(err, ErrInvalidProof) {
+			t.Errorf("Expected Verify with the wrong spec to fail, but got: %v", err)
+		}
+	}
+}
+
+func TestProofRejectsInnerNodeAsLeaf(t *testing.T) {
+	keys := [][]byte{[]byte("a"), []byte("b")}
+	values := [][]byte{[]byte("1"), []byte("2")}
+	root, proofs := simpleMerkleProofs(t, keys, values)
+
+	// Claim the leaf hash is stored under a made up key one level up
+	forged := &ExistenceProof{
+		Key:   []byte("x"),
+		Value: []byte("y"),
+		Leaf:  &LeafOp{Hash: HashSHA256, Length: LengthVarProto, PrehashValue: HashSHA256, Prefix: []byte{0}},
+		Path:  []*InnerOp{{Hash: HashSHA256, Prefix: append([]byte{0}, proofs[0].Path[0].Prefix...)}},
+	}
+	if err := forged.Verify(SimpleMerkleSpec, root, []byte("x"), []byte("y")); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected Verify of a forged proof to fail, but got: %v", err)
+	}
+}
+
+func TestVerifyChained(t *testing.T) {
+	sibling := sha256.Sum256([]byte("sibling"))
+	storeRoot, storeProof := iavlProof(t, []byte("key"), []byte("value"), sibling[:], false)
+	root, storeProofs := simpleMerkleProofs(t,
+		[][]byte{[]byte("bank"), []byte("ibc")},
+		[][]byte{[]byte("bank root"), storeRoot},
+	)
+	specs := []*ProofSpec{IAVLSpec, SimpleMerkleSpec}
+	proofs := []*ExistenceProof{storeProof, storeProofs[1]}
+	keys := [][]byte{[]byte("key"), []byte("ibc")}
+
+	if err := VerifyChained(specs, proofs, root, keys, []byte("value")); err != nil {
+		t.Errorf("Expected VerifyChained to succeed, but got error: %s", err)
+	}
+	if err := VerifyChained(specs, proofs, root, [][]byte{[]byte("key"), []byte("bank")}, []byte("value")); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyChained into another store to fail, but got: %v", err)
+	}
+	if err := VerifyChained(specs, proofs[:1], root, keys, []byte("value")); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyChained with a missing proof to fail, but got: %v", err)
+	}
+	if err := VerifyChained(specs, proofs, storeRoot, keys, []byte("value")); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyChained against another root to fail, but got: %v", err)
+	}
+}
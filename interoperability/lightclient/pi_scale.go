@@ -0,0 +1,115 @@
+package lightclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// Minimal SCALE codec, the encoding of Substrate headers, justifications
+// and trie nodes
+
+var errShortInput = errors.New("scale: unexpected end of input")
+
+// scaleReader decodes SCALE values from a byte slice
+type scaleReader struct {
+	data []byte
+	err  error
+}
+
+func (r *scaleReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errShortInput
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *scaleReader) u8() byte {
+	b := r.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *scaleReader) u32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *scaleReader) u64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// compact decodes a compact integer, which must fit in 64 bits
+func (r *scaleReader) compact() uint64 {
+	first := r.u8()
+	switch first & 3 {
+	case 0:
+		return uint64(first >> 2)
+	case 1:
+		second := r.u8()
+		return uint64(binary.LittleEndian.Uint16([]byte{first, second}) >> 2)
+	case 2:
+		rest := r.take(3)
+		if rest == nil {
+			return 0
+		}
+		return uint64(binary.LittleEndian.Uint32(append([]byte{first}, rest...)) >> 2)
+	default:
+		n := int(first>>2) + 4
+		b := r.take(n)
+		if b == nil {
+			return 0
+		}
+		if n > 8 {
+			r.err = errors.New("scale: compact integer too large")
+			return 0
+		}
+		return binary.LittleEndian.Uint64(append(append([]byte(nil), b...), make([]byte, 8-n)...))
+	}
+}
+
+// vec decodes a length-prefixed byte vector
+func (r *scaleReader) vec() []byte {
+	n := r.compact()
+	if n > uint64(len(r.data)) {
+		r.err = errShortInput
+		return nil
+	}
+	return r.take(int(n))
+}
+
+func appendCompact(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v<<2))
+	case v < 1<<14:
+		return binary.LittleEndian.AppendUint16(b, uint16(v<<2|1))
+	case v < 1<<30:
+		return binary.LittleEndian.AppendUint32(b, uint32(v<<2|2))
+	}
+	le := new(big.Int).SetUint64(v).Bytes()
+	for i, j := 0, len(le)-1; i < j; i, j = i+1, j-1 {
+		le[i], le[j] = le[j], le[i]
+	}
+	b = append(b, byte((len(le)-4)<<2|3))
+	return append(b, le...)
+}
+
+func appendScaleBytes(b []byte, v []byte) []byte {
+	return append(appendCompact(b, uint64(len(v))), v...)
+}
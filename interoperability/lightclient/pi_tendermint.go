@@ -0,0 +1,455 @@
+package lightclient
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Tendermint light client for Cosmos chains, following the CometBFT light
+// client protocol. Headers, validator sets and votes are hashed and signed
+// in CometBFT's protobuf encodings, so headers and commits fetched from any
+// CometBFT RPC endpoint verify as they are.
+
+// Defaults for TendermintConfig
+const (
+	DefaultTrustingPeriod = 14 * 24 * time.Hour
+	DefaultMaxClockDrift  = 10 * time.Second
+	DefaultStoreKey       = "ibc"
+)
+
+// Block ID flags of a commit signature
+const (
+	BlockIDFlagAbsent = 1
+	BlockIDFlagCommit = 2
+	BlockIDFlagNil    = 3
+)
+
+// precommitType is SIGNED_MSG_TYPE_PRECOMMIT
+const precommitType = 2
+
+// ErrTrustExpired is returned when the latest trusted header is older than
+// the trusting period, after which its validators may have unbonded and can
+// no longer be held to account. The client must be reset from a new trusted
+// header.
+var ErrTrustExpired = errors.New("lightclient: trusted header expired")
+
+// BlockID identifies a block by its header hash and part set
+type BlockID struct {
+	Hash         []byte `json:"hash"`
+	PartSetTotal uint32 `json:"part_set_total"`
+	PartSetHash  []byte `json:"part_set_hash"`
+}
+
+// TendermintHeader is a CometBFT block header
+type TendermintHeader struct {
+	VersionBlock       uint64    `json:"version_block"`
+	VersionApp         uint64    `json:"version_app"`
+	ChainID            string    `json:"chain_id"`
+	Height             int64     `json:"height"`
+	Time               time.Time `json:"time"`
+	LastBlockID        BlockID   `json:"last_block_id"`
+	LastCommitHash     []byte    `json:"last_commit_hash"`
+	DataHash           []byte    `json:"data_hash"`
+	ValidatorsHash     []byte    `json:"validators_hash"`
+	NextValidatorsHash []byte    `json:"next_validators_hash"`
+	ConsensusHash      []byte    `json:"consensus_hash"`
+	AppHash            []byte    `json:"app_hash"`
+	LastResultsHash    []byte    `json:"last_results_hash"`
+	EvidenceHash       []byte    `json:"evidence_hash"`
+	ProposerAddress    []byte    `json:"proposer_address"`
+}
+
+// CommitSig is one validator's precommit in a commit
+type CommitSig struct {
+	BlockIDFlag      int       `json:"block_id_flag"`
+	ValidatorAddress []byte    `json:"validator_address"`
+	Timestamp        time.Time `json:"timestamp"`
+	Signature        []byte    `json:"signature"`
+}
+
+// TendermintCommit holds the precommits that committed a block, one per
+// validator in validator set order
+type TendermintCommit struct {
+	Height     int64       `json:"height"`
+	Round      int32       `json:"round"`
+	BlockID    BlockID     `json:"block_id"`
+	Signatures []CommitSig `json:"signatures"`
+}
+
+// SignedHeader is a header with the commit for it
+type SignedHeader struct {
+	Header *TendermintHeader `json:"header"`
+	Commit *TendermintCommit `json:"commit"`
+}
+
+// TendermintValidator is a validator with its ed25519 key
+type TendermintValidator struct {
+	PubKey      ed25519.PublicKey `json:"pub_key"`
+	VotingPower int64             `json:"voting_power"`
+}
+
+// Address is the validator's address, the first 20 bytes of the SHA-256 of its key
+func (v *TendermintValidator) Address() []byte {
+	sum := sha256.Sum256(v.PubKey)
+	return sum[:20]
+}
+
+// TendermintValidatorSet is a validator set in CometBFT order
+type TendermintValidatorSet struct {
+	Validators []*TendermintValidator `json:"validators"`
+}
+
+// Hash is the Merkle root over the validators, as in header validator hashes
+func (vs *TendermintValidatorSet) Hash() []byte {
+	items := make([][]byte, len(vs.Validators))
+	for i, v := range vs.Validators {
+		// SimpleValidator{pub_key: PublicKey{ed25519}, voting_power}
+		var pubKey []byte
+		pubKey = protowire.AppendTag(pubKey, 1, protowire.BytesType)
+		pubKey = protowire.AppendBytes(pubKey, v.PubKey)
+		var b []byte
+		b = appendMessage(b, 1, pubKey)
+		b = appendVarint(b, 2, uint64(v.VotingPower))
+		items[i] = b
+	}
+	return simpleHashFromByteSlices(items)
+}
+
+// TotalVotingPower sums the validators' voting power
+func (vs *TendermintValidatorSet) TotalVotingPower() int64 {
+	total := int64(0)
+	for _, v := range vs.Validators {
+		total += v.VotingPower
+	}
+	return total
+}
+
+// validate checks that the set can be hashed and its signatures verified:
+// it is not empty and every validator has an Ed25519 key and positive power
+func (vs *TendermintValidatorSet) validate() error {
+	if vs == nil || len(vs.Validators) == 0 {
+		return fmt.Errorf("%w: empty validator set", ErrInvalidHeader)
+	}
+	for i, v := range vs.Validators {
+		if v == nil || len(v.PubKey) != ed25519.PublicKeySize || v.VotingPower <= 0 {
+			return fmt.Errorf("%w: invalid validator %d", ErrInvalidHeader, i)
+		}
+	}
+	return nil
+}
+
+func (vs *TendermintValidatorSet) byAddress(address []byte) *TendermintValidator {
+	for _, v := range vs.Validators {
+		if bytes.Equal(v.Address(), address) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Protobuf encoding helpers. Like proto3, they omit fields with zero values.
+
+func appendVarint(b []byte, field protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendSfixed64(b []byte, field protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, uint64(v))
+}
+
+func appendBytes(b []byte, field protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendMessage appends an embedded message, even an empty one, as gogoproto
+// does for non-nullable fields
+func appendMessage(b []byte, field protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func encodeTimestamp(t time.Time) []byte {
+	b := appendVarint(nil, 1, uint64(t.Unix()))
+	return appendVarint(b, 2, uint64(t.Nanosecond()))
+}
+
+func encodeBlockID(id BlockID) []byte {
+	partSetHeader := appendVarint(nil, 1, uint64(id.PartSetTotal))
+	partSetHeader = appendBytes(partSetHeader, 2, id.PartSetHash)
+	b := appendBytes(nil, 1, id.Hash)
+	return appendMessage(b, 2, partSetHeader)
+}
+
+func (id BlockID) isZero() bool {
+	return len(id.Hash) == 0 && id.PartSetTotal == 0 && len(id.PartSetHash) == 0
+}
+
+// Hash is the Merkle root over the header's fields, which is what the
+// validators commit to
+func (h *TendermintHeader) Hash() []byte {
+	version := appendVarint(nil, 1, h.VersionBlock)
+	version = appendVarint(version, 2, h.VersionApp)
+	// Scalar fields are wrapped in their gogoproto wrapper types
+	return simpleHashFromByteSlices([][]byte{
+		version,
+		appendBytes(nil, 1, []byte(h.ChainID)),
+		appendVarint(nil, 1, uint64(h.Height)),
+		encodeTimestamp(h.Time),
+		encodeBlockID(h.LastBlockID),
+		appendBytes(nil, 1, h.LastCommitHash),
+		appendBytes(nil, 1, h.DataHash),
+		appendBytes(nil, 1, h.ValidatorsHash),
+		appendBytes(nil, 1, h.NextValidatorsHash),
+		appendBytes(nil, 1, h.ConsensusHash),
+		appendBytes(nil, 1, h.AppHash),
+		appendBytes(nil, 1, h.LastResultsHash),
+		appendBytes(nil, 1, h.EvidenceHash),
+		appendBytes(nil, 1, h.ProposerAddress),
+	})
+}
+
+// VoteSignBytes returns the bytes a validator signs for its precommit in
+// the commit: the length-delimited CanonicalVote
+func (c *TendermintCommit) VoteSignBytes(chainID string, sig *CommitSig) []byte {
+	b := appendVarint(nil, 1, precommitType)
+	b = appendSfixed64(b, 2, c.Height)
+	b = appendSfixed64(b, 3, int64(c.Round))
+	if sig.BlockIDFlag == BlockIDFlagCommit && !c.BlockID.isZero() {
+		partSetHeader := appendVarint(nil, 1, uint64(c.BlockID.PartSetTotal))
+		partSetHeader = appendBytes(partSetHeader, 2, c.BlockID.PartSetHash)
+		blockID := appendBytes(nil, 1, c.BlockID.Hash)
+		blockID = appendMessage(blockID, 2, partSetHeader)
+		b = appendMessage(b, 4, blockID)
+	}
+	b = appendMessage(b, 5, encodeTimestamp(sig.Timestamp))
+	b = appendBytes(b, 6, []byte(chainID))
+	return protowire.AppendBytes(nil, b)
+}
+
+// TendermintConfig configures a TendermintClient. Zero fields take defaults.
+type TendermintConfig struct {
+	// TrustingPeriod is how long a verified header can be built upon; it must
+	// be shorter than the chain's unbonding period
+	TrustingPeriod time.Duration
+	// MaxClockDrift is how far in the future a header's time may be
+	MaxClockDrift time.Duration
+	// TrustLevelNumerator and TrustLevelDenominator are the fraction of the
+	// trusted validators' power that must sign a non-adjacent header.
+	// Defaults to 1/3.
+	TrustLevelNumerator   int64
+	TrustLevelDenominator int64
+	// StoreKey is the multistore key of the store that proofs are into
+	StoreKey string
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// TendermintClient tracks a CometBFT chain
+type TendermintClient struct {
+	*consensusStates
+	chainID string
+	config  TendermintConfig
+
+	trusted        *TendermintHeader
+	nextValidators *TendermintValidatorSet
+	mu             sync.Mutex
+}
+
+// NewTendermintClient creates a client trusting header, obtained out of
+// band, and its next validator set
+func NewTendermintClient(trusted *TendermintHeader, nextValidators *TendermintValidatorSet, config *TendermintConfig) (*TendermintClient, error) {
+	cfg := TendermintConfig{}
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.TrustingPeriod <= 0 {
+		cfg.TrustingPeriod = DefaultTrustingPeriod
+	}
+	if cfg.MaxClockDrift <= 0 {
+		cfg.MaxClockDrift = DefaultMaxClockDrift
+	}
+	if cfg.TrustLevelNumerator <= 0 || cfg.TrustLevelDenominator <= 0 {
+		cfg.TrustLevelNumerator, cfg.TrustLevelDenominator = 1, 3
+	}
+	if cfg.StoreKey == "" {
+		cfg.StoreKey = DefaultStoreKey
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if trusted == nil {
+		return nil, fmt.Errorf("%w: missing trusted header", ErrInvalidHeader)
+	}
+	if err := nextValidators.validate(); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(nextValidators.Hash(), trusted.NextValidatorsHash) {
+		return nil, fmt.Errorf("%w: next validators don't match the trusted header", ErrInvalidHeader)
+	}
+	return &TendermintClient{
+		consensusStates: newConsensusStates(tendermintConsensusState(trusted)),
+		chainID:         trusted.ChainID,
+		config:          cfg,
+		trusted:         trusted,
+		nextValidators:  nextValidators,
+	}, nil
+}
+
+func tendermintConsensusState(header *TendermintHeader) *ConsensusState {
+	return &ConsensusState{Height: uint64(header.Height), Timestamp: header.Time, Root: header.AppHash}
+}
+
+// ChainID identifies the tracked chain
+func (c *TendermintClient) ChainID() string {
+	return c.chainID
+}
+
+// Update verifies a header newer than the latest trusted one, signed by
+// validators, whose successors are nextValidators. Headers right after the
+// trusted one are verified by following the validator set hash; later
+// headers are accepted if validators holding the trust level of the trusted
+// validators' power signed them, so a client can skip ahead.
+func (c *TendermintClient) Update(signed *SignedHeader, validators, nextValidators *TendermintValidatorSet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if signed == nil || signed.Header == nil || signed.Commit == nil {
+		return fmt.Errorf("%w: missing header or commit", ErrInvalidHeader)
+	}
+	if err := validators.validate(); err != nil {
+		return err
+	}
+	if err := nextValidators.validate(); err != nil {
+		return err
+	}
+	header, commit := signed.Header, signed.Commit
+	now := c.config.Now()
+	switch {
+	case !c.trusted.Time.Add(c.config.TrustingPeriod).After(now):
+		return ErrTrustExpired
+	case header.ChainID != c.chainID:
+		return fmt.Errorf("%w: header for chain %s", ErrInvalidHeader, header.ChainID)
+	case header.Height <= c.trusted.Height:
+		return fmt.Errorf("%w: height %d isn't after trusted height %d", ErrInvalidHeader, header.Height, c.trusted.Height)
+	case !header.Time.After(c.trusted.Time):
+		return fmt.Errorf("%w: time isn't after the trusted header", ErrInvalidHeader)
+	case header.Time.After(now.Add(c.config.MaxClockDrift)):
+		return fmt.Errorf("%w: time is in the future", ErrInvalidHeader)
+	case commit.Height != header.Height || !bytes.Equal(commit.BlockID.Hash, header.Hash()):
+		return fmt.Errorf("%w: commit is for another block", ErrInvalidHeader)
+	case !bytes.Equal(validators.Hash(), header.ValidatorsHash):
+		return fmt.Errorf("%w: validators don't match the header", ErrInvalidHeader)
+	case !bytes.Equal(nextValidators.Hash(), header.NextValidatorsHash):
+		return fmt.Errorf("%w: next validators don't match the header", ErrInvalidHeader)
+	}
+
+	if header.Height == c.trusted.Height+1 {
+		if !bytes.Equal(header.ValidatorsHash, c.trusted.NextValidatorsHash) {
+			return fmt.Errorf("%w: validators don't follow the trusted header", ErrInvalidHeader)
+		}
+	} else if err := c.verifyCommitTrusting(commit); err != nil {
+		return err
+	}
+	if err := c.verifyCommit(validators, commit); err != nil {
+		return err
+	}
+
+	c.trusted, c.nextValidators = header, nextValidators
+	c.add(tendermintConsensusState(header))
+	return nil
+}
+
+// verifyCommit checks that more than two thirds of the header's validators
+// signed the commit
+func (c *TendermintClient) verifyCommit(validators *TendermintValidatorSet, commit *TendermintCommit) error {
+	if len(commit.Signatures) != len(validators.Validators) {
+		return fmt.Errorf("%w: %d signatures for %d validators", ErrInvalidHeader, len(commit.Signatures), len(validators.Validators))
+	}
+	power := int64(0)
+	for i := range commit.Signatures {
+		sig := &commit.Signatures[i]
+		if sig.BlockIDFlag != BlockIDFlagCommit {
+			continue
+		}
+		validator := validators.Validators[i]
+		if !bytes.Equal(sig.ValidatorAddress, validator.Address()) {
+			return fmt.Errorf("%w: signature %d is from another validator", ErrInvalidHeader, i)
+		}
+		if !ed25519.Verify(validator.PubKey, commit.VoteSignBytes(c.chainID, sig), sig.Signature) {
+			return fmt.Errorf("%w: invalid signature from validator %d", ErrInvalidHeader, i)
+		}
+		power += validator.VotingPower
+	}
+	if 3*power <= 2*validators.TotalVotingPower() {
+		return ErrNotEnoughVotingPower
+	}
+	return nil
+}
+
+// verifyCommitTrusting checks that validators of the trusted next set with
+// more than the trust level of its power signed the commit
+func (c *TendermintClient) verifyCommitTrusting(commit *TendermintCommit) error {
+	power := int64(0)
+	seen := make(map[string]bool)
+	for i := range commit.Signatures {
+		sig := &commit.Signatures[i]
+		if sig.BlockIDFlag != BlockIDFlagCommit {
+			continue
+		}
+		validator := c.nextValidators.byAddress(sig.ValidatorAddress)
+		if validator == nil || seen[string(sig.ValidatorAddress)] {
+			continue
+		}
+		seen[string(sig.ValidatorAddress)] = true
+		if !ed25519.Verify(validator.PubKey, commit.VoteSignBytes(c.chainID, sig), sig.Signature) {
+			return fmt.Errorf("%w: invalid signature from trusted validator", ErrInvalidHeader)
+		}
+		power += validator.VotingPower
+	}
+	total := c.nextValidators.TotalVotingPower()
+	if power*c.config.TrustLevelDenominator <= total*c.config.TrustLevelNumerator {
+		return ErrNotEnoughVotingPower
+	}
+	return nil
+}
+
+// VerifyMembership checks a proof into the configured store of the Cosmos
+// SDK multistore. The proof is the JSON encoding of two existence proofs:
+// the key into the store's IAVL tree, then the store into the multistore.
+// Root is the header's app hash.
+func (c *TendermintClient) VerifyMembership(height uint64, proof []byte, key, value []byte) error {
+	state, err := c.ConsensusState(height)
+	if err != nil {
+		return err
+	}
+	var proofs []*ExistenceProof
+	if err := json.Unmarshal(proof, &proofs); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidProof, err)
+	}
+	return VerifyChained(
+		[]*ProofSpec{IAVLSpec, SimpleMerkleSpec},
+		proofs,
+		state.Root,
+		[][]byte{key, []byte(c.config.StoreKey)},
+		value,
+	)
+}
@@ -0,0 +1,266 @@
+package lightclient
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+var tendermintGenesis = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// tendermintValidators creates n validators with one unit of power each
+func tendermintValidators(seed byte, n int) (*TendermintValidatorSet, []ed25519.PrivateKey) {
+	set := &TendermintValidatorSet{}
+	keys := make([]ed25519.PrivateKey, n)
+	for i := range keys {
+		keys[i] = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed + byte(i)}, ed25519.SeedSize))
+		set.Validators = append(set.Validators, &TendermintValidator{PubKey: keys[i].Public().(ed25519.PublicKey), VotingPower: 1})
+	}
+	return set, keys
+}
+
+func tendermintHeader(height int64, validators, nextValidators *TendermintValidatorSet, appHash []byte) *TendermintHeader {
+	return &TendermintHeader{
+		VersionBlock:       11,
+		ChainID:            "cosmoshub-4",
+		Height:             height,
+		Time:               tendermintGenesis.Add(time.Duration(height) * 6 * time.Second),
+		ValidatorsHash:     validators.Hash(),
+		NextValidatorsHash: nextValidators.Hash(),
+		AppHash:            appHash,
+	}
+}
+
+// signHeader commits the header with the signatures of the validators at the
+// given indices
+func signHeader(header *TendermintHeader, validators *TendermintValidatorSet, keys []ed25519.PrivateKey, signers ...int) *SignedHeader {
+	commit := &TendermintCommit{
+		Height:  header.Height,
+		BlockID: BlockID{Hash: header.Hash(), PartSetTotal: 1, PartSetHash: bytes.Repeat([]byte{1}, 32)},
+	}
+	commit.Signatures = make([]CommitSig, len(validators.Validators))
+	for i := range commit.Signatures {
+		commit.Signatures[i].BlockIDFlag = BlockIDFlagAbsent
+	}
+	for _, i := range signers {
+		sig := &commit.Signatures[i]
+		sig.BlockIDFlag = BlockIDFlagCommit
+		sig.ValidatorAddress = validators.Validators[i].Address()
+		sig.Timestamp = header.Time.Add(time.Second)
+		sig.Signature = ed25519.Sign(keys[i], commit.VoteSignBytes(header.ChainID, sig))
+	}
+	return &SignedHeader{Header: header, Commit: commit}
+}
+
+func newTestTendermintClient(t *testing.T, validators *TendermintValidatorSet, now time.Time) *TendermintClient {
+	client, err := NewTendermintClient(tendermintHeader(1, validators, validators, nil), validators, &TendermintConfig{
+		Now: func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("Expected NewTendermintClient to succeed, but got error: %s", err)
+	}
+	return client
+}
+
+func TestTendermintHeaderHash(t *testing.T) {
+	validators, _ := tendermintValidators(1, 4)
+	header := tendermintHeader(5, validators, validators, []byte("app"))
+	hash := header.Hash()
+	if len(hash) != sha256.Size {
+		t.Fatalf("Expected a %d byte hash, got %d bytes", sha256.Size, len(hash))
+	}
+	for _, change := range []func(*TendermintHeader){
+		func(h *TendermintHeader) { h.Height++ },
+		func(h *TendermintHeader) { h.Time = h.Time.Add(time.Nanosecond) },
+		func(h *TendermintHeader) { h.AppHash = []byte("other") },
+		func(h *TendermintHeader) { h.ChainID = "other" },
+	} {
+		changed := *header
+		change(&changed)
+		if bytes.Equal(changed.Hash(), hash) {
+			t.Errorf("Expected a header change to change the hash")
+		}
+	}
+}
+
+func TestTendermintAdjacentUpdate(t *testing.T) {
+	validators, keys := tendermintValidators(1, 4)
+	next, nextKeys := tendermintValidators(10, 4)
+	client := newTestTendermintClient(t, validators, tendermintGenesis.Add(time.Hour))
+
+	// Height 2 hands over to a new validator set, which signs height 3
+	header := tendermintHeader(2, validators, next, []byte("root 2"))
+	if err := client.Update(signHeader(header, validators, keys, 0, 1, 2), validators, next); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+	header = tendermintHeader(3, next, next, []byte("root 3"))
+	if err := client.Update(signHeader(header, next, nextKeys, 1, 2, 3), next, next); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+
+	if client.LatestHeight() != 3 {
+		t.Errorf("Expected latest height 3, got %d", client.LatestHeight())
+	}
+	state, err := client.ConsensusState(3)
+	if err != nil {
+		t.Fatalf("Expected ConsensusState to succeed, but got error: %s", err)
+	}
+	if !bytes.Equal(state.Root, []byte("root 3")) || !state.Timestamp.Equal(header.Time) {
+		t.Errorf("Expected the consensus state of header 3, got %+v", state)
+	}
+	if _, err := client.ConsensusState(4); !errors.Is(err, ErrUnknownHeight) {
+		t.Errorf("Expected ConsensusState of an unknown height to fail, but got: %v", err)
+	}
+}
+
+func TestTendermintSkippingUpdate(t *testing.T) {
+	validators, keys := tendermintValidators(1, 4)
+	client := newTestTendermintClient(t, validators, tendermintGenesis.Add(time.Hour))
+
+	// Three of the four trusted validators moved on to a new set
+	next, nextKeys := tendermintValidators(2, 4)
+	header := tendermintHeader(100, next, next, nil)
+	if err := client.Update(signHeader(header, next, nextKeys, 0, 1, 2, 3), next, next); err != nil {
+		t.Errorf("Expected Update to succeed, but got error: %s", err)
+	}
+
+	// A completely new set can't be trusted after skipping
+	client = newTestTendermintClient(t, validators, tendermintGenesis.Add(time.Hour))
+	other, otherKeys := tendermintValidators(50, 4)
+	header = tendermintHeader(100, other, other, nil)
+	if err := client.Update(signHeader(header, other, otherKeys, 0, 1, 2, 3), other, other); !errors.Is(err, ErrNotEnoughVotingPower) {
+		t.Errorf("Expected Update signed by an untrusted set to fail, but got: %v", err)
+	}
+	// Neither can one signed by only one trusted validator
+	header = tendermintHeader(100, validators, validators, nil)
+	if err := client.Update(signHeader(header, validators, keys, 0), validators, validators); !errors.Is(err, ErrNotEnoughVotingPower) {
+		t.Errorf("Expected Update below the trust level to fail, but got: %v", err)
+	}
+}
+
+func TestTendermintRejectsInvalidHeaders(t *testing.T) {
+	validators, keys := tendermintValidators(1, 4)
+	now := tendermintGenesis.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		signed func() *SignedHeader
+		err    error
+	}{
+		{"two thirds not reached", func() *SignedHeader {
+			return signHeader(tendermintHeader(2, validators, validators, nil), validators, keys, 0, 1)
+		}, ErrNotEnoughVotingPower},
+		{"forged signature", func() *SignedHeader {
+			signed := signHeader(tendermintHeader(2, validators, validators, nil), validators, keys, 0, 1, 2)
+			signed.Commit.Signatures[1].Signature[0] ^= 1
+			return signed
+		}, ErrInvalidHeader},
+		{"commit for another block", func() *SignedHeader {
+			signed := signHeader(tendermintHeader(2, validators, validators, nil), validators, keys, 0, 1, 2)
+			signed.Header.AppHash = []byte("forged")
+			return signed
+		}, ErrInvalidHeader},
+		{"other chain", func() *SignedHeader {
+			header := tendermintHeader(2, validators, validators, nil)
+			header.ChainID = "other"
+			return signHeader(header, validators, keys, 0, 1, 2)
+		}, ErrInvalidHeader},
+		{"from the future", func() *SignedHeader {
+			header := tendermintHeader(2, validators, validators, nil)
+			header.Time = now.Add(time.Minute)
+			return signHeader(header, validators, keys, 0, 1, 2)
+		}, ErrInvalidHeader},
+		{"not newer", func() *SignedHeader {
+			return signHeader(tendermintHeader(1, validators, validators, nil), validators, keys, 0, 1, 2)
+		}, ErrInvalidHeader},
+	}
+	for _, test := range tests {
+		client := newTestTendermintClient(t, validators, now)
+		if err := client.Update(test.signed(), validators, validators); !errors.Is(err, test.err) {
+			t.Errorf("Expected Update with %s to fail with %v, but got: %v", test.name, test.err, err)
+		}
+		if client.LatestHeight() != 1 {
+			t.Errorf("Expected Update with %s to leave the client at height 1, got %d", test.name, client.LatestHeight())
+		}
+	}
+}
+
+func TestTendermintRejectsMissingInputs(t *testing.T) {
+	validators, keys := tendermintValidators(1, 4)
+	now := tendermintGenesis.Add(time.Hour)
+	client := newTestTendermintClient(t, validators, now)
+	signed := signHeader(tendermintHeader(2, validators, validators, nil), validators, keys, 0, 1, 2)
+	shortKey := &TendermintValidatorSet{Validators: []*TendermintValidator{{PubKey: []byte{1}, VotingPower: 1}}}
+
+	tests := []struct {
+		name                       string
+		signed                     *SignedHeader
+		validators, nextValidators *TendermintValidatorSet
+	}{
+		{"no signed header", nil, validators, validators},
+		{"no header", &SignedHeader{Commit: signed.Commit}, validators, validators},
+		{"no validators", signed, nil, validators},
+		{"no next validators", signed, validators, nil},
+		{"empty validators", signed, &TendermintValidatorSet{}, validators},
+		{"nil validator", signed, &TendermintValidatorSet{Validators: []*TendermintValidator{nil}}, validators},
+		{"short validator key", signed, validators, shortKey},
+	}
+	for _, test := range tests {
+		if err := client.Update(test.signed, test.validators, test.nextValidators); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("Expected Update with %s to fail with ErrInvalidHeader, but got: %v", test.name, err)
+		}
+	}
+	if _, err := NewTendermintClient(signed.Header, nil, nil); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected NewTendermintClient without next validators to fail, but got: %v", err)
+	}
+}
+
+func TestTendermintTrustExpired(t *testing.T) {
+	validators, keys := tendermintValidators(1, 4)
+	client := newTestTendermintClient(t, validators, tendermintGenesis.Add(DefaultTrustingPeriod+time.Hour))
+	header := tendermintHeader(2, validators, validators, nil)
+	if err := client.Update(signHeader(header, validators, keys, 0, 1, 2), validators, validators); !errors.Is(err, ErrTrustExpired) {
+		t.Errorf("Expected Update after the trusting period to fail, but got: %v", err)
+	}
+}
+
+func TestTendermintVerifyMembership(t *testing.T) {
+	key, value := []byte("commitments/ports/transfer/channels/channel-0/sequences/1"), []byte("commitment")
+	sibling := sha256.Sum256([]byte("sibling"))
+	storeRoot, storeProof := iavlProof(t, key, value, sibling[:], true)
+	appHash, storeProofs := simpleMerkleProofs(t,
+		[][]byte{[]byte("bank"), []byte(DefaultStoreKey)},
+		[][]byte{[]byte("bank root"), storeRoot},
+	)
+	proof, err := json.Marshal([]*ExistenceProof{storeProof, storeProofs[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validators, keys := tendermintValidators(1, 4)
+	client := newTestTendermintClient(t, validators, tendermintGenesis.Add(time.Hour))
+	header := tendermintHeader(2, validators, validators, appHash)
+	if err := client.Update(signHeader(header, validators, keys, 0, 1, 2, 3), validators, validators); err != nil {
+		t.Fatalf("Expected Update to succeed, but got error: %s", err)
+	}
+
+	if err := client.VerifyMembership(2, proof, key, value); err != nil {
+		t.Errorf("Expected VerifyMembership to succeed, but got error: %s", err)
+	}
+	if err := client.VerifyMembership(2, proof, key, []byte("other")); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyMembership of another value to fail, but got: %v", err)
+	}
+	if err := client.VerifyMembership(1, proof, key, value); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyMembership against another root to fail, but got: %v", err)
+	}
+	if err := client.VerifyMembership(3, proof, key, value); !errors.Is(err, ErrUnknownHeight) {
+		t.Errorf("Expected VerifyMembership at an unknown height to fail, but got: %v", err)
+	}
+	if err := client.VerifyMembership(2, []byte("garbage"), key, value); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected VerifyMembership with a malformed proof to fail, but got: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package lightclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Substrate storage proofs are the trie nodes on the path from the state
+// root to a key, each referenced from its parent by BLAKE2b-256 hash. Nodes
+// are in the V1 layout, where values longer than 32 bytes are stored
+// separately and referenced by hash.
+
+// Node header prefixes and the bits left for the partial key length
+const (
+	trieLeaf              = 0x40
+	trieBranch            = 0x80
+	trieBranchWithValue   = 0xc0
+	trieHashedLeaf        = 0x20
+	trieHashedValueBranch = 0x10
+	trieEmpty             = 0x00
+)
+
+// trieNode is a decoded trie node
+type trieNode struct {
+	partial  []byte // nibbles
+	value    []byte
+	hashed   bool // value is the hash of the stored value
+	hasValue bool
+	children [16][]byte // hash, or inline encoded node if shorter than 32 bytes
+}
+
+// decodeTrieNode decodes a node in the V1 layout
+func decodeTrieNode(data []byte) (*trieNode, error) {
+	r := &scaleReader{data: data}
+	header := r.u8()
+	node := &trieNode{}
+	var mask byte
+	branch := false
+	switch {
+	case header == trieEmpty && len(data) == 1:
+		return node, nil
+	case header&0xc0 == trieLeaf:
+		mask, node.hasValue = 0x3f, true
+	case header&0xc0 == trieBranch:
+		mask, branch = 0x3f, true
+	case header&0xc0 == trieBranchWithValue:
+		mask, branch, node.hasValue = 0x3f, true, true
+	case header&0xe0 == trieHashedLeaf:
+		mask, node.hasValue, node.hashed = 0x1f, true, true
+	case header&0xf0 == trieHashedValueBranch:
+		mask, branch, node.hasValue, node.hashed = 0x0f, true, true, true
+	default:
+		return nil, fmt.Errorf("%w: unknown trie node header %#x", ErrInvalidProof, header)
+	}
+
+	// The partial key length spills into following bytes when it doesn't fit
+	// in the header, each adding up to 255
+	nibbles := int(header & mask)
+	if nibbles == int(mask) {
+		for r.err == nil {
+			b := r.u8()
+			nibbles += int(b)
+			if b != 255 {
+				break
+			}
+		}
+	}
+	key := r.take((nibbles + 1) / 2)
+	for i := 0; i < len(key)*2; i++ {
+		// Odd-length keys are padded with a zero nibble at the start
+		if i == 0 && nibbles%2 == 1 {
+			continue
+		}
+		node.partial = append(node.partial, key[i/2]>>(4*(1-i%2))&0x0f)
+	}
+
+	var bitmap uint16
+	if branch {
+		b := r.take(2)
+		if b != nil {
+			bitmap = binary.LittleEndian.Uint16(b)
+		}
+	}
+	if node.hasValue {
+		if node.hashed {
+			node.value = r.take(32)
+		} else {
+			node.value = r.vec()
+		}
+	}
+	for i := 0; i < 16; i++ {
+		if bitmap&(1<<i) != 0 {
+			node.children[i] = r.vec()
+		}
+	}
+	if r.err != nil || len(r.data) != 0 {
+		return nil, fmt.Errorf("%w: malformed trie node", ErrInvalidProof)
+	}
+	return node, nil
+}
+
+// ReadTrieProof looks up key in the trie with the given root, using only
+// the proof nodes, and returns its value. It fails if the proof doesn't
+// cover the key or the key isn't in the trie.
+func ReadTrieProof(root []byte, proof [][]byte, key []byte) ([]byte, error) {
+	nodes := make(map[[32]byte][]byte, len(proof))
+	for _, node := range proof {
+		nodes[blake2b.Sum256(node)] = node
+	}
+	lookup := func(hash []byte) ([]byte, error) {
+		var h [32]byte
+		copy(h[:], hash)
+		node, ok := nodes[h]
+		if !ok || len(hash) != 32 {
+			return nil, fmt.Errorf("%w: proof is missing trie node %x", ErrInvalidProof, hash)
+		}
+		return node, nil
+	}
+
+	path := make([]byte, 0, len(key)*2)
+	for _, b := range key {
+		path = append(path, b>>4, b&0x0f)
+	}
+	encoded, err := lookup(root)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		node, err := decodeTrieNode(encoded)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) < len(node.partial) || !bytes.Equal(path[:len(node.partial)], node.partial) {
+			return nil, fmt.Errorf("%w: key isn't in the trie", ErrInvalidProof)
+		}
+		path = path[len(node.partial):]
+		if len(path) == 0 {
+			if !node.hasValue {
+				return nil, fmt.Errorf("%w: key isn't in the trie", ErrInvalidProof)
+			}
+			if node.hashed {
+				return lookup(node.value)
+			}
+			return node.value, nil
+		}
+		child := node.children[path[0]]
+		if child == nil {
+			return nil, fmt.Errorf("%w: key isn't in the trie", ErrInvalidProof)
+		}
+		path = path[1:]
+		if len(child) == 32 {
+			if encoded, err = lookup(child); err != nil {
+				return nil, err
+			}
+		} else {
+			encoded = child
+		}
+	}
+}
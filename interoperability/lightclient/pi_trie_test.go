@@ -0,0 +1,153 @@
+package lightclient
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// trieHeader encodes a node header with its partial key
+func trieHeader(prefix, mask byte, partial []byte) []byte {
+	n := len(partial)
+	var b []byte
+	if n < int(mask) {
+		b = []byte{prefix | byte(n)}
+	} else {
+		b = []byte{prefix | mask}
+		rest := n - int(mask)
+		for ; rest >= 255; rest -= 255 {
+			b = append(b, 255)
+		}
+		b = append(b, byte(rest))
+	}
+	if len(partial)%2 == 1 {
+		b = append(b, partial[0])
+		partial = partial[1:]
+	}
+	for i := 0; i < len(partial); i += 2 {
+		b = append(b, partial[i]<<4|partial[i+1])
+	}
+	return b
+}
+
+func trieLeafNode(partial, value []byte) []byte {
+	return appendScaleBytes(trieHeader(trieLeaf, 0x3f, partial), value)
+}
+
+func trieHashedLeafNode(partial, value []byte) []byte {
+	hash := blake2b.Sum256(value)
+	return append(trieHeader(trieHashedLeaf, 0x1f, partial), hash[:]...)
+}
+
+// trieBranchNode encodes a branch. Children of 32 bytes or more are
+// referenced by hash, shorter ones are inlined.
+func trieBranchNode(partial []byte, children map[byte][]byte, value []byte) []byte {
+	var b []byte
+	if value == nil {
+		b = trieHeader(trieBranch, 0x3f, partial)
+	} else {
+		b = trieHeader(trieBranchWithValue, 0x3f, partial)
+	}
+	bitmap := uint16(0)
+	for i := range children {
+		bitmap |= 1 << i
+	}
+	b = append(b, byte(bitmap), byte(bitmap>>8))
+	if value != nil {
+		b = appendScaleBytes(b, value)
+	}
+	for i := byte(0); i < 16; i++ {
+		child, ok := children[i]
+		if !ok {
+			continue
+		}
+		if len(child) >= 32 {
+			hash := blake2b.Sum256(child)
+			child = hash[:]
+		}
+		b = appendScaleBytes(b, child)
+	}
+	return b
+}
+
+func trieHash(node []byte) []byte {
+	hash := blake2b.Sum256(node)
+	return hash[:]
+}
+
+func TestReadTrieProof(t *testing.T) {
+	long := bytes.Repeat([]byte("b"), 40)
+	hashedLeaf := trieHashedLeafNode(nil, long)
+	inner := trieBranchNode([]byte{2, 3}, map[byte][]byte{
+		4: trieLeafNode(nil, []byte("a")),
+		5: hashedLeaf,
+	}, nil)
+	root := trieBranchNode(nil, map[byte][]byte{
+		1: inner,
+		5: trieLeafNode([]byte{6}, []byte("c")),
+	}, []byte("root value"))
+	proof := [][]byte{root, inner, hashedLeaf, long}
+
+	tests := []struct {
+		key   []byte
+		value []byte
+	}{
+		{[]byte{0x12, 0x34}, []byte("a")},
+		{[]byte{0x12, 0x35}, long},
+		{[]byte{0x56}, []byte("c")},
+		{[]byte{}, []byte("root value")},
+	}
+	for _, test := range tests {
+		value, err := ReadTrieProof(trieHash(root), proof, test.key)
+		if err != nil {
+			t.Errorf("Expected ReadTrieProof of %x to succeed, but got error: %s", test.key, err)
+			continue
+		}
+		if !bytes.Equal(value, test.value) {
+			t.Errorf("Expected value %q for %x, got %q", test.value, test.key, value)
+		}
+	}
+
+	for _, key := range [][]byte{{0x12, 0x36}, {0x12}, {0x57}, {0x12, 0x34, 0x00}, {0x80}} {
+		if _, err := ReadTrieProof(trieHash(root), proof, key); !errors.Is(err, ErrInvalidProof) {
+			t.Errorf("Expected ReadTrieProof of absent key %x to fail, but got: %v", key, err)
+		}
+	}
+	// The hashed value must be part of the proof
+	if _, err := ReadTrieProof(trieHash(root), proof[:3], []byte{0x12, 0x35}); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected ReadTrieProof without the value to fail, but got: %v", err)
+	}
+	if _, err := ReadTrieProof(trieHash(inner), proof, []byte{0x12, 0x34}); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected ReadTrieProof against another root to fail, but got: %v", err)
+	}
+}
+
+func TestReadTrieProofLongPartialKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 200)
+	nibbles := make([]byte, 0, 400)
+	for _, b := range key {
+		nibbles = append(nibbles, b>>4, b&0x0f)
+	}
+	// An odd partial key under a branch, longer than fits in the header
+	leaf := trieLeafNode(nibbles[1:], []byte("value"))
+	root := trieBranchNode(nil, map[byte][]byte{0xa: leaf}, nil)
+
+	value, err := ReadTrieProof(trieHash(root), [][]byte{root, leaf}, key)
+	if err != nil {
+		t.Fatalf("Expected ReadTrieProof to succeed, but got error: %s", err)
+	}
+	if !bytes.Equal(value, []byte("value")) {
+		t.Errorf("Expected value %q, got %q", "value", value)
+	}
+}
+
+func TestDecodeTrieNodeRejectsMalformed(t *testing.T) {
+	leaf := trieLeafNode([]byte{1, 2}, []byte("value"))
+	for _, node := range [][]byte{leaf[:len(leaf)-1], append(leaf, 0), {0x01}} {
+		if _, err := decodeTrieNode(node); !errors.Is(err, ErrInvalidProof) {
+			t.Errorf("Expected decodeTrieNode of %x to fail, but got: %v", node, err)
+		}
+	}
+}
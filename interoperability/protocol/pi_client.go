@@ -0,0 +1,440 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrClientClosed is returned when sending on a client that has been closed
+var ErrClientClosed = errors.New("interoperability client closed")
+
+// Handler handles an inbound PI Interoperability message
+type Handler func(message *PIMessage)
+
+// ClientConfig configures a Client. Zero fields take the defaults below.
+type ClientConfig struct {
+	// Header is sent with every handshake, for example to authenticate
+	Header http.Header
+	// Dialer dials the WebSocket connection
+	Dialer *websocket.Dialer
+	// Encodings are offered to the server in order of preference
+	Encodings []Encoding
+	// MinBackoff and MaxBackoff bound the exponential delay between reconnects
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PingInterval is how often the client pings; the connection is dropped
+	// when no pong arrives within PongTimeout
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// WriteTimeout bounds each frame write
+	WriteTimeout time.Duration
+	// QueueSize is how many outbound messages are held while disconnected
+	QueueSize int
+	// Outbox holds messages sent with Ack until they are acknowledged. It
+	// defaults to a MemoryOutbox; use a FileOutbox to keep them across restarts.
+	Outbox Outbox
+	// AckTimeout is how long to wait for an acknowledgement before resending
+	AckTimeout time.Duration
+	// DedupSize is how many inbound message IDs are remembered to drop duplicates
+	DedupSize int
+	// MaxMessageSize bounds inbound frames in bytes; the connection is
+	// dropped when the server sends a larger one
+	MaxMessageSize int64
+}
+
+// Client defaults
+const (
+	DefaultMinBackoff     = 500 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+	DefaultPingInterval   = 20 * time.Second
+	DefaultPongTimeout    = 10 * time.Second
+	DefaultWriteTimeout   = 10 * time.Second
+	DefaultQueueSize      = 256
+	DefaultAckTimeout     = 10 * time.Second
+	DefaultMaxMessageSize = 1 << 20
+)
+
+func (c *ClientConfig) withDefaults() ClientConfig {
+	config := ClientConfig{}
+	if c != nil {
+		config = *c
+	}
+	dialer := websocket.DefaultDialer
+	if config.Dialer != nil {
+		dialer = config.Dialer
+	}
+	// Copy the dialer so setting the subprotocols doesn't change the caller's
+	d := *dialer
+	d.Subprotocols = subprotocols(config.Encodings)
+	config.Dialer = &d
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = DefaultMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = DefaultMaxBackoff
+		if config.MaxBackoff < config.MinBackoff {
+			config.MaxBackoff = config.MinBackoff
+		}
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = DefaultPingInterval
+	}
+	if config.PongTimeout <= 0 {
+		config.PongTimeout = DefaultPongTimeout
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = DefaultWriteTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.Outbox == nil {
+		config.Outbox = NewMemoryOutbox()
+	}
+	if config.AckTimeout <= 0 {
+		config.AckTimeout = DefaultAckTimeout
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = DefaultMaxMessageSize
+	}
+	return config
+}
+
+// Client is a PI Interoperability connection that survives network failures.
+// It redials with exponential backoff whenever the connection drops, queues
+// outbound messages until they can be written, writes from a single
+// goroutine, and dispatches inbound messages to handlers by Type. Replies to
+// a Request go to its caller instead of a handler.
+type Client struct {
+	url    string
+	config ClientConfig
+
+	handlers map[string]Handler
+	waiters  map[string]chan *PIMessage
+	mu       sync.RWMutex
+	dedup    *deduplicator
+
+	outbound  chan *PIMessage
+	connected chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	stateMu sync.Mutex
+	conn    *websocket.Conn
+}
+
+// NewClient creates a client for the endpoint at url and starts connecting in
+// the background. Call Close to stop it.
+func NewClient(url string, config *ClientConfig) *Client {
+	cfg := config.withDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		url:       url,
+		config:    cfg,
+		handlers:  make(map[string]Handler),
+		waiters:   make(map[string]chan *PIMessage),
+		dedup:     newDeduplicator(cfg.DedupSize),
+		outbound:  make(chan *PIMessage, cfg.QueueSize),
+		connected: make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Handle registers the handler for messages of the given type, replacing any
+// previous one. Handlers run on the client's read goroutine, so a slow
+// handler delays the messages after it.
+func (c *Client) Handle(messageType string, handler Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[messageType] = handler
+}
+
+// Send queues a message for delivery, giving it an ID and timestamp if it
+// has none. It blocks while the queue is full until ctx is done. Messages
+// queued while disconnected are sent after the next reconnect; a message
+// whose write fails is retried on the next connection, so the peer may see
+// it twice. A message with Ack set is first stored in the outbox and resent
+// until the peer acknowledges it.
+func (c *Client) Send(ctx context.Context, message *PIMessage) error {
+	select {
+	case <-c.ctx.Done():
+		return ErrClientClosed
+	default:
+	}
+	if err := stamp(message); err != nil {
+		return err
+	}
+	if message.Ack {
+		if err := c.config.Outbox.Put(message); err != nil {
+			return err
+		}
+	}
+	return c.enqueue(ctx, message)
+}
+
+// Request sends message and waits for the reply correlated with its ID
+func (c *Client) Request(ctx context.Context, message *PIMessage) (*PIMessage, error) {
+	if err := stamp(message); err != nil {
+		return nil, err
+	}
+	reply := make(chan *PIMessage, 1)
+	c.mu.Lock()
+	c.waiters[message.ID] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiters, message.ID)
+		c.mu.Unlock()
+	}()
+	if err := c.Send(ctx, message); err != nil {
+		return nil, err
+	}
+	select {
+	case response := <-reply:
+		return response, nil
+	case <-c.ctx.Done():
+		return nil, ErrClientClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) enqueue(ctx context.Context, message *PIMessage) error {
+	select {
+	case c.outbound <- message:
+		return nil
+	case <-c.ctx.Done():
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Connected returns a channel that is closed once the client is connected.
+// It is replaced with a new channel whenever the connection drops.
+func (c *Client) Connected() <-chan struct{} {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.connected
+}
+
+// Close stops reconnecting, closes the connection and waits for the client's
+// goroutines to finish. Queued messages that weren't sent are dropped.
+func (c *Client) Close() error {
+	c.cancel()
+	c.stateMu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.stateMu.Unlock()
+	<-c.done
+	return nil
+}
+
+// run dials and serves connections until the client is closed. The backoff
+// only resets once a connection has stayed up for MaxBackoff, so a peer
+// that accepts and immediately drops connections isn't redialed in a loop.
+func (c *Client) run() {
+	defer close(c.done)
+	var pending *PIMessage
+	attempt := 0
+	for {
+		conn, _, err := c.config.Dialer.DialContext(c.ctx, c.url, c.config.Header)
+		if err == nil {
+			connectedAt := time.Now()
+			pending = c.serve(conn, pending)
+			if time.Since(connectedAt) >= c.config.MaxBackoff {
+				attempt = 0
+			}
+		}
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-c.ctx.Done():
+			return
+		}
+		attempt++
+	}
+}
+
+// backoff returns the delay before reconnect attempt n, doubling from
+// MinBackoff up to MaxBackoff with up to 50% jitter so that many clients
+// don't reconnect in lockstep
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.config.MinBackoff
+	for i := 0; i < attempt && delay < c.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.config.MaxBackoff {
+		delay = c.config.MaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// serve writes queued messages to conn and reads from it until either side
+// fails. It returns the message that was being written, if any, so it can
+// be retried on the next connection.
+func (c *Client) serve(conn *websocket.Conn, pending *PIMessage) *PIMessage {
+	c.stateMu.Lock()
+	c.conn = conn
+	close(c.connected)
+	c.stateMu.Unlock()
+	defer func() {
+		c.stateMu.Lock()
+		c.conn = nil
+		c.connected = make(chan struct{})
+		c.stateMu.Unlock()
+		conn.Close()
+	}()
+
+	encoding := NegotiatedEncoding(conn)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- c.read(conn)
+	}()
+
+	// Resend whatever the peer hasn't acknowledged, including messages
+	// stored in a persistent outbox before a restart
+	sent := make(map[string]time.Time)
+	if !c.redeliver(conn, encoding, sent) {
+		return pending
+	}
+	ping := time.NewTicker(c.config.PingInterval)
+	defer ping.Stop()
+	retry := time.NewTicker(c.config.AckTimeout)
+	defer retry.Stop()
+	for {
+		if pending == nil {
+			select {
+			case pending = <-c.outbound:
+			case <-retry.C:
+				if !c.redeliver(conn, encoding, sent) {
+					return nil
+				}
+				continue
+			case <-ping.C:
+				deadline := time.Now().Add(c.config.WriteTimeout)
+				if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+					return nil
+				}
+				continue
+			case <-readErr:
+				return nil
+			case <-c.ctx.Done():
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				return nil
+			}
+		}
+		if at, ok := sent[pending.ID]; ok && pending.Ack && time.Since(at) < c.config.AckTimeout {
+			// Already redelivered from the outbox on this connection
+			pending = nil
+			continue
+		}
+		frameType, data, err := EncodeMessage(encoding, pending)
+		if err != nil {
+			// Can't ever be sent, so don't retry it
+			pending = nil
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+		if err := conn.WriteMessage(frameType, data); err != nil {
+			return pending
+		}
+		if pending.Ack {
+			sent[pending.ID] = time.Now()
+		}
+		pending = nil
+	}
+}
+
+// redeliver writes the outbox messages that weren't sent on this connection
+// within AckTimeout. It returns false if the connection failed.
+func (c *Client) redeliver(conn *websocket.Conn, encoding Encoding, sent map[string]time.Time) bool {
+	messages, err := c.config.Outbox.List()
+	if err != nil {
+		return true
+	}
+	for _, message := range messages {
+		if at, ok := sent[message.ID]; ok && time.Since(at) < c.config.AckTimeout {
+			continue
+		}
+		frameType, data, err := EncodeMessage(encoding, message)
+		if err != nil {
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+		if err := conn.WriteMessage(frameType, data); err != nil {
+			return false
+		}
+		sent[message.ID] = time.Now()
+	}
+	return true
+}
+
+// read dispatches inbound messages until the connection fails. A pong must
+// arrive within PingInterval+PongTimeout of the previous one, or of any
+// other frame, for the connection to stay up.
+func (c *Client) read(conn *websocket.Conn) error {
+	conn.SetReadLimit(c.config.MaxMessageSize)
+	timeout := c.config.PingInterval + c.config.PongTimeout
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(timeout))
+	})
+	for {
+		frameType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		message, err := DecodeMessage(frameType, data)
+		if err != nil {
+			continue
+		}
+		c.dispatch(message)
+	}
+}
+
+// dispatch handles acknowledgements, drops duplicates, and passes a message
+// to the Request waiting for it or else to the handler for its type
+func (c *Client) dispatch(message *PIMessage) {
+	if message.Type == MessageTypeAck {
+		c.config.Outbox.Delete(message.CorrelationID)
+		return
+	}
+	if message.Ack {
+		// Acknowledge duplicates too, since the first ack may have been lost.
+		// If the queue is full the peer will resend and be acked then.
+		select {
+		case c.outbound <- newAck(message):
+		default:
+		}
+		if message.ID != "" && c.dedup.duplicate(message.ID) {
+			return
+		}
+	}
+	c.mu.RLock()
+	waiter, ok := c.waiters[message.CorrelationID]
+	handler := c.handlers[message.Type]
+	c.mu.RUnlock()
+	if ok && message.CorrelationID != "" {
+		select {
+		case waiter <- message:
+		default:
+		}
+		return
+	}
+	if handler != nil {
+		handler(message)
+	}
+}
@@ -0,0 +1,227 @@
+package protocol
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoServer echoes every frame back. If dropAfter is positive it closes
+// each connection after that many frames.
+type echoServer struct {
+	*httptest.Server
+	dropAfter   int
+	mu          sync.Mutex
+	connections int
+}
+
+func newEchoServer(t *testing.T, dropAfter int) *echoServer {
+	s := &echoServer{dropAfter: dropAfter}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.mu.Lock()
+		s.connections++
+		s.mu.Unlock()
+		for frames := 0; s.dropAfter <= 0 || frames < s.dropAfter; frames++ {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *echoServer) wsURL() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func (s *echoServer) connectionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+func testClientConfig() *ClientConfig {
+	return &ClientConfig{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+}
+
+func TestClientSendAndHandle(t *testing.T) {
+	server := newEchoServer(t, 0)
+	client := NewClient(server.wsURL(), testClientConfig())
+	defer client.Close()
+
+	received := make(chan *PIMessage, 1)
+	client.Handle("hello", func(message *PIMessage) {
+		received <- message
+	})
+	client.Handle("other", func(message *PIMessage) {
+		t.Errorf("Expected the other handler not to be called")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Send(ctx, &PIMessage{Type: "hello", Payload: []byte(`"world"`)}); err != nil {
+		t.Fatalf("Expected Send to succeed, but got error: %s", err)
+	}
+	select {
+	case message := <-received:
+		if string(message.Payload) != `"world"` {
+			t.Errorf("Expected payload %q, but got %q", `"world"`, message.Payload)
+		}
+	case <-ctx.Done():
+		t.Fatalf("Expected the echoed message to be dispatched")
+	}
+}
+
+func TestClientReconnects(t *testing.T) {
+	// The server drops every connection after one frame
+	server := newEchoServer(t, 1)
+	client := NewClient(server.wsURL(), testClientConfig())
+	defer client.Close()
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	all := make(chan struct{})
+	client.Handle("seq", func(message *PIMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[string(message.Payload)] = true
+		if len(seen) == 3 {
+			close(all)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, payload := range []string{`1`, `2`, `3`} {
+		// Wait for a connection so each message is echoed before the drop
+		select {
+		case <-client.Connected():
+		case <-ctx.Done():
+			t.Fatalf("Expected the client to reconnect")
+		}
+		if err := client.Send(ctx, &PIMessage{Type: "seq", Payload: []byte(payload)}); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			ok := seen[payload]
+			mu.Unlock()
+			if ok || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	select {
+	case <-all:
+	case <-ctx.Done():
+		t.Fatalf("Expected all messages to be delivered across reconnects")
+	}
+	if server.connectionCount() < 3 {
+		t.Errorf("Expected at least 3 connections, but got %d", server.connectionCount())
+	}
+}
+
+func TestClientQueuesWhileDisconnected(t *testing.T) {
+	server := newEchoServer(t, 0)
+	url := server.wsURL()
+	server.Close()
+
+	// Nothing is listening yet, so messages wait in the queue
+	client := NewClient(url, testClientConfig())
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := client.Send(ctx, &PIMessage{Type: "queued"}); err != nil {
+		t.Fatalf("Expected Send to queue while disconnected, but got error: %s", err)
+	}
+	select {
+	case <-client.Connected():
+		t.Errorf("Expected the client not to be connected")
+	default:
+	}
+}
+
+func TestClientSendQueueFull(t *testing.T) {
+	client := NewClient("ws://127.0.0.1:1", &ClientConfig{QueueSize: 1, MinBackoff: time.Hour})
+	defer client.Close()
+	if err := client.Send(context.Background(), &PIMessage{Type: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.Send(ctx, &PIMessage{Type: "second"}); err != context.DeadlineExceeded {
+		t.Errorf("Expected Send on a full queue to time out, but got %v", err)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	server := newEchoServer(t, 0)
+	client := NewClient(server.wsURL(), testClientConfig())
+	select {
+	case <-client.Connected():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the client to connect")
+	}
+	if err := client.Close(); err != nil {
+		t.Errorf("Expected Close to succeed, but got error: %s", err)
+	}
+	if err := client.Send(context.Background(), &PIMessage{Type: "late"}); err != ErrClientClosed {
+		t.Errorf("Expected ErrClientClosed after Close, but got %v", err)
+	}
+}
+
+func TestClientBackoff(t *testing.T) {
+	client := &Client{config: (&ClientConfig{MinBackoff: time.Second, MaxBackoff: 8 * time.Second}).withDefaults()}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+		delay := client.backoff(attempt)
+		if delay < max/2 || delay > max {
+			t.Errorf("Expected backoff for attempt %d between %s and %s, but got %s", attempt, max/2, max, delay)
+		}
+	}
+}
+
+func TestClientMaxMessageSize(t *testing.T) {
+	server, url := newTestServer(t, nil)
+	config := testClientConfig()
+	config.MaxMessageSize = 1024
+	client := NewClient(url, config)
+	defer client.Close()
+	received := make(chan *PIMessage, 1)
+	client.Handle("big", func(message *PIMessage) {
+		received <- message
+	})
+	waitForSessions(t, server, 1)
+	session := server.Sessions()[0]
+	if err := session.Send(&PIMessage{Type: "big", Payload: []byte(`"` + strings.Repeat("x", 2048) + `"`)}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the client to drop the connection after an oversized message")
+	}
+	select {
+	case <-received:
+		t.Errorf("Expected an oversized message not to be handled")
+	default:
+	}
+}
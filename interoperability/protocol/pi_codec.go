@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// Encoding is a wire encoding for PIMessage, negotiated as a WebSocket
+// subprotocol when a connection is opened
+type Encoding string
+
+// Supported encodings. JSON is sent in text frames and protobuf in binary
+// frames. A peer that negotiates no subprotocol speaks JSON, which keeps
+// endpoints from before negotiation working.
+const (
+	EncodingJSON     Encoding = "pi.v1.json"
+	EncodingProtobuf Encoding = "pi.v1.proto"
+)
+
+// DefaultEncodings is the preference order offered and accepted by default
+var DefaultEncodings = []Encoding{EncodingProtobuf, EncodingJSON}
+
+// ErrUnsupportedFrame is returned for WebSocket frames that carry no PIMessage
+var ErrUnsupportedFrame = errors.New("unsupported frame type")
+
+// NegotiatedEncoding returns the encoding agreed on for conn
+func NegotiatedEncoding(conn *websocket.Conn) Encoding {
+	if Encoding(conn.Subprotocol()) == EncodingProtobuf {
+		return EncodingProtobuf
+	}
+	return EncodingJSON
+}
+
+// subprotocols converts encodings to the subprotocol names used in the handshake
+func subprotocols(encodings []Encoding) []string {
+	if len(encodings) == 0 {
+		encodings = DefaultEncodings
+	}
+	names := make([]string, len(encodings))
+	for i, encoding := range encodings {
+		names[i] = string(encoding)
+	}
+	return names
+}
+
+// ToProto converts a message to its protobuf form. The payload is carried
+// as opaque bytes, so a message survives conversion both ways unchanged.
+func (m *PIMessage) ToProto() *PIProtoMessage {
+	return &PIProtoMessage{
+		Type:          m.Type,
+		Payload:       m.Payload,
+		Id:            m.ID,
+		CorrelationId: m.CorrelationID,
+		Timestamp:     m.Timestamp,
+		Ack:           m.Ack,
+	}
+}
+
+// ToMessage converts a protobuf message back to a PIMessage
+func (m *PIProtoMessage) ToMessage() *PIMessage {
+	return &PIMessage{
+		Type:          m.Type,
+		Payload:       m.Payload,
+		ID:            m.Id,
+		CorrelationID: m.CorrelationId,
+		Timestamp:     m.Timestamp,
+		Ack:           m.Ack,
+	}
+}
+
+// EncodeMessage encodes a message for the given encoding and returns it with
+// the WebSocket frame type to send it in
+func EncodeMessage(encoding Encoding, message *PIMessage) (int, []byte, error) {
+	switch encoding {
+	case EncodingJSON:
+		data, err := json.Marshal(message)
+		return websocket.TextMessage, data, err
+	case EncodingProtobuf:
+		data, err := message.ToProto().Marshal()
+		return websocket.BinaryMessage, data, err
+	default:
+		return 0, nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// DecodeMessage decodes a frame by its type, so either encoding is accepted
+// whatever was negotiated
+func DecodeMessage(frameType int, data []byte) (*PIMessage, error) {
+	switch frameType {
+	case websocket.TextMessage:
+		var message PIMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			return nil, err
+		}
+		return &message, nil
+	case websocket.BinaryMessage:
+		var message PIProtoMessage
+		if err := message.Unmarshal(data); err != nil {
+			return nil, err
+		}
+		return message.ToMessage(), nil
+	default:
+		return nil, ErrUnsupportedFrame
+	}
+}
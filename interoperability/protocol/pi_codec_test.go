@@ -0,0 +1,163 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var codecMessages = []*PIMessage{
+	{Type: "hello", Payload: []byte(`"world"`)},
+	{Type: "transfer", Payload: []byte(`{"amount":10,"to":"cosmos1xyz","memo":"ü"}`)},
+	{Type: "", Payload: []byte(`[]`)},
+	{ID: "id-1", CorrelationID: "id-0", Timestamp: 1700000000000, Ack: true, Type: "reply", Payload: []byte(`1`)},
+}
+
+func TestEncodeDecodeMessage(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingProtobuf} {
+		for _, message := range codecMessages {
+			frameType, data, err := EncodeMessage(encoding, message)
+			if err != nil {
+				t.Errorf("Expected EncodeMessage with %s to succeed, but got error: %s", encoding, err)
+				continue
+			}
+			decoded, err := DecodeMessage(frameType, data)
+			if err != nil {
+				t.Errorf("Expected DecodeMessage with %s to succeed, but got error: %s", encoding, err)
+				continue
+			}
+			if decoded.Type != message.Type || !bytes.Equal(decoded.Payload, message.Payload) {
+				t.Errorf("Expected %s round trip to give %+v, but got %+v", encoding, message, decoded)
+			}
+		}
+	}
+	if _, _, err := EncodeMessage("pi.v1.xml", codecMessages[0]); err == nil {
+		t.Errorf("Expected EncodeMessage to reject an unknown encoding")
+	}
+}
+
+func TestEncodingsCompatible(t *testing.T) {
+	for _, message := range codecMessages {
+		// JSON -> protobuf -> JSON gives the same frame
+		_, jsonData, err := EncodeMessage(EncodingJSON, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromJSON, err := DecodeMessage(websocket.TextMessage, jsonData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, protoData, err := EncodeMessage(EncodingProtobuf, fromJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromProto, err := DecodeMessage(websocket.BinaryMessage, protoData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, again, err := EncodeMessage(EncodingJSON, fromProto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(jsonData, again) {
+			t.Errorf("Expected %s to survive conversion through protobuf, but got %s", jsonData, again)
+		}
+		if !bytes.Equal(fromProto.ToProto().Payload, message.ToProto().Payload) {
+			t.Errorf("Expected ToProto to keep the payload")
+		}
+	}
+}
+
+func TestDecodeMessageUnsupportedFrame(t *testing.T) {
+	if _, err := DecodeMessage(websocket.PingMessage, nil); err != ErrUnsupportedFrame {
+		t.Errorf("Expected ErrUnsupportedFrame, but got %v", err)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	server, url := newTestServer(t, nil)
+	tests := []struct {
+		offered  []string
+		expected Encoding
+	}{
+		{nil, EncodingJSON},
+		{[]string{string(EncodingJSON)}, EncodingJSON},
+		{[]string{string(EncodingProtobuf)}, EncodingProtobuf},
+		{[]string{string(EncodingJSON), string(EncodingProtobuf)}, EncodingProtobuf},
+		{[]string{"pi.v2.cbor"}, EncodingJSON},
+	}
+	for _, test := range tests {
+		dialer := websocket.Dialer{Subprotocols: test.offered}
+		conn, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := NegotiatedEncoding(conn); got != test.expected {
+			t.Errorf("Expected offering %v to negotiate %s, but got %s", test.offered, test.expected, got)
+		}
+		waitForSessions(t, server, 1)
+		if got := server.Sessions()[0].Encoding; got != test.expected {
+			t.Errorf("Expected the server session to use %s, but got %s", test.expected, got)
+		}
+		conn.Close()
+		waitForSessions(t, server, 0)
+	}
+}
+
+func TestClientServerEncodings(t *testing.T) {
+	for _, encodings := range [][]Encoding{{EncodingJSON}, {EncodingProtobuf}, nil} {
+		server, url := newTestServer(t, nil)
+		server.Handle("ping", func(session *Session, message *PIMessage) {
+			session.Send(&PIMessage{Type: "pong", Payload: message.Payload})
+		})
+		config := testClientConfig()
+		config.Encodings = encodings
+		client := NewClient(url, config)
+		pongs := make(chan *PIMessage, 1)
+		client.Handle("pong", func(message *PIMessage) {
+			pongs <- message
+		})
+		if err := client.Send(context.Background(), &PIMessage{Type: "ping", Payload: []byte(`{"n":1}`)}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case message := <-pongs:
+			if string(message.Payload) != `{"n":1}` {
+				t.Errorf("Expected pong payload over %v, but got %s", encodings, message.Payload)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Expected a pong over %v", encodings)
+		}
+		client.Close()
+	}
+}
+
+func TestPIInteroperabilityNegotiated(t *testing.T) {
+	server, url := newTestServer(t, nil)
+	server.Handle("ping", func(session *Session, message *PIMessage) {
+		session.Send(&PIMessage{Type: "pong", Payload: message.Payload})
+	})
+	dialer := websocket.Dialer{Subprotocols: []string{string(EncodingProtobuf)}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pi := NewPIInteroperability(conn)
+	defer pi.Close()
+	if pi.Encoding() != EncodingProtobuf {
+		t.Errorf("Expected protobuf, but got %s", pi.Encoding())
+	}
+	if err := pi.SendMessage(&PIMessage{Type: "ping", Payload: []byte(`1`)}); err != nil {
+		t.Fatalf("Expected SendMessage to succeed, but got error: %s", err)
+	}
+	message, err := pi.ReceiveMessage()
+	if err != nil {
+		t.Fatalf("Expected ReceiveMessage to succeed, but got error: %s", err)
+	}
+	if message.Type != "pong" || string(message.Payload) != `1` {
+		t.Errorf("Expected pong 1, but got %s %s", message.Type, message.Payload)
+	}
+}
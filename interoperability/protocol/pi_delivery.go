@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// MessageTypeAck is the type of acknowledgements. An acknowledgement's
+// CorrelationID is the ID of the message it acknowledges.
+const MessageTypeAck = "pi.ack"
+
+// DefaultDedupSize is how many message IDs a receiver remembers to drop duplicates
+const DefaultDedupSize = 4096
+
+// NewReply creates a response to request, correlated by its ID
+func NewReply(request *PIMessage, messageType string) *PIMessage {
+	return &PIMessage{Type: messageType, CorrelationID: request.ID}
+}
+
+// newAck acknowledges message
+func newAck(message *PIMessage) *PIMessage {
+	return &PIMessage{Type: MessageTypeAck, CorrelationID: message.ID}
+}
+
+// stamp gives a message an ID and timestamp if it doesn't have them yet
+func stamp(message *PIMessage) error {
+	if message.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		message.ID = id
+	}
+	if message.Timestamp == 0 {
+		message.Timestamp = time.Now().UnixMilli()
+	}
+	return nil
+}
+
+// newID returns a random 128-bit identifier in hex
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// deduplicator remembers the most recent message IDs it has seen, so
+// messages redelivered after a lost acknowledgement are handled only once
+type deduplicator struct {
+	seen map[string]struct{}
+	ring []string
+	next int
+	mu   sync.Mutex
+}
+
+func newDeduplicator(size int) *deduplicator {
+	if size <= 0 {
+		size = DefaultDedupSize
+	}
+	return &deduplicator{seen: make(map[string]struct{}, size), ring: make([]string, size)}
+}
+
+// duplicate records id and reports whether it had been seen already. Once
+// more than size IDs are recorded the oldest are forgotten.
+func (d *deduplicator) duplicate(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.seen[id]; ok {
+		return true
+	}
+	if old := d.ring[d.next]; old != "" {
+		delete(d.seen, old)
+	}
+	d.ring[d.next] = id
+	d.next = (d.next + 1) % len(d.ring)
+	d.seen[id] = struct{}{}
+	return false
+}
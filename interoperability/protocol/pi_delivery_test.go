@@ -0,0 +1,278 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDeduplicator(t *testing.T) {
+	d := newDeduplicator(2)
+	if d.duplicate("a") || d.duplicate("b") {
+		t.Errorf("Expected new IDs not to be duplicates")
+	}
+	if !d.duplicate("a") {
+		t.Errorf("Expected a repeated ID to be a duplicate")
+	}
+	// c pushes out a, the oldest
+	d.duplicate("c")
+	if d.duplicate("a") {
+		t.Errorf("Expected the oldest ID to be forgotten")
+	}
+}
+
+func TestStamp(t *testing.T) {
+	message := &PIMessage{Type: "hello"}
+	if err := stamp(message); err != nil {
+		t.Fatal(err)
+	}
+	if len(message.ID) != 32 || message.Timestamp == 0 {
+		t.Errorf("Expected an ID and timestamp, but got %+v", message)
+	}
+	id, timestamp := message.ID, message.Timestamp
+	if err := stamp(message); err != nil {
+		t.Fatal(err)
+	}
+	if message.ID != id || message.Timestamp != timestamp {
+		t.Errorf("Expected stamp to keep an existing ID and timestamp")
+	}
+}
+
+func TestClientRequest(t *testing.T) {
+	server, url := newTestServer(t, nil)
+	// An unrelated message arriving first must not be taken as the reply
+	server.Handle("balance", func(session *Session, message *PIMessage) {
+		session.Send(&PIMessage{Type: "noise", Payload: []byte(`1`)})
+		response := &PIMessage{Type: "balance.result"}
+		var account string
+		message.UnmarshalPayload(&account)
+		response.MarshalPayload(account + ":10")
+		session.Reply(message, response)
+	})
+
+	client := NewClient(url, testClientConfig())
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			request := &PIMessage{Type: "balance"}
+			request.MarshalPayload(fmt.Sprintf("acct%d", i))
+			response, err := client.Request(ctx, request)
+			if err != nil {
+				t.Errorf("Expected Request to succeed, but got error: %s", err)
+				return
+			}
+			var result string
+			response.UnmarshalPayload(&result)
+			if result != fmt.Sprintf("acct%d:10", i) {
+				t.Errorf("Expected the reply to request %d, but got %q", i, result)
+			}
+			if response.CorrelationID != request.ID {
+				t.Errorf("Expected the reply to be correlated with the request")
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestClientRequestTimeout(t *testing.T) {
+	_, url := newTestServer(t, nil)
+	client := NewClient(url, testClientConfig())
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Request(ctx, &PIMessage{Type: "unanswered", Payload: []byte(`1`)}); err != context.DeadlineExceeded {
+		t.Errorf("Expected Request to time out, but got %v", err)
+	}
+}
+
+// lossyServer drops the first connection without acknowledging what it
+// read, then acknowledges everything on later connections
+type lossyServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	received []*PIMessage
+	conns    int
+}
+
+func newLossyServer(t *testing.T) *lossyServer {
+	s := &lossyServer{}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.mu.Lock()
+		s.conns++
+		first := s.conns == 1
+		s.mu.Unlock()
+		for {
+			frameType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			message, err := DecodeMessage(frameType, data)
+			if err != nil {
+				continue
+			}
+			s.mu.Lock()
+			s.received = append(s.received, message)
+			s.mu.Unlock()
+			if first {
+				return
+			}
+			_, ack, _ := EncodeMessage(EncodingJSON, newAck(message))
+			conn.WriteMessage(websocket.TextMessage, ack)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *lossyServer) receivedIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(s.received))
+	for i, message := range s.received {
+		ids[i] = message.ID
+	}
+	return ids
+}
+
+func waitForEmptyOutbox(t *testing.T, outbox Outbox) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		messages, err := outbox.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the outbox to be emptied by acknowledgements, but %d messages remain", len(messages))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClientAtLeastOnce(t *testing.T) {
+	server := newLossyServer(t)
+	outbox := NewMemoryOutbox()
+	config := testClientConfig()
+	config.Outbox = outbox
+	client := NewClient("ws"+strings.TrimPrefix(server.URL, "http"), config)
+	defer client.Close()
+
+	message := &PIMessage{Type: "transfer", Payload: []byte(`10`), Ack: true}
+	if err := client.Send(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+	waitForEmptyOutbox(t, outbox)
+	ids := server.receivedIDs()
+	if len(ids) < 2 {
+		t.Fatalf("Expected the unacknowledged message to be resent, but it was received %d times", len(ids))
+	}
+	for _, id := range ids {
+		if id != message.ID {
+			t.Errorf("Expected every delivery to carry ID %s, but got %s", message.ID, id)
+		}
+	}
+}
+
+func TestClientOutboxSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := NewFileOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is listening, so the message stays in the outbox
+	config := testClientConfig()
+	config.Outbox = outbox
+	client := NewClient("ws://127.0.0.1:1", config)
+	if err := client.Send(context.Background(), &PIMessage{Type: "transfer", Payload: []byte(`10`), Ack: true}); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	server, url := newTestServer(t, nil)
+	received := make(chan *PIMessage, 1)
+	server.Handle("transfer", func(session *Session, message *PIMessage) {
+		received <- message
+	})
+	reopened, err := NewFileOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = testClientConfig()
+	config.Outbox = reopened
+	restarted := NewClient(url, config)
+	defer restarted.Close()
+	select {
+	case message := <-received:
+		if string(message.Payload) != `10` {
+			t.Errorf("Expected payload 10, but got %s", message.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the stored message to be delivered after restart")
+	}
+	waitForEmptyOutbox(t, reopened)
+}
+
+func TestServerDropsDuplicates(t *testing.T) {
+	server, url := newTestServer(t, nil)
+	var mu sync.Mutex
+	handled := 0
+	server.Handle("transfer", func(session *Session, message *PIMessage) {
+		mu.Lock()
+		handled++
+		mu.Unlock()
+	})
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	message := &PIMessage{ID: "tx-1", Type: "transfer", Payload: []byte(`10`), Ack: true}
+	_, data, err := EncodeMessage(EncodingJSON, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			t.Fatal(err)
+		}
+		// Every copy is acknowledged
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		frameType, reply, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected an acknowledgement, but got error: %s", err)
+		}
+		ack, err := DecodeMessage(frameType, reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ack.Type != MessageTypeAck || ack.CorrelationID != "tx-1" {
+			t.Errorf("Expected an acknowledgement of tx-1, but got %+v", ack)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if handled != 1 {
+		t.Errorf("Expected the message to be handled once, but it was handled %d times", handled)
+	}
+}
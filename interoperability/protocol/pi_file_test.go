@@ -0,0 +1,32 @@
+package protocol
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	if err := WriteFileAtomic(path, []byte("first")); err != nil {
+		t.Errorf("Expected WriteFileAtomic to succeed, but got error: %s", err)
+	}
+	if err := WriteFileAtomic(path, []byte("second")); err != nil {
+		t.Errorf("Expected WriteFileAtomic to succeed, but got error: %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("Expected the file to hold the last write, but got %q", data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left behind, but got %d entries", len(entries))
+	}
+}
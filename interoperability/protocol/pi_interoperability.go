@@ -2,8 +2,7 @@ package protocol
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
+	"sync"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/gorilla/websocket"
@@ -11,32 +10,40 @@ import (
 
 // PIInteroperability represents the PI Interoperability protocol
 type PIInteroperability struct {
-	conn *websocket.Conn
+	conn     *websocket.Conn
+	encoding Encoding
+	writeMu  sync.Mutex
 }
 
-// NewPIInteroperability creates a new PI Interoperability instance
+// NewPIInteroperability creates a new PI Interoperability instance, speaking
+// the encoding negotiated when conn was opened
 func NewPIInteroperability(conn *websocket.Conn) *PIInteroperability {
-	return &PIInteroperability{conn: conn}
+	return &PIInteroperability{conn: conn, encoding: NegotiatedEncoding(conn)}
+}
+
+// Encoding returns the wire encoding of the connection
+func (pi *PIInteroperability) Encoding() Encoding {
+	return pi.encoding
 }
 
 // SendMessage sends a message to the PI Interoperability endpoint
 func (pi *PIInteroperability) SendMessage(message *PIMessage) error {
-	data, err := json.Marshal(message)
+	frameType, data, err := EncodeMessage(pi.encoding, message)
 	if err != nil {
 		return err
 	}
-	return pi.conn.WriteMessage(websocket.TextMessage, data)
+	pi.writeMu.Lock()
+	defer pi.writeMu.Unlock()
+	return pi.conn.WriteMessage(frameType, data)
 }
 
 // ReceiveMessage receives a message from the PI Interoperability endpoint
 func (pi *PIInteroperability) ReceiveMessage() (*PIMessage, error) {
-	_, data, err := pi.conn.ReadMessage()
+	frameType, data, err := pi.conn.ReadMessage()
 	if err != nil {
 		return nil, err
 	}
-	var message PIMessage
-	err = json.Unmarshal(data, &message)
-	return &message, err
+	return DecodeMessage(frameType, data)
 }
 
 // Close closes the PI Interoperability connection
@@ -48,6 +55,16 @@ func (pi *PIInteroperability) Close() error {
 type PIMessage struct {
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+	// ID identifies the message. The client assigns one when it is empty.
+	ID string `json:"id,omitempty"`
+	// CorrelationID is the ID of the request this message answers
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// Timestamp is when the message was first sent, in Unix milliseconds
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Ack asks the receiver to acknowledge the message. The sender retries
+	// until it is acknowledged, and the receiver drops duplicates by ID.
+	// Only a Client can send with Ack; server sessions reject it.
+	Ack bool `json:"ack,omitempty"`
 }
 
 // UnmarshalPayload unmarshals the payload of a PI Interoperability message
@@ -65,12 +82,6 @@ func (m *PIMessage) MarshalPayload(v interface{}) error {
 	return nil
 }
 
-// PIProtoMessage represents a PI Interoperability protocol buffer message
-type PIProtoMessage struct {
-	Type    string          `protobuf:"bytes,1,opt,name=type"`
-	Payload []byte          `protobuf:"bytes,2,opt,name=payload"`
-}
-
 // Marshal marshals a PI Interoperability protocol buffer message
 func (m *PIProtoMessage) Marshal() ([]byte, error) {
 	return proto.Marshal(m)
@@ -0,0 +1,175 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: pi_message.proto
+
+package protocol
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// PIProtoMessage is the protobuf wire form of PIMessage, sent as a binary
+// frame when a connection negotiates the pi.v1.proto subprotocol
+type PIProtoMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// type selects the handler, as PIMessage.Type
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// payload is the message body, as PIMessage.Payload
+	Payload []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	// id identifies the message, as PIMessage.ID
+	Id string `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	// correlation_id is the id of the request this message answers
+	CorrelationId string `protobuf:"bytes,4,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	// timestamp is when the message was sent, in Unix milliseconds
+	Timestamp int64 `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// ack asks the receiver to acknowledge the message
+	Ack           bool `protobuf:"varint,6,opt,name=ack,proto3" json:"ack,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PIProtoMessage) Reset() {
+	*x = PIProtoMessage{}
+	mi := &file_pi_message_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PIProtoMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PIProtoMessage) ProtoMessage() {}
+
+func (x *PIProtoMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_pi_message_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PIProtoMessage.ProtoReflect.Descriptor instead.
+func (*PIProtoMessage) Descriptor() ([]byte, []int) {
+	return file_pi_message_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PIProtoMessage) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *PIProtoMessage) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *PIProtoMessage) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PIProtoMessage) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+func (x *PIProtoMessage) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *PIProtoMessage) GetAck() bool {
+	if x != nil {
+		return x.Ack
+	}
+	return false
+}
+
+var File_pi_message_proto protoreflect.FileDescriptor
+
+const file_pi_message_proto_rawDesc = "" +
+	"\n" +
+	"\x10pi_message.proto\x12\x16pi.interoperability.v1\"\xa5\x01\n" +
+	"\x0ePIProtoMessage\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x18\n" +
+	"\apayload\x18\x02 \x01(\fR\apayload\x12\x0e\n" +
+	"\x02id\x18\x03 \x01(\tR\x02id\x12%\n" +
+	"\x0ecorrelation_id\x18\x04 \x01(\tR\rcorrelationId\x12\x1c\n" +
+	"\ttimestamp\x18\x05 \x01(\x03R\ttimestamp\x12\x10\n" +
+	"\x03ack\x18\x06 \x01(\bR\x03ackB\x1eZ\x1cpi/interoperability/protocolb\x06proto3"
+
+var (
+	file_pi_message_proto_rawDescOnce sync.Once
+	file_pi_message_proto_rawDescData []byte
+)
+
+func file_pi_message_proto_rawDescGZIP() []byte {
+	file_pi_message_proto_rawDescOnce.Do(func() {
+		file_pi_message_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pi_message_proto_rawDesc), len(file_pi_message_proto_rawDesc)))
+	})
+	return file_pi_message_proto_rawDescData
+}
+
+var file_pi_message_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_pi_message_proto_goTypes = []any{
+	(*PIProtoMessage)(nil), // 0: pi.interoperability.v1.PIProtoMessage
+}
+var file_pi_message_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_pi_message_proto_init() }
+func file_pi_message_proto_init() {
+	if File_pi_message_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pi_message_proto_rawDesc), len(file_pi_message_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_pi_message_proto_goTypes,
+		DependencyIndexes: file_pi_message_proto_depIdxs,
+		MessageInfos:      file_pi_message_proto_msgTypes,
+	}.Build()
+	File_pi_message_proto = out.File
+	file_pi_message_proto_goTypes = nil
+	file_pi_message_proto_depIdxs = nil
+}
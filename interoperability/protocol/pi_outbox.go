@@ -0,0 +1,168 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Outbox holds messages that asked for an acknowledgement until the peer
+// acknowledges them. The client resends everything still in the outbox
+// after every reconnect, which gives at-least-once delivery.
+type Outbox interface {
+	// Put stores a message under its ID
+	Put(message *PIMessage) error
+	// Delete removes an acknowledged message. Unknown IDs are ignored.
+	Delete(id string) error
+	// List returns the stored messages, oldest first
+	List() ([]*PIMessage, error)
+}
+
+// MemoryOutbox is an Outbox that lasts as long as the process
+type MemoryOutbox struct {
+	messages map[string]*PIMessage
+	order    []string
+	mu       sync.Mutex
+}
+
+// NewMemoryOutbox creates an empty in-memory outbox
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{messages: make(map[string]*PIMessage)}
+}
+
+// Put stores a message
+func (o *MemoryOutbox) Put(message *PIMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.messages[message.ID]; !ok {
+		o.order = append(o.order, message.ID)
+	}
+	o.messages[message.ID] = message
+	return nil
+}
+
+// Delete removes a message
+func (o *MemoryOutbox) Delete(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.messages[id]; !ok {
+		return nil
+	}
+	delete(o.messages, id)
+	for i, stored := range o.order {
+		if stored == id {
+			o.order = append(o.order[:i], o.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// List returns the stored messages, oldest first
+func (o *MemoryOutbox) List() ([]*PIMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	messages := make([]*PIMessage, 0, len(o.order))
+	for _, id := range o.order {
+		messages = append(messages, o.messages[id])
+	}
+	return messages, nil
+}
+
+// FileOutbox is an Outbox that survives restarts. Each message is a JSON
+// file in a directory, named by timestamp and ID so they list in order.
+type FileOutbox struct {
+	dir   string
+	files map[string]string
+	mu    sync.Mutex
+}
+
+// NewFileOutbox opens the outbox in dir, creating the directory if needed
+func NewFileOutbox(dir string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	o := &FileOutbox{dir: dir, files: make(map[string]string)}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		_, id, ok := strings.Cut(strings.TrimSuffix(name, ".json"), "-")
+		if !ok {
+			continue
+		}
+		o.files[id] = name
+	}
+	return o, nil
+}
+
+// Put writes a message atomically
+func (o *FileOutbox) Put(message *PIMessage) error {
+	if message.ID == "" || strings.ContainsAny(message.ID, `/\`) {
+		return fmt.Errorf("invalid outbox message ID %q", message.ID)
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	name, ok := o.files[message.ID]
+	if !ok {
+		name = fmt.Sprintf("%020d-%s.json", message.Timestamp, message.ID)
+	}
+	if err := WriteFileAtomic(filepath.Join(o.dir, name), data); err != nil {
+		return err
+	}
+	o.files[message.ID] = name
+	return nil
+}
+
+// Delete removes an acknowledged message's file
+func (o *FileOutbox) Delete(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	name, ok := o.files[id]
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(o.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	delete(o.files, id)
+	return nil
+}
+
+// List reads the stored messages, oldest first
+func (o *FileOutbox) List() ([]*PIMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	names := make([]string, 0, len(o.files))
+	for _, name := range o.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	messages := make([]*PIMessage, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(o.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		var message PIMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			return nil, fmt.Errorf("outbox file %s: %w", name, err)
+		}
+		messages = append(messages, &message)
+	}
+	return messages, nil
+}
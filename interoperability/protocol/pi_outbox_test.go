@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func testOutbox(t *testing.T, outbox Outbox) {
+	for i, id := range []string{"b", "a", "c"} {
+		if err := outbox.Put(&PIMessage{ID: id, Type: "transfer", Timestamp: int64(i + 1)}); err != nil {
+			t.Fatalf("Expected Put to succeed, but got error: %s", err)
+		}
+	}
+	// Putting again replaces the message but keeps its place
+	if err := outbox.Put(&PIMessage{ID: "b", Type: "updated", Timestamp: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Delete("a"); err != nil {
+		t.Errorf("Expected Delete to succeed, but got error: %s", err)
+	}
+	if err := outbox.Delete("unknown"); err != nil {
+		t.Errorf("Expected Delete of an unknown ID to succeed, but got error: %s", err)
+	}
+	messages, err := outbox.List()
+	if err != nil {
+		t.Fatalf("Expected List to succeed, but got error: %s", err)
+	}
+	if len(messages) != 2 || messages[0].ID != "b" || messages[1].ID != "c" {
+		t.Fatalf("Expected messages b and c in order, but got %+v", messages)
+	}
+	if messages[0].Type != "updated" {
+		t.Errorf("Expected the replaced message, but got type %s", messages[0].Type)
+	}
+}
+
+func TestMemoryOutbox(t *testing.T) {
+	testOutbox(t, NewMemoryOutbox())
+}
+
+func TestFileOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := NewFileOutbox(dir)
+	if err != nil {
+		t.Fatalf("Expected NewFileOutbox to succeed, but got error: %s", err)
+	}
+	testOutbox(t, outbox)
+
+	// Reopening finds the messages that weren't deleted
+	reopened, err := NewFileOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].ID != "b" || messages[1].ID != "c" {
+		t.Errorf("Expected messages b and c after reopening, but got %+v", messages)
+	}
+	if err := reopened.Delete("c"); err != nil {
+		t.Errorf("Expected Delete after reopening to succeed, but got error: %s", err)
+	}
+}
+
+func TestFileOutboxRejectsBadID(t *testing.T) {
+	outbox, err := NewFileOutbox(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"", "../escape"} {
+		if err := outbox.Put(&PIMessage{ID: id}); err == nil {
+			t.Errorf("Expected Put to reject ID %q", id)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package protocol
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Message types carrying packets between routers, and letting relayers
+// query and settle the packets a router sent
+const (
+	MessageTypePacket         = "pi.packet"
+	MessageTypeStatus         = "pi.status"
+	MessageTypePendingPackets = "pi.packet.pending"
+	MessageTypePacketProof    = "pi.packet.proof"
+	MessageTypePacketAck      = "pi.packet.ack"
+	MessageTypePacketTimeout  = "pi.packet.timeout"
+	MessageTypeAckProof       = "pi.packet.ack.proof"
+)
+
+// ErrInvalidPacket is returned for packets missing a required field
+var ErrInvalidPacket = errors.New("invalid packet")
+
+// Packet is a cross-chain message, modelled on IBC packets. It is sent from a
+// port and channel on the source chain to a port and channel on the
+// destination chain, and is numbered by a sequence that is unique per source
+// channel. A packet that hasn't been received by its timeout height or
+// timestamp on the destination chain can no longer be received, and is
+// timed out on the source chain instead.
+type Packet struct {
+	Sequence uint64 `json:"sequence"`
+
+	SourceChain   string `json:"source_chain"`
+	SourcePort    string `json:"source_port"`
+	SourceChannel string `json:"source_channel"`
+
+	DestinationChain   string `json:"destination_chain"`
+	DestinationPort    string `json:"destination_port"`
+	DestinationChannel string `json:"destination_channel"`
+
+	// TimeoutHeight is the first destination height at which the packet is
+	// timed out, or 0 for none
+	TimeoutHeight uint64 `json:"timeout_height,omitempty"`
+	// TimeoutTimestamp is the first destination time, in Unix milliseconds,
+	// at which the packet is timed out, or 0 for none
+	TimeoutTimestamp int64 `json:"timeout_timestamp,omitempty"`
+
+	Data []byte `json:"data"`
+
+	// Proof proves the source chain committed the packet. It isn't part of
+	// the commitment, and is required only by routers that verify packets
+	// from the source chain.
+	Proof *PacketProof `json:"proof,omitempty"`
+}
+
+// PacketProof proves a packet or acknowledgement commitment is stored on the
+// chain that wrote it, in the state at Height. Proof is in that chain's own
+// format and is checked by a light client of the chain.
+type PacketProof struct {
+	Height uint64 `json:"height"`
+	Proof  []byte `json:"proof"`
+}
+
+// ProofVerifier checks the proofs of one chain: of the packets it sent, and
+// of the acknowledgements it wrote for the packets it received
+type ProofVerifier interface {
+	VerifyPacket(packet *Packet, proof *PacketProof) error
+	VerifyAcknowledgement(packet *Packet, ack *Acknowledgement, proof *PacketProof) error
+}
+
+// PacketProver proves the commitments of packets sent by the local chain,
+// and of the acknowledgements it wrote for packets it received
+type PacketProver interface {
+	ProvePacket(ctx context.Context, packet *Packet) (*PacketProof, error)
+	ProveAcknowledgement(ctx context.Context, packet *Packet, ack *Acknowledgement) (*PacketProof, error)
+}
+
+// Validate checks that the packet is routable and can time out
+func (p *Packet) Validate() error {
+	switch {
+	case p.SourceChain == "" || p.SourcePort == "" || p.SourceChannel == "":
+		return fmt.Errorf("%w: missing source", ErrInvalidPacket)
+	case p.DestinationChain == "" || p.DestinationPort == "" || p.DestinationChannel == "":
+		return fmt.Errorf("%w: missing destination", ErrInvalidPacket)
+	case p.SourceChain == p.DestinationChain:
+		return fmt.Errorf("%w: source and destination chain are both %s", ErrInvalidPacket, p.SourceChain)
+	case p.TimeoutHeight == 0 && p.TimeoutTimestamp == 0:
+		return fmt.Errorf("%w: no timeout", ErrInvalidPacket)
+	}
+	return nil
+}
+
+// TimedOut reports whether the packet has timed out on a destination chain
+// at the given height and time
+func (p *Packet) TimedOut(height uint64, timestamp int64) bool {
+	return (p.TimeoutHeight != 0 && height >= p.TimeoutHeight) ||
+		(p.TimeoutTimestamp != 0 && timestamp >= p.TimeoutTimestamp)
+}
+
+// Commitment is the hash the source chain keeps for a sent packet until it
+// is acknowledged or timed out. It covers everything the destination acts on
+// besides the routing fields.
+func (p *Packet) Commitment() []byte {
+	data := sha256.Sum256(p.Data)
+	b := make([]byte, 0, 16+len(data))
+	b = binary.BigEndian.AppendUint64(b, p.TimeoutHeight)
+	b = binary.BigEndian.AppendUint64(b, uint64(p.TimeoutTimestamp))
+	b = append(b, data[:]...)
+	commitment := sha256.Sum256(b)
+	return commitment[:]
+}
+
+// key identifies the packet among all packets of its source chain
+func (p *Packet) key() string {
+	return fmt.Sprintf("%s/%s/%d", p.SourcePort, p.SourceChannel, p.Sequence)
+}
+
+// Acknowledgement is the destination chain's response to a received packet.
+// An acknowledgement with an error tells the source that the packet failed,
+// which is handled like a timeout, e.g. by refunding escrowed tokens.
+type Acknowledgement struct {
+	Result []byte `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// Proof proves the destination chain committed the acknowledgement. It
+	// isn't part of the commitment, and is required only by routers that
+	// verify the destination chain.
+	Proof *PacketProof `json:"proof,omitempty"`
+}
+
+// Success reports whether the packet was processed successfully
+func (a *Acknowledgement) Success() bool {
+	return a.Error == ""
+}
+
+// Commitment is the hash the destination chain keeps of its acknowledgement
+// of a received packet
+func (a *Acknowledgement) Commitment() []byte {
+	var b []byte
+	if a.Success() {
+		b = append([]byte{1}, a.Result...)
+	} else {
+		b = append([]byte{0}, a.Error...)
+	}
+	commitment := sha256.Sum256(b)
+	return commitment[:]
+}
+
+// NewResultAcknowledgement acknowledges a successful packet
+func NewResultAcknowledgement(result []byte) *Acknowledgement {
+	return &Acknowledgement{Result: result}
+}
+
+// NewErrorAcknowledgement acknowledges a failed packet
+func NewErrorAcknowledgement(err error) *Acknowledgement {
+	return &Acknowledgement{Error: err.Error()}
+}
+
+// ChainStatus is a chain's latest height and block time in Unix milliseconds,
+// against which packet timeouts are checked
+type ChainStatus struct {
+	ChainID   string `json:"chain_id"`
+	Height    uint64 `json:"height"`
+	Timestamp int64  `json:"timestamp"`
+}
@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testPacket() *Packet {
+	return &Packet{
+		Sequence:           1,
+		SourceChain:        "pi-1",
+		SourcePort:         "transfer",
+		SourceChannel:      "channel-0",
+		DestinationChain:   "cosmoshub-4",
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-7",
+		TimeoutHeight:      100,
+		TimeoutTimestamp:   1700000000000,
+		Data:               []byte(`{"amount":"10"}`),
+	}
+}
+
+func TestPacketValidate(t *testing.T) {
+	if err := testPacket().Validate(); err != nil {
+		t.Errorf("Expected Validate to succeed, but got error: %s", err)
+	}
+	invalid := []func(*Packet){
+		func(p *Packet) { p.SourceChannel = "" },
+		func(p *Packet) { p.DestinationPort = "" },
+		func(p *Packet) { p.DestinationChain = p.SourceChain },
+		func(p *Packet) { p.TimeoutHeight, p.TimeoutTimestamp = 0, 0 },
+	}
+	for i, change := range invalid {
+		packet := testPacket()
+		change(packet)
+		if err := packet.Validate(); !errors.Is(err, ErrInvalidPacket) {
+			t.Errorf("Expected packet %d to be invalid, but got %v", i, err)
+		}
+	}
+}
+
+func TestPacketTimedOut(t *testing.T) {
+	packet := testPacket()
+	if packet.TimedOut(99, 1699999999999) {
+		t.Errorf("Expected the packet not to time out before its timeout")
+	}
+	if !packet.TimedOut(100, 0) || !packet.TimedOut(0, 1700000000000) {
+		t.Errorf("Expected the packet to time out at either timeout")
+	}
+	packet.TimeoutHeight = 0
+	if packet.TimedOut(1000, 0) {
+		t.Errorf("Expected a zero timeout height to be ignored")
+	}
+}
+
+func TestPacketCommitment(t *testing.T) {
+	commitment := testPacket().Commitment()
+	for i, change := range []func(*Packet){
+		func(p *Packet) { p.Data = []byte(`{"amount":"11"}`) },
+		func(p *Packet) { p.TimeoutHeight++ },
+		func(p *Packet) { p.TimeoutTimestamp++ },
+	} {
+		packet := testPacket()
+		change(packet)
+		if bytes.Equal(packet.Commitment(), commitment) {
+			t.Errorf("Expected change %d to change the commitment", i)
+		}
+	}
+	if !bytes.Equal(testPacket().Commitment(), commitment) {
+		t.Errorf("Expected the commitment to be deterministic")
+	}
+}
@@ -0,0 +1,804 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnknownChain is returned for packets to a chain without an endpoint
+	ErrUnknownChain = errors.New("unknown chain")
+
+	// ErrUnknownPort is returned for packets to or from a port no application is bound to
+	ErrUnknownPort = errors.New("unknown port")
+
+	// ErrPacketTimedOut is returned when sending or receiving a packet past its timeout
+	ErrPacketTimedOut = errors.New("packet timed out")
+
+	// ErrPacketNotTimedOut is returned when timing out a packet that can still be received
+	ErrPacketNotTimedOut = errors.New("packet not timed out")
+
+	// ErrPacketNotPending is returned for acknowledgements and timeouts of
+	// packets that weren't sent, or were already acknowledged or timed out
+	ErrPacketNotPending = errors.New("packet not pending")
+
+	// ErrMissingProof is returned for packets without a proof from a source
+	// chain whose packets are verified
+	ErrMissingProof = errors.New("packet proof missing")
+
+	// ErrUntrustedChain is returned for packets from a source chain that has
+	// neither a verifier nor explicit trust
+	ErrUntrustedChain = errors.New("untrusted chain")
+
+	// ErrPacketNotReceived is returned when proving the acknowledgement of a
+	// packet the router hasn't received
+	ErrPacketNotReceived = errors.New("packet not received")
+
+	// ErrPacketReceived is returned when timing out a packet the destination
+	// received before its timeout; it must be acknowledged instead
+	ErrPacketReceived = errors.New("packet received")
+)
+
+// ChainEndpoint is how a router reaches another chain
+type ChainEndpoint interface {
+	// ChainID identifies the chain
+	ChainID() string
+	// Status returns the chain's latest height and time
+	Status(ctx context.Context) (*ChainStatus, error)
+	// DeliverPacket submits a packet to the chain and returns its
+	// acknowledgement. A packet the chain already received returns its
+	// acknowledgement even past the timeout; one it never received fails with
+	// ErrPacketTimedOut once it no longer can, which is how routers check that
+	// a packet may be timed out.
+	DeliverPacket(ctx context.Context, packet *Packet) (*Acknowledgement, error)
+}
+
+// AcknowledgementProver is implemented by endpoints that prove the
+// acknowledgements their chain wrote, which routers verifying that chain
+// require to settle packets
+type AcknowledgementProver interface {
+	ProveAcknowledgement(ctx context.Context, packet *Packet) (*PacketProof, error)
+}
+
+// PacketApplication is the module bound to a port, such as a token transfer.
+// Failed acknowledgements and timeouts are where it undoes the effects of
+// sending, e.g. refunds escrowed tokens.
+type PacketApplication interface {
+	// OnRecvPacket processes a packet received from another chain
+	OnRecvPacket(ctx context.Context, packet *Packet) *Acknowledgement
+	// OnAcknowledgementPacket is called with the destination's acknowledgement
+	// of a packet sent from this port
+	OnAcknowledgementPacket(ctx context.Context, packet *Packet, ack *Acknowledgement) error
+	// OnTimeoutPacket is called when a packet sent from this port timed out
+	OnTimeoutPacket(ctx context.Context, packet *Packet) error
+}
+
+// StatusFunc returns the local chain's status
+type StatusFunc func(ctx context.Context) (*ChainStatus, error)
+
+// Router sends packets from the applications of the local chain to other
+// chains, delivers received packets to the applications, and settles sent
+// packets when they are acknowledged or time out
+type Router struct {
+	chainID string
+	status  StatusFunc
+
+	apps      map[string]PacketApplication
+	chains    map[string]ChainEndpoint
+	sequences map[string]uint64
+	pending   map[string]*Packet
+	receipts  map[string]*Acknowledgement
+	verifiers map[string]ProofVerifier
+	trusted   map[string]bool
+	peers     map[string]map[string]bool
+	prover    PacketProver
+	store     RouterStore
+	mu        sync.Mutex
+	// receiving serializes ReceivePacket, so a packet retried concurrently
+	// isn't processed twice
+	receiving sync.Mutex
+	// settling serializes acknowledgements and timeouts, so a packet is
+	// settled only once
+	settling sync.Mutex
+}
+
+// NewRouter creates a router for the chain with the given ID, keeping its
+// state in memory
+func NewRouter(chainID string, status StatusFunc) *Router {
+	r, _ := NewRouterWithStore(chainID, status, NewMemoryRouterStore())
+	return r
+}
+
+// NewRouterWithStore creates a router for the chain with the given ID that
+// persists its sequences, pending packets and receipts in store, and resumes
+// from the state already there
+func NewRouterWithStore(chainID string, status StatusFunc, store RouterStore) (*Router, error) {
+	state, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	r := &Router{
+		chainID:   chainID,
+		status:    status,
+		apps:      make(map[string]PacketApplication),
+		chains:    make(map[string]ChainEndpoint),
+		sequences: make(map[string]uint64),
+		pending:   make(map[string]*Packet),
+		receipts:  make(map[string]*Acknowledgement),
+		verifiers: make(map[string]ProofVerifier),
+		trusted:   make(map[string]bool),
+		peers:     make(map[string]map[string]bool),
+		store:     store,
+	}
+	for channel, sequence := range state.Sequences {
+		r.sequences[channel] = sequence
+	}
+	for _, packet := range state.Pending {
+		r.pending[packet.key()] = packet
+	}
+	for key, ack := range state.Receipts {
+		r.receipts[key] = ack
+	}
+	return r, nil
+}
+
+// ChainID returns the ID of the local chain
+func (r *Router) ChainID() string {
+	return r.chainID
+}
+
+// BindPort binds an application to a port, replacing any previous one
+func (r *Router) BindPort(port string, app PacketApplication) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apps[port] = app
+}
+
+// AddChain adds or replaces the endpoint of a remote chain
+func (r *Router) AddChain(endpoint ChainEndpoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chains[endpoint.ChainID()] = endpoint
+}
+
+// SetVerifier makes the router verify the proofs of packets from a source
+// chain, and of the acknowledgements of packets sent to it, usually with a
+// light client of that chain. Packets from chains without a verifier are
+// rejected unless the chain is trusted.
+func (r *Router) SetVerifier(chainID string, verifier ProofVerifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.verifiers[chainID] = verifier
+}
+
+// SetTrusted makes the router accept packets from a source chain without a
+// verifier as delivered, without proofs. Only trust chains whose relayers
+// are trusted as much as the chain itself.
+func (r *Router) SetTrusted(chainID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.trusted[chainID] = true
+}
+
+// AllowPeer lets an authenticated peer deliver packets from the given source
+// chains when the router is served. Packets from trusted chains aren't
+// proven, so a peer that could speak for any chain could forge them.
+func (r *Router) AllowPeer(peer string, chainIDs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.peers[peer] == nil {
+		r.peers[peer] = make(map[string]bool)
+	}
+	for _, chainID := range chainIDs {
+		r.peers[peer][chainID] = true
+	}
+}
+
+func (r *Router) peerAllowed(peer string, chainID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.peers[peer][chainID]
+}
+
+// SetProver sets how the router proves the commitments of the packets it
+// sent and the acknowledgements it wrote to the relayers delivering them
+func (r *Router) SetProver(prover PacketProver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prover = prover
+}
+
+func (r *Router) app(port string) (PacketApplication, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	app, ok := r.apps[port]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPort, port)
+	}
+	return app, nil
+}
+
+func (r *Router) chain(chainID string) (ChainEndpoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	endpoint, ok := r.chains[chainID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownChain, chainID)
+	}
+	return endpoint, nil
+}
+
+// SendPacket assigns the packet the next sequence of its source channel and
+// keeps it pending until it is acknowledged or times out. The source chain
+// defaults to the local chain. Packets already past their timeout on the
+// destination are rejected.
+func (r *Router) SendPacket(ctx context.Context, packet *Packet) (uint64, error) {
+	if packet.SourceChain == "" {
+		packet.SourceChain = r.chainID
+	}
+	if packet.SourceChain != r.chainID {
+		return 0, fmt.Errorf("%w: sent from %s on %s", ErrInvalidPacket, packet.SourceChain, r.chainID)
+	}
+	if err := packet.Validate(); err != nil {
+		return 0, err
+	}
+	if _, err := r.app(packet.SourcePort); err != nil {
+		return 0, err
+	}
+	endpoint, err := r.chain(packet.DestinationChain)
+	if err != nil {
+		return 0, err
+	}
+	status, err := endpoint.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if packet.TimedOut(status.Height, status.Timestamp) {
+		return 0, ErrPacketTimedOut
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	channel := channelKey(packet)
+	packet.Sequence = r.sequences[channel] + 1
+	sent := *packet
+	// The packet is only sent once it is stored, so a restart never reuses
+	// its sequence or forgets to settle it
+	if err := r.store.SavePending(&sent); err != nil {
+		packet.Sequence = 0
+		return 0, err
+	}
+	r.sequences[channel] = sent.Sequence
+	r.pending[packet.key()] = &sent
+	return packet.Sequence, nil
+}
+
+// Pending returns the packets sent and not yet acknowledged or timed out,
+// in the order they were sent on each channel
+func (r *Router) Pending() []*Packet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	packets := make([]*Packet, 0, len(r.pending))
+	for _, packet := range r.pending {
+		sent := *packet
+		packets = append(packets, &sent)
+	}
+	sort.Slice(packets, func(i, j int) bool {
+		if packets[i].SourcePort != packets[j].SourcePort {
+			return packets[i].SourcePort < packets[j].SourcePort
+		}
+		if packets[i].SourceChannel != packets[j].SourceChannel {
+			return packets[i].SourceChannel < packets[j].SourceChannel
+		}
+		return packets[i].Sequence < packets[j].Sequence
+	})
+	return packets
+}
+
+// pendingPacket returns the sent packet matching packet, which must not have
+// been altered since it was sent
+func (r *Router) pendingPacket(packet *Packet) (*Packet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sent, ok := r.pending[packet.key()]
+	if !ok || sent.DestinationChain != packet.DestinationChain || !bytes.Equal(sent.Commitment(), packet.Commitment()) {
+		return nil, ErrPacketNotPending
+	}
+	return sent, nil
+}
+
+// settle removes a pending packet once its application has handled the
+// outcome. The application has already acted on it, so the packet is gone
+// from memory even if the store fails to forget it.
+func (r *Router) settle(packet *Packet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, packet.key())
+	return r.store.DeletePending(packet)
+}
+
+// Relay delivers a pending packet to its destination and settles it with
+// the acknowledgement, or times it out if the destination is past its
+// timeout and never received it
+func (r *Router) Relay(ctx context.Context, packet *Packet) error {
+	sent, err := r.pendingPacket(packet)
+	if err != nil {
+		return err
+	}
+	endpoint, err := r.chain(sent.DestinationChain)
+	if err != nil {
+		return err
+	}
+	ack, err := endpoint.DeliverPacket(ctx, sent)
+	if errors.Is(err, ErrPacketTimedOut) {
+		return r.timeout(ctx, sent)
+	}
+	if err != nil {
+		return err
+	}
+	if prover, ok := endpoint.(AcknowledgementProver); ok && ack.Proof == nil {
+		proof, err := prover.ProveAcknowledgement(ctx, sent)
+		if err != nil {
+			return err
+		}
+		proven := *ack
+		proven.Proof = proof
+		ack = &proven
+	}
+	return r.AcknowledgePacket(ctx, sent, ack)
+}
+
+// ProvePacket proves the commitment of a pending packet. Without a prover
+// it returns a nil proof, which only destinations that don't verify packets
+// from this chain accept.
+func (r *Router) ProvePacket(ctx context.Context, packet *Packet) (*PacketProof, error) {
+	sent, err := r.pendingPacket(packet)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	prover := r.prover
+	r.mu.Unlock()
+	if prover == nil {
+		return nil, nil
+	}
+	return prover.ProvePacket(ctx, sent)
+}
+
+// ProveAcknowledgement proves the acknowledgement the router wrote for a
+// received packet. Without a prover it returns a nil proof, which only
+// sources that don't verify this chain accept.
+func (r *Router) ProveAcknowledgement(ctx context.Context, packet *Packet) (*PacketProof, error) {
+	r.mu.Lock()
+	ack, ok := r.receipts[receiptKey(packet)]
+	prover := r.prover
+	r.mu.Unlock()
+	if !ok {
+		return nil, ErrPacketNotReceived
+	}
+	if prover == nil {
+		return nil, nil
+	}
+	return prover.ProveAcknowledgement(ctx, packet, ack)
+}
+
+// RelayPending relays every pending packet and returns the errors of those
+// that couldn't be relayed; they stay pending to be retried
+func (r *Router) RelayPending(ctx context.Context) error {
+	var errs []error
+	for _, packet := range r.Pending() {
+		if err := r.Relay(ctx, packet); err != nil {
+			errs = append(errs, fmt.Errorf("packet %s to %s: %w", packet.key(), packet.DestinationChain, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AcknowledgePacket hands the acknowledgement of a pending packet to the
+// application that sent it and settles the packet. If a verifier is set for
+// the destination chain, the acknowledgement's proof must verify. If the
+// application fails the packet stays pending.
+func (r *Router) AcknowledgePacket(ctx context.Context, packet *Packet, ack *Acknowledgement) error {
+	r.settling.Lock()
+	defer r.settling.Unlock()
+	sent, err := r.pendingPacket(packet)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	verifier := r.verifiers[sent.DestinationChain]
+	r.mu.Unlock()
+	if verifier != nil {
+		if ack.Proof == nil {
+			return ErrMissingProof
+		}
+		if err := verifier.VerifyAcknowledgement(sent, ack, ack.Proof); err != nil {
+			return err
+		}
+	}
+	app, err := r.app(sent.SourcePort)
+	if err != nil {
+		return err
+	}
+	if err := app.OnAcknowledgementPacket(ctx, sent, ack); err != nil {
+		return err
+	}
+	return r.settle(sent)
+}
+
+// TimeoutPacket times out a pending packet once the destination chain is
+// past its timeout, so the destination can no longer receive it. The
+// destination is asked whether it received the packet before, and if it
+// did the timeout fails with ErrPacketReceived.
+func (r *Router) TimeoutPacket(ctx context.Context, packet *Packet) error {
+	sent, err := r.pendingPacket(packet)
+	if err != nil {
+		return err
+	}
+	endpoint, err := r.chain(sent.DestinationChain)
+	if err != nil {
+		return err
+	}
+	status, err := endpoint.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if !sent.TimedOut(status.Height, status.Timestamp) {
+		return ErrPacketNotTimedOut
+	}
+	if err := notReceived(ctx, endpoint, sent); err != nil {
+		return err
+	}
+	return r.timeout(ctx, sent)
+}
+
+// notReceived checks that the destination never received a packet past its
+// timeout. Delivering it again returns the destination's acknowledgement if
+// it did, and fails with ErrPacketTimedOut if it didn't.
+func notReceived(ctx context.Context, endpoint ChainEndpoint, packet *Packet) error {
+	_, err := endpoint.DeliverPacket(ctx, packet)
+	switch {
+	case err == nil:
+		return ErrPacketReceived
+	case errors.Is(err, ErrPacketTimedOut):
+		return nil
+	default:
+		return err
+	}
+}
+
+func (r *Router) timeout(ctx context.Context, packet *Packet) error {
+	r.settling.Lock()
+	defer r.settling.Unlock()
+	sent, err := r.pendingPacket(packet)
+	if err != nil {
+		return err
+	}
+	app, err := r.app(sent.SourcePort)
+	if err != nil {
+		return err
+	}
+	if err := app.OnTimeoutPacket(ctx, sent); err != nil {
+		return err
+	}
+	return r.settle(sent)
+}
+
+// ReceivePacket delivers a packet from another chain to the application
+// bound to its destination port and returns the acknowledgement. If a
+// verifier is set for the source chain, the packet's proof must verify;
+// otherwise the source chain must be trusted. A packet is processed only
+// once; receiving it again returns the first acknowledgement, so relayers
+// can safely retry.
+func (r *Router) ReceivePacket(ctx context.Context, packet *Packet) (*Acknowledgement, error) {
+	if packet.DestinationChain != r.chainID {
+		return nil, fmt.Errorf("%w: sent to %s, received on %s", ErrInvalidPacket, packet.DestinationChain, r.chainID)
+	}
+	if err := packet.Validate(); err != nil {
+		return nil, err
+	}
+	r.receiving.Lock()
+	defer r.receiving.Unlock()
+	receipt := receiptKey(packet)
+	r.mu.Lock()
+	ack, ok := r.receipts[receipt]
+	r.mu.Unlock()
+	if ok {
+		return ack, nil
+	}
+
+	status, err := r.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if packet.TimedOut(status.Height, status.Timestamp) {
+		return nil, ErrPacketTimedOut
+	}
+	r.mu.Lock()
+	verifier := r.verifiers[packet.SourceChain]
+	trusted := r.trusted[packet.SourceChain]
+	r.mu.Unlock()
+	if verifier == nil && !trusted {
+		return nil, fmt.Errorf("%w: %s", ErrUntrustedChain, packet.SourceChain)
+	}
+	if verifier != nil {
+		if packet.Proof == nil {
+			return nil, ErrMissingProof
+		}
+		if err := verifier.VerifyPacket(packet, packet.Proof); err != nil {
+			return nil, err
+		}
+	}
+	app, err := r.app(packet.DestinationPort)
+	if err != nil {
+		return nil, err
+	}
+	ack = app.OnRecvPacket(ctx, packet)
+	if ack == nil {
+		ack = NewResultAcknowledgement(nil)
+	}
+	// The application has processed the packet, so its acknowledgement is
+	// kept in memory even if the store fails, and retries still get it
+	r.mu.Lock()
+	r.receipts[receipt] = ack
+	r.mu.Unlock()
+	if err := r.store.SaveReceipt(packet, ack); err != nil {
+		return nil, err
+	}
+	return ack, nil
+}
+
+// routerReply answers the requests of ClientEndpoints. Error carries the
+// failure of the request, as opposed to an error acknowledgement, which is
+// the outcome of a received packet.
+type routerReply struct {
+	Ack   *Acknowledgement `json:"ack,omitempty"`
+	Proof *PacketProof     `json:"proof,omitempty"`
+	Error string           `json:"error,omitempty"`
+}
+
+// packetAcknowledgement is a relayed acknowledgement of a sent packet
+type packetAcknowledgement struct {
+	Packet *Packet          `json:"packet"`
+	Ack    *Acknowledgement `json:"ack"`
+}
+
+// Serve answers status requests, receives packets sent over the
+// interoperability protocol by ClientEndpoints of other chains, and lets
+// relayers query, prove and settle the packets the router sent. Only
+// authenticated peers may settle packets: timeouts are checked with the
+// destination rather than proven, and acknowledgements from chains without
+// a verifier aren't proven at all. Packets are only received from
+// authenticated peers allowed to deliver them with AllowPeer.
+func (r *Router) Serve(server *Server) {
+	server.Handle(MessageTypeStatus, func(session *Session, message *PIMessage) {
+		status, err := r.status(context.Background())
+		if err != nil {
+			return
+		}
+		response := &PIMessage{Type: MessageTypeStatus}
+		if err := response.MarshalPayload(status); err != nil {
+			return
+		}
+		session.Reply(message, response)
+	})
+	server.Handle(MessageTypePendingPackets, func(session *Session, message *PIMessage) {
+		response := &PIMessage{Type: MessageTypePendingPackets}
+		if err := response.MarshalPayload(r.Pending()); err != nil {
+			return
+		}
+		session.Reply(message, response)
+	})
+	server.Handle(MessageTypePacket, authenticated(func(session *Session, message *PIMessage) {
+		handlePacket(func(ctx context.Context, packet *Packet) (*routerReply, error) {
+			if !r.peerAllowed(session.Peer, packet.SourceChain) {
+				return nil, fmt.Errorf("%w: %s may not deliver packets from %s", ErrUnauthorized, session.Peer, packet.SourceChain)
+			}
+			ack, err := r.ReceivePacket(ctx, packet)
+			return &routerReply{Ack: ack}, err
+		})(session, message)
+	}))
+	server.Handle(MessageTypePacketProof, handlePacket(func(ctx context.Context, packet *Packet) (*routerReply, error) {
+		proof, err := r.ProvePacket(ctx, packet)
+		return &routerReply{Proof: proof}, err
+	}))
+	server.Handle(MessageTypeAckProof, handlePacket(func(ctx context.Context, packet *Packet) (*routerReply, error) {
+		proof, err := r.ProveAcknowledgement(ctx, packet)
+		return &routerReply{Proof: proof}, err
+	}))
+	server.Handle(MessageTypePacketTimeout, authenticated(handlePacket(func(ctx context.Context, packet *Packet) (*routerReply, error) {
+		return &routerReply{}, r.TimeoutPacket(ctx, packet)
+	})))
+	server.Handle(MessageTypePacketAck, authenticated(func(session *Session, message *PIMessage) {
+		var request packetAcknowledgement
+		reply := &routerReply{}
+		if err := message.UnmarshalPayload(&request); err != nil {
+			reply.Error = err.Error()
+		} else if request.Packet == nil || request.Ack == nil {
+			reply.Error = ErrInvalidPacket.Error()
+		} else if err := r.AcknowledgePacket(context.Background(), request.Packet, request.Ack); err != nil {
+			reply.Error = err.Error()
+		}
+		respond(session, message, reply)
+	}))
+}
+
+// handlePacket answers requests carrying a packet with handle's reply
+func handlePacket(handle func(ctx context.Context, packet *Packet) (*routerReply, error)) SessionHandler {
+	return func(session *Session, message *PIMessage) {
+		var packet Packet
+		reply := &routerReply{}
+		if err := message.UnmarshalPayload(&packet); err != nil {
+			reply.Error = err.Error()
+		} else if reply, err = handle(context.Background(), &packet); err != nil {
+			reply = &routerReply{Error: err.Error()}
+		}
+		respond(session, message, reply)
+	}
+}
+
+// authenticated refuses the requests of anonymous peers
+func authenticated(handler SessionHandler) SessionHandler {
+	return func(session *Session, message *PIMessage) {
+		if session.Peer == "" {
+			respond(session, message, &routerReply{Error: ErrUnauthorized.Error()})
+			return
+		}
+		handler(session, message)
+	}
+}
+
+func respond(session *Session, request *PIMessage, reply *routerReply) {
+	response := &PIMessage{Type: request.Type}
+	if err := response.MarshalPayload(reply); err != nil {
+		return
+	}
+	session.Reply(request, response)
+}
+
+// remoteErrors are the errors a ClientEndpoint recognizes in replies, so
+// callers can tell them apart with errors.Is
+var remoteErrors = []error{
+	ErrUnknownChain,
+	ErrUnknownPort,
+	ErrPacketTimedOut,
+	ErrPacketNotTimedOut,
+	ErrPacketNotPending,
+	ErrMissingProof,
+	ErrUntrustedChain,
+	ErrPacketNotReceived,
+	ErrPacketReceived,
+	ErrUnauthorized,
+	ErrInvalidPacket,
+}
+
+// remoteError turns the error message of a reply back into an error
+func remoteError(message string) error {
+	for _, err := range remoteErrors {
+		if message == err.Error() {
+			return err
+		}
+		if rest, ok := strings.CutPrefix(message, err.Error()+": "); ok {
+			return fmt.Errorf("%w: %s", err, rest)
+		}
+	}
+	return errors.New(message)
+}
+
+// ClientEndpoint reaches a chain whose router is served over the
+// interoperability protocol
+type ClientEndpoint struct {
+	chainID string
+	client  *Client
+}
+
+// NewClientEndpoint creates an endpoint for the chain with the given ID,
+// reached through client
+func NewClientEndpoint(chainID string, client *Client) *ClientEndpoint {
+	return &ClientEndpoint{chainID: chainID, client: client}
+}
+
+// ChainID returns the ID of the remote chain
+func (e *ClientEndpoint) ChainID() string {
+	return e.chainID
+}
+
+// Status requests the remote chain's status
+func (e *ClientEndpoint) Status(ctx context.Context) (*ChainStatus, error) {
+	response, err := e.client.Request(ctx, &PIMessage{Type: MessageTypeStatus, Payload: []byte(`null`)})
+	if err != nil {
+		return nil, err
+	}
+	var status ChainStatus
+	if err := response.UnmarshalPayload(&status); err != nil {
+		return nil, err
+	}
+	if status.ChainID != e.chainID {
+		return nil, fmt.Errorf("endpoint for %s is connected to %s", e.chainID, status.ChainID)
+	}
+	return &status, nil
+}
+
+// request sends a request to the remote router and returns its reply
+func (e *ClientEndpoint) request(ctx context.Context, messageType string, payload interface{}) (*routerReply, error) {
+	request := &PIMessage{Type: messageType}
+	if err := request.MarshalPayload(payload); err != nil {
+		return nil, err
+	}
+	response, err := e.client.Request(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	var reply routerReply
+	if err := response.UnmarshalPayload(&reply); err != nil {
+		return nil, err
+	}
+	if reply.Error != "" {
+		return nil, remoteError(reply.Error)
+	}
+	return &reply, nil
+}
+
+// DeliverPacket sends the packet to the remote router and waits for its
+// acknowledgement. A packet the router refused, e.g. for a missing proof,
+// returns an error instead; it wasn't received and may be delivered again.
+func (e *ClientEndpoint) DeliverPacket(ctx context.Context, packet *Packet) (*Acknowledgement, error) {
+	reply, err := e.request(ctx, MessageTypePacket, packet)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Ack == nil {
+		return nil, errors.New("reply without acknowledgement")
+	}
+	return reply.Ack, nil
+}
+
+// Pending requests the packets the remote router sent and hasn't settled
+func (e *ClientEndpoint) Pending(ctx context.Context) ([]*Packet, error) {
+	response, err := e.client.Request(ctx, &PIMessage{Type: MessageTypePendingPackets, Payload: []byte(`null`)})
+	if err != nil {
+		return nil, err
+	}
+	var packets []*Packet
+	if err := response.UnmarshalPayload(&packets); err != nil {
+		return nil, err
+	}
+	return packets, nil
+}
+
+// ProvePacket requests the proof of a packet the remote router sent
+func (e *ClientEndpoint) ProvePacket(ctx context.Context, packet *Packet) (*PacketProof, error) {
+	reply, err := e.request(ctx, MessageTypePacketProof, packet)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Proof, nil
+}
+
+// ProveAcknowledgement requests the proof of the acknowledgement the remote
+// router wrote for a packet it received
+func (e *ClientEndpoint) ProveAcknowledgement(ctx context.Context, packet *Packet) (*PacketProof, error) {
+	reply, err := e.request(ctx, MessageTypeAckProof, packet)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Proof, nil
+}
+
+// AcknowledgePacket relays the acknowledgement of a packet the remote router
+// sent, with its proof if the router verifies the acknowledging chain
+func (e *ClientEndpoint) AcknowledgePacket(ctx context.Context, packet *Packet, ack *Acknowledgement) error {
+	_, err := e.request(ctx, MessageTypePacketAck, &packetAcknowledgement{Packet: packet, Ack: ack})
+	return err
+}
+
+// TimeoutPacket times out a packet the remote router sent
+func (e *ClientEndpoint) TimeoutPacket(ctx context.Context, packet *Packet) error {
+	_, err := e.request(ctx, MessageTypePacketTimeout, packet)
+	return err
+}
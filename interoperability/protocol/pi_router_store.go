@@ -0,0 +1,281 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// RouterStore persists the state a router can't lose across restarts: the
+// last sequence sent on each channel, the packets awaiting settlement, and
+// the acknowledgements of received packets. Losing them would reuse
+// sequences, strand escrowed funds, and process retried packets twice.
+type RouterStore interface {
+	// Load returns the persisted state
+	Load() (*RouterState, error)
+	// SavePending records a sent packet and advances its channel's sequence
+	SavePending(packet *Packet) error
+	// DeletePending forgets a settled packet
+	DeletePending(packet *Packet) error
+	// SaveReceipt records the acknowledgement of a received packet
+	SaveReceipt(packet *Packet, ack *Acknowledgement) error
+}
+
+// RouterState is the persisted state of a router
+type RouterState struct {
+	// Sequences holds the last sequence sent, by source port and channel
+	Sequences map[string]uint64 `json:"sequences"`
+	// Pending holds the sent packets not yet settled
+	Pending []*Packet `json:"pending"`
+	// Receipts holds the acknowledgements of received packets, by receiptKey
+	Receipts map[string]*Acknowledgement `json:"receipts"`
+}
+
+func newRouterState() *RouterState {
+	return &RouterState{
+		Sequences: make(map[string]uint64),
+		Receipts:  make(map[string]*Acknowledgement),
+	}
+}
+
+// channelKey identifies the source channel of a packet
+func channelKey(packet *Packet) string {
+	return packet.SourcePort + "/" + packet.SourceChannel
+}
+
+// receiptKey identifies a received packet among the packets of all source chains
+func receiptKey(packet *Packet) string {
+	return packet.SourceChain + "/" + packet.key()
+}
+
+// MemoryRouterStore is a RouterStore that lasts as long as the process
+type MemoryRouterStore struct {
+	state *RouterState
+	mu    sync.Mutex
+}
+
+// NewMemoryRouterStore creates an empty in-memory store
+func NewMemoryRouterStore() *MemoryRouterStore {
+	return &MemoryRouterStore{state: newRouterState()}
+}
+
+// Load returns the stored state
+func (s *MemoryRouterStore) Load() (*RouterState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.clone(), nil
+}
+
+// SavePending records a sent packet
+func (s *MemoryRouterStore) SavePending(packet *Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.addPending(packet)
+	return nil
+}
+
+// DeletePending forgets a settled packet
+func (s *MemoryRouterStore) DeletePending(packet *Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.deletePending(packet)
+	return nil
+}
+
+// SaveReceipt records the acknowledgement of a received packet
+func (s *MemoryRouterStore) SaveReceipt(packet *Packet, ack *Acknowledgement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Receipts[receiptKey(packet)] = ack
+	return nil
+}
+
+// FileRouterStore is a RouterStore that survives restarts. Sequences and
+// pending packets are kept in one JSON file, rewritten atomically on every
+// change. Receipts are never deleted, since a packet received again must get
+// the same acknowledgement, so they are appended to a log next to it instead
+// of rewriting every receipt on every change.
+type FileRouterStore struct {
+	path     string
+	state    *RouterState
+	receipts map[string]*Acknowledgement
+	log      *os.File
+	logSize  int64
+	mu       sync.Mutex
+}
+
+// receiptRecord is a line of the receipt log
+type receiptRecord struct {
+	Key string           `json:"key"`
+	Ack *Acknowledgement `json:"ack"`
+}
+
+// NewFileRouterStore opens the store at path, with its receipts in
+// path.receipts, or starts an empty one if the files don't exist
+func NewFileRouterStore(path string) (*FileRouterStore, error) {
+	s := &FileRouterStore{path: path, state: newRouterState(), receipts: make(map[string]*Acknowledgement)}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, s.state); err != nil {
+			return nil, fmt.Errorf("router state %s: %w", path, err)
+		}
+	}
+	if s.state.Sequences == nil {
+		s.state.Sequences = make(map[string]uint64)
+	}
+	s.state.Receipts = make(map[string]*Acknowledgement)
+	if err := s.openLog(path + ".receipts"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openLog reads the receipt log and opens it for appending. A crash while
+// appending can leave a partial last record, which was never reported as
+// saved; it is cut off so the next record starts on a line of its own.
+func (s *FileRouterStore) openLog(path string) error {
+	log, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(log)
+	if err != nil {
+		log.Close()
+		return err
+	}
+	end := bytes.LastIndexByte(data, '\n') + 1
+	for _, line := range bytes.Split(data[:end], []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var record receiptRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			log.Close()
+			return fmt.Errorf("receipt log %s: %w", path, err)
+		}
+		s.receipts[record.Key] = record.Ack
+	}
+	if end < len(data) {
+		if err := log.Truncate(int64(end)); err != nil {
+			log.Close()
+			return err
+		}
+	}
+	s.log = log
+	s.logSize = int64(end)
+	return nil
+}
+
+// Close closes the receipt log
+func (s *FileRouterStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log.Close()
+}
+
+// Load returns the stored state
+func (s *FileRouterStore) Load() (*RouterState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state.clone()
+	for key, ack := range s.receipts {
+		state.Receipts[key] = ack
+	}
+	return state, nil
+}
+
+// SavePending records a sent packet
+func (s *FileRouterStore) SavePending(packet *Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.state.clone()
+	next.addPending(packet)
+	return s.save(next)
+}
+
+// DeletePending forgets a settled packet
+func (s *FileRouterStore) DeletePending(packet *Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.state.clone()
+	next.deletePending(packet)
+	return s.save(next)
+}
+
+// SaveReceipt appends the acknowledgement of a received packet to the
+// receipt log
+func (s *FileRouterStore) SaveReceipt(packet *Packet, ack *Acknowledgement) error {
+	key := receiptKey(packet)
+	data, err := json.Marshal(&receiptRecord{Key: key, Ack: ack})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.log.Write(data)
+	if err == nil {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		// Drop whatever part of the record made it to the log, so a failed
+		// record can't corrupt the next
+		s.log.Truncate(s.logSize)
+		return err
+	}
+	s.logSize += int64(len(data))
+	s.receipts[key] = ack
+	return nil
+}
+
+// save writes state and makes it the current state once it is on disk
+func (s *FileRouterStore) save(state *RouterState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(s.path, data); err != nil {
+		return err
+	}
+	s.state = state
+	return nil
+}
+
+func (st *RouterState) clone() *RouterState {
+	c := newRouterState()
+	for channel, sequence := range st.Sequences {
+		c.Sequences[channel] = sequence
+	}
+	for _, packet := range st.Pending {
+		sent := *packet
+		c.Pending = append(c.Pending, &sent)
+	}
+	for key, ack := range st.Receipts {
+		c.Receipts[key] = ack
+	}
+	return c
+}
+
+func (st *RouterState) addPending(packet *Packet) {
+	sent := *packet
+	st.Pending = append(st.Pending, &sent)
+	if channel := channelKey(packet); packet.Sequence > st.Sequences[channel] {
+		st.Sequences[channel] = packet.Sequence
+	}
+}
+
+func (st *RouterState) deletePending(packet *Packet) {
+	for i, sent := range st.Pending {
+		if sent.key() == packet.key() {
+			st.Pending = append(st.Pending[:i], st.Pending[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package protocol
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testRouterStore(t *testing.T, store RouterStore) {
+	for sequence := uint64(1); sequence <= 3; sequence++ {
+		packet := &Packet{SourceChain: "pi-1", SourcePort: "transfer", SourceChannel: "channel-0", Sequence: sequence}
+		if err := store.SavePending(packet); err != nil {
+			t.Fatalf("Expected SavePending to succeed, but got error: %s", err)
+		}
+	}
+	if err := store.DeletePending(&Packet{SourcePort: "transfer", SourceChannel: "channel-0", Sequence: 2}); err != nil {
+		t.Errorf("Expected DeletePending to succeed, but got error: %s", err)
+	}
+	received := &Packet{SourceChain: "cosmoshub-4", SourcePort: "transfer", SourceChannel: "channel-9", Sequence: 7}
+	if err := store.SaveReceipt(received, NewResultAcknowledgement([]byte("ok"))); err != nil {
+		t.Errorf("Expected SaveReceipt to succeed, but got error: %s", err)
+	}
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatalf("Expected Load to succeed, but got error: %s", err)
+	}
+	if state.Sequences["transfer/channel-0"] != 3 {
+		t.Errorf("Expected sequence 3, but got %d", state.Sequences["transfer/channel-0"])
+	}
+	if len(state.Pending) != 2 || state.Pending[0].Sequence != 1 || state.Pending[1].Sequence != 3 {
+		t.Errorf("Expected packets 1 and 3 to be pending, but got %+v", state.Pending)
+	}
+	if ack := state.Receipts[receiptKey(received)]; ack == nil || !ack.Success() {
+		t.Errorf("Expected the receipt to be stored, but got %+v", ack)
+	}
+}
+
+func TestMemoryRouterStore(t *testing.T) {
+	testRouterStore(t, NewMemoryRouterStore())
+}
+
+func TestFileRouterStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "router.json")
+	store, err := NewFileRouterStore(path)
+	if err != nil {
+		t.Fatalf("Expected NewFileRouterStore to succeed, but got error: %s", err)
+	}
+	testRouterStore(t, store)
+
+	// Reopening finds the same state
+	reopened, err := NewFileRouterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := reopened.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Sequences["transfer/channel-0"] != 3 || len(state.Pending) != 2 || len(state.Receipts) != 1 {
+		t.Errorf("Expected the state after reopening, but got %+v", state)
+	}
+}
+
+func TestFileRouterStoreAppendsReceipts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "router.json")
+	store, err := NewFileRouterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for sequence := uint64(1); sequence <= 2; sequence++ {
+		received := &Packet{SourceChain: "cosmoshub-4", SourcePort: "transfer", SourceChannel: "channel-9", Sequence: sequence}
+		if err := store.SaveReceipt(received, NewResultAcknowledgement([]byte("ok"))); err != nil {
+			t.Fatalf("Expected SaveReceipt to succeed, but got error: %s", err)
+		}
+	}
+	if err := store.SavePending(&Packet{SourceChain: "pi-1", SourcePort: "transfer", SourceChannel: "channel-0", Sequence: 1}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "cosmoshub-4") {
+		t.Errorf("Expected receipts to stay out of the state file, but got %s", data)
+	}
+
+	// A record cut off by a crash is dropped, and the log stays usable
+	log, err := os.OpenFile(path+".receipts", os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.WriteString(`{"key":"cosmoshub-4/transfer/chan`)
+	log.Close()
+	reopened, err := NewFileRouterStore(path)
+	if err != nil {
+		t.Fatalf("Expected a partial receipt to be dropped, but got error: %s", err)
+	}
+	defer reopened.Close()
+	received := &Packet{SourceChain: "cosmoshub-4", SourcePort: "transfer", SourceChannel: "channel-9", Sequence: 3}
+	if err := reopened.SaveReceipt(received, NewResultAcknowledgement([]byte("ok"))); err != nil {
+		t.Fatal(err)
+	}
+	again, err := NewFileRouterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	state, err := again.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Receipts) != 3 || len(state.Pending) != 1 {
+		t.Errorf("Expected 3 receipts and 1 pending packet, but got %+v", state)
+	}
+}
+
+func TestRouterResumesFromStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "router.json")
+	pi, piApp, cosmos, cosmosApp := newTestChains()
+	store, err := NewFileRouterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.router, err = NewRouterWithStore("pi-1", pi.Status, store); err != nil {
+		t.Fatalf("Expected NewRouterWithStore to succeed, but got error: %s", err)
+	}
+	pi.router.BindPort("transfer", piApp)
+	pi.router.AddChain(cosmos)
+	if _, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 5}, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := pi.router.Relay(ctx, pi.router.Pending()[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart the unsettled packet is still pending and the channel
+	// continues from its last sequence
+	reopened, err := NewFileRouterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.router, err = NewRouterWithStore("pi-1", pi.Status, reopened); err != nil {
+		t.Fatal(err)
+	}
+	pi.router.BindPort("transfer", piApp)
+	pi.router.AddChain(cosmos)
+	pending := pi.router.Pending()
+	if len(pending) != 1 || pending[0].Sequence != 2 {
+		t.Fatalf("Expected packet 2 to be pending after the restart, but got %+v", pending)
+	}
+	packet, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 1}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.Sequence != 3 {
+		t.Errorf("Expected sequence 3 after the restart, but got %d", packet.Sequence)
+	}
+	if err := pi.router.RelayPending(ctx); err != nil {
+		t.Fatalf("Expected RelayPending to succeed, but got error: %s", err)
+	}
+	if cosmosApp.balance("bob") != 16 || piApp.balance("alice") != 84 {
+		t.Errorf("Expected every packet to be received once, but got alice=%d bob=%d", piApp.balance("alice"), cosmosApp.balance("bob"))
+	}
+
+	// A receiving router returns the stored acknowledgement to a retry after
+	// a restart
+	receivedPath := filepath.Join(t.TempDir(), "cosmos.json")
+	received, err := NewFileRouterStore(receivedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cosmos.router, err = NewRouterWithStore("cosmoshub-4", cosmos.Status, received); err != nil {
+		t.Fatal(err)
+	}
+	cosmos.router.BindPort("transfer", cosmosApp)
+	cosmos.router.SetTrusted("pi-1")
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); err != nil {
+		t.Fatal(err)
+	}
+	if received, err = NewFileRouterStore(receivedPath); err != nil {
+		t.Fatal(err)
+	}
+	if cosmos.router, err = NewRouterWithStore("cosmoshub-4", cosmos.Status, received); err != nil {
+		t.Fatal(err)
+	}
+	cosmos.router.BindPort("transfer", cosmosApp)
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); err != nil {
+		t.Errorf("Expected a retried packet to get its stored acknowledgement, but got error: %s", err)
+	}
+	if cosmosApp.balance("bob") != 17 {
+		t.Errorf("Expected the retried packet to be processed once, but bob has %d", cosmosApp.balance("bob"))
+	}
+}
@@ -0,0 +1,579 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testChain is a chain with a router and a settable height and time
+type testChain struct {
+	router *Router
+	mu     sync.Mutex
+	height uint64
+	time   int64
+}
+
+func newTestChain(chainID string) *testChain {
+	chain := &testChain{height: 1, time: 1000}
+	chain.router = NewRouter(chainID, chain.Status)
+	return chain
+}
+
+func (c *testChain) ChainID() string {
+	return c.router.ChainID()
+}
+
+func (c *testChain) Status(ctx context.Context) (*ChainStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &ChainStatus{ChainID: c.router.ChainID(), Height: c.height, Timestamp: c.time}, nil
+}
+
+func (c *testChain) DeliverPacket(ctx context.Context, packet *Packet) (*Acknowledgement, error) {
+	return c.router.ReceivePacket(ctx, packet)
+}
+
+func (c *testChain) ProveAcknowledgement(ctx context.Context, packet *Packet) (*PacketProof, error) {
+	return c.router.ProveAcknowledgement(ctx, packet)
+}
+
+func (c *testChain) setHeight(height uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.height = height
+}
+
+// transferApp escrows tokens when sending, mints vouchers when receiving and
+// refunds the sender when a transfer fails or times out
+type transferApp struct {
+	mu       sync.Mutex
+	balances map[string]int
+	escrow   int
+	fail     bool
+}
+
+type transferData struct {
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	Amount   int    `json:"amount"`
+}
+
+func newTransferApp(balances map[string]int) *transferApp {
+	return &transferApp{balances: balances}
+}
+
+func (a *transferApp) send(ctx context.Context, router *Router, to string, data transferData, timeoutHeight uint64) (*Packet, error) {
+	a.mu.Lock()
+	if a.balances[data.Sender] < data.Amount {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("insufficient funds")
+	}
+	a.balances[data.Sender] -= data.Amount
+	a.escrow += data.Amount
+	a.mu.Unlock()
+
+	payload, _ := json.Marshal(data)
+	packet := &Packet{
+		SourcePort:         "transfer",
+		SourceChannel:      "channel-0",
+		DestinationChain:   to,
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-1",
+		TimeoutHeight:      timeoutHeight,
+		Data:               payload,
+	}
+	if _, err := router.SendPacket(ctx, packet); err != nil {
+		a.refund(packet)
+		return nil, err
+	}
+	return packet, nil
+}
+
+func (a *transferApp) refund(packet *Packet) {
+	var data transferData
+	json.Unmarshal(packet.Data, &data)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.escrow -= data.Amount
+	a.balances[data.Sender] += data.Amount
+}
+
+func (a *transferApp) balance(account string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.balances[account]
+}
+
+func (a *transferApp) OnRecvPacket(ctx context.Context, packet *Packet) *Acknowledgement {
+	var data transferData
+	if err := json.Unmarshal(packet.Data, &data); err != nil {
+		return NewErrorAcknowledgement(err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.fail {
+		return NewErrorAcknowledgement(errors.New("receiver blocked"))
+	}
+	a.balances[data.Receiver] += data.Amount
+	return NewResultAcknowledgement([]byte(`"ok"`))
+}
+
+func (a *transferApp) OnAcknowledgementPacket(ctx context.Context, packet *Packet, ack *Acknowledgement) error {
+	if !ack.Success() {
+		a.refund(packet)
+	}
+	return nil
+}
+
+func (a *transferApp) OnTimeoutPacket(ctx context.Context, packet *Packet) error {
+	a.refund(packet)
+	return nil
+}
+
+func newTestChains() (*testChain, *transferApp, *testChain, *transferApp) {
+	pi := newTestChain("pi-1")
+	cosmos := newTestChain("cosmoshub-4")
+	piApp := newTransferApp(map[string]int{"alice": 100})
+	cosmosApp := newTransferApp(map[string]int{})
+	pi.router.BindPort("transfer", piApp)
+	cosmos.router.BindPort("transfer", cosmosApp)
+	pi.router.AddChain(cosmos)
+	cosmos.router.AddChain(pi)
+	pi.router.SetTrusted("cosmoshub-4")
+	cosmos.router.SetTrusted("pi-1")
+	return pi, piApp, cosmos, cosmosApp
+}
+
+func TestRouterTransfer(t *testing.T) {
+	ctx := context.Background()
+	pi, piApp, _, cosmosApp := newTestChains()
+
+	for i := 1; i <= 2; i++ {
+		packet, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100)
+		if err != nil {
+			t.Fatalf("Expected SendPacket to succeed, but got error: %s", err)
+		}
+		if packet.Sequence != uint64(i) || packet.SourceChain != "pi-1" {
+			t.Errorf("Expected sequence %d from pi-1, but got %d from %s", i, packet.Sequence, packet.SourceChain)
+		}
+	}
+	if len(pi.router.Pending()) != 2 {
+		t.Fatalf("Expected 2 pending packets, but got %d", len(pi.router.Pending()))
+	}
+	if err := pi.router.RelayPending(ctx); err != nil {
+		t.Fatalf("Expected RelayPending to succeed, but got error: %s", err)
+	}
+	if len(pi.router.Pending()) != 0 {
+		t.Errorf("Expected acknowledged packets to be settled")
+	}
+	if piApp.balance("alice") != 80 || piApp.escrow != 20 || cosmosApp.balance("bob") != 20 {
+		t.Errorf("Expected 20 escrowed and received, but got alice=%d escrow=%d bob=%d", piApp.balance("alice"), piApp.escrow, cosmosApp.balance("bob"))
+	}
+}
+
+func TestRouterReceiveOnce(t *testing.T) {
+	ctx := context.Background()
+	pi, piApp, cosmos, cosmosApp := newTestChains()
+	packet, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cosmos.router.ReceivePacket(ctx, packet); err != nil {
+				t.Errorf("Expected ReceivePacket to succeed, but got error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if cosmosApp.balance("bob") != 10 {
+		t.Errorf("Expected the packet to be processed once, but bob has %d", cosmosApp.balance("bob"))
+	}
+}
+
+func TestRouterErrorAcknowledgementRefunds(t *testing.T) {
+	ctx := context.Background()
+	pi, piApp, _, cosmosApp := newTestChains()
+	cosmosApp.fail = true
+	if _, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := pi.router.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if piApp.balance("alice") != 100 || piApp.escrow != 0 {
+		t.Errorf("Expected a refund after the error acknowledgement, but got alice=%d escrow=%d", piApp.balance("alice"), piApp.escrow)
+	}
+}
+
+func TestRouterTimeoutRefunds(t *testing.T) {
+	ctx := context.Background()
+	pi, piApp, cosmos, cosmosApp := newTestChains()
+	packet, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pi.router.TimeoutPacket(ctx, packet); !errors.Is(err, ErrPacketNotTimedOut) {
+		t.Errorf("Expected ErrPacketNotTimedOut before the timeout height, but got %v", err)
+	}
+
+	cosmos.setHeight(5)
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); !errors.Is(err, ErrPacketTimedOut) {
+		t.Errorf("Expected the destination to reject a timed out packet, but got %v", err)
+	}
+	if err := pi.router.RelayPending(ctx); err != nil {
+		t.Fatalf("Expected RelayPending to time out the packet, but got error: %s", err)
+	}
+	if piApp.balance("alice") != 100 || cosmosApp.balance("bob") != 0 {
+		t.Errorf("Expected a refund after the timeout, but got alice=%d bob=%d", piApp.balance("alice"), cosmosApp.balance("bob"))
+	}
+	if err := pi.router.TimeoutPacket(ctx, packet); !errors.Is(err, ErrPacketNotPending) {
+		t.Errorf("Expected a settled packet not to time out again, but got %v", err)
+	}
+
+	if _, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 5); !errors.Is(err, ErrPacketTimedOut) {
+		t.Errorf("Expected a packet already past its timeout to be rejected, but got %v", err)
+	}
+	if piApp.balance("alice") != 100 {
+		t.Errorf("Expected a rejected packet to be refunded, but alice has %d", piApp.balance("alice"))
+	}
+}
+
+func TestRouterTimeoutAfterReceipt(t *testing.T) {
+	ctx := context.Background()
+	pi, piApp, cosmos, cosmosApp := newTestChains()
+	packet, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); err != nil {
+		t.Fatalf("Expected ReceivePacket to succeed, but got error: %s", err)
+	}
+
+	cosmos.setHeight(5)
+	if err := pi.router.TimeoutPacket(ctx, packet); !errors.Is(err, ErrPacketReceived) {
+		t.Errorf("Expected a received packet not to time out, but got %v", err)
+	}
+	if piApp.balance("alice") != 90 {
+		t.Errorf("Expected no refund for a received packet, but alice has %d", piApp.balance("alice"))
+	}
+	if err := pi.router.RelayPending(ctx); err != nil {
+		t.Fatalf("Expected RelayPending to acknowledge the packet, but got error: %s", err)
+	}
+	if len(pi.router.Pending()) != 0 {
+		t.Errorf("Expected the received packet to be settled")
+	}
+	if piApp.balance("alice") != 90 || piApp.escrow != 10 || cosmosApp.balance("bob") != 10 {
+		t.Errorf("Expected the transfer to stand, but got alice=%d escrow=%d bob=%d", piApp.balance("alice"), piApp.escrow, cosmosApp.balance("bob"))
+	}
+}
+
+func TestRouterRejectsAlteredPacket(t *testing.T) {
+	ctx := context.Background()
+	pi, piApp, _, _ := newTestChains()
+	packet, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	altered := *packet
+	altered.Data = []byte(`{"sender":"alice","receiver":"bob","amount":1000}`)
+	if err := pi.router.AcknowledgePacket(ctx, &altered, NewErrorAcknowledgement(errors.New("failed"))); !errors.Is(err, ErrPacketNotPending) {
+		t.Errorf("Expected an altered packet to be rejected, but got %v", err)
+	}
+	if piApp.balance("alice") != 90 {
+		t.Errorf("Expected no refund for an altered packet, but alice has %d", piApp.balance("alice"))
+	}
+}
+
+func TestRouterUnknownRoutes(t *testing.T) {
+	ctx := context.Background()
+	pi, _, cosmos, _ := newTestChains()
+	packet := &Packet{
+		SourcePort: "transfer", SourceChannel: "channel-0",
+		DestinationChain: "polkadot", DestinationPort: "transfer", DestinationChannel: "channel-1",
+		TimeoutHeight: 100,
+	}
+	if _, err := pi.router.SendPacket(ctx, packet); !errors.Is(err, ErrUnknownChain) {
+		t.Errorf("Expected ErrUnknownChain, but got %v", err)
+	}
+	packet.DestinationChain = "cosmoshub-4"
+	packet.SourcePort = "nft"
+	if _, err := pi.router.SendPacket(ctx, packet); !errors.Is(err, ErrUnknownPort) {
+		t.Errorf("Expected ErrUnknownPort for an unbound source port, but got %v", err)
+	}
+	packet.SourceChain, packet.SourcePort, packet.DestinationPort = "pi-1", "transfer", "nft"
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); !errors.Is(err, ErrUnknownPort) {
+		t.Errorf("Expected ErrUnknownPort for an unbound destination port, but got %v", err)
+	}
+	packet.DestinationChain = "polkadot"
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); !errors.Is(err, ErrInvalidPacket) {
+		t.Errorf("Expected a packet for another chain to be rejected, but got %v", err)
+	}
+}
+
+func TestRouterOverInteroperability(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pi, piApp, cosmos, cosmosApp := newTestChains()
+	server, url := newTestServer(t, &ServerConfig{
+		Authenticate: TokenAuthenticator(map[string]string{"secret": "pi-relayer", "other": "osmosis-relayer"}),
+	})
+	cosmos.router.Serve(server)
+	cosmos.router.AllowPeer("pi-relayer", "pi-1")
+	client := NewClient(url, bearer("secret"))
+	defer client.Close()
+	endpoint := NewClientEndpoint("cosmoshub-4", client)
+	pi.router.AddChain(endpoint)
+
+	// Peers may only deliver packets from the chains they're allowed for
+	other := NewClient(url, bearer("other"))
+	defer other.Close()
+	packet := &Packet{
+		SourceChain: "pi-1", SourcePort: "transfer", SourceChannel: "channel-0",
+		DestinationChain: "cosmoshub-4", DestinationPort: "transfer", DestinationChannel: "channel-1",
+		Sequence: 1, TimeoutHeight: 100, Data: []byte(`{"sender":"mallory","receiver":"mallory","amount":1000}`),
+	}
+	if _, err := NewClientEndpoint("cosmoshub-4", other).DeliverPacket(ctx, packet); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for a peer not allowed for pi-1, but got %v", err)
+	}
+	if cosmosApp.balance("mallory") != 0 {
+		t.Errorf("Expected the forged packet not to be received")
+	}
+
+	if _, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100); err != nil {
+		t.Fatalf("Expected SendPacket to succeed, but got error: %s", err)
+	}
+	if err := pi.router.RelayPending(ctx); err != nil {
+		t.Fatalf("Expected RelayPending to succeed, but got error: %s", err)
+	}
+	if cosmosApp.balance("bob") != 10 || len(pi.router.Pending()) != 0 {
+		t.Errorf("Expected the packet to be delivered and settled, but bob has %d", cosmosApp.balance("bob"))
+	}
+
+	wrong := NewClientEndpoint("osmosis-1", client)
+	if _, err := wrong.Status(ctx); err == nil || !strings.Contains(err.Error(), "cosmoshub-4") {
+		t.Errorf("Expected an endpoint connected to the wrong chain to fail, but got %v", err)
+	}
+}
+
+// proofVerifier accepts proofs whose bytes equal the proven commitment
+type proofVerifier struct{}
+
+func (proofVerifier) VerifyPacket(packet *Packet, proof *PacketProof) error {
+	if string(proof.Proof) != string(packet.Commitment()) {
+		return errors.New("invalid proof")
+	}
+	return nil
+}
+
+func (proofVerifier) VerifyAcknowledgement(packet *Packet, ack *Acknowledgement, proof *PacketProof) error {
+	if string(proof.Proof) != string(ack.Commitment()) {
+		return errors.New("invalid proof")
+	}
+	return nil
+}
+
+func TestRouterVerifiesProofs(t *testing.T) {
+	ctx := context.Background()
+	pi, piApp, cosmos, cosmosApp := newTestChains()
+	cosmos.router.SetVerifier("pi-1", proofVerifier{})
+	packet, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); !errors.Is(err, ErrMissingProof) {
+		t.Errorf("Expected ErrMissingProof, but got %v", err)
+	}
+	packet.Proof = &PacketProof{Height: 1, Proof: []byte("forged")}
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); err == nil {
+		t.Errorf("Expected a packet with an invalid proof to be rejected")
+	}
+	packet.Proof = &PacketProof{Height: 1, Proof: packet.Commitment()}
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); err != nil {
+		t.Errorf("Expected a proven packet to be received, but got error: %s", err)
+	}
+	if cosmosApp.balance("bob") != 10 {
+		t.Errorf("Expected the proven packet to be processed, but bob has %d", cosmosApp.balance("bob"))
+	}
+}
+
+func TestRouterRejectsUntrustedChain(t *testing.T) {
+	ctx := context.Background()
+	pi, piApp, _, cosmosApp := newTestChains()
+	cosmos := newTestChain("cosmoshub-4")
+	cosmos.router.BindPort("transfer", cosmosApp)
+	packet, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); !errors.Is(err, ErrUntrustedChain) {
+		t.Errorf("Expected ErrUntrustedChain, but got %v", err)
+	}
+	if cosmosApp.balance("bob") != 0 {
+		t.Errorf("Expected the packet not to be processed, but bob has %d", cosmosApp.balance("bob"))
+	}
+	cosmos.router.SetTrusted("pi-1")
+	if _, err := cosmos.router.ReceivePacket(ctx, packet); err != nil {
+		t.Errorf("Expected a packet from a trusted chain to be received, but got error: %s", err)
+	}
+}
+
+func TestRouterVerifiesAcknowledgements(t *testing.T) {
+	ctx := context.Background()
+	pi, piApp, cosmos, cosmosApp := newTestChains()
+	pi.router.SetVerifier("cosmoshub-4", proofVerifier{})
+	packet, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack := NewErrorAcknowledgement(errors.New("receiver blocked"))
+	if err := pi.router.AcknowledgePacket(ctx, packet, ack); !errors.Is(err, ErrMissingProof) {
+		t.Errorf("Expected ErrMissingProof, but got %v", err)
+	}
+	ack.Proof = &PacketProof{Height: 1, Proof: []byte("forged")}
+	if err := pi.router.AcknowledgePacket(ctx, packet, ack); err == nil {
+		t.Errorf("Expected an acknowledgement with an invalid proof to be rejected")
+	}
+	if piApp.balance("alice") != 90 || len(pi.router.Pending()) != 1 {
+		t.Errorf("Expected the packet to stay pending, but alice has %d", piApp.balance("alice"))
+	}
+
+	// Relaying fetches the proof of the destination's acknowledgement
+	if _, err := cosmos.router.ProveAcknowledgement(ctx, packet); !errors.Is(err, ErrPacketNotReceived) {
+		t.Errorf("Expected ErrPacketNotReceived, but got %v", err)
+	}
+	cosmos.router.SetProver(commitmentProver{})
+	if err := pi.router.RelayPending(ctx); err != nil {
+		t.Fatalf("Expected RelayPending to succeed, but got error: %s", err)
+	}
+	if cosmosApp.balance("bob") != 10 || len(pi.router.Pending()) != 0 {
+		t.Errorf("Expected the packet to be delivered and settled, but bob has %d", cosmosApp.balance("bob"))
+	}
+}
+
+// commitmentProver proves packets and acknowledgements with their
+// commitment, as proofVerifier expects
+type commitmentProver struct{}
+
+func (commitmentProver) ProvePacket(ctx context.Context, packet *Packet) (*PacketProof, error) {
+	return &PacketProof{Height: 1, Proof: packet.Commitment()}, nil
+}
+
+func (commitmentProver) ProveAcknowledgement(ctx context.Context, packet *Packet, ack *Acknowledgement) (*PacketProof, error) {
+	return &PacketProof{Height: 1, Proof: ack.Commitment()}, nil
+}
+
+func TestClientEndpointRelaysPackets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pi, piApp, cosmos, cosmosApp := newTestChains()
+	for _, chain := range []*testChain{pi, cosmos} {
+		chain.router.SetProver(commitmentProver{})
+	}
+	pi.router.SetVerifier("cosmoshub-4", proofVerifier{})
+	cosmos.router.SetVerifier("pi-1", proofVerifier{})
+	endpoints := make(map[string]*ClientEndpoint)
+	anonymous := make(map[string]*ClientEndpoint)
+	for _, chain := range []*testChain{pi, cosmos} {
+		server, url := newTestServer(t, &ServerConfig{
+			Authenticate: func(r *http.Request) (string, error) {
+				if r.Header.Get("Authorization") == "" {
+					return "", nil
+				}
+				return TokenAuthenticator(map[string]string{"secret": "relayer"})(r)
+			},
+		})
+		chain.router.Serve(server)
+		chain.router.AllowPeer("relayer", "pi-1", "cosmoshub-4")
+		client := NewClient(url, bearer("secret"))
+		defer client.Close()
+		endpoints[chain.ChainID()] = NewClientEndpoint(chain.ChainID(), client)
+		anonymousClient := NewClient(url, testClientConfig())
+		defer anonymousClient.Close()
+		anonymous[chain.ChainID()] = NewClientEndpoint(chain.ChainID(), anonymousClient)
+	}
+	source, destination := endpoints["pi-1"], endpoints["cosmoshub-4"]
+
+	delivered, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 10}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, err := piApp.send(ctx, pi.router, "cosmoshub-4", transferData{Sender: "alice", Receiver: "bob", Amount: 5}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := source.Pending(ctx)
+	if err != nil {
+		t.Fatalf("Expected Pending to succeed, but got error: %s", err)
+	}
+	if len(pending) != 2 || pending[0].Sequence != 1 || pending[1].Sequence != 2 {
+		t.Fatalf("Expected the 2 sent packets to be pending, but got %d", len(pending))
+	}
+
+	// A refused packet is an error, not a failed acknowledgement
+	if _, err := destination.DeliverPacket(ctx, delivered); !errors.Is(err, ErrMissingProof) {
+		t.Errorf("Expected ErrMissingProof, but got %v", err)
+	}
+	if delivered.Proof, err = source.ProvePacket(ctx, delivered); err != nil {
+		t.Fatalf("Expected ProvePacket to succeed, but got error: %s", err)
+	}
+	if _, err := anonymous["cosmoshub-4"].DeliverPacket(ctx, delivered); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for an anonymous peer, but got %v", err)
+	}
+	ack, err := destination.DeliverPacket(ctx, delivered)
+	if err != nil {
+		t.Fatalf("Expected DeliverPacket to succeed, but got error: %s", err)
+	}
+	if !ack.Success() || cosmosApp.balance("bob") != 10 {
+		t.Errorf("Expected the packet to be received, but got ack %+v and bob has %d", ack, cosmosApp.balance("bob"))
+	}
+
+	// Settling needs an authenticated peer and a proof of the acknowledgement
+	if err := source.AcknowledgePacket(ctx, delivered, ack); !errors.Is(err, ErrMissingProof) {
+		t.Errorf("Expected ErrMissingProof, but got %v", err)
+	}
+	if ack.Proof, err = destination.ProveAcknowledgement(ctx, delivered); err != nil {
+		t.Fatalf("Expected ProveAcknowledgement to succeed, but got error: %s", err)
+	}
+	if err := anonymous["pi-1"].AcknowledgePacket(ctx, delivered, ack); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for an anonymous peer, but got %v", err)
+	}
+	forged := NewResultAcknowledgement([]byte(`"forged"`))
+	forged.Proof = ack.Proof
+	if err := source.AcknowledgePacket(ctx, delivered, forged); err == nil {
+		t.Errorf("Expected a forged acknowledgement to be rejected")
+	}
+	if err := source.AcknowledgePacket(ctx, delivered, ack); err != nil {
+		t.Errorf("Expected AcknowledgePacket to succeed, but got error: %s", err)
+	}
+	if err := source.AcknowledgePacket(ctx, delivered, ack); !errors.Is(err, ErrPacketNotPending) {
+		t.Errorf("Expected ErrPacketNotPending for a settled packet, but got %v", err)
+	}
+
+	if err := source.TimeoutPacket(ctx, expiring); !errors.Is(err, ErrPacketNotTimedOut) {
+		t.Errorf("Expected ErrPacketNotTimedOut, but got %v", err)
+	}
+	cosmos.setHeight(5)
+	if err := anonymous["pi-1"].TimeoutPacket(ctx, expiring); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for an anonymous peer, but got %v", err)
+	}
+	if err := source.TimeoutPacket(ctx, expiring); err != nil {
+		t.Errorf("Expected TimeoutPacket to succeed, but got error: %s", err)
+	}
+	if _, err := source.ProvePacket(ctx, expiring); !errors.Is(err, ErrPacketNotPending) {
+		t.Errorf("Expected ErrPacketNotPending for a settled packet, but got %v", err)
+	}
+	if len(pi.router.Pending()) != 0 || piApp.balance("alice") != 90 {
+		t.Errorf("Expected both packets to be settled, but alice has %d", piApp.balance("alice"))
+	}
+}
@@ -0,0 +1,361 @@
+package protocol
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrUnauthorized is returned by authenticators to reject a peer
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrSessionClosed is returned when sending on a closed session
+	ErrSessionClosed = errors.New("interoperability session closed")
+
+	// ErrSessionQueueFull is returned when a session's peer doesn't keep up
+	// with its messages; the session is closed
+	ErrSessionQueueFull = errors.New("interoperability session send queue full")
+
+	// ErrSessionAck is returned when sending a message with Ack on a session.
+	// Sessions end with their connection and have no outbox to resend from,
+	// so acknowledged delivery is only offered by Client.
+	ErrSessionAck = errors.New("interoperability sessions don't support acknowledged delivery")
+)
+
+// Authenticator identifies the peer making a connection request, or returns
+// an error to reject it
+type Authenticator func(r *http.Request) (peer string, err error)
+
+// TokenAuthenticator accepts requests carrying "Authorization: Bearer <token>"
+// for one of the tokens, which map to peer names
+func TokenAuthenticator(tokens map[string]string) Authenticator {
+	return func(r *http.Request) (string, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return "", ErrUnauthorized
+		}
+		for known, peer := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+				return peer, nil
+			}
+		}
+		return "", ErrUnauthorized
+	}
+}
+
+// AnonymousAuthenticator accepts every request with an empty peer name. Only
+// use it where the network already restricts who can connect, such as tests
+// or a loopback listener behind an authenticating proxy.
+func AnonymousAuthenticator() Authenticator {
+	return func(r *http.Request) (string, error) {
+		return "", nil
+	}
+}
+
+// SessionHandler handles a message received on a session
+type SessionHandler func(session *Session, message *PIMessage)
+
+// ServerConfig configures a Server. Zero fields take the client defaults.
+type ServerConfig struct {
+	// Authenticate identifies peers. It is required: a server without one
+	// rejects every connection. Set it to AnonymousAuthenticator to
+	// deliberately accept unauthenticated peers.
+	Authenticate Authenticator
+	// Upgrader upgrades HTTP requests to WebSocket connections
+	Upgrader *websocket.Upgrader
+	// Encodings are accepted in order of preference. A client offering none
+	// of them, or no subprotocol at all, is served JSON.
+	Encodings []Encoding
+	// PingInterval, PongTimeout and WriteTimeout work as for ClientConfig
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	WriteTimeout time.Duration
+	// QueueSize is how many outbound messages a session holds before it is
+	// considered too slow and closed
+	QueueSize int
+	// DedupSize is how many inbound message IDs are remembered to drop
+	// duplicates, across all peers
+	DedupSize int
+	// MaxMessageSize bounds inbound frames in bytes; a peer sending a larger
+	// one is disconnected
+	MaxMessageSize int64
+}
+
+// Server accepts PI Interoperability connections from relayers of other
+// chains. It is an http.Handler, so it can be mounted on any path of the
+// node's HTTP server.
+type Server struct {
+	config ServerConfig
+
+	handlers map[string]SessionHandler
+	sessions map[string]*Session
+	mu       sync.RWMutex
+	dedup    *deduplicator
+}
+
+// Session is one connected peer
+type Session struct {
+	// ID is unique per connection
+	ID string
+	// Peer is the identity returned by the authenticator
+	Peer string
+	// Encoding is the wire encoding negotiated with the peer
+	Encoding Encoding
+
+	conn      *websocket.Conn
+	send      chan *PIMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewServer creates a server
+func NewServer(config *ServerConfig) *Server {
+	cfg := ServerConfig{}
+	if config != nil {
+		cfg = *config
+	}
+	upgrader := websocket.Upgrader{}
+	if cfg.Upgrader != nil {
+		upgrader = *cfg.Upgrader
+	}
+	upgrader.Subprotocols = subprotocols(cfg.Encodings)
+	cfg.Upgrader = &upgrader
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = DefaultPingInterval
+	}
+	if cfg.PongTimeout <= 0 {
+		cfg.PongTimeout = DefaultPongTimeout
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = DefaultWriteTimeout
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = DefaultMaxMessageSize
+	}
+	return &Server{
+		config:   cfg,
+		handlers: make(map[string]SessionHandler),
+		sessions: make(map[string]*Session),
+		dedup:    newDeduplicator(cfg.DedupSize),
+	}
+}
+
+// Handle registers the handler for messages of the given type, replacing
+// any previous one. Handlers for one session run one at a time on its read
+// goroutine; different sessions are handled concurrently.
+func (s *Server) Handle(messageType string, handler SessionHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[messageType] = handler
+}
+
+// ServeHTTP authenticates the request, upgrades it and serves the session
+// until the peer disconnects
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.config.Authenticate == nil {
+		http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+	peer, err := s.config.Authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	conn, err := s.config.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with an error
+		return
+	}
+	conn.SetReadLimit(s.config.MaxMessageSize)
+	id, err := newID()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	session := &Session{
+		ID:       id,
+		Peer:     peer,
+		Encoding: NegotiatedEncoding(conn),
+		conn:     conn,
+		send:     make(chan *PIMessage, s.config.QueueSize),
+		done:     make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.sessions[id] = session
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+		session.Close()
+	}()
+
+	go s.write(session)
+	s.read(session)
+}
+
+// Session returns the session with the given ID, or nil
+func (s *Server) Session(id string) *Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sessions[id]
+}
+
+// Sessions returns the sessions currently connected
+func (s *Server) Sessions() []*Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// Broadcast queues message on every session for which filter returns true,
+// or on every session if filter is nil, and returns how many sessions it
+// was queued on
+func (s *Server) Broadcast(message *PIMessage, filter func(*Session) bool) int {
+	sent := 0
+	for _, session := range s.Sessions() {
+		if filter != nil && !filter(session) {
+			continue
+		}
+		if session.Send(message) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Close disconnects every session
+func (s *Server) Close() error {
+	for _, session := range s.Sessions() {
+		session.Close()
+	}
+	return nil
+}
+
+// Reply sends a response correlated with request, as awaited by the peer's
+// Client.Request
+func (session *Session) Reply(request *PIMessage, response *PIMessage) error {
+	response.CorrelationID = request.ID
+	if err := stamp(response); err != nil {
+		return err
+	}
+	return session.Send(response)
+}
+
+// Send queues a message to the peer without blocking. A peer that falls
+// QueueSize messages behind is disconnected, so one slow relayer can't hold
+// up a broadcast. Delivery is best effort: messages with Ack set are
+// rejected with ErrSessionAck, and anything still queued when the
+// connection drops is lost.
+func (session *Session) Send(message *PIMessage) error {
+	if message.Ack {
+		return ErrSessionAck
+	}
+	select {
+	case <-session.done:
+		return ErrSessionClosed
+	default:
+	}
+	select {
+	case session.send <- message:
+		return nil
+	case <-session.done:
+		return ErrSessionClosed
+	default:
+		session.Close()
+		return ErrSessionQueueFull
+	}
+}
+
+// Close disconnects the session
+func (session *Session) Close() error {
+	session.closeOnce.Do(func() {
+		close(session.done)
+		session.conn.Close()
+	})
+	return nil
+}
+
+// Done returns a channel that is closed when the session ends
+func (session *Session) Done() <-chan struct{} {
+	return session.done
+}
+
+func (s *Server) read(session *Session) {
+	conn := session.conn
+	timeout := s.config.PingInterval + s.config.PongTimeout
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(timeout))
+	})
+	for {
+		frameType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		message, err := DecodeMessage(frameType, data)
+		if err != nil {
+			continue
+		}
+		if message.Type == MessageTypeAck {
+			// Sessions never ask for acknowledgements, see Send
+			continue
+		}
+		if message.Ack {
+			// Acknowledge duplicates too, since the first ack may have been
+			// lost. IDs are remembered per peer, so a relayer's resends after
+			// reconnecting on a new session are still recognized.
+			session.Send(newAck(message))
+			if message.ID != "" && s.dedup.duplicate(session.Peer+"/"+message.ID) {
+				continue
+			}
+		}
+		s.mu.RLock()
+		handler := s.handlers[message.Type]
+		s.mu.RUnlock()
+		if handler != nil {
+			handler(session, message)
+		}
+	}
+}
+
+// write is the only goroutine writing to the session's connection
+func (s *Server) write(session *Session) {
+	ping := time.NewTicker(s.config.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case message := <-session.send:
+			frameType, data, err := EncodeMessage(session.Encoding, message)
+			if err != nil {
+				continue
+			}
+			session.conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+			if err := session.conn.WriteMessage(frameType, data); err != nil {
+				session.Close()
+				return
+			}
+		case <-ping.C:
+			if err := session.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.config.WriteTimeout)); err != nil {
+				session.Close()
+				return
+			}
+		case <-session.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package protocol
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newTestServer(t *testing.T, config *ServerConfig) (*Server, string) {
+	if config == nil {
+		config = &ServerConfig{}
+	}
+	if config.Authenticate == nil {
+		config.Authenticate = AnonymousAuthenticator()
+	}
+	server := NewServer(config)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		server.Close()
+		httpServer.Close()
+	})
+	return server, "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+func waitForSessions(t *testing.T, server *Server, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.Sessions()) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d sessions, but got %d", n, len(server.Sessions()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func bearer(token string) *ClientConfig {
+	config := testClientConfig()
+	config.Header = http.Header{"Authorization": []string{"Bearer " + token}}
+	return config
+}
+
+func TestServerAuthenticates(t *testing.T) {
+	_, url := newTestServer(t, &ServerConfig{
+		Authenticate: TokenAuthenticator(map[string]string{"secret": "cosmos-relayer"}),
+	})
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": []string{"Bearer wrong"}})
+	if err == nil {
+		t.Fatalf("Expected a connection with a wrong token to be rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a wrong token, but got %v", resp)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": []string{"Bearer secret"}})
+	if err != nil {
+		t.Fatalf("Expected a connection with a valid token to succeed, but got error: %s", err)
+	}
+	conn.Close()
+}
+
+func TestServerRequiresAuthenticator(t *testing.T) {
+	server := NewServer(nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	defer server.Close()
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err == nil {
+		t.Fatalf("Expected a server without an authenticator to reject connections")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without an authenticator, but got %v", resp)
+	}
+}
+
+func TestServerMaxMessageSize(t *testing.T) {
+	server, url := newTestServer(t, &ServerConfig{MaxMessageSize: 1024})
+	received := make(chan *PIMessage, 1)
+	server.Handle("big", func(session *Session, message *PIMessage) {
+		received <- message
+	})
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitForSessions(t, server, 1)
+	frameType, data, err := EncodeMessage(EncodingJSON, &PIMessage{Type: "big", Payload: []byte(`"` + strings.Repeat("x", 2048) + `"`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(frameType, data); err != nil {
+		t.Fatal(err)
+	}
+	waitForSessions(t, server, 0)
+	select {
+	case <-received:
+		t.Errorf("Expected an oversized message not to be handled")
+	default:
+	}
+}
+
+func TestServerRoutesByType(t *testing.T) {
+	server, url := newTestServer(t, &ServerConfig{
+		Authenticate: TokenAuthenticator(map[string]string{"secret": "cosmos-relayer"}),
+	})
+	server.Handle("ping", func(session *Session, message *PIMessage) {
+		if session.Peer != "cosmos-relayer" {
+			t.Errorf("Expected peer cosmos-relayer, but got %q", session.Peer)
+		}
+		session.Send(&PIMessage{Type: "pong", Payload: message.Payload})
+	})
+
+	client := NewClient(url, bearer("secret"))
+	defer client.Close()
+	pongs := make(chan *PIMessage, 1)
+	client.Handle("pong", func(message *PIMessage) {
+		pongs <- message
+	})
+	if err := client.Send(context.Background(), &PIMessage{Type: "ping", Payload: []byte(`42`)}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case message := <-pongs:
+		if string(message.Payload) != `42` {
+			t.Errorf("Expected pong payload 42, but got %s", message.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a pong from the server")
+	}
+}
+
+func TestServerBroadcast(t *testing.T) {
+	server, url := newTestServer(t, &ServerConfig{
+		Authenticate: TokenAuthenticator(map[string]string{"a": "cosmos", "b": "polkadot", "c": "cosmos"}),
+	})
+	received := make(map[string]chan *PIMessage)
+	for _, token := range []string{"a", "b", "c"} {
+		client := NewClient(url, bearer(token))
+		defer client.Close()
+		ch := make(chan *PIMessage, 2)
+		received[token] = ch
+		client.Handle("header", func(message *PIMessage) {
+			ch <- message
+		})
+	}
+	waitForSessions(t, server, 3)
+
+	sent := server.Broadcast(&PIMessage{Type: "header", Payload: []byte(`"cosmos"`)}, func(session *Session) bool {
+		return session.Peer == "cosmos"
+	})
+	if sent != 2 {
+		t.Errorf("Expected the broadcast to reach 2 sessions, but got %d", sent)
+	}
+	if sent := server.Broadcast(&PIMessage{Type: "header", Payload: []byte(`"all"`)}, nil); sent != 3 {
+		t.Errorf("Expected the broadcast to reach 3 sessions, but got %d", sent)
+	}
+
+	expected := map[string][]string{"a": {`"cosmos"`, `"all"`}, "b": {`"all"`}, "c": {`"cosmos"`, `"all"`}}
+	for token, payloads := range expected {
+		for _, payload := range payloads {
+			select {
+			case message := <-received[token]:
+				if string(message.Payload) != payload {
+					t.Errorf("Expected client %s to receive %s, but got %s", token, payload, message.Payload)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected client %s to receive %s", token, payload)
+			}
+		}
+	}
+}
+
+func TestServerRemovesClosedSessions(t *testing.T) {
+	server, url := newTestServer(t, nil)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForSessions(t, server, 1)
+	session := server.Sessions()[0]
+	if server.Session(session.ID) != session {
+		t.Errorf("Expected to look up the session by ID")
+	}
+	conn.Close()
+	waitForSessions(t, server, 0)
+	select {
+	case <-session.Done():
+	default:
+		t.Errorf("Expected the session to be done")
+	}
+	if err := session.Send(&PIMessage{Type: "late"}); err != ErrSessionClosed {
+		t.Errorf("Expected ErrSessionClosed, but got %v", err)
+	}
+}
+
+func TestServerClosesSlowSession(t *testing.T) {
+	server, url := newTestServer(t, &ServerConfig{QueueSize: 1})
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitForSessions(t, server, 1)
+	session := server.Sessions()[0]
+
+	// The client never reads, so the queue eventually fills
+	var sendErr error
+	payload := []byte(`"` + strings.Repeat("x", 1<<20) + `"`)
+	for i := 0; i < 1000 && sendErr == nil; i++ {
+		sendErr = session.Send(&PIMessage{Type: "flood", Payload: payload})
+	}
+	if sendErr != ErrSessionQueueFull && sendErr != ErrSessionClosed {
+		t.Errorf("Expected a slow session to be closed, but got %v", sendErr)
+	}
+	waitForSessions(t, server, 0)
+}
+
+func TestSessionRejectsAck(t *testing.T) {
+	server, url := newTestServer(t, nil)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitForSessions(t, server, 1)
+	session := server.Sessions()[0]
+	if err := session.Send(&PIMessage{Type: "transfer", Ack: true}); err != ErrSessionAck {
+		t.Errorf("Expected ErrSessionAck, but got %v", err)
+	}
+	request := &PIMessage{ID: "request-1", Type: "query"}
+	if err := session.Reply(request, &PIMessage{Type: "result", Ack: true}); err != ErrSessionAck {
+		t.Errorf("Expected ErrSessionAck for a reply, but got %v", err)
+	}
+	if sent := server.Broadcast(&PIMessage{Type: "header", Ack: true}, nil); sent != 0 {
+		t.Errorf("Expected a broadcast with Ack not to be queued, but it reached %d sessions", sent)
+	}
+}
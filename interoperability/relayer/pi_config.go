@@ -0,0 +1,85 @@
+package relayer
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"pi/interoperability/protocol"
+)
+
+// FileConfig is the relayer's configuration file, read by the `nexapi
+// relayer` command:
+//
+//	chains:
+//	  - id: pi-1
+//	    url: wss://pi.example.org/interop
+//	    token: secret
+//	  - id: cosmoshub-4
+//	    url: wss://cosmos.example.org/interop
+//	paths:
+//	  - a: {chain: pi-1, port: transfer, channel: channel-0}
+//	    b: {chain: cosmoshub-4, port: transfer, channel: channel-141}
+//	state_file: relayer-state.json
+//	poll_interval: 5s
+type FileConfig struct {
+	Chains       []ChainConfig `mapstructure:"chains"`
+	Paths        []Path        `mapstructure:"paths"`
+	StateFile    string        `mapstructure:"state_file"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+}
+
+// ChainConfig is a chain whose router is served over the interoperability
+// protocol at URL
+type ChainConfig struct {
+	ID  string `mapstructure:"id"`
+	URL string `mapstructure:"url"`
+	// Token is sent as a bearer token. Routers only take packets and
+	// settlements from authenticated relayers, and packets only from those
+	// allowed to deliver them with protocol.Router.AllowPeer.
+	Token string `mapstructure:"token"`
+}
+
+// Dial connects to the configured chains and opens the state file. The
+// connections are closed with the relayer.
+func Dial(config *FileConfig) (*Relayer, error) {
+	state, err := OpenState(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	chains := make([]Chain, 0, len(config.Chains))
+	clients := make([]*protocol.Client, 0, len(config.Chains))
+	closeAll := func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}
+	for _, chain := range config.Chains {
+		if chain.ID == "" || chain.URL == "" {
+			closeAll()
+			return nil, errors.New("relayer: chains need an id and a url")
+		}
+		clientConfig := &protocol.ClientConfig{}
+		if chain.Token != "" {
+			clientConfig.Header = http.Header{"Authorization": []string{"Bearer " + chain.Token}}
+		}
+		client := protocol.NewClient(chain.URL, clientConfig)
+		clients = append(clients, client)
+		chains = append(chains, protocol.NewClientEndpoint(chain.ID, client))
+	}
+
+	relayer, err := NewRelayer(&Config{
+		Chains:       chains,
+		Paths:        config.Paths,
+		State:        state,
+		PollInterval: config.PollInterval,
+	})
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	for _, client := range clients {
+		relayer.closers = append(relayer.closers, client)
+	}
+	return relayer, nil
+}
@@ -0,0 +1,72 @@
+package relayer
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pi/interoperability/protocol"
+)
+
+// serve serves the chain's router over the interoperability protocol and
+// returns its URL
+func serve(t *testing.T, chain *testChain, token string) string {
+	server := protocol.NewServer(&protocol.ServerConfig{
+		Authenticate: protocol.TokenAuthenticator(map[string]string{token: "relayer"}),
+	})
+	chain.router.Serve(server)
+	chain.router.AllowPeer("relayer", "pi-1", "cosmoshub-4")
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		server.Close()
+		httpServer.Close()
+	})
+	return "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+func TestDialRelaysOverInteroperability(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pi, cosmos, path := newTestChains()
+	config := &FileConfig{
+		Chains: []ChainConfig{
+			{ID: "pi-1", URL: serve(t, pi, "pi-token"), Token: "pi-token"},
+			{ID: "cosmoshub-4", URL: serve(t, cosmos, "cosmos-token"), Token: "cosmos-token"},
+		},
+		Paths:     []Path{path},
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+	relayer, err := Dial(config)
+	if err != nil {
+		t.Fatalf("Expected Dial to succeed, but got error: %s", err)
+	}
+	defer relayer.Close()
+
+	pi.send(t, cosmos, "channel-0", "over the wire", 100)
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if received, _, _ := cosmos.app.counts(); received != 1 {
+		t.Errorf("Expected cosmos to receive the packet, got %d", received)
+	}
+	if _, acked, _ := pi.app.counts(); acked != 1 || len(pi.router.Pending()) != 0 {
+		t.Errorf("Expected the packet to be acknowledged and settled")
+	}
+}
+
+func TestDialRejectsBadConfig(t *testing.T) {
+	_, _, path := newTestChains()
+	configs := []*FileConfig{
+		{Chains: []ChainConfig{{ID: "pi-1"}}},
+		{Chains: []ChainConfig{{ID: "pi-1", URL: "ws://127.0.0.1:1"}}, Paths: []Path{path}},
+	}
+	for _, config := range configs {
+		if relayer, err := Dial(config); err == nil {
+			relayer.Close()
+			t.Errorf("Expected Dial of %+v to fail", config)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package relayer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"pi/interoperability/protocol"
+)
+
+// Packet relayer. For each path between two chains' channels the relayer
+// polls both chains for packets they sent over the path, delivers each with
+// its proof to the counterparty, and hands the acknowledgement back to the
+// source. Packets the counterparty never received and can no longer receive
+// are timed out on the source instead. Acknowledgements are persisted until the source
+// settles the packet, so a restarted relayer doesn't deliver a packet twice.
+// Several relayers may serve the same path: chains receive a packet once and
+// settle it once, and a relayer treats packets settled by others as done.
+
+// DefaultPollInterval is how often chains are polled for packets
+const DefaultPollInterval = 5 * time.Second
+
+// ErrUnknownChain is returned for paths to a chain the relayer has no endpoint for
+var ErrUnknownChain = errors.New("relayer: unknown chain")
+
+// Chain is a chain's router as seen by a relayer. protocol.ClientEndpoint
+// reaches routers served over the interoperability protocol.
+type Chain interface {
+	protocol.ChainEndpoint
+	// Pending returns the packets the chain sent and hasn't settled
+	Pending(ctx context.Context) ([]*protocol.Packet, error)
+	// ProvePacket proves a sent packet's commitment, or returns nil for
+	// chains whose packets aren't verified
+	ProvePacket(ctx context.Context, packet *protocol.Packet) (*protocol.PacketProof, error)
+	// ProveAcknowledgement proves the chain's acknowledgement of a received
+	// packet, or returns nil for chains whose acknowledgements aren't verified
+	ProveAcknowledgement(ctx context.Context, packet *protocol.Packet) (*protocol.PacketProof, error)
+	// AcknowledgePacket settles a sent packet with the counterparty's acknowledgement
+	AcknowledgePacket(ctx context.Context, packet *protocol.Packet, ack *protocol.Acknowledgement) error
+	// TimeoutPacket settles a sent packet the counterparty can no longer receive
+	TimeoutPacket(ctx context.Context, packet *protocol.Packet) error
+}
+
+// End is one end of a path: a port and channel on a chain
+type End struct {
+	Chain   string `mapstructure:"chain"`
+	Port    string `mapstructure:"port"`
+	Channel string `mapstructure:"channel"`
+}
+
+func (e End) String() string {
+	return e.Chain + "/" + e.Port + "/" + e.Channel
+}
+
+// Path pairs the channels of two chains. Packets are relayed both ways.
+type Path struct {
+	A End `mapstructure:"a"`
+	B End `mapstructure:"b"`
+}
+
+// Config configures a Relayer
+type Config struct {
+	// Chains are the chains the paths connect
+	Chains []Chain
+	// Paths are relayed in both directions
+	Paths []Path
+	// State remembers delivered packets. Defaults to an in-memory state.
+	State *State
+	// PollInterval defaults to DefaultPollInterval
+	PollInterval time.Duration
+}
+
+// Relayer relays packets over paths between chains
+type Relayer struct {
+	config Config
+	chains map[string]Chain
+	// closers are closed with the relayer, e.g. the clients dialed by Dial
+	closers []io.Closer
+}
+
+// NewRelayer creates a relayer, checking that every path connects two
+// configured chains
+func NewRelayer(config *Config) (*Relayer, error) {
+	cfg := *config
+	if cfg.State == nil {
+		cfg.State, _ = OpenState("")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	chains := make(map[string]Chain)
+	for _, chain := range cfg.Chains {
+		chains[chain.ChainID()] = chain
+	}
+	for _, path := range cfg.Paths {
+		for _, end := range []End{path.A, path.B} {
+			if end.Chain == "" || end.Port == "" || end.Channel == "" {
+				return nil, fmt.Errorf("relayer: incomplete path end %s", end)
+			}
+			if _, ok := chains[end.Chain]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownChain, end.Chain)
+			}
+		}
+		if path.A.Chain == path.B.Chain {
+			return nil, fmt.Errorf("relayer: path from %s to its own chain", path.A)
+		}
+	}
+	return &Relayer{config: cfg, chains: chains}, nil
+}
+
+// Run relays packets every poll interval until ctx is done
+func (r *Relayer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.Relay(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("relayer: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Relay makes one pass over every path in both directions and returns the
+// errors of the packets it couldn't relay; they are retried on the next pass
+func (r *Relayer) Relay(ctx context.Context) error {
+	var errs []error
+	for _, path := range r.config.Paths {
+		errs = append(errs, r.relay(ctx, path.A, path.B), r.relay(ctx, path.B, path.A))
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the connections the relayer opened
+func (r *Relayer) Close() error {
+	var errs []error
+	for _, closer := range r.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// relay relays the packets sent from source to destination
+func (r *Relayer) relay(ctx context.Context, source, destination End) error {
+	src, dst := r.chains[source.Chain], r.chains[destination.Chain]
+	pending, err := src.Pending(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: pending packets: %w", source, err)
+	}
+	packets := make([]*protocol.Packet, 0, len(pending))
+	for _, packet := range pending {
+		if packet.SourceChain == source.Chain && packet.SourcePort == source.Port && packet.SourceChannel == source.Channel &&
+			packet.DestinationChain == destination.Chain && packet.DestinationPort == destination.Port && packet.DestinationChannel == destination.Channel {
+			packets = append(packets, packet)
+		}
+	}
+	if err := r.config.State.Retain(source, packets); err != nil {
+		return err
+	}
+	if len(packets) == 0 {
+		return nil
+	}
+	status, err := dst.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: status: %w", destination, err)
+	}
+
+	var errs []error
+	for _, packet := range packets {
+		if err := r.relayPacket(ctx, src, dst, status, packet); err != nil {
+			errs = append(errs, fmt.Errorf("packet %s to %s: %w", packetKey(packet), destination, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// relayPacket delivers a packet and settles it on the source, picking up
+// after the last step a previous attempt completed
+func (r *Relayer) relayPacket(ctx context.Context, src, dst Chain, status *protocol.ChainStatus, packet *protocol.Packet) error {
+	ack, delivered := r.config.State.Acknowledgement(packet)
+	if !delivered {
+		// The destination returns its acknowledgement of a packet it already
+		// received even past the timeout, e.g. when another relayer delivered
+		// it or this one crashed before recording the delivery, so a packet
+		// is only timed out once the destination refuses it as timed out
+		if !packet.TimedOut(status.Height, status.Timestamp) {
+			proof, err := src.ProvePacket(ctx, packet)
+			if err != nil {
+				return fmt.Errorf("proof: %w", err)
+			}
+			packet.Proof = proof
+		}
+		var err error
+		ack, err = dst.DeliverPacket(ctx, packet)
+		if errors.Is(err, protocol.ErrPacketTimedOut) {
+			return r.settled(packet, src.TimeoutPacket(ctx, packet))
+		}
+		if err != nil {
+			return fmt.Errorf("delivery: %w", err)
+		}
+		if err := r.config.State.Delivered(packet, ack); err != nil {
+			return err
+		}
+	}
+	proof, err := dst.ProveAcknowledgement(ctx, packet)
+	if err != nil {
+		return fmt.Errorf("acknowledgement proof: %w", err)
+	}
+	proven := *ack
+	proven.Proof = proof
+	return r.settled(packet, src.AcknowledgePacket(ctx, packet, &proven))
+}
+
+// settled forgets a packet once the source settled it, or if it already was
+func (r *Relayer) settled(packet *protocol.Packet, err error) error {
+	if err != nil && !errors.Is(err, protocol.ErrPacketNotPending) {
+		return err
+	}
+	return r.config.State.Settled(packet)
+}
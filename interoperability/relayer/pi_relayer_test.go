@@ -0,0 +1,439 @@
+package relayer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"pi/interoperability/protocol"
+)
+
+// testChain is an in-process chain whose router the relayer drives
+// directly. It counts deliveries and can fail acknowledgements.
+type testChain struct {
+	router *protocol.Router
+	app    *testApp
+
+	mu         sync.Mutex
+	height     uint64
+	deliveries int
+	failAcks   bool
+}
+
+func newTestChain(chainID string) *testChain {
+	chain := &testChain{height: 1, app: &testApp{}}
+	chain.router = protocol.NewRouter(chainID, chain.Status)
+	chain.router.BindPort("transfer", chain.app)
+	return chain
+}
+
+func (c *testChain) ChainID() string {
+	return c.router.ChainID()
+}
+
+func (c *testChain) Status(ctx context.Context) (*protocol.ChainStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &protocol.ChainStatus{ChainID: c.router.ChainID(), Height: c.height, Timestamp: 1000}, nil
+}
+
+func (c *testChain) DeliverPacket(ctx context.Context, packet *protocol.Packet) (*protocol.Acknowledgement, error) {
+	c.mu.Lock()
+	c.deliveries++
+	c.mu.Unlock()
+	return c.router.ReceivePacket(ctx, packet)
+}
+
+func (c *testChain) Pending(ctx context.Context) ([]*protocol.Packet, error) {
+	return c.router.Pending(), nil
+}
+
+func (c *testChain) ProvePacket(ctx context.Context, packet *protocol.Packet) (*protocol.PacketProof, error) {
+	return c.router.ProvePacket(ctx, packet)
+}
+
+func (c *testChain) ProveAcknowledgement(ctx context.Context, packet *protocol.Packet) (*protocol.PacketProof, error) {
+	return c.router.ProveAcknowledgement(ctx, packet)
+}
+
+func (c *testChain) AcknowledgePacket(ctx context.Context, packet *protocol.Packet, ack *protocol.Acknowledgement) error {
+	c.mu.Lock()
+	fail := c.failAcks
+	c.mu.Unlock()
+	if fail {
+		return errors.New("chain unavailable")
+	}
+	return c.router.AcknowledgePacket(ctx, packet, ack)
+}
+
+func (c *testChain) TimeoutPacket(ctx context.Context, packet *protocol.Packet) error {
+	return c.router.TimeoutPacket(ctx, packet)
+}
+
+func (c *testChain) setHeight(height uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.height = height
+}
+
+func (c *testChain) setFailAcks(fail bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failAcks = fail
+}
+
+func (c *testChain) send(t *testing.T, to *testChain, channel string, data string, timeoutHeight uint64) *protocol.Packet {
+	packet := &protocol.Packet{
+		SourcePort:         "transfer",
+		SourceChannel:      channel,
+		DestinationChain:   to.ChainID(),
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-9",
+		TimeoutHeight:      timeoutHeight,
+		Data:               []byte(data),
+	}
+	if _, err := c.router.SendPacket(context.Background(), packet); err != nil {
+		t.Fatalf("Expected SendPacket to succeed, but got error: %s", err)
+	}
+	return packet
+}
+
+// testApp records the packets it received and the outcomes of those it sent
+type testApp struct {
+	mu       sync.Mutex
+	received []string
+	acked    []string
+	timedOut []string
+}
+
+func (a *testApp) OnRecvPacket(ctx context.Context, packet *protocol.Packet) *protocol.Acknowledgement {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.received = append(a.received, string(packet.Data))
+	return protocol.NewResultAcknowledgement([]byte(`"ok"`))
+}
+
+func (a *testApp) OnAcknowledgementPacket(ctx context.Context, packet *protocol.Packet, ack *protocol.Acknowledgement) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acked = append(a.acked, string(packet.Data))
+	return nil
+}
+
+func (a *testApp) OnTimeoutPacket(ctx context.Context, packet *protocol.Packet) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.timedOut = append(a.timedOut, string(packet.Data))
+	return nil
+}
+
+func (a *testApp) counts() (received, acked, timedOut int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.received), len(a.acked), len(a.timedOut)
+}
+
+// newTestChains creates two chains with a path between their channel-0 and
+// channel-9 transfer ports
+func newTestChains() (*testChain, *testChain, Path) {
+	pi, cosmos := newTestChain("pi-1"), newTestChain("cosmoshub-4")
+	pi.router.AddChain(cosmos)
+	cosmos.router.AddChain(pi)
+	pi.router.SetTrusted("cosmoshub-4")
+	cosmos.router.SetTrusted("pi-1")
+	path := Path{
+		A: End{Chain: "pi-1", Port: "transfer", Channel: "channel-0"},
+		B: End{Chain: "cosmoshub-4", Port: "transfer", Channel: "channel-9"},
+	}
+	return pi, cosmos, path
+}
+
+func newTestRelayer(t *testing.T, state *State, path Path, chains ...Chain) *Relayer {
+	relayer, err := NewRelayer(&Config{Chains: chains, Paths: []Path{path}, State: state})
+	if err != nil {
+		t.Fatalf("Expected NewRelayer to succeed, but got error: %s", err)
+	}
+	return relayer
+}
+
+func TestRelayerIgnoresOtherPaths(t *testing.T) {
+	ctx := context.Background()
+	pi, cosmos, path := newTestChains()
+	relayer := newTestRelayer(t, nil, path, pi, cosmos)
+
+	pi.send(t, cosmos, "channel-1", "other channel", 100)
+	packet := &protocol.Packet{
+		SourcePort:         "transfer",
+		SourceChannel:      "channel-0",
+		DestinationChain:   "cosmoshub-4",
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-7",
+		TimeoutHeight:      100,
+		Data:               []byte("other counterparty channel"),
+	}
+	if _, err := pi.router.SendPacket(ctx, packet); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if cosmos.deliveries != 0 || len(pi.router.Pending()) != 2 {
+		t.Errorf("Expected packets of other paths to be left alone, got %d deliveries", cosmos.deliveries)
+	}
+}
+
+func TestRelayerDeliversAndAcknowledges(t *testing.T) {
+	ctx := context.Background()
+	pi, cosmos, path := newTestChains()
+	relayer := newTestRelayer(t, nil, path, pi, cosmos)
+
+	for _, data := range []string{"one", "two"} {
+		pi.send(t, cosmos, "channel-0", data, 100)
+	}
+	packet := &protocol.Packet{
+		SourcePort:         "transfer",
+		SourceChannel:      "channel-9",
+		DestinationChain:   "pi-1",
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-0",
+		TimeoutHeight:      100,
+		Data:               []byte("three"),
+	}
+	if _, err := cosmos.router.SendPacket(ctx, packet); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if received, acked, _ := cosmos.app.counts(); received != 2 || acked != 1 {
+		t.Errorf("Expected cosmos to receive 2 packets and get 1 ack, got %d and %d", received, acked)
+	}
+	if received, acked, _ := pi.app.counts(); received != 1 || acked != 2 {
+		t.Errorf("Expected pi to receive 1 packet and get 2 acks, got %d and %d", received, acked)
+	}
+	if len(pi.router.Pending()) != 0 || len(cosmos.router.Pending()) != 0 {
+		t.Errorf("Expected every packet to be settled")
+	}
+
+	// Nothing is left to relay
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if pi.deliveries != 1 || cosmos.deliveries != 2 {
+		t.Errorf("Expected each packet to be delivered once, got %d and %d deliveries", pi.deliveries, cosmos.deliveries)
+	}
+}
+
+func TestRelayerTimesOutPackets(t *testing.T) {
+	ctx := context.Background()
+	pi, cosmos, path := newTestChains()
+	relayer := newTestRelayer(t, nil, path, pi, cosmos)
+
+	pi.send(t, cosmos, "channel-0", "late", 5)
+	cosmos.setHeight(5)
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if received, _, _ := cosmos.app.counts(); received != 0 {
+		t.Errorf("Expected a timed out packet not to be received")
+	}
+	if _, _, timedOut := pi.app.counts(); timedOut != 1 || len(pi.router.Pending()) != 0 {
+		t.Errorf("Expected the packet to be timed out on the source")
+	}
+}
+
+func TestRelayerAcknowledgesPacketsReceivedBeforeTimeout(t *testing.T) {
+	ctx := context.Background()
+	pi, cosmos, path := newTestChains()
+	relayer := newTestRelayer(t, nil, path, pi, cosmos)
+
+	// Another relayer, or this one before a crash, delivered the packet
+	// without it being recorded here
+	packet := pi.send(t, cosmos, "channel-0", "received", 5)
+	if _, err := cosmos.DeliverPacket(ctx, packet); err != nil {
+		t.Fatal(err)
+	}
+	cosmos.setHeight(5)
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if received, _, _ := cosmos.app.counts(); received != 1 {
+		t.Errorf("Expected the packet to be received once, got %d", received)
+	}
+	if _, acked, timedOut := pi.app.counts(); acked != 1 || timedOut != 0 || len(pi.router.Pending()) != 0 {
+		t.Errorf("Expected the received packet to be acknowledged, not timed out, got %d acked and %d timed out", acked, timedOut)
+	}
+}
+
+func TestRelayerVerifiesProofs(t *testing.T) {
+	ctx := context.Background()
+	pi, cosmos, path := newTestChains()
+	cosmos.router.SetVerifier("pi-1", commitmentVerifier{})
+	relayer := newTestRelayer(t, nil, path, pi, cosmos)
+
+	pi.send(t, cosmos, "channel-0", "proven", 100)
+	// Without a prover the packet can't be delivered, and stays pending
+	if err := relayer.Relay(ctx); !errors.Is(err, protocol.ErrMissingProof) {
+		t.Fatalf("Expected ErrMissingProof, but got %v", err)
+	}
+	if len(pi.router.Pending()) != 1 {
+		t.Fatalf("Expected the unproven packet to stay pending")
+	}
+	pi.router.SetProver(commitmentProver{})
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if received, _, _ := cosmos.app.counts(); received != 1 || len(pi.router.Pending()) != 0 {
+		t.Errorf("Expected the proven packet to be received and settled")
+	}
+
+	// Acknowledgements are proven too once the source verifies the destination
+	pi.router.SetVerifier("cosmoshub-4", commitmentVerifier{})
+	pi.send(t, cosmos, "channel-0", "acknowledged", 100)
+	if err := relayer.Relay(ctx); !errors.Is(err, protocol.ErrMissingProof) {
+		t.Fatalf("Expected ErrMissingProof, but got %v", err)
+	}
+	if received, _, _ := cosmos.app.counts(); received != 2 || len(pi.router.Pending()) != 1 {
+		t.Fatalf("Expected the packet to be received but stay pending without an acknowledgement proof")
+	}
+	cosmos.router.SetProver(commitmentProver{})
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if received, _, _ := cosmos.app.counts(); received != 2 || len(pi.router.Pending()) != 0 {
+		t.Errorf("Expected the acknowledgement to settle the packet without redelivering it")
+	}
+}
+
+// commitmentProver and commitmentVerifier stand in for a light client
+type commitmentProver struct{}
+
+func (commitmentProver) ProvePacket(ctx context.Context, packet *protocol.Packet) (*protocol.PacketProof, error) {
+	return &protocol.PacketProof{Height: 1, Proof: packet.Commitment()}, nil
+}
+
+func (commitmentProver) ProveAcknowledgement(ctx context.Context, packet *protocol.Packet, ack *protocol.Acknowledgement) (*protocol.PacketProof, error) {
+	return &protocol.PacketProof{Height: 1, Proof: ack.Commitment()}, nil
+}
+
+type commitmentVerifier struct{}
+
+func (commitmentVerifier) VerifyPacket(packet *protocol.Packet, proof *protocol.PacketProof) error {
+	if string(proof.Proof) != string(packet.Commitment()) {
+		return errors.New("invalid proof")
+	}
+	return nil
+}
+
+func (commitmentVerifier) VerifyAcknowledgement(packet *protocol.Packet, ack *protocol.Acknowledgement, proof *protocol.PacketProof) error {
+	if string(proof.Proof) != string(ack.Commitment()) {
+		return errors.New("invalid proof")
+	}
+	return nil
+}
+
+func TestRelayerResumesWithoutRedelivering(t *testing.T) {
+	ctx := context.Background()
+	pi, cosmos, path := newTestChains()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	state, err := OpenState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayer := newTestRelayer(t, state, path, pi, cosmos)
+
+	pi.send(t, cosmos, "channel-0", "once", 100)
+	pi.setFailAcks(true)
+	if err := relayer.Relay(ctx); err == nil {
+		t.Fatalf("Expected Relay to fail while the source is unavailable")
+	}
+	if cosmos.deliveries != 1 || state.Len() != 1 {
+		t.Fatalf("Expected the packet to be delivered and its acknowledgement kept, got %d deliveries", cosmos.deliveries)
+	}
+
+	// A restarted relayer only submits the acknowledgement
+	pi.setFailAcks(false)
+	state, err = OpenState(stateFile)
+	if err != nil {
+		t.Fatalf("Expected OpenState to succeed, but got error: %s", err)
+	}
+	relayer = newTestRelayer(t, state, path, pi, cosmos)
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if cosmos.deliveries != 1 {
+		t.Errorf("Expected the packet not to be delivered again, got %d deliveries", cosmos.deliveries)
+	}
+	if _, acked, _ := pi.app.counts(); acked != 1 || state.Len() != 0 {
+		t.Errorf("Expected the packet to be acknowledged and forgotten, got %d acks and %d records", acked, state.Len())
+	}
+}
+
+func TestRelayerForgetsPacketsSettledElsewhere(t *testing.T) {
+	ctx := context.Background()
+	pi, cosmos, path := newTestChains()
+	state, _ := OpenState("")
+	relayer := newTestRelayer(t, state, path, pi, cosmos)
+
+	packet := pi.send(t, cosmos, "channel-0", "raced", 100)
+	pi.setFailAcks(true)
+	relayer.Relay(ctx)
+	// Another relayer settles the packet first
+	ack, _ := state.Acknowledgement(packet)
+	if err := pi.router.AcknowledgePacket(ctx, packet, ack); err != nil {
+		t.Fatal(err)
+	}
+	pi.setFailAcks(false)
+	if err := relayer.Relay(ctx); err != nil {
+		t.Fatalf("Expected Relay to succeed, but got error: %s", err)
+	}
+	if state.Len() != 0 {
+		t.Errorf("Expected the settled packet to be forgotten")
+	}
+}
+
+func TestNewRelayerRejectsBadPaths(t *testing.T) {
+	pi, cosmos, path := newTestChains()
+	bad := []Path{
+		{A: path.A, B: End{Chain: "osmosis-1", Port: "transfer", Channel: "channel-0"}},
+		{A: path.A, B: End{Chain: "cosmoshub-4", Port: "transfer"}},
+		{A: path.A, B: End{Chain: "pi-1", Port: "transfer", Channel: "channel-1"}},
+	}
+	for _, p := range bad {
+		if _, err := NewRelayer(&Config{Chains: []Chain{pi, cosmos}, Paths: []Path{p}}); err == nil {
+			t.Errorf("Expected NewRelayer with path %s to %s to fail", p.A, p.B)
+		}
+	}
+	if _, err := NewRelayer(&Config{Chains: []Chain{pi}, Paths: []Path{path}}); !errors.Is(err, ErrUnknownChain) {
+		t.Errorf("Expected ErrUnknownChain, but got %v", err)
+	}
+}
+
+func TestRelayerRun(t *testing.T) {
+	pi, cosmos, path := newTestChains()
+	relayer, err := NewRelayer(&Config{Chains: []Chain{pi, cosmos}, Paths: []Path{path}, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- relayer.Run(ctx) }()
+
+	pi.send(t, cosmos, "channel-0", "later", 100)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pi.router.Pending()) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Run to stop with the context, but got %v", err)
+	}
+	if received, _, _ := cosmos.app.counts(); received != 1 {
+		t.Errorf("Expected Run to relay the packet, but cosmos received %d", received)
+	}
+}
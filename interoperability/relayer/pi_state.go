@@ -0,0 +1,139 @@
+package relayer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"pi/interoperability/protocol"
+)
+
+// State remembers the acknowledgements of packets the relayer delivered
+// until the source chain has settled them, so a restarted relayer submits
+// the acknowledgement instead of delivering the packet again
+type State struct {
+	path    string
+	records map[string]*record
+	mu      sync.Mutex
+}
+
+// record is a delivered packet's acknowledgement. The commitment tells a
+// record apart from a different packet that reuses the sequence, e.g. after
+// a chain was reset.
+type record struct {
+	Commitment []byte                    `json:"commitment"`
+	Ack        *protocol.Acknowledgement `json:"ack"`
+}
+
+// stateFile is the persisted form of a State
+type stateFile struct {
+	Acknowledgements map[string]*record `json:"acknowledgements"`
+}
+
+// OpenState loads the state persisted at path, or starts an empty one if
+// the file doesn't exist. With an empty path the state is kept in memory.
+func OpenState(path string) (*State, error) {
+	s := &State{path: path, records: make(map[string]*record)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("relayer state %s: %w", path, err)
+	}
+	for key, r := range file.Acknowledgements {
+		if r != nil && r.Ack != nil {
+			s.records[key] = r
+		}
+	}
+	return s, nil
+}
+
+// packetKey identifies a packet among all packets of all chains
+func packetKey(packet *protocol.Packet) string {
+	return fmt.Sprintf("%s/%s/%s/%d", packet.SourceChain, packet.SourcePort, packet.SourceChannel, packet.Sequence)
+}
+
+// Acknowledgement returns the acknowledgement of a delivered packet
+func (s *State) Acknowledgement(packet *protocol.Packet) (*protocol.Acknowledgement, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[packetKey(packet)]
+	if !ok || !bytes.Equal(r.Commitment, packet.Commitment()) {
+		return nil, false
+	}
+	return r.Ack, true
+}
+
+// Delivered records the acknowledgement of a delivered packet
+func (s *State) Delivered(packet *protocol.Packet, ack *protocol.Acknowledgement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[packetKey(packet)] = &record{Commitment: packet.Commitment(), Ack: ack}
+	return s.save()
+}
+
+// Settled forgets a packet the source chain has settled
+func (s *State) Settled(packet *protocol.Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := packetKey(packet)
+	if _, ok := s.records[key]; !ok {
+		return nil
+	}
+	delete(s.records, key)
+	return s.save()
+}
+
+// Retain forgets the packets sent from a source channel that aren't in
+// pending, because the source chain settled them without this relayer
+func (s *State) Retain(source End, pending []*protocol.Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keep := make(map[string]bool, len(pending))
+	for _, packet := range pending {
+		keep[packetKey(packet)] = true
+	}
+	prefix := fmt.Sprintf("%s/%s/%s/", source.Chain, source.Port, source.Channel)
+	changed := false
+	for key := range s.records {
+		if strings.HasPrefix(key, prefix) && !keep[key] {
+			delete(s.records, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// Len returns the number of delivered packets awaiting settlement
+func (s *State) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records)
+}
+
+// save writes the state atomically
+func (s *State) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(&stateFile{Acknowledgements: s.records})
+	if err != nil {
+		return err
+	}
+	return protocol.WriteFileAtomic(s.path, data)
+}
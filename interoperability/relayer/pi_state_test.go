@@ -0,0 +1,90 @@
+package relayer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pi/interoperability/protocol"
+)
+
+func testPacket(sequence uint64, channel string) *protocol.Packet {
+	return &protocol.Packet{
+		Sequence:           sequence,
+		SourceChain:        "pi-1",
+		SourcePort:         "transfer",
+		SourceChannel:      channel,
+		DestinationChain:   "cosmoshub-4",
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-9",
+		TimeoutHeight:      100,
+		Data:               []byte("data"),
+	}
+}
+
+func TestStatePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := OpenState(path)
+	if err != nil {
+		t.Fatalf("Expected OpenState to succeed, but got error: %s", err)
+	}
+	first, second := testPacket(1, "channel-0"), testPacket(2, "channel-0")
+	if err := state.Delivered(first, protocol.NewResultAcknowledgement([]byte("one"))); err != nil {
+		t.Fatalf("Expected Delivered to succeed, but got error: %s", err)
+	}
+	if err := state.Delivered(second, protocol.NewResultAcknowledgement([]byte("two"))); err != nil {
+		t.Fatalf("Expected Delivered to succeed, but got error: %s", err)
+	}
+	if err := state.Settled(first); err != nil {
+		t.Fatalf("Expected Settled to succeed, but got error: %s", err)
+	}
+
+	reopened, err := OpenState(path)
+	if err != nil {
+		t.Fatalf("Expected OpenState to succeed, but got error: %s", err)
+	}
+	if _, ok := reopened.Acknowledgement(first); ok {
+		t.Errorf("Expected the settled packet to be forgotten")
+	}
+	ack, ok := reopened.Acknowledgement(second)
+	if !ok || string(ack.Result) != "two" {
+		t.Errorf("Expected the acknowledgement to survive a restart, got %+v", ack)
+	}
+
+	// A different packet with the same sequence isn't the delivered one
+	reused := testPacket(2, "channel-0")
+	reused.Data = []byte("other data")
+	if _, ok := reopened.Acknowledgement(reused); ok {
+		t.Errorf("Expected a packet with another commitment not to match")
+	}
+}
+
+func TestStateRetain(t *testing.T) {
+	state, _ := OpenState("")
+	packets := []*protocol.Packet{testPacket(1, "channel-0"), testPacket(2, "channel-0"), testPacket(1, "channel-1")}
+	for _, packet := range packets {
+		state.Delivered(packet, protocol.NewResultAcknowledgement(nil))
+	}
+	source := End{Chain: "pi-1", Port: "transfer", Channel: "channel-0"}
+	if err := state.Retain(source, packets[1:2]); err != nil {
+		t.Fatalf("Expected Retain to succeed, but got error: %s", err)
+	}
+	if _, ok := state.Acknowledgement(packets[0]); ok {
+		t.Errorf("Expected the packet no longer pending to be forgotten")
+	}
+	for _, packet := range packets[1:] {
+		if _, ok := state.Acknowledgement(packet); !ok {
+			t.Errorf("Expected packet %s to be kept", packetKey(packet))
+		}
+	}
+}
+
+func TestOpenStateRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenState(path); err == nil {
+		t.Errorf("Expected OpenState of a corrupt file to fail")
+	}
+}
@@ -0,0 +1,494 @@
+package tss
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"pi/crypto/bls"
+)
+
+// Distributed key generation and share refresh, following joint Feldman
+// verifiable secret sharing. Every party deals a random polynomial of degree
+// Threshold-1, broadcasts commitments to its coefficients and sends each
+// other party its evaluation privately. Parties check the shares they receive
+// against the commitments and broadcast complaints. An accused dealer answers
+// by broadcasting the disputed shares, which everyone checks against its
+// commitments; a complainer adopts a share that checks out, and a dealer that
+// doesn't answer every complaint with a valid share is disqualified. The group
+// key is the sum of the remaining dealers' secrets, which no single party ever
+// holds.
+//
+// The protocol needs every party online for every round. A false complaint
+// can't get an honest dealer disqualified, it only makes the dealer publish
+// the complainer's share of its polynomial. A dishonest party can't learn the
+// group secret or make parties disagree on the group key.
+
+// Broadcast is the Message.To value for messages sent to every other party
+const Broadcast = 0
+
+// DKG rounds
+const (
+	roundCommitments = iota + 1
+	roundShares
+	roundComplaints
+	roundJustifications
+)
+
+var (
+	// ErrInvalidParams is returned for a party index or threshold that doesn't fit the number of parties
+	ErrInvalidParams = errors.New("tss: invalid parameters")
+
+	// ErrTooManyDisqualified is returned when too few dealers remain to reach the threshold
+	ErrTooManyDisqualified = errors.New("tss: too many dealers disqualified")
+)
+
+// Message is a protocol message between parties. Session keeps concurrent
+// runs apart; messages for other sessions are discarded.
+type Message struct {
+	Session string
+	Round   int
+	From    int
+	To      int
+	Payload []byte
+}
+
+// Transport delivers protocol messages between parties. It must authenticate
+// the sender of every message, keep messages addressed to a single party
+// confidential, and deliver broadcasts to every party alike.
+type Transport interface {
+	// Send delivers msg to msg.To, or to every other party if it is Broadcast
+	Send(ctx context.Context, msg *Message) error
+	// Receive returns the next message addressed to this party
+	Receive(ctx context.Context) (*Message, error)
+}
+
+// Params identifies a party and the shape of the committee
+type Params struct {
+	Session   string
+	Index     int
+	Parties   int
+	Threshold int
+}
+
+func (p Params) validate() error {
+	if p.Parties < 1 || p.Threshold < 1 || p.Threshold > p.Parties || p.Index < 1 || p.Index > p.Parties {
+		return ErrInvalidParams
+	}
+	return nil
+}
+
+// RunDKG runs distributed key generation with the other parties and returns
+// this party's share of the new group key
+func RunDKG(ctx context.Context, transport Transport, params Params) (*KeyShare, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	coeffs, err := randomPolynomial(params.Threshold, true)
+	if err != nil {
+		return nil, err
+	}
+	result, err := runSharing(ctx, transport, params, coeffs, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.qualified) < params.Threshold {
+		return nil, ErrTooManyDisqualified
+	}
+	share := &KeyShare{
+		Index:            params.Index,
+		Threshold:        params.Threshold,
+		VerificationKeys: make(map[int]*bls.PublicKey, params.Parties),
+	}
+	var constants []*bls.PublicKey
+	for _, dealer := range result.qualified {
+		constants = append(constants, result.commitments[dealer][0])
+	}
+	share.GroupKey, err = bls.AggregatePublicKeys(constants...)
+	if err != nil {
+		return nil, err
+	}
+	for party := 1; party <= params.Parties; party++ {
+		share.VerificationKeys[party], err = result.evaluate(party, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	share.secret, err = bls.SecretKeyFromInt(result.secret)
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// Refresh re-randomizes the shares of an existing group key. Every party adds
+// a sharing of zero to its share, so the group key is unchanged while shares
+// leaked before the refresh become useless together with shares from after
+// it. All parties must take part.
+func Refresh(ctx context.Context, transport Transport, session string, share *KeyShare) (*KeyShare, error) {
+	params := Params{Session: session, Index: share.Index, Parties: share.Parties(), Threshold: share.Threshold}
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	if params.Threshold < 2 {
+		// Every party holds the whole secret, so there is nothing to re-share
+		return nil, ErrInvalidParams
+	}
+	coeffs, err := randomPolynomial(params.Threshold, false)
+	if err != nil {
+		return nil, err
+	}
+	result, err := runSharing(ctx, transport, params, coeffs, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.qualified) == 0 {
+		return nil, ErrTooManyDisqualified
+	}
+	refreshed := &KeyShare{
+		Index:            share.Index,
+		Threshold:        share.Threshold,
+		GroupKey:         share.GroupKey,
+		VerificationKeys: make(map[int]*bls.PublicKey, params.Parties),
+	}
+	for party, key := range share.VerificationKeys {
+		delta, err := result.evaluate(party, 1)
+		if err != nil {
+			return nil, err
+		}
+		refreshed.VerificationKeys[party], err = bls.AggregatePublicKeys(key, delta)
+		if err != nil {
+			return nil, err
+		}
+	}
+	secret := new(big.Int).Add(share.secret.Int(), result.secret)
+	refreshed.secret, err = bls.SecretKeyFromInt(secret.Mod(secret, bls.Order()))
+	if err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// commitmentsPayload is the round one broadcast of a dealer
+type commitmentsPayload struct {
+	Commitments [][]byte `json:"commitments"`
+}
+
+// complaintsPayload is the round three broadcast listing dealers whose share failed to verify
+type complaintsPayload struct {
+	Dealers []int `json:"dealers"`
+}
+
+// justificationPayload is the round four broadcast in which an accused dealer
+// reveals the shares it dealt to the parties complaining about it, by party
+type justificationPayload struct {
+	Shares map[int][]byte `json:"shares"`
+}
+
+// sharingResult is the outcome of one round of joint sharing from this party's view
+type sharingResult struct {
+	// qualified lists the dealers that weren't disqualified
+	qualified []int
+	// commitments holds each dealer's coefficient commitments, starting at the first committed degree
+	commitments map[int][]*bls.PublicKey
+	// secret is the sum of the shares received from qualified dealers
+	secret *big.Int
+}
+
+// evaluate returns the sum over qualified dealers of their committed
+// polynomials at party, as a public key. from is the degree of the first
+// commitment.
+func (r *sharingResult) evaluate(party int, from int) (*bls.PublicKey, error) {
+	var points []*bls.PublicKey
+	var powers []*big.Int
+	for _, dealer := range r.qualified {
+		for k, commitment := range r.commitments[dealer] {
+			points = append(points, commitment)
+			powers = append(powers, new(big.Int).Exp(big.NewInt(int64(party)), big.NewInt(int64(k+from)), bls.Order()))
+		}
+	}
+	return bls.LinearCombinationPublicKeys(points, powers)
+}
+
+// runSharing deals coeffs to the other parties, collects and checks their
+// deals, and agrees on the qualified dealers. Commitments are sent for the
+// coefficients of degree from and above; a refresh leaves out the constant
+// term, which is zero.
+func runSharing(ctx context.Context, transport Transport, params Params, coeffs []*big.Int, from int) (*sharingResult, error) {
+	s := newSession(transport, params)
+
+	commitments := make([]*bls.PublicKey, 0, len(coeffs)-from)
+	encoded := make([][]byte, 0, len(coeffs)-from)
+	for _, c := range coeffs[from:] {
+		sk, err := bls.SecretKeyFromInt(c)
+		if err != nil {
+			return nil, err
+		}
+		commitments = append(commitments, sk.PublicKey())
+		encoded = append(encoded, sk.PublicKey().Bytes())
+	}
+	payload, err := json.Marshal(&commitmentsPayload{Commitments: encoded})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.send(ctx, roundCommitments, Broadcast, payload); err != nil {
+		return nil, err
+	}
+	result := &sharingResult{
+		commitments: map[int][]*bls.PublicKey{params.Index: commitments},
+		secret:      evaluatePolynomial(coeffs, params.Index),
+	}
+	// disqualified holds dealers whose broadcasts are malformed, which every
+	// party sees alike. accused holds the dealers this party complains about.
+	disqualified := make(map[int]bool)
+	accused := make(map[int]bool)
+
+	messages, err := s.collect(ctx, roundCommitments)
+	if err != nil {
+		return nil, err
+	}
+	for dealer, msg := range messages {
+		var p commitmentsPayload
+		if err := json.Unmarshal(msg.Payload, &p); err != nil || len(p.Commitments) != len(coeffs)-from {
+			disqualified[dealer] = true
+			continue
+		}
+		for _, b := range p.Commitments {
+			pk, err := bls.PublicKeyFromBytes(b)
+			if err != nil {
+				disqualified[dealer] = true
+				break
+			}
+			result.commitments[dealer] = append(result.commitments[dealer], pk)
+		}
+	}
+
+	for party := 1; party <= params.Parties; party++ {
+		if party == params.Index {
+			continue
+		}
+		share := evaluatePolynomial(coeffs, party).FillBytes(make([]byte, bls.SecretKeySize))
+		if err := s.send(ctx, roundShares, party, share); err != nil {
+			return nil, err
+		}
+	}
+	messages, err = s.collect(ctx, roundShares)
+	if err != nil {
+		return nil, err
+	}
+	shares := make(map[int]*big.Int)
+	for dealer, msg := range messages {
+		if disqualified[dealer] {
+			continue
+		}
+		share, ok := result.parseShare(dealer, params.Index, msg.Payload, from)
+		if !ok {
+			accused[dealer] = true
+			continue
+		}
+		shares[dealer] = share
+	}
+
+	dealers := make([]int, 0, len(accused))
+	for dealer := range accused {
+		dealers = append(dealers, dealer)
+	}
+	payload, err = json.Marshal(&complaintsPayload{Dealers: dealers})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.send(ctx, roundComplaints, Broadcast, payload); err != nil {
+		return nil, err
+	}
+	messages, err = s.collect(ctx, roundComplaints)
+	if err != nil {
+		return nil, err
+	}
+	// complainers maps each accused dealer to the parties complaining about it
+	complainers := make(map[int][]int)
+	for dealer := range accused {
+		complainers[dealer] = append(complainers[dealer], params.Index)
+	}
+	for _, msg := range messages {
+		var p complaintsPayload
+		if err := json.Unmarshal(msg.Payload, &p); err != nil {
+			// A malformed complaint is attributed to its sender, so every
+			// honest party still reaches the same verdict
+			disqualified[msg.From] = true
+			continue
+		}
+		for _, dealer := range p.Dealers {
+			if dealer >= 1 && dealer <= params.Parties && dealer != msg.From {
+				complainers[dealer] = append(complainers[dealer], msg.From)
+			}
+		}
+	}
+
+	// Answer the complaints against this party by revealing the disputed shares
+	justification := &justificationPayload{Shares: make(map[int][]byte)}
+	for _, party := range complainers[params.Index] {
+		justification.Shares[party] = evaluatePolynomial(coeffs, party).FillBytes(make([]byte, bls.SecretKeySize))
+	}
+	payload, err = json.Marshal(justification)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.send(ctx, roundJustifications, Broadcast, payload); err != nil {
+		return nil, err
+	}
+	messages, err = s.collect(ctx, roundJustifications)
+	if err != nil {
+		return nil, err
+	}
+	for dealer, parties := range complainers {
+		if dealer == params.Index || disqualified[dealer] {
+			continue
+		}
+		var p justificationPayload
+		msg, ok := messages[dealer]
+		if !ok || json.Unmarshal(msg.Payload, &p) != nil {
+			disqualified[dealer] = true
+			continue
+		}
+		for _, party := range parties {
+			share, ok := result.parseShare(dealer, party, p.Shares[party], from)
+			if !ok {
+				disqualified[dealer] = true
+				break
+			}
+			if party == params.Index {
+				shares[dealer] = share
+			}
+		}
+	}
+
+	order := bls.Order()
+	for dealer := 1; dealer <= params.Parties; dealer++ {
+		if disqualified[dealer] {
+			continue
+		}
+		result.qualified = append(result.qualified, dealer)
+		if dealer != params.Index {
+			result.secret.Add(result.secret, shares[dealer])
+		}
+	}
+	result.secret.Mod(result.secret, order)
+	return result, nil
+}
+
+// parseShare decodes a share dealt by dealer to party and checks it against
+// the dealer's commitments
+func (r *sharingResult) parseShare(dealer int, party int, payload []byte, from int) (*big.Int, bool) {
+	if len(payload) != bls.SecretKeySize {
+		return nil, false
+	}
+	share := new(big.Int).SetBytes(payload)
+	if !r.verifyShare(dealer, party, share, from) {
+		return nil, false
+	}
+	return share, true
+}
+
+// verifyShare checks share, dealt by dealer to party, against the dealer's
+// commitments
+func (r *sharingResult) verifyShare(dealer int, party int, share *big.Int, from int) bool {
+	sk, err := bls.SecretKeyFromInt(share)
+	if err != nil {
+		return false
+	}
+	expected, err := (&sharingResult{
+		qualified:   []int{dealer},
+		commitments: r.commitments,
+	}).evaluate(party, from)
+	if err != nil {
+		return false
+	}
+	return sk.PublicKey().Equal(expected)
+}
+
+// randomPolynomial returns threshold random coefficients, lowest degree
+// first. The constant term is zero when withSecret is false.
+func randomPolynomial(threshold int, withSecret bool) ([]*big.Int, error) {
+	coeffs := make([]*big.Int, threshold)
+	for i := range coeffs {
+		if i == 0 && !withSecret {
+			coeffs[i] = big.NewInt(0)
+			continue
+		}
+		sk, err := bls.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		coeffs[i] = sk.Int()
+	}
+	return coeffs, nil
+}
+
+// evaluatePolynomial evaluates coeffs at x modulo the group order
+func evaluatePolynomial(coeffs []*big.Int, x int) *big.Int {
+	order := bls.Order()
+	result := new(big.Int)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		result.Mul(result, big.NewInt(int64(x)))
+		result.Add(result, coeffs[i])
+		result.Mod(result, order)
+	}
+	return result
+}
+
+// session sends and collects the messages of one protocol run. Messages for
+// later rounds that arrive early are held until their round is collected.
+type session struct {
+	transport Transport
+	params    Params
+	pending   map[int][]*Message
+}
+
+func newSession(transport Transport, params Params) *session {
+	return &session{transport: transport, params: params, pending: make(map[int][]*Message)}
+}
+
+func (s *session) send(ctx context.Context, round int, to int, payload []byte) error {
+	return s.transport.Send(ctx, &Message{
+		Session: s.params.Session,
+		Round:   round,
+		From:    s.params.Index,
+		To:      to,
+		Payload: payload,
+	})
+}
+
+// collect waits for one message of round from every other party
+func (s *session) collect(ctx context.Context, round int) (map[int]*Message, error) {
+	messages := make(map[int]*Message, s.params.Parties-1)
+	accept := func(msg *Message) {
+		if msg.From < 1 || msg.From > s.params.Parties || msg.From == s.params.Index {
+			return
+		}
+		if _, ok := messages[msg.From]; !ok {
+			messages[msg.From] = msg
+		}
+	}
+	for _, msg := range s.pending[round] {
+		accept(msg)
+	}
+	delete(s.pending, round)
+	for len(messages) < s.params.Parties-1 {
+		msg, err := s.transport.Receive(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("tss: waiting for round %d: %w", round, err)
+		}
+		switch {
+		case msg.Session != s.params.Session || msg.Round < round:
+			continue
+		case msg.Round > round:
+			s.pending[msg.Round] = append(s.pending[msg.Round], msg)
+		default:
+			accept(msg)
+		}
+	}
+	return messages, nil
+}
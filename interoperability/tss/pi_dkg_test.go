@@ -0,0 +1,377 @@
+package tss
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"pi/crypto/bls"
+)
+
+// memoryTransport connects parties running in the same process
+type memoryTransport struct {
+	index   int
+	inboxes []chan *Message
+	// tamper, if set, may rewrite outgoing messages
+	tamper func(msg *Message)
+}
+
+func newMemoryNetwork(n int) []*memoryTransport {
+	inboxes := make([]chan *Message, n+1)
+	for i := range inboxes {
+		inboxes[i] = make(chan *Message, 16*n)
+	}
+	transports := make([]*memoryTransport, n)
+	for i := range transports {
+		transports[i] = &memoryTransport{index: i + 1, inboxes: inboxes}
+	}
+	return transports
+}
+
+func (t *memoryTransport) Send(ctx context.Context, msg *Message) error {
+	for to := 1; to < len(t.inboxes); to++ {
+		if to == t.index || (msg.To != Broadcast && msg.To != to) {
+			continue
+		}
+		copied := *msg
+		copied.To = to
+		if t.tamper != nil {
+			t.tamper(&copied)
+		}
+		select {
+		case t.inboxes[to] <- &copied:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (t *memoryTransport) Receive(ctx context.Context) (*Message, error) {
+	select {
+	case msg := <-t.inboxes[t.index]:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runParties runs fn for every party concurrently and returns the results by party
+func runParties(t *testing.T, transports []*memoryTransport, fn func(ctx context.Context, tr *memoryTransport) (*KeyShare, error)) ([]*KeyShare, []error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	shares := make([]*KeyShare, len(transports))
+	errs := make([]error, len(transports))
+	var wg sync.WaitGroup
+	for i, tr := range transports {
+		wg.Add(1)
+		go func(i int, tr *memoryTransport) {
+			defer wg.Done()
+			shares[i], errs[i] = fn(ctx, tr)
+		}(i, tr)
+	}
+	wg.Wait()
+	return shares, errs
+}
+
+func runTestDKG(t *testing.T, n int, threshold int) []*KeyShare {
+	transports := newMemoryNetwork(n)
+	shares, errs := runParties(t, transports, func(ctx context.Context, tr *memoryTransport) (*KeyShare, error) {
+		return RunDKG(ctx, tr, Params{Session: "dkg", Index: tr.index, Parties: n, Threshold: threshold})
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Expected RunDKG for party %d to succeed, but got error: %s", i+1, err)
+		}
+	}
+	return shares
+}
+
+func TestRunDKG(t *testing.T) {
+	shares := runTestDKG(t, 5, 3)
+	for _, share := range shares {
+		if !share.GroupKey.Equal(shares[0].GroupKey) {
+			t.Errorf("Expected party %d to agree on the group key", share.Index)
+		}
+		if !share.secret.PublicKey().Equal(shares[0].VerificationKeys[share.Index]) {
+			t.Errorf("Expected party %d's secret share to match its verification key", share.Index)
+		}
+		for party, key := range share.VerificationKeys {
+			if !key.Equal(shares[0].VerificationKeys[party]) {
+				t.Errorf("Expected party %d to agree on the verification key of party %d", share.Index, party)
+			}
+		}
+	}
+}
+
+func TestRunDKGDisqualifiesCheatingDealer(t *testing.T) {
+	transports := newMemoryNetwork(4)
+	// Party 1 sends party 2 a share that doesn't match its commitments, and
+	// reveals a bad share again when party 2 complains
+	transports[0].tamper = func(msg *Message) {
+		switch msg.Round {
+		case roundShares:
+			if msg.To == 2 {
+				msg.Payload = append([]byte(nil), msg.Payload...)
+				msg.Payload[len(msg.Payload)-1] ^= 1
+			}
+		case roundJustifications:
+			msg.Payload = []byte(`{"shares":{}}`)
+		}
+	}
+	groupKey := recordGroupKey(t, transports)
+	shares, errs := runParties(t, transports, func(ctx context.Context, tr *memoryTransport) (*KeyShare, error) {
+		return RunDKG(ctx, tr, Params{Session: "dkg", Index: tr.index, Parties: 4, Threshold: 2})
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Expected RunDKG for party %d to succeed, but got error: %s", i+1, err)
+		}
+	}
+	expected := groupKey(2, 3, 4)
+	for _, share := range shares[1:] {
+		if !share.GroupKey.Equal(expected) {
+			t.Errorf("Expected party %d to disqualify the cheating dealer", share.Index)
+		}
+	}
+	// With party 1 disqualified, the group key is made of the other dealers' secrets only
+	message := []byte("unlock 10 PI")
+	var sigShares []*SignatureShare
+	for _, share := range shares[1:] {
+		sigShare, err := share.Sign(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigShares = append(sigShares, sigShare)
+	}
+	signature, err := shares[1].Combine(message, sigShares)
+	if err != nil {
+		t.Fatalf("Expected Combine to succeed, but got error: %s", err)
+	}
+	if !shares[1].GroupKey.Verify(message, signature) {
+		t.Errorf("Expected the combined signature to verify with the group key")
+	}
+}
+
+// recordGroupKey makes the transports record every dealer's commitment to its
+// secret, and returns a function that aggregates the recorded commitments of
+// the given dealers into the group key they would form
+func recordGroupKey(t *testing.T, transports []*memoryTransport) func(dealers ...int) *bls.PublicKey {
+	var mu sync.Mutex
+	constants := make(map[int]*bls.PublicKey)
+	for _, tr := range transports {
+		tamper := tr.tamper
+		tr.tamper = func(msg *Message) {
+			if tamper != nil {
+				tamper(msg)
+			}
+			if msg.Round != roundCommitments {
+				return
+			}
+			var p commitmentsPayload
+			if err := json.Unmarshal(msg.Payload, &p); err != nil {
+				return
+			}
+			pk, err := bls.PublicKeyFromBytes(p.Commitments[0])
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			constants[msg.From] = pk
+			mu.Unlock()
+		}
+	}
+	return func(dealers ...int) *bls.PublicKey {
+		mu.Lock()
+		defer mu.Unlock()
+		keys := make([]*bls.PublicKey, 0, len(dealers))
+		for _, dealer := range dealers {
+			keys = append(keys, constants[dealer])
+		}
+		groupKey, err := bls.AggregatePublicKeys(keys...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return groupKey
+	}
+}
+
+func TestRunDKGJustifiedComplaint(t *testing.T) {
+	transports := newMemoryNetwork(4)
+	// Party 1's share for party 2 is corrupted on the way, but party 1 reveals
+	// the right one when party 2 complains
+	transports[0].tamper = func(msg *Message) {
+		if msg.Round == roundShares && msg.To == 2 {
+			msg.Payload = append([]byte(nil), msg.Payload...)
+			msg.Payload[len(msg.Payload)-1] ^= 1
+		}
+	}
+	groupKey := recordGroupKey(t, transports)
+	shares, errs := runParties(t, transports, func(ctx context.Context, tr *memoryTransport) (*KeyShare, error) {
+		return RunDKG(ctx, tr, Params{Session: "dkg", Index: tr.index, Parties: 4, Threshold: 2})
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Expected RunDKG for party %d to succeed, but got error: %s", i+1, err)
+		}
+	}
+	expected := groupKey(1, 2, 3, 4)
+	for _, share := range shares {
+		if !share.GroupKey.Equal(expected) {
+			t.Errorf("Expected party %d to keep the justified dealer in the group key", share.Index)
+		}
+		if !share.secret.PublicKey().Equal(shares[0].VerificationKeys[share.Index]) {
+			t.Errorf("Expected party %d's secret share to match its verification key", share.Index)
+		}
+	}
+}
+
+func TestRunDKGFalseComplaint(t *testing.T) {
+	transports := newMemoryNetwork(4)
+	// Party 2 complains about party 1, which dealt it a valid share
+	transports[1].tamper = func(msg *Message) {
+		if msg.Round == roundComplaints {
+			msg.Payload = []byte(`{"dealers":[1]}`)
+		}
+	}
+	groupKey := recordGroupKey(t, transports)
+	shares, errs := runParties(t, transports, func(ctx context.Context, tr *memoryTransport) (*KeyShare, error) {
+		return RunDKG(ctx, tr, Params{Session: "dkg", Index: tr.index, Parties: 4, Threshold: 2})
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Expected RunDKG for party %d to succeed, but got error: %s", i+1, err)
+		}
+	}
+	expected := groupKey(1, 2, 3, 4)
+	for _, share := range shares {
+		if !share.GroupKey.Equal(expected) {
+			t.Errorf("Expected party %d not to disqualify a dealer over a false complaint", share.Index)
+		}
+	}
+}
+
+func TestRunDKGInvalidParams(t *testing.T) {
+	transports := newMemoryNetwork(3)
+	for _, params := range []Params{
+		{Index: 1, Parties: 3, Threshold: 4},
+		{Index: 0, Parties: 3, Threshold: 2},
+		{Index: 4, Parties: 3, Threshold: 2},
+		{Index: 1, Parties: 3, Threshold: 0},
+	} {
+		if _, err := RunDKG(context.Background(), transports[0], params); err != ErrInvalidParams {
+			t.Errorf("Expected ErrInvalidParams for %+v, but got %v", params, err)
+		}
+	}
+}
+
+func TestRunDKGMissingParty(t *testing.T) {
+	transports := newMemoryNetwork(3)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := RunDKG(ctx, transports[0], Params{Session: "dkg", Index: 1, Parties: 3, Threshold: 2})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected RunDKG to time out without the other parties, but got %v", err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	shares := runTestDKG(t, 4, 3)
+	transports := newMemoryNetwork(4)
+	refreshed, errs := runParties(t, transports, func(ctx context.Context, tr *memoryTransport) (*KeyShare, error) {
+		return Refresh(ctx, tr, "refresh", shares[tr.index-1])
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Expected Refresh for party %d to succeed, but got error: %s", i+1, err)
+		}
+	}
+
+	message := []byte("unlock 10 PI")
+	sign := func(keyShares ...*KeyShare) []*SignatureShare {
+		var sigShares []*SignatureShare
+		for _, share := range keyShares {
+			sigShare, err := share.Sign(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sigShares = append(sigShares, sigShare)
+		}
+		return sigShares
+	}
+
+	for i, share := range refreshed {
+		if !share.GroupKey.Equal(shares[0].GroupKey) {
+			t.Errorf("Expected party %d to keep the group key", share.Index)
+		}
+		if share.secret.Int().Cmp(shares[i].secret.Int()) == 0 {
+			t.Errorf("Expected party %d's share to change", share.Index)
+		}
+		if !share.secret.PublicKey().Equal(refreshed[0].VerificationKeys[share.Index]) {
+			t.Errorf("Expected party %d's refreshed share to match its verification key", share.Index)
+		}
+	}
+
+	signature, err := refreshed[0].Combine(message, sign(refreshed[1], refreshed[2], refreshed[3]))
+	if err != nil {
+		t.Fatalf("Expected Combine with refreshed shares to succeed, but got error: %s", err)
+	}
+	if !refreshed[0].GroupKey.Verify(message, signature) {
+		t.Errorf("Expected the signature from refreshed shares to verify with the group key")
+	}
+
+	// Old and new shares are points on different polynomials and don't combine
+	mixed := sign(shares[0], refreshed[1], refreshed[2])
+	combined, err := interpolate(mixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares[0].GroupKey.Verify(message, combined) {
+		t.Errorf("Expected a signature mixing old and refreshed shares not to verify")
+	}
+}
+
+func TestRefreshThresholdOne(t *testing.T) {
+	shares := runTestDKG(t, 2, 1)
+	if _, err := Refresh(context.Background(), newMemoryNetwork(2)[0], "refresh", shares[0]); err != ErrInvalidParams {
+		t.Errorf("Expected ErrInvalidParams refreshing a 1-of-2 key, but got %v", err)
+	}
+}
+
+func TestSessionBuffersEarlyRounds(t *testing.T) {
+	transports := newMemoryNetwork(2)
+	ctx := context.Background()
+	for _, msg := range []*Message{
+		{Session: "other", Round: 1, From: 2, To: 1, Payload: []byte("ignored")},
+		{Session: "s", Round: 2, From: 2, To: 1, Payload: []byte("second")},
+		{Session: "s", Round: 1, From: 2, To: 1, Payload: []byte("first")},
+	} {
+		if err := transports[1].Send(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := newSession(transports[0], Params{Session: "s", Index: 1, Parties: 2, Threshold: 1})
+	for round, want := range []string{"first", "second"} {
+		messages, err := s.collect(ctx, round+1)
+		if err != nil {
+			t.Fatalf("Expected collect to succeed, but got error: %s", err)
+		}
+		if got := string(messages[2].Payload); got != want {
+			t.Errorf("Expected round %d payload %q, but got %q", round+1, want, got)
+		}
+	}
+}
+
+// interpolate combines signature shares without verifying them first
+func interpolate(shares []*SignatureShare) (*bls.Signature, error) {
+	indices := make([]int, len(shares))
+	signatures := make([]*bls.Signature, len(shares))
+	for i, share := range shares {
+		indices[i] = share.Index
+		signatures[i] = share.Signature
+	}
+	return bls.LinearCombinationSignatures(signatures, lagrangeCoefficients(indices))
+}
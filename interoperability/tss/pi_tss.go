@@ -0,0 +1,116 @@
+package tss
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"pi/crypto/bls"
+)
+
+// Threshold BLS signatures for bridge custody. A committee of n parties runs
+// the DKG in pi_dkg.go to share a group key so that any Threshold of them can
+// sign for it, while fewer learn nothing about the group secret. Signatures
+// combined from shares are ordinary BLS signatures and verify with
+// GroupKey.Verify like any other key.
+
+var (
+	// ErrNotEnoughShares is returned when fewer than Threshold distinct shares are combined
+	ErrNotEnoughShares = errors.New("tss: not enough signature shares")
+
+	// ErrInvalidShare is returned for signature shares that don't verify against the signer's verification key
+	ErrInvalidShare = errors.New("tss: invalid signature share")
+)
+
+// KeyShare is one party's share of a group key
+type KeyShare struct {
+	// Index identifies the party, from 1 to the number of parties
+	Index int
+	// Threshold is the number of shares needed to sign
+	Threshold int
+	// GroupKey verifies signatures combined from shares
+	GroupKey *bls.PublicKey
+	// VerificationKeys holds each party's public share, used to check their signature shares
+	VerificationKeys map[int]*bls.PublicKey
+
+	secret *bls.SecretKey
+}
+
+// SignatureShare is one party's partial signature over a message
+type SignatureShare struct {
+	Index     int
+	Signature *bls.Signature
+}
+
+// Parties returns the number of parties holding shares of the group key
+func (ks *KeyShare) Parties() int {
+	return len(ks.VerificationKeys)
+}
+
+// Sign produces this party's signature share over message
+func (ks *KeyShare) Sign(message []byte) (*SignatureShare, error) {
+	signature, err := ks.secret.Sign(message)
+	if err != nil {
+		return nil, err
+	}
+	return &SignatureShare{Index: ks.Index, Signature: signature}, nil
+}
+
+// VerifyShare checks a signature share against the verification key of the
+// party that produced it
+func (ks *KeyShare) VerifyShare(message []byte, share *SignatureShare) error {
+	key, ok := ks.VerificationKeys[share.Index]
+	if !ok {
+		return fmt.Errorf("tss: unknown party %d", share.Index)
+	}
+	if !key.Verify(message, share.Signature) {
+		return ErrInvalidShare
+	}
+	return nil
+}
+
+// Combine verifies the signature shares and interpolates Threshold of them
+// into a signature by the group key. Invalid and duplicate shares are
+// skipped, so a coordinator can pass in everything it received.
+func (ks *KeyShare) Combine(message []byte, shares []*SignatureShare) (*bls.Signature, error) {
+	seen := make(map[int]bool)
+	indices := make([]int, 0, ks.Threshold)
+	signatures := make([]*bls.Signature, 0, ks.Threshold)
+	for _, share := range shares {
+		if len(indices) == ks.Threshold {
+			break
+		}
+		if seen[share.Index] || ks.VerifyShare(message, share) != nil {
+			continue
+		}
+		seen[share.Index] = true
+		indices = append(indices, share.Index)
+		signatures = append(signatures, share.Signature)
+	}
+	if len(indices) < ks.Threshold {
+		return nil, ErrNotEnoughShares
+	}
+	return bls.LinearCombinationSignatures(signatures, lagrangeCoefficients(indices))
+}
+
+// lagrangeCoefficients returns the coefficients that interpolate a
+// polynomial's value at zero from its values at indices
+func lagrangeCoefficients(indices []int) []*big.Int {
+	order := bls.Order()
+	coeffs := make([]*big.Int, len(indices))
+	for i, xi := range indices {
+		num := big.NewInt(1)
+		den := big.NewInt(1)
+		for _, xj := range indices {
+			if xj == xi {
+				continue
+			}
+			num.Mul(num, big.NewInt(int64(xj)))
+			num.Mod(num, order)
+			den.Mul(den, big.NewInt(int64(xj-xi)))
+			den.Mod(den, order)
+		}
+		coeffs[i] = num.Mul(num, den.ModInverse(den, order)).Mod(num, order)
+	}
+	return coeffs
+}
@@ -0,0 +1,100 @@
+package tss
+
+import (
+	"math/big"
+	"testing"
+
+	"pi/crypto/bls"
+)
+
+func signShares(t *testing.T, shares []*KeyShare, message []byte) []*SignatureShare {
+	sigShares := make([]*SignatureShare, len(shares))
+	for i, share := range shares {
+		sigShare, err := share.Sign(message)
+		if err != nil {
+			t.Fatalf("Expected Sign for party %d to succeed, but got error: %s", share.Index, err)
+		}
+		sigShares[i] = sigShare
+	}
+	return sigShares
+}
+
+func TestCombine(t *testing.T) {
+	shares := runTestDKG(t, 5, 3)
+	message := []byte("unlock 10 PI")
+	sigShares := signShares(t, shares, message)
+
+	// Any three of the five parties can sign
+	for _, subset := range [][]int{{0, 1, 2}, {2, 3, 4}, {0, 2, 4}, {4, 1, 3}} {
+		var selected []*SignatureShare
+		for _, i := range subset {
+			selected = append(selected, sigShares[i])
+		}
+		signature, err := shares[0].Combine(message, selected)
+		if err != nil {
+			t.Errorf("Expected Combine with parties %v to succeed, but got error: %s", subset, err)
+			continue
+		}
+		if !shares[0].GroupKey.Verify(message, signature) {
+			t.Errorf("Expected the signature from parties %v to verify with the group key", subset)
+		}
+	}
+}
+
+func TestCombineNotEnoughShares(t *testing.T) {
+	shares := runTestDKG(t, 4, 3)
+	message := []byte("unlock 10 PI")
+	sigShares := signShares(t, shares, message)
+
+	// A duplicated share doesn't count twice
+	if _, err := shares[0].Combine(message, []*SignatureShare{sigShares[0], sigShares[1], sigShares[1]}); err != ErrNotEnoughShares {
+		t.Errorf("Expected ErrNotEnoughShares, but got %v", err)
+	}
+}
+
+func TestCombineSkipsInvalidShares(t *testing.T) {
+	shares := runTestDKG(t, 4, 2)
+	message := []byte("unlock 10 PI")
+	sigShares := signShares(t, shares, message)
+
+	// Party 1 signs something else
+	forged, err := shares[0].Sign([]byte("unlock 1000 PI"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shares[1].VerifyShare(message, forged); err != ErrInvalidShare {
+		t.Errorf("Expected ErrInvalidShare, but got %v", err)
+	}
+	signature, err := shares[1].Combine(message, []*SignatureShare{forged, sigShares[2], sigShares[3]})
+	if err != nil {
+		t.Fatalf("Expected Combine to succeed, but got error: %s", err)
+	}
+	if !shares[1].GroupKey.Verify(message, signature) {
+		t.Errorf("Expected the combined signature to verify with the group key")
+	}
+}
+
+func TestVerifyShareUnknownParty(t *testing.T) {
+	shares := runTestDKG(t, 3, 2)
+	share, err := shares[0].Sign([]byte("unlock 10 PI"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	share.Index = 7
+	if err := shares[0].VerifyShare([]byte("unlock 10 PI"), share); err == nil {
+		t.Errorf("Expected VerifyShare to reject a share from an unknown party")
+	}
+}
+
+func TestLagrangeCoefficients(t *testing.T) {
+	// f(x) = 7 + 3x + 2x^2, interpolated at zero from f(1), f(3) and f(4)
+	coeffs := []*big.Int{big.NewInt(7), big.NewInt(3), big.NewInt(2)}
+	indices := []int{1, 3, 4}
+	sum := new(big.Int)
+	for i, lambda := range lagrangeCoefficients(indices) {
+		sum.Add(sum, new(big.Int).Mul(lambda, evaluatePolynomial(coeffs, indices[i])))
+	}
+	if sum.Mod(sum, bls.Order()).Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("Expected interpolation at zero to give 7, but got %s", sum)
+	}
+}
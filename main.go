@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"math"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/spf13/viper"
 	"golang.org/x/exp/rand"
 
+	"pi/interoperability/relayer"
 	"pi/utils"
 )
 
@@ -20,6 +26,10 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "relayer" {
+		runRelayer(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
 	// Load configuration from file
@@ -47,3 +57,36 @@ func main() {
 	fmt.Println(" Num workers:", *numWorkers)
 	fmt.Println(" Config file:", *configFile)
 }
+
+// runRelayer runs the packet relayer between the chains and channels of its
+// configuration file until interrupted
+func runRelayer(args []string) {
+	flags := flag.NewFlagSet("relayer", flag.ExitOnError)
+	relayerConfig := flags.String("config", "relayer.yaml", "Path to the relayer configuration file")
+	flags.Parse(args)
+
+	viper.SetConfigFile(*relayerConfig)
+	err := viper.ReadInConfig()
+	if err!= nil {
+		log.Fatal(err)
+	}
+	var config relayer.FileConfig
+	err = viper.Unmarshal(&config)
+	if err!= nil {
+		log.Fatal(err)
+	}
+
+	r, err := relayer.Dial(&config)
+	if err!= nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Relaying %d paths between %d chains", len(config.Paths), len(config.Chains))
+	err = r.Run(ctx)
+	if err!= nil && !errors.Is(err, context.Canceled) {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,576 @@
+package blocksync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+
+	piprotocol "pi/network/protocol"
+)
+
+const (
+	// SyncProtocolID is the libp2p protocol used for block sync requests
+	SyncProtocolID = "/pi/sync/1.0.0"
+
+	// DefaultHeaderBatchSize is the number of headers requested per round trip
+	DefaultHeaderBatchSize = 128
+
+	// DefaultBodyBatchSize is the number of bodies requested from a single peer at a time
+	DefaultBodyBatchSize = 32
+
+	// DefaultRequestTimeout bounds a single request to a peer
+	DefaultRequestTimeout = 15 * time.Second
+)
+
+const (
+	requestStatus  = "status"
+	requestHeaders = "headers"
+	requestBodies  = "bodies"
+)
+
+var (
+	// ErrNoPeers is returned when there is no peer to sync from
+	ErrNoPeers = errors.New("blocksync: no peers available")
+
+	// ErrInvalidChain is returned when a peer serves headers that don't link up
+	ErrInvalidChain = errors.New("blocksync: invalid header chain")
+
+	// ErrBodyMismatch is returned when a body doesn't match its header
+	ErrBodyMismatch = errors.New("blocksync: body does not match header")
+)
+
+// Header is the part of a block that is downloaded first and validated as a chain
+type Header struct {
+	Height     uint64 `json:"height"`
+	Hash       []byte `json:"hash"`
+	ParentHash []byte `json:"parent_hash"`
+	BodyHash   []byte `json:"body_hash"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// ComputeHash returns the hash the header should carry in its Hash field
+func (h *Header) ComputeHash() []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[:8], h.Height)
+	binary.BigEndian.PutUint64(buf[8:], uint64(h.Timestamp))
+	hash := sha256.New()
+	hash.Write(buf)
+	hash.Write(h.ParentHash)
+	hash.Write(h.BodyHash)
+	return hash.Sum(nil)
+}
+
+// Body holds the transactions of a block
+type Body struct {
+	Transactions [][]byte `json:"transactions"`
+}
+
+// Hash returns the hash committed to by Header.BodyHash
+func (b *Body) Hash() []byte {
+	hash := sha256.New()
+	for _, tx := range b.Transactions {
+		txHash := sha256.Sum256(tx)
+		hash.Write(txHash[:])
+	}
+	return hash.Sum(nil)
+}
+
+// Block is a header together with its body
+type Block struct {
+	Header *Header `json:"header"`
+	Body   *Body   `json:"body"`
+}
+
+// Chain is the local block store the syncer reads from and imports into
+type Chain interface {
+	// Head returns the header of the latest imported block
+	Head() (*Header, error)
+	// HeaderByHeight returns the header at the given height
+	HeaderByHeight(height uint64) (*Header, error)
+	// BodyByHeight returns the body at the given height
+	BodyByHeight(height uint64) (*Body, error)
+	// ImportBlock appends a validated block on top of the current head
+	ImportBlock(block *Block) error
+}
+
+// Fetcher retrieves chain data from remote peers
+type Fetcher interface {
+	Status(ctx context.Context, p peer.ID) (*Header, error)
+	Headers(ctx context.Context, p peer.ID, from uint64, count uint64) ([]*Header, error)
+	Bodies(ctx context.Context, p peer.ID, heights []uint64) ([]*Body, error)
+}
+
+// Progress reports how far a sync has come
+type Progress struct {
+	Syncing       bool      `json:"syncing"`
+	StartHeight   uint64    `json:"start_height"`
+	CurrentHeight uint64    `json:"current_height"`
+	TargetHeight  uint64    `json:"target_height"`
+	PeersInUse    []peer.ID `json:"peers_in_use"`
+	LastError     string    `json:"last_error,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Syncer downloads the chain from peers and imports it into the local Chain
+type Syncer struct {
+	host    host.Host
+	chain   Chain
+	fetcher Fetcher
+	peers   func() []peer.ID
+
+	HeaderBatchSize uint64
+	BodyBatchSize   uint64
+
+	mu       sync.RWMutex
+	progress Progress
+	running  bool
+}
+
+// NewSyncer creates a Syncer that talks to peers over libp2p streams
+func NewSyncer(h host.Host, chain Chain) *Syncer {
+	s := NewSyncerWithFetcher(chain, &streamFetcher{host: h}, func() []peer.ID {
+		return h.Network().Peers()
+	})
+	s.host = h
+	return s
+}
+
+// NewSyncerWithFetcher creates a Syncer using a custom Fetcher and peer source
+func NewSyncerWithFetcher(chain Chain, fetcher Fetcher, peers func() []peer.ID) *Syncer {
+	return &Syncer{
+		chain:           chain,
+		fetcher:         fetcher,
+		peers:           peers,
+		HeaderBatchSize: DefaultHeaderBatchSize,
+		BodyBatchSize:   DefaultBodyBatchSize,
+	}
+}
+
+// Start registers the sync protocol handler so peers can sync from us
+func (s *Syncer) Start(ctx context.Context) error {
+	if s.host == nil {
+		return errors.New("blocksync: syncer has no host")
+	}
+	s.host.SetStreamHandler(protocol.ID(SyncProtocolID), s.HandleStream)
+	return nil
+}
+
+// Progress returns a snapshot of the current sync progress
+func (s *Syncer) Progress() Progress {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p := s.progress
+	p.PeersInUse = append([]peer.ID(nil), s.progress.PeersInUse...)
+	return p
+}
+
+// HandleProgress serves the current sync progress as JSON
+func (s *Syncer) HandleProgress(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Progress())
+}
+
+func (s *Syncer) updateProgress(update func(p *Progress)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.progress)
+	s.progress.UpdatedAt = time.Now()
+}
+
+// Sync downloads and imports blocks until the local head reaches the best
+// height advertised by connected peers. It always resumes from the local
+// head, so calling it again after an interruption continues where the
+// previous run stopped.
+func (s *Syncer) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return errors.New("blocksync: sync already running")
+	}
+	s.running = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.progress.Syncing = false
+		s.mu.Unlock()
+	}()
+
+	err := s.sync(ctx)
+	if err!= nil {
+		s.updateProgress(func(p *Progress) {
+			p.LastError = err.Error()
+		})
+	}
+	return err
+}
+
+func (s *Syncer) sync(ctx context.Context) error {
+	head, err := s.chain.Head()
+	if err!= nil {
+		return err
+	}
+	target, peers := s.selectPeers(ctx, head.Height)
+	s.updateProgress(func(p *Progress) {
+		p.Syncing = len(peers) > 0
+		p.StartHeight = head.Height
+		p.CurrentHeight = head.Height
+		p.TargetHeight = target
+		p.PeersInUse = peers
+		p.LastError = ""
+	})
+	if len(peers) == 0 {
+		if len(s.peers()) == 0 {
+			return ErrNoPeers
+		}
+		return nil
+	}
+
+	for head.Height < target {
+		count := target - head.Height
+		if count > s.HeaderBatchSize {
+			count = s.HeaderBatchSize
+		}
+		headers, err := s.fetchHeaders(ctx, peers, head, count)
+		if err!= nil {
+			return err
+		}
+		bodies, err := s.fetchBodies(ctx, peers, headers)
+		if err!= nil {
+			return err
+		}
+		for i, header := range headers {
+			err = s.chain.ImportBlock(&Block{Header: header, Body: bodies[i]})
+			if err!= nil {
+				return fmt.Errorf("blocksync: importing block %d: %w", header.Height, err)
+			}
+			head = header
+			s.updateProgress(func(p *Progress) {
+				p.CurrentHeight = header.Height
+			})
+		}
+	}
+	return nil
+}
+
+// selectPeers asks every connected peer for its head and returns the best
+// height along with the peers that are ahead of the local chain
+func (s *Syncer) selectPeers(ctx context.Context, localHeight uint64) (uint64, []peer.ID) {
+	type status struct {
+		id     peer.ID
+		height uint64
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		statuses []status
+	)
+	for _, id := range s.peers() {
+		wg.Add(1)
+		go func(id peer.ID) {
+			defer wg.Done()
+			reqCtx, cancel := context.WithTimeout(ctx, DefaultRequestTimeout)
+			defer cancel()
+			head, err := s.fetcher.Status(reqCtx, id)
+			if err!= nil || head.Height <= localHeight {
+				return
+			}
+			mu.Lock()
+			statuses = append(statuses, status{id: id, height: head.Height})
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].height > statuses[j].height
+	})
+	var (
+		target uint64
+		peers  []peer.ID
+	)
+	for _, st := range statuses {
+		if st.height > target {
+			target = st.height
+		}
+		peers = append(peers, st.id)
+	}
+	return target, peers
+}
+
+// fetchHeaders downloads count headers on top of parent, trying each peer in
+// turn until one serves a valid, linked range
+func (s *Syncer) fetchHeaders(ctx context.Context, peers []peer.ID, parent *Header, count uint64) ([]*Header, error) {
+	var lastErr error
+	for _, id := range peers {
+		reqCtx, cancel := context.WithTimeout(ctx, DefaultRequestTimeout)
+		headers, err := s.fetcher.Headers(reqCtx, id, parent.Height+1, count)
+		cancel()
+		if err == nil {
+			err = validateHeaders(parent, headers, count)
+		}
+		if err == nil {
+			return headers, nil
+		}
+		if ctx.Err()!= nil {
+			return nil, ctx.Err()
+		}
+		lastErr = fmt.Errorf("peer %s: %w", id, err)
+	}
+	return nil, lastErr
+}
+
+func validateHeaders(parent *Header, headers []*Header, count uint64) error {
+	if len(headers) == 0 || uint64(len(headers)) > count {
+		return fmt.Errorf("%w: got %d headers, requested %d", ErrInvalidChain, len(headers), count)
+	}
+	prev := parent
+	for _, h := range headers {
+		if h.Height!= prev.Height+1 {
+			return fmt.Errorf("%w: expected height %d, got %d", ErrInvalidChain, prev.Height+1, h.Height)
+		}
+		if!bytes.Equal(h.ParentHash, prev.Hash) {
+			return fmt.Errorf("%w: parent hash mismatch at height %d", ErrInvalidChain, h.Height)
+		}
+		if!bytes.Equal(h.Hash, h.ComputeHash()) {
+			return fmt.Errorf("%w: bad hash at height %d", ErrInvalidChain, h.Height)
+		}
+		prev = h
+	}
+	return nil
+}
+
+// fetchBodies downloads the bodies for headers in parallel, spreading batches
+// across peers and retrying a failed batch on the other peers
+func (s *Syncer) fetchBodies(ctx context.Context, peers []peer.ID, headers []*Header) ([]*Body, error) {
+	bodies := make([]*Body, len(headers))
+	batchSize := int(s.BodyBatchSize)
+	if batchSize <= 0 {
+		batchSize = DefaultBodyBatchSize
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for start, n := 0, 0; start < len(headers); start, n = start+batchSize, n+1 {
+		end := start + batchSize
+		if end > len(headers) {
+			end = len(headers)
+		}
+		wg.Add(1)
+		go func(batch []*Header, offset int, first int) {
+			defer wg.Done()
+			fetched, err := s.fetchBodyBatch(ctx, peers, first, batch)
+			if err!= nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+				return
+			}
+			copy(bodies[offset:], fetched)
+		}(headers[start:end], start, n%len(peers))
+	}
+	wg.Wait()
+	if firstErr!= nil {
+		return nil, firstErr
+	}
+	return bodies, nil
+}
+
+func (s *Syncer) fetchBodyBatch(ctx context.Context, peers []peer.ID, first int, headers []*Header) ([]*Body, error) {
+	heights := make([]uint64, len(headers))
+	for i, h := range headers {
+		heights[i] = h.Height
+	}
+	var lastErr error
+	for i := range peers {
+		id := peers[(first+i)%len(peers)]
+		reqCtx, cancel := context.WithTimeout(ctx, DefaultRequestTimeout)
+		bodies, err := s.fetcher.Bodies(reqCtx, id, heights)
+		cancel()
+		if err == nil {
+			err = validateBodies(headers, bodies)
+		}
+		if err == nil {
+			return bodies, nil
+		}
+		if ctx.Err()!= nil {
+			return nil, ctx.Err()
+		}
+		lastErr = fmt.Errorf("peer %s: %w", id, err)
+	}
+	return nil, lastErr
+}
+
+func validateBodies(headers []*Header, bodies []*Body) error {
+	if len(bodies)!= len(headers) {
+		return fmt.Errorf("%w: got %d bodies, requested %d", ErrBodyMismatch, len(bodies), len(headers))
+	}
+	for i, body := range bodies {
+		if body == nil ||!bytes.Equal(body.Hash(), headers[i].BodyHash) {
+			return fmt.Errorf("%w at height %d", ErrBodyMismatch, headers[i].Height)
+		}
+	}
+	return nil
+}
+
+// syncRequest is sent by a syncing node over a SyncProtocolID stream
+type syncRequest struct {
+	Type    string   `json:"type"`
+	From    uint64   `json:"from,omitempty"`
+	Count   uint64   `json:"count,omitempty"`
+	Heights []uint64 `json:"heights,omitempty"`
+}
+
+// syncResponse is the reply to a syncRequest
+type syncResponse struct {
+	Head    *Header   `json:"head,omitempty"`
+	Headers []*Header `json:"headers,omitempty"`
+	Bodies  []*Body   `json:"bodies,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// HandleStream serves a single sync request from a remote peer
+func (s *Syncer) HandleStream(stream network.Stream) {
+	defer stream.Close()
+	data, err := piprotocol.ReadMessage(stream)
+	if err!= nil {
+		stream.Reset()
+		return
+	}
+	var req syncRequest
+	var resp syncResponse
+	if err := json.Unmarshal(data, &req); err!= nil {
+		resp.Error = err.Error()
+	} else if err := s.serve(&req, &resp); err!= nil {
+		resp.Error = err.Error()
+	}
+	data, err = json.Marshal(&resp)
+	if err!= nil {
+		stream.Reset()
+		return
+	}
+	piprotocol.WriteMessage(stream, data)
+}
+
+func (s *Syncer) serve(req *syncRequest, resp *syncResponse) error {
+	switch req.Type {
+	case requestStatus:
+		head, err := s.chain.Head()
+		if err!= nil {
+			return err
+		}
+		resp.Head = head
+	case requestHeaders:
+		count := req.Count
+		if count > DefaultHeaderBatchSize {
+			count = DefaultHeaderBatchSize
+		}
+		head, err := s.chain.Head()
+		if err!= nil {
+			return err
+		}
+		for height := req.From; height < req.From+count && height <= head.Height; height++ {
+			header, err := s.chain.HeaderByHeight(height)
+			if err!= nil {
+				return err
+			}
+			resp.Headers = append(resp.Headers, header)
+		}
+	case requestBodies:
+		if len(req.Heights) > DefaultHeaderBatchSize {
+			return fmt.Errorf("too many bodies requested: %d", len(req.Heights))
+		}
+		for _, height := range req.Heights {
+			body, err := s.chain.BodyByHeight(height)
+			if err!= nil {
+				return err
+			}
+			resp.Bodies = append(resp.Bodies, body)
+		}
+	default:
+		return fmt.Errorf("unknown sync request type: %s", req.Type)
+	}
+	return nil
+}
+
+// streamFetcher implements Fetcher over SyncProtocolID streams
+type streamFetcher struct {
+	host host.Host
+}
+
+func (f *streamFetcher) Status(ctx context.Context, p peer.ID) (*Header, error) {
+	resp, err := f.request(ctx, p, &syncRequest{Type: requestStatus})
+	if err!= nil {
+		return nil, err
+	}
+	if resp.Head == nil {
+		return nil, errors.New("blocksync: peer returned no head")
+	}
+	return resp.Head, nil
+}
+
+func (f *streamFetcher) Headers(ctx context.Context, p peer.ID, from uint64, count uint64) ([]*Header, error) {
+	resp, err := f.request(ctx, p, &syncRequest{Type: requestHeaders, From: from, Count: count})
+	if err!= nil {
+		return nil, err
+	}
+	return resp.Headers, nil
+}
+
+func (f *streamFetcher) Bodies(ctx context.Context, p peer.ID, heights []uint64) ([]*Body, error) {
+	resp, err := f.request(ctx, p, &syncRequest{Type: requestBodies, Heights: heights})
+	if err!= nil {
+		return nil, err
+	}
+	return resp.Bodies, nil
+}
+
+func (f *streamFetcher) request(ctx context.Context, p peer.ID, req *syncRequest) (*syncResponse, error) {
+	stream, err := f.host.NewStream(ctx, p, protocol.ID(SyncProtocolID))
+	if err!= nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+	data, err := json.Marshal(req)
+	if err!= nil {
+		return nil, err
+	}
+	if err := piprotocol.WriteMessage(stream, data); err!= nil {
+		stream.Reset()
+		return nil, err
+	}
+	data, err = piprotocol.ReadMessage(stream)
+	if err!= nil {
+		stream.Reset()
+		return nil, err
+	}
+	var resp syncResponse
+	if err := json.Unmarshal(data, &resp); err!= nil {
+		return nil, err
+	}
+	if resp.Error!= "" {
+		return nil, fmt.Errorf("blocksync: remote error: %s", resp.Error)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,255 @@
+package blocksync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// memChain is an in-memory Chain used by the tests
+type memChain struct {
+	mu     sync.Mutex
+	blocks []*Block
+}
+
+func newMemChain(height uint64) *memChain {
+	genesis := &Header{Height: 0, BodyHash: (&Body{}).Hash()}
+	genesis.Hash = genesis.ComputeHash()
+	c := &memChain{blocks: []*Block{{Header: genesis, Body: &Body{}}}}
+	for i := uint64(1); i <= height; i++ {
+		c.ImportBlock(c.nextBlock())
+	}
+	return c
+}
+
+func (c *memChain) nextBlock() *Block {
+	parent := c.blocks[len(c.blocks)-1].Header
+	body := &Body{Transactions: [][]byte{[]byte(fmt.Sprintf("tx-%d", parent.Height+1))}}
+	header := &Header{
+		Height:     parent.Height + 1,
+		ParentHash: parent.Hash,
+		BodyHash:   body.Hash(),
+		Timestamp:  int64(parent.Height + 1),
+	}
+	header.Hash = header.ComputeHash()
+	return &Block{Header: header, Body: body}
+}
+
+func (c *memChain) Head() (*Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blocks[len(c.blocks)-1].Header, nil
+}
+
+func (c *memChain) HeaderByHeight(height uint64) (*Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height >= uint64(len(c.blocks)) {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	return c.blocks[height].Header, nil
+}
+
+func (c *memChain) BodyByHeight(height uint64) (*Body, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height >= uint64(len(c.blocks)) {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	return c.blocks[height].Body, nil
+}
+
+func (c *memChain) ImportBlock(block *Block) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if block.Header.Height!= uint64(len(c.blocks)) {
+		return fmt.Errorf("out of order import: %d", block.Header.Height)
+	}
+	c.blocks = append(c.blocks, block)
+	return nil
+}
+
+// memFetcher serves requests straight from other peers' memChains
+type memFetcher struct {
+	chains     map[peer.ID]*memChain
+	failBodies map[peer.ID]bool
+	failAfter  int
+	calls      int
+	mu         sync.Mutex
+}
+
+func (f *memFetcher) server(p peer.ID) (*Syncer, error) {
+	chain, ok := f.chains[p]
+	if!ok {
+		return nil, errors.New("peer gone")
+	}
+	return NewSyncerWithFetcher(chain, nil, nil), nil
+}
+
+func (f *memFetcher) Status(ctx context.Context, p peer.ID) (*Header, error) {
+	s, err := f.server(p)
+	if err!= nil {
+		return nil, err
+	}
+	var resp syncResponse
+	err = s.serve(&syncRequest{Type: requestStatus}, &resp)
+	return resp.Head, err
+}
+
+func (f *memFetcher) Headers(ctx context.Context, p peer.ID, from uint64, count uint64) ([]*Header, error) {
+	s, err := f.server(p)
+	if err!= nil {
+		return nil, err
+	}
+	var resp syncResponse
+	err = s.serve(&syncRequest{Type: requestHeaders, From: from, Count: count}, &resp)
+	return resp.Headers, err
+}
+
+func (f *memFetcher) Bodies(ctx context.Context, p peer.ID, heights []uint64) ([]*Body, error) {
+	f.mu.Lock()
+	f.calls++
+	calls := f.calls
+	f.mu.Unlock()
+	if f.failAfter > 0 && calls > f.failAfter {
+		return nil, errors.New("connection reset")
+	}
+	if f.failBodies[p] {
+		return []*Body{{Transactions: [][]byte{[]byte("forged")}}}, nil
+	}
+	s, err := f.server(p)
+	if err!= nil {
+		return nil, err
+	}
+	var resp syncResponse
+	err = s.serve(&syncRequest{Type: requestBodies, Heights: heights}, &resp)
+	return resp.Bodies, err
+}
+
+func (f *memFetcher) peerIDs() []peer.ID {
+	ids := make([]peer.ID, 0, len(f.chains))
+	for id := range f.chains {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestSync(t *testing.T) {
+	remote := newMemChain(300)
+	fetcher := &memFetcher{chains: map[peer.ID]*memChain{
+		peer.ID("peer-a"): remote,
+		peer.ID("peer-b"): remote,
+	}}
+	local := newMemChain(0)
+	syncer := NewSyncerWithFetcher(local, fetcher, fetcher.peerIDs)
+	syncer.BodyBatchSize = 10
+	err := syncer.Sync(context.Background())
+	if err!= nil {
+		t.Fatalf("Expected Sync to succeed, but got error: %s", err)
+	}
+	head, _ := local.Head()
+	if head.Height!= 300 {
+		t.Errorf("Expected local head at 300, but got %d", head.Height)
+	}
+	progress := syncer.Progress()
+	if progress.CurrentHeight!= 300 || progress.TargetHeight!= 300 {
+		t.Errorf("Expected progress 300/300, but got %d/%d", progress.CurrentHeight, progress.TargetHeight)
+	}
+	if len(progress.PeersInUse)!= 2 {
+		t.Errorf("Expected 2 peers in use, but got %d", len(progress.PeersInUse))
+	}
+	if progress.Syncing {
+		t.Errorf("Expected Syncing to be false after Sync returns")
+	}
+}
+
+func TestSyncResume(t *testing.T) {
+	remote := newMemChain(200)
+	fetcher := &memFetcher{
+		chains:    map[peer.ID]*memChain{peer.ID("peer-a"): remote},
+		failAfter: 3,
+	}
+	local := newMemChain(0)
+	syncer := NewSyncerWithFetcher(local, fetcher, fetcher.peerIDs)
+	syncer.HeaderBatchSize = 50
+	syncer.BodyBatchSize = 50
+	err := syncer.Sync(context.Background())
+	if err == nil {
+		t.Fatalf("Expected interrupted Sync to fail")
+	}
+	head, _ := local.Head()
+	if head.Height!= 150 {
+		t.Errorf("Expected local head at 150 after interruption, but got %d", head.Height)
+	}
+	if syncer.Progress().LastError == "" {
+		t.Errorf("Expected progress to record the last error")
+	}
+
+	fetcher.failAfter = 0
+	err = syncer.Sync(context.Background())
+	if err!= nil {
+		t.Fatalf("Expected resumed Sync to succeed, but got error: %s", err)
+	}
+	head, _ = local.Head()
+	if head.Height!= 200 {
+		t.Errorf("Expected local head at 200, but got %d", head.Height)
+	}
+	if syncer.Progress().StartHeight!= 150 {
+		t.Errorf("Expected resumed sync to start at 150, but got %d", syncer.Progress().StartHeight)
+	}
+}
+
+func TestSyncRejectsForgedBodies(t *testing.T) {
+	remote := newMemChain(40)
+	fetcher := &memFetcher{
+		chains:     map[peer.ID]*memChain{peer.ID("honest"): remote, peer.ID("forger"): remote},
+		failBodies: map[peer.ID]bool{peer.ID("forger"): true},
+	}
+	local := newMemChain(0)
+	syncer := NewSyncerWithFetcher(local, fetcher, fetcher.peerIDs)
+	syncer.BodyBatchSize = 5
+	err := syncer.Sync(context.Background())
+	if err!= nil {
+		t.Fatalf("Expected Sync to fall back to the honest peer, but got error: %s", err)
+	}
+	for height := uint64(1); height <= 40; height++ {
+		body, _ := local.BodyByHeight(height)
+		if string(body.Transactions[0])== "forged" {
+			t.Fatalf("Expected forged body at height %d to be rejected", height)
+		}
+	}
+}
+
+func TestValidateHeaders(t *testing.T) {
+	chain := newMemChain(3)
+	genesis, _ := chain.HeaderByHeight(0)
+	h1, _ := chain.HeaderByHeight(1)
+	h2, _ := chain.HeaderByHeight(2)
+	h3, _ := chain.HeaderByHeight(3)
+	err := validateHeaders(genesis, []*Header{h1, h2, h3}, 3)
+	if err!= nil {
+		t.Errorf("Expected validateHeaders to succeed, but got error: %s", err)
+	}
+	err = validateHeaders(genesis, []*Header{h1, h3}, 3)
+	if!errors.Is(err, ErrInvalidChain) {
+		t.Errorf("Expected gap to be rejected with ErrInvalidChain, but got %v", err)
+	}
+	tampered := *h2
+	tampered.Timestamp++
+	err = validateHeaders(genesis, []*Header{h1, &tampered}, 3)
+	if!errors.Is(err, ErrInvalidChain) {
+		t.Errorf("Expected tampered header to be rejected with ErrInvalidChain, but got %v", err)
+	}
+}
+
+func TestSyncNoPeers(t *testing.T) {
+	syncer := NewSyncerWithFetcher(newMemChain(0), &memFetcher{}, func() []peer.ID { return nil })
+	err := syncer.Sync(context.Background())
+	if err!= ErrNoPeers {
+		t.Errorf("Expected ErrNoPeers, but got %v", err)
+	}
+}
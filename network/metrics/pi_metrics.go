@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	libp2pmetrics "github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pi_network"
+
+// Direction labels for message counters
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// Unknown is the label recorded for message types and methods that were not
+// registered. Message types and method names come from peers, so only
+// registered values become label values.
+const Unknown = "unknown"
+
+// Metrics holds the Prometheus collectors for the network layer
+type Metrics struct {
+	registry *prometheus.Registry
+
+	// Bandwidth is passed to libp2p as the bandwidth reporter; its per
+	// protocol totals are exported as pi_network_bytes_total
+	Bandwidth *libp2pmetrics.BandwidthCounter
+
+	messages      *prometheus.CounterVec
+	messageErrors *prometheus.CounterVec
+	latency       *prometheus.HistogramVec
+
+	mu      sync.RWMutex
+	types   map[string]struct{}
+	methods map[string]struct{}
+	hosts   map[peer.ID]prometheus.Collector
+}
+
+// bytesDesc is declared before Default so that it is set when NewMetrics
+// registers the bandwidth collector
+var bytesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "bytes_total"),
+	"Bytes sent and received over libp2p streams, by protocol and direction.",
+	[]string{"protocol", "direction"}, nil,
+)
+
+// Default is the registry used by network/node and network/protocol
+var Default = NewMetrics()
+
+// NewMetrics creates a new set of network metrics on its own registry
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry:  prometheus.NewRegistry(),
+		Bandwidth: libp2pmetrics.NewBandwidthCounter(),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_total",
+			Help:      "Number of messages sent and received, by message type and direction.",
+		}, []string{"type", "direction"}),
+		messageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "message_errors_total",
+			Help:      "Number of messages that failed to be read, decoded or handled, by message type.",
+		}, []string{"type"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of requests to peers, by method.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, []string{"method"}),
+		types:   make(map[string]struct{}),
+		methods: make(map[string]struct{}),
+		hosts:   make(map[peer.ID]prometheus.Collector),
+	}
+	m.registry.MustRegister(
+		m.messages,
+		m.messageErrors,
+		m.latency,
+		&bandwidthCollector{counter: m.Bandwidth},
+		prometheus.NewGoCollector(),
+	)
+	return m
+}
+
+// TrackHost exports the number of peers connected to h until UntrackHost is called
+func (m *Metrics) TrackHost(h host.Host) error {
+	gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "peers_connected",
+		Help:        "Number of currently connected peers.",
+		ConstLabels: prometheus.Labels{"host": h.ID().Pretty()},
+	}, func() float64 {
+		return float64(len(h.Network().Peers()))
+	})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.registry.Register(gauge); err!= nil {
+		return err
+	}
+	m.hosts[h.ID()] = gauge
+	return nil
+}
+
+// UntrackHost stops exporting the peer count of h, which should be called
+// when h is closed. It reports whether h was tracked.
+func (m *Metrics) UntrackHost(h host.Host) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	gauge, ok := m.hosts[h.ID()]
+	if!ok {
+		return false
+	}
+	delete(m.hosts, h.ID())
+	return m.registry.Unregister(gauge)
+}
+
+// RegisterMessageTypes allows message types to be used as label values
+func (m *Metrics) RegisterMessageTypes(types ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range types {
+		m.types[t] = struct{}{}
+	}
+}
+
+// RegisterMethods allows request methods to be used as label values
+func (m *Metrics) RegisterMethods(methods ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, method := range methods {
+		m.methods[method] = struct{}{}
+	}
+}
+
+// label returns value if it is in known, and Unknown otherwise
+func (m *Metrics) label(known map[string]struct{}, value string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := known[value]; ok {
+		return value
+	}
+	return Unknown
+}
+
+// MessageReceived counts a received message of the given type
+func (m *Metrics) MessageReceived(msgType string) {
+	m.messages.WithLabelValues(m.label(m.types, msgType), DirectionIn).Inc()
+}
+
+// MessageSent counts a sent message of the given type
+func (m *Metrics) MessageSent(msgType string) {
+	m.messages.WithLabelValues(m.label(m.types, msgType), DirectionOut).Inc()
+}
+
+// MessageError counts a message of the given type that could not be processed
+func (m *Metrics) MessageError(msgType string) {
+	m.messageErrors.WithLabelValues(m.label(m.types, msgType)).Inc()
+}
+
+// ObserveLatency records how long a request for method took
+func (m *Metrics) ObserveLatency(method string, d time.Duration) {
+	m.latency.WithLabelValues(m.label(m.methods, method)).Observe(d.Seconds())
+}
+
+// Handler returns an HTTP handler serving the metrics in Prometheus format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Gatherer returns the underlying registry for tests and custom exporters
+func (m *Metrics) Gatherer() prometheus.Gatherer {
+	return m.registry
+}
+
+// bandwidthCollector exports libp2p's per-protocol bandwidth counters
+type bandwidthCollector struct {
+	counter *libp2pmetrics.BandwidthCounter
+}
+
+func (c *bandwidthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bytesDesc
+}
+
+func (c *bandwidthCollector) Collect(ch chan<- prometheus.Metric) {
+	for proto, stats := range c.counter.GetBandwidthByProtocol() {
+		ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.CounterValue, float64(stats.TotalIn), string(proto), DirectionIn)
+		ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.CounterValue, float64(stats.TotalOut), string(proto), DirectionOut)
+	}
+}
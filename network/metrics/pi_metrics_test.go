@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(rec.Body)
+	if err!= nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMessageCounters(t *testing.T) {
+	m := NewMetrics()
+	m.RegisterMessageTypes("hello", "data")
+	m.MessageReceived("hello")
+	m.MessageReceived("hello")
+	m.MessageSent("data")
+	m.MessageError("data")
+	if v := testutil.ToFloat64(m.messages.WithLabelValues("hello", DirectionIn)); v!= 2 {
+		t.Errorf("Expected 2 received hello messages, but got %v", v)
+	}
+	if v := testutil.ToFloat64(m.messages.WithLabelValues("data", DirectionOut)); v!= 1 {
+		t.Errorf("Expected 1 sent data message, but got %v", v)
+	}
+	if v := testutil.ToFloat64(m.messageErrors.WithLabelValues("data")); v!= 1 {
+		t.Errorf("Expected 1 data message error, but got %v", v)
+	}
+}
+
+func TestUnregisteredLabels(t *testing.T) {
+	m := NewMetrics()
+	m.MessageReceived("attacker-chosen-1")
+	m.MessageReceived("attacker-chosen-2")
+	m.MessageError("attacker-chosen-3")
+	m.ObserveLatency("attacker-chosen-4", time.Millisecond)
+	if v := testutil.ToFloat64(m.messages.WithLabelValues(Unknown, DirectionIn)); v!= 2 {
+		t.Errorf("Expected 2 received unknown messages, but got %v", v)
+	}
+	if v := testutil.ToFloat64(m.messageErrors.WithLabelValues(Unknown)); v!= 1 {
+		t.Errorf("Expected 1 unknown message error, but got %v", v)
+	}
+	body := scrape(t, m)
+	if strings.Contains(body, "attacker-chosen") {
+		t.Errorf("Expected unregistered values to be recorded as %q, but got:\n%s", Unknown, body)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	m := NewMetrics()
+	m.RegisterMethods("sync.headers")
+	m.ObserveLatency("sync.headers", 30*time.Millisecond)
+	m.ObserveLatency("sync.headers", 60*time.Millisecond)
+	body := scrape(t, m)
+	if!strings.Contains(body, `pi_network_request_duration_seconds_count{method="sync.headers"} 2`) {
+		t.Errorf("Expected latency histogram with 2 observations, but got:\n%s", body)
+	}
+}
+
+func TestBandwidthByProtocol(t *testing.T) {
+	m := NewMetrics()
+	m.Bandwidth.LogSentMessageStream(42, protocol.ID("/pi/1.0.0"), peer.ID("peer"))
+	m.Bandwidth.LogRecvMessageStream(7, protocol.ID("/pi/1.0.0"), peer.ID("peer"))
+
+	// libp2p's flow meters fold new samples into their totals periodically
+	var body string
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		body = scrape(t, m)
+		if strings.Contains(body, `pi_network_bytes_total{direction="out",protocol="/pi/1.0.0"} 42`) {
+			break
+		}
+	}
+	if!strings.Contains(body, `pi_network_bytes_total{direction="out",protocol="/pi/1.0.0"} 42`) {
+		t.Errorf("Expected 42 bytes out on /pi/1.0.0, but got:\n%s", body)
+	}
+	if!strings.Contains(body, `pi_network_bytes_total{direction="in",protocol="/pi/1.0.0"} 7`) {
+		t.Errorf("Expected 7 bytes in on /pi/1.0.0, but got:\n%s", body)
+	}
+}
+
+// fakeHost is the part of a host.Host that TrackHost uses
+type fakeHost struct {
+	host.Host
+	id    peer.ID
+	peers []peer.ID
+}
+
+func (h *fakeHost) ID() peer.ID { return h.id }
+
+func (h *fakeHost) Network() network.Network { return &fakeNetwork{peers: h.peers} }
+
+type fakeNetwork struct {
+	network.Network
+	peers []peer.ID
+}
+
+func (n *fakeNetwork) Peers() []peer.ID { return n.peers }
+
+func TestTrackHost(t *testing.T) {
+	m := NewMetrics()
+	h := &fakeHost{id: peer.ID("host"), peers: []peer.ID{"a", "b"}}
+	err := m.TrackHost(h)
+	if err!= nil {
+		t.Fatalf("Expected TrackHost to succeed, but got error: %s", err)
+	}
+	if!strings.Contains(scrape(t, m), "pi_network_peers_connected") {
+		t.Errorf("Expected the peer gauge to be exported")
+	}
+	if m.TrackHost(h) == nil {
+		t.Errorf("Expected tracking the same host twice to fail")
+	}
+	if!m.UntrackHost(h) {
+		t.Errorf("Expected UntrackHost to remove the tracked host")
+	}
+	if strings.Contains(scrape(t, m), "pi_network_peers_connected") {
+		t.Errorf("Expected the peer gauge to be removed")
+	}
+	if m.TrackHost(h)!= nil {
+		t.Errorf("Expected a host to be tracked again after UntrackHost")
+	}
+}
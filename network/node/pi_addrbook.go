@@ -0,0 +1,134 @@
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// AddressBook is a persistent store of peer addresses we have successfully
+// dialed, used to reconnect to known peers after a restart
+type AddressBook struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[peer.ID]*addressBookEntry
+}
+
+type addressBookEntry struct {
+	Addrs    []string  `json:"addrs"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// NewAddressBook creates an address book backed by the file at path, loading
+// any entries already stored there. An empty path keeps the book in memory.
+func NewAddressBook(path string) (*AddressBook, error) {
+	ab := &AddressBook{
+		path:    path,
+		entries: make(map[peer.ID]*addressBookEntry),
+	}
+	if path == "" {
+		return ab, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ab, nil
+	}
+	if err!= nil {
+		return nil, err
+	}
+	var stored map[string]*addressBookEntry
+	err = json.Unmarshal(data, &stored)
+	if err!= nil {
+		return nil, err
+	}
+	for id, entry := range stored {
+		pid, err := peer.Decode(id)
+		if err!= nil {
+			continue
+		}
+		ab.entries[pid] = entry
+	}
+	return ab, nil
+}
+
+// Add records an address for a peer
+func (ab *AddressBook) Add(id peer.ID, addr multiaddr.Multiaddr) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	entry, ok := ab.entries[id]
+	if!ok {
+		entry = &addressBookEntry{}
+		ab.entries[id] = entry
+	}
+	entry.LastSeen = time.Now()
+	s := addr.String()
+	for _, a := range entry.Addrs {
+		if a == s {
+			return
+		}
+	}
+	entry.Addrs = append(entry.Addrs, s)
+}
+
+// Remove forgets a peer
+func (ab *AddressBook) Remove(id peer.ID) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	delete(ab.entries, id)
+}
+
+// Peers returns all known peers with their addresses
+func (ab *AddressBook) Peers() []peer.AddrInfo {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	infos := make([]peer.AddrInfo, 0, len(ab.entries))
+	for id, entry := range ab.entries {
+		info := peer.AddrInfo{ID: id}
+		for _, a := range entry.Addrs {
+			addr, err := multiaddr.NewMultiaddr(a)
+			if err!= nil {
+				continue
+			}
+			info.Addrs = append(info.Addrs, addr)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Save writes the address book to its file
+func (ab *AddressBook) Save() error {
+	if ab.path == "" {
+		return nil
+	}
+	ab.mu.Lock()
+	stored := make(map[string]*addressBookEntry, len(ab.entries))
+	for id, entry := range ab.entries {
+		stored[peer.Encode(id)] = entry
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	ab.mu.Unlock()
+	if err!= nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(ab.path), ".addrbook-*")
+	if err!= nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err!= nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err!= nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ab.path)
+}
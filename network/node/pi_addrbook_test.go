@@ -0,0 +1,76 @@
+package node
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestAddressBookSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	ab, err := NewAddressBook(path)
+	if err!= nil {
+		t.Fatalf("Expected NewAddressBook to succeed, but got error: %s", err)
+	}
+	node := newLoopbackNode(t, &Config{})
+	addr := multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001")
+	ab.Add(node.ID(), addr)
+	ab.Add(node.ID(), addr)
+	err = ab.Save()
+	if err!= nil {
+		t.Fatalf("Expected Save to succeed, but got error: %s", err)
+	}
+
+	loaded, err := NewAddressBook(path)
+	if err!= nil {
+		t.Fatalf("Expected NewAddressBook to load the saved book, but got error: %s", err)
+	}
+	peers := loaded.Peers()
+	if len(peers)!= 1 || peers[0].ID!= node.ID() {
+		t.Fatalf("Expected one stored peer, but got %v", peers)
+	}
+	if len(peers[0].Addrs)!= 1 ||!peers[0].Addrs[0].Equal(addr) {
+		t.Errorf("Expected stored address %s, but got %v", addr, peers[0].Addrs)
+	}
+}
+
+func TestNodeReconnectsToKnownPeers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	remote := newLoopbackNode(t, &Config{})
+	privateKey, _, err := GenerateKeyPair()
+	if err!= nil {
+		t.Fatal(err)
+	}
+	config := &Config{ListenAddrs: []string{"/ip4/127.0.0.1/tcp/0"}, AddressBookPath: path}
+	first, err := NewPiNodeWithConfig(context.Background(), privateKey, config)
+	if err!= nil {
+		t.Fatalf("Expected NewPiNodeWithConfig to succeed, but got error: %s", err)
+	}
+	connect(t, first, remote)
+	err = first.Stop()
+	if err!= nil {
+		t.Fatalf("Expected Stop to succeed, but got error: %s", err)
+	}
+
+	restarted, err := NewPiNodeWithConfig(context.Background(), privateKey, config)
+	if err!= nil {
+		t.Fatalf("Expected NewPiNodeWithConfig to succeed, but got error: %s", err)
+	}
+	defer restarted.Close()
+	err = restarted.Start(context.Background())
+	if err!= nil {
+		t.Fatalf("Expected Start to succeed, but got error: %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for restarted.Network().Connectedness(remote.ID())!= network.Connected && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if restarted.Network().Connectedness(remote.ID())!= network.Connected {
+		t.Errorf("Expected restarted node to reconnect to %s from its address book", peer.Encode(remote.ID()))
+	}
+}
@@ -0,0 +1,76 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"pi/network/metrics"
+)
+
+// PeerStatus describes a connected peer on the admin endpoint
+type PeerStatus struct {
+	ID          string    `json:"id"`
+	Addrs       []string  `json:"addrs"`
+	Direction   string    `json:"direction"`
+	Score       int       `json:"score"`
+	Protected   bool      `json:"protected"`
+	Protocols   []string  `json:"protocols"`
+	ConnectedAt time.Time `json:"connected_at"`
+	Age         string    `json:"age"`
+}
+
+// AdminHandler returns an HTTP handler exposing /metrics in Prometheus format
+// and /admin/peers listing the connected peers
+func (n *PiNode) AdminHandler() http.Handler {
+	router := mux.NewRouter()
+	router.Handle("/metrics", metrics.Default.Handler()).Methods("GET")
+	router.HandleFunc("/admin/peers", n.handlePeersRequest).Methods("GET")
+	return router
+}
+
+// handlePeersRequest handles requests to the /admin/peers endpoint
+func (n *PiNode) handlePeersRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n.Peers())
+}
+
+// Peers returns the status of every connected peer, oldest connection first
+func (n *PiNode) Peers() []PeerStatus {
+	now := time.Now()
+	peers := make([]PeerStatus, 0)
+	for _, id := range n.Network().Peers() {
+		conns := n.Network().ConnsToPeer(id)
+		if len(conns) == 0 {
+			continue
+		}
+		status := PeerStatus{
+			ID:          peer.Encode(id),
+			Direction:   conns[0].Stat().Direction.String(),
+			Score:       n.connManager.Score(id),
+			Protected:   n.connManager.IsProtected(id, ""),
+			ConnectedAt: conns[0].Stat().Opened,
+		}
+		for _, c := range conns {
+			status.Addrs = append(status.Addrs, c.RemoteMultiaddr().String())
+			if c.Stat().Opened.Before(status.ConnectedAt) {
+				status.ConnectedAt = c.Stat().Opened
+			}
+		}
+		protocols, err := n.Peerstore().GetProtocols(id)
+		if err == nil {
+			sort.Strings(protocols)
+			status.Protocols = protocols
+		}
+		status.Age = now.Sub(status.ConnectedAt).Round(time.Second).String()
+		peers = append(peers, status)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].ConnectedAt.Before(peers[j].ConnectedAt)
+	})
+	return peers
+}
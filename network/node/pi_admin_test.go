@@ -0,0 +1,59 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestAdminPeers(t *testing.T) {
+	server := newLoopbackNode(t, &Config{})
+	client := newLoopbackNode(t, &Config{})
+	connect(t, client, server)
+	server.connManager.TagPeer(client.ID(), "useful", 7)
+
+	rec := httptest.NewRecorder()
+	server.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/admin/peers", nil))
+	if rec.Code!= 200 {
+		t.Fatalf("Expected status 200, but got %d", rec.Code)
+	}
+	var peers []PeerStatus
+	err := json.Unmarshal(rec.Body.Bytes(), &peers)
+	if err!= nil {
+		t.Fatalf("Expected a JSON peer list, but got error: %s", err)
+	}
+	if len(peers)!= 1 {
+		t.Fatalf("Expected 1 peer, but got %d", len(peers))
+	}
+	status := peers[0]
+	if status.ID!= peer.Encode(client.ID()) {
+		t.Errorf("Expected peer %s, but got %s", peer.Encode(client.ID()), status.ID)
+	}
+	if status.Direction!= "Inbound" {
+		t.Errorf("Expected an inbound connection, but got %s", status.Direction)
+	}
+	if status.Score!= 7 {
+		t.Errorf("Expected score 7, but got %d", status.Score)
+	}
+	if len(status.Addrs) == 0 ||!strings.HasPrefix(status.Addrs[0], "/ip4/127.0.0.1/tcp/") {
+		t.Errorf("Expected a loopback address, but got %v", status.Addrs)
+	}
+	if status.ConnectedAt.IsZero() {
+		t.Errorf("Expected a connection time")
+	}
+}
+
+func TestAdminMetrics(t *testing.T) {
+	server := newLoopbackNode(t, &Config{})
+	rec := httptest.NewRecorder()
+	server.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code!= 200 {
+		t.Fatalf("Expected status 200, but got %d", rec.Code)
+	}
+	if!strings.Contains(rec.Body.String(), "pi_network_peers_connected") {
+		t.Errorf("Expected the peers_connected gauge in the metrics output")
+	}
+}
@@ -0,0 +1,328 @@
+package node
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/connmgr"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// ConnManager enforces separate inbound and outbound peer limits. When a
+// limit is exceeded the lowest scoring peers in that direction are
+// disconnected, skipping protected peers and peers still in their grace
+// period. A peer's score is the sum of its tag values.
+type ConnManager struct {
+	maxInbound  int
+	maxOutbound int
+	gracePeriod time.Duration
+	addressBook *AddressBook
+
+	mu      sync.Mutex
+	peers   map[peer.ID]*peerState
+	network network.Network
+	closed  bool
+}
+
+type peerState struct {
+	firstSeen time.Time
+	direction network.Direction
+	conns     map[network.Conn]time.Time
+	tags      map[string]int
+	protected map[string]struct{}
+}
+
+func (ps *peerState) score() int {
+	score := 0
+	for _, v := range ps.tags {
+		score += v
+	}
+	return score
+}
+
+// unconnectedPeerTTL is how long the tags set on a peer are kept while it is
+// not connected
+const unconnectedPeerTTL = time.Minute
+
+var _ connmgr.ConnManager = (*ConnManager)(nil)
+
+// NewConnManager creates a new ConnManager. A limit of zero or less disables
+// trimming in that direction. addressBook may be nil.
+func NewConnManager(maxInbound, maxOutbound int, gracePeriod time.Duration, addressBook *AddressBook) *ConnManager {
+	return &ConnManager{
+		maxInbound:  maxInbound,
+		maxOutbound: maxOutbound,
+		gracePeriod: gracePeriod,
+		addressBook: addressBook,
+		peers:       make(map[peer.ID]*peerState),
+	}
+}
+
+// PeerCounts returns the number of connected inbound and outbound peers.
+// Peers whose direction is unknown are in neither count.
+func (cm *ConnManager) PeerCounts() (inbound int, outbound int) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for _, ps := range cm.peers {
+		if len(ps.conns) == 0 {
+			continue
+		}
+		switch ps.direction {
+		case network.DirInbound:
+			inbound++
+		case network.DirOutbound:
+			outbound++
+		}
+	}
+	return inbound, outbound
+}
+
+// Score returns the current score of a peer
+func (cm *ConnManager) Score(p peer.ID) int {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if ps, ok := cm.peers[p]; ok {
+		return ps.score()
+	}
+	return 0
+}
+
+// TagPeer sets a tag value on a peer, which contributes to its score
+func (cm *ConnManager) TagPeer(p peer.ID, tag string, value int) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.state(p).tags[tag] = value
+}
+
+// UntagPeer removes a tag from a peer
+func (cm *ConnManager) UntagPeer(p peer.ID, tag string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if ps, ok := cm.peers[p]; ok {
+		delete(ps.tags, tag)
+		cm.forget(p)
+	}
+}
+
+// UpsertTag updates a tag value on a peer
+func (cm *ConnManager) UpsertTag(p peer.ID, tag string, upsert func(int) int) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	ps := cm.state(p)
+	ps.tags[tag] = upsert(ps.tags[tag])
+}
+
+// GetTagInfo returns the tags and connections known for a peer
+func (cm *ConnManager) GetTagInfo(p peer.ID) *connmgr.TagInfo {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	ps, ok := cm.peers[p]
+	if!ok {
+		return nil
+	}
+	info := &connmgr.TagInfo{
+		FirstSeen: ps.firstSeen,
+		Value:     ps.score(),
+		Tags:      make(map[string]int, len(ps.tags)),
+		Conns:     make(map[string]time.Time, len(ps.conns)),
+	}
+	for tag, v := range ps.tags {
+		info.Tags[tag] = v
+	}
+	for c, t := range ps.conns {
+		info.Conns[c.RemoteMultiaddr().String()] = t
+	}
+	return info
+}
+
+// Protect prevents a peer from being trimmed
+func (cm *ConnManager) Protect(p peer.ID, tag string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.state(p).protected[tag] = struct{}{}
+}
+
+// Unprotect removes a protection tag and reports whether the peer is still protected
+func (cm *ConnManager) Unprotect(p peer.ID, tag string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	ps, ok := cm.peers[p]
+	if!ok {
+		return false
+	}
+	delete(ps.protected, tag)
+	cm.forget(p)
+	return len(ps.protected) > 0
+}
+
+// IsProtected reports whether a peer is protected, by the given tag or by any tag if tag is empty
+func (cm *ConnManager) IsProtected(p peer.ID, tag string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	ps, ok := cm.peers[p]
+	if!ok {
+		return false
+	}
+	if tag == "" {
+		return len(ps.protected) > 0
+	}
+	_, ok = ps.protected[tag]
+	return ok
+}
+
+// TrimOpenConns disconnects the lowest scoring peers until both limits are met
+func (cm *ConnManager) TrimOpenConns(ctx context.Context) {
+	for _, conn := range cm.connsToClose() {
+		if ctx.Err()!= nil {
+			return
+		}
+		conn.Close()
+	}
+}
+
+func (cm *ConnManager) connsToClose() []network.Conn {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.closed {
+		return nil
+	}
+	cm.prune(time.Now())
+	var conns []network.Conn
+	conns = append(conns, cm.selectVictims(network.DirInbound, cm.maxInbound)...)
+	conns = append(conns, cm.selectVictims(network.DirOutbound, cm.maxOutbound)...)
+	return conns
+}
+
+// selectVictims must be called with cm.mu held
+func (cm *ConnManager) selectVictims(dir network.Direction, limit int) []network.Conn {
+	if limit <= 0 {
+		return nil
+	}
+	type candidate struct {
+		id    peer.ID
+		score int
+	}
+	var (
+		count      int
+		candidates []candidate
+	)
+	now := time.Now()
+	for id, ps := range cm.peers {
+		if len(ps.conns) == 0 || ps.direction!= dir {
+			continue
+		}
+		count++
+		if len(ps.protected) > 0 || now.Sub(ps.firstSeen) < cm.gracePeriod {
+			continue
+		}
+		candidates = append(candidates, candidate{id: id, score: ps.score()})
+	}
+	if count <= limit {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].score < candidates[j].score
+	})
+	var conns []network.Conn
+	for _, c := range candidates {
+		if count <= limit {
+			break
+		}
+		for conn := range cm.peers[c.id].conns {
+			conns = append(conns, conn)
+		}
+		count--
+	}
+	return conns
+}
+
+// Notifee returns the network notifiee that feeds the manager
+func (cm *ConnManager) Notifee() network.Notifiee {
+	return (*cmNotifee)(cm)
+}
+
+// Close stops the manager from trimming connections
+func (cm *ConnManager) Close() error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.closed = true
+	return nil
+}
+
+// forget drops the state of a peer that is neither connected nor protected
+// and has no tags left. It must be called with cm.mu held.
+func (cm *ConnManager) forget(p peer.ID) {
+	if ps, ok := cm.peers[p]; ok && len(ps.conns) == 0 && len(ps.protected) == 0 && len(ps.tags) == 0 {
+		delete(cm.peers, p)
+	}
+}
+
+// prune drops the state tagging created for peers that did not connect
+// within unconnectedPeerTTL. It must be called with cm.mu held.
+func (cm *ConnManager) prune(now time.Time) {
+	for id, ps := range cm.peers {
+		if len(ps.conns) == 0 && len(ps.protected) == 0 && now.Sub(ps.firstSeen) > unconnectedPeerTTL {
+			delete(cm.peers, id)
+		}
+	}
+}
+
+// state returns the state for a peer, creating it if needed. It must be called with cm.mu held.
+func (cm *ConnManager) state(p peer.ID) *peerState {
+	ps, ok := cm.peers[p]
+	if!ok {
+		ps = &peerState{
+			firstSeen: time.Now(),
+			conns:     make(map[network.Conn]time.Time),
+			tags:      make(map[string]int),
+			protected: make(map[string]struct{}),
+		}
+		cm.peers[p] = ps
+	}
+	return ps
+}
+
+type cmNotifee ConnManager
+
+func (nn *cmNotifee) cm() *ConnManager {
+	return (*ConnManager)(nn)
+}
+
+func (nn *cmNotifee) Connected(n network.Network, c network.Conn) {
+	cm := nn.cm()
+	cm.mu.Lock()
+	ps := cm.state(c.RemotePeer())
+	if len(ps.conns) == 0 {
+		ps.direction = c.Stat().Direction
+	}
+	ps.conns[c] = time.Now()
+	cm.mu.Unlock()
+
+	if cm.addressBook!= nil && c.Stat().Direction == network.DirOutbound {
+		cm.addressBook.Add(c.RemotePeer(), c.RemoteMultiaddr())
+	}
+	go cm.TrimOpenConns(context.Background())
+}
+
+func (nn *cmNotifee) Disconnected(n network.Network, c network.Conn) {
+	cm := nn.cm()
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	ps, ok := cm.peers[c.RemotePeer()]
+	if!ok {
+		return
+	}
+	delete(ps.conns, c)
+	if len(ps.conns) == 0 && len(ps.protected) == 0 {
+		delete(cm.peers, c.RemotePeer())
+	}
+}
+
+func (nn *cmNotifee) Listen(network.Network, multiaddr.Multiaddr)      {}
+func (nn *cmNotifee) ListenClose(network.Network, multiaddr.Multiaddr) {}
+func (nn *cmNotifee) OpenedStream(network.Network, network.Stream)     {}
+func (nn *cmNotifee) ClosedStream(network.Network, network.Stream)     {}
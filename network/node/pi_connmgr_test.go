@@ -0,0 +1,176 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// fakeConn is the part of a network.Conn the connection manager uses
+type fakeConn struct {
+	network.Conn
+	remote    peer.ID
+	direction network.Direction
+}
+
+func (c *fakeConn) RemotePeer() peer.ID { return c.remote }
+
+func (c *fakeConn) Stat() network.Stat { return network.Stat{Direction: c.direction} }
+
+func (c *fakeConn) RemoteMultiaddr() multiaddr.Multiaddr {
+	return multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func newLoopbackNode(t *testing.T, config *Config) *PiNode {
+	privateKey, _, err := GenerateKeyPair()
+	if err!= nil {
+		t.Fatalf("Expected GenerateKeyPair to succeed, but got error: %s", err)
+	}
+	config.ListenAddrs = []string{"/ip4/127.0.0.1/tcp/0"}
+	node, err := NewPiNodeWithConfig(context.Background(), privateKey, config)
+	if err!= nil {
+		t.Fatalf("Expected NewPiNodeWithConfig to succeed, but got error: %s", err)
+	}
+	t.Cleanup(func() { node.Close() })
+	return node
+}
+
+func connect(t *testing.T, from, to *PiNode) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := from.Connect(ctx, peer.AddrInfo{ID: to.ID(), Addrs: to.Addrs()})
+	if err!= nil {
+		t.Fatalf("Expected Connect to succeed, but got error: %s", err)
+	}
+}
+
+func TestConnManagerInboundLimit(t *testing.T) {
+	server := newLoopbackNode(t, &Config{MaxInboundPeers: 2})
+	favourite := newLoopbackNode(t, &Config{})
+	connect(t, favourite, server)
+	server.connManager.TagPeer(favourite.ID(), "useful", 100)
+
+	for i := 0; i < 3; i++ {
+		connect(t, newLoopbackNode(t, &Config{}), server)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		inbound, _ := server.connManager.PeerCounts()
+		if inbound <= 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	inbound, outbound := server.connManager.PeerCounts()
+	if inbound!= 2 {
+		t.Errorf("Expected inbound peers to be trimmed to 2, but got %d", inbound)
+	}
+	if outbound!= 0 {
+		t.Errorf("Expected no outbound peers, but got %d", outbound)
+	}
+	if server.Network().Connectedness(favourite.ID())!= network.Connected {
+		t.Errorf("Expected the highest scoring peer to survive trimming")
+	}
+}
+
+func TestConnManagerProtectedPeer(t *testing.T) {
+	server := newLoopbackNode(t, &Config{MaxInboundPeers: 1})
+	protected := newLoopbackNode(t, &Config{})
+	connect(t, protected, server)
+	server.connManager.Protect(protected.ID(), "validator")
+	connect(t, newLoopbackNode(t, &Config{}), server)
+
+	time.Sleep(500 * time.Millisecond)
+	if server.Network().Connectedness(protected.ID())!= network.Connected {
+		t.Errorf("Expected protected peer to stay connected")
+	}
+	if!server.connManager.IsProtected(protected.ID(), "") {
+		t.Errorf("Expected peer to be reported as protected")
+	}
+	if server.connManager.Unprotect(protected.ID(), "validator") {
+		t.Errorf("Expected peer to be unprotected after removing its only tag")
+	}
+}
+
+func TestConnManagerPeerCounts(t *testing.T) {
+	cm := NewConnManager(0, 0, 0, nil)
+	notifee := cm.Notifee()
+	inbound := &fakeConn{remote: peer.ID("inbound"), direction: network.DirInbound}
+	notifee.Connected(nil, inbound)
+	notifee.Connected(nil, &fakeConn{remote: peer.ID("outbound"), direction: network.DirOutbound})
+	notifee.Connected(nil, &fakeConn{remote: peer.ID("unknown"), direction: network.DirUnknown})
+	cm.TagPeer(peer.ID("never-connected"), "useful", 10)
+	cm.Protect(peer.ID("validator"), "validator")
+
+	if in, out := cm.PeerCounts(); in!= 1 || out!= 1 {
+		t.Errorf("Expected 1 inbound and 1 outbound peer, but got %d and %d", in, out)
+	}
+	notifee.Disconnected(nil, inbound)
+	if in, _ := cm.PeerCounts(); in!= 0 {
+		t.Errorf("Expected no inbound peers after disconnecting, but got %d", in)
+	}
+}
+
+func TestConnManagerForgetsUnconnectedPeers(t *testing.T) {
+	cm := NewConnManager(0, 0, 0, nil)
+	cm.TagPeer(peer.ID("untagged"), "useful", 10)
+	cm.UntagPeer(peer.ID("untagged"), "useful")
+	cm.Protect(peer.ID("unprotected"), "validator")
+	cm.Unprotect(peer.ID("unprotected"), "validator")
+	if cm.GetTagInfo(peer.ID("untagged"))!= nil || cm.GetTagInfo(peer.ID("unprotected"))!= nil {
+		t.Errorf("Expected the state of unconnected peers to be dropped with their last tag")
+	}
+
+	cm.TagPeer(peer.ID("stale"), "useful", 10)
+	cm.Protect(peer.ID("protected"), "validator")
+	cm.mu.Lock()
+	for _, ps := range cm.peers {
+		ps.firstSeen = time.Now().Add(-2 * unconnectedPeerTTL)
+	}
+	cm.mu.Unlock()
+	cm.TrimOpenConns(context.Background())
+	if cm.GetTagInfo(peer.ID("stale"))!= nil {
+		t.Errorf("Expected the tags of a peer that never connected to expire")
+	}
+	if!cm.IsProtected(peer.ID("protected"), "validator") {
+		t.Errorf("Expected protection of a peer that has not connected yet to be kept")
+	}
+}
+
+func TestConnManagerGracePeriod(t *testing.T) {
+	server := newLoopbackNode(t, &Config{MaxInboundPeers: 1, GracePeriod: time.Minute})
+	connect(t, newLoopbackNode(t, &Config{}), server)
+	connect(t, newLoopbackNode(t, &Config{}), server)
+
+	time.Sleep(500 * time.Millisecond)
+	inbound, _ := server.connManager.PeerCounts()
+	if inbound!= 2 {
+		t.Errorf("Expected peers in their grace period to be kept, but got %d inbound", inbound)
+	}
+}
+
+func TestAnnounceAddrs(t *testing.T) {
+	node := newLoopbackNode(t, &Config{AnnounceAddrs: []string{"/ip4/203.0.113.7/tcp/4001"}})
+	addrs := node.Addrs()
+	if len(addrs)!= 1 || addrs[0].String()!= "/ip4/203.0.113.7/tcp/4001" {
+		t.Errorf("Expected only the announced address, but got %v", addrs)
+	}
+}
+
+func TestInvalidAnnounceAddr(t *testing.T) {
+	privateKey, _, err := GenerateKeyPair()
+	if err!= nil {
+		t.Fatal(err)
+	}
+	_, err = NewPiNodeWithConfig(context.Background(), privateKey, &Config{AnnounceAddrs: []string{"not-a-multiaddr"}})
+	if err == nil {
+		t.Errorf("Expected NewPiNodeWithConfig to fail with an invalid announce address")
+	}
+}
@@ -7,48 +7,235 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p"
+	libp2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	quic "github.com/libp2p/go-libp2p-quic-transport"
+	tcp "github.com/libp2p/go-tcp-transport"
+	websocket "github.com/libp2p/go-ws-transport"
 	"github.com/multiformats/go-multiaddr"
+
+	"pi/crypto/keystore"
+	"pi/network/metrics"
 )
 
+// DefaultListenAddrs are the addresses a node listens on when none are configured
+var DefaultListenAddrs = []string{
+	"/ip4/0.0.0.0/tcp/0",
+	"/ip4/0.0.0.0/udp/0/quic",
+}
+
+// Config holds the networking options of a PiNode
+type Config struct {
+	// ListenAddrs are the multiaddrs to listen on. TCP, QUIC (/udp/.../quic)
+	// and WebSocket (/tcp/.../ws) addresses are supported.
+	ListenAddrs []string
+
+	// AnnounceAddrs, when set, replace the listen addresses advertised to
+	// other peers, e.g. a public IP in front of a NAT
+	AnnounceAddrs []string
+
+	// MaxInboundPeers and MaxOutboundPeers bound the number of connected
+	// peers in each direction. Zero disables the limit.
+	MaxInboundPeers  int
+	MaxOutboundPeers int
+
+	// GracePeriod protects newly connected peers from being trimmed
+	GracePeriod time.Duration
+
+	// AddressBookPath is the file dialed peers are persisted to
+	AddressBookPath string
+
+	// KeystorePath is the encrypted keystore holding the node key used by
+	// NewPiNodeFromKeystore. It is created on first start so the peer ID
+	// survives restarts.
+	KeystorePath string
+
+	// EnableRelay allows connecting through and acting as a circuit relay
+	EnableRelay bool
+
+	// StaticRelays are relays used when the node is not publicly reachable
+	StaticRelays []string
+
+	// EnableHolePunching enables direct connection upgrades through NATs
+	EnableHolePunching bool
+
+	// EnableNATPortMap asks the gateway to map the listen ports via UPnP/NAT-PMP
+	EnableNATPortMap bool
+}
+
+// DefaultConfig returns the default node configuration
+func DefaultConfig() *Config {
+	return &Config{
+		ListenAddrs:      DefaultListenAddrs,
+		MaxInboundPeers:  40,
+		MaxOutboundPeers: 10,
+		GracePeriod:      20 * time.Second,
+		EnableNATPortMap: true,
+	}
+}
+
 // PiNode represents a node in the Pi network
 type PiNode struct {
 	host.Host
-	privateKey *ecdsa.PrivateKey
-	publicKey  *ecdsa.PublicKey
-	peerInfo   peer.AddrInfo
+	privateKey  *ecdsa.PrivateKey
+	publicKey   *ecdsa.PublicKey
+	peerInfo    peer.AddrInfo
+	config      *Config
+	connManager *ConnManager
+	addressBook *AddressBook
 }
 
-// NewPiNode creates a new PiNode instance
+// NewPiNode creates a new PiNode instance with the default configuration
 func NewPiNode(ctx context.Context, privateKey *ecdsa.PrivateKey) (*PiNode, error) {
-	h, err := host.New(ctx)
+	return NewPiNodeWithConfig(ctx, privateKey, DefaultConfig())
+}
+
+// NewPiNodeFromKeystore creates a new PiNode whose key is loaded from, or on
+// first start generated into, config.KeystorePath
+func NewPiNodeFromKeystore(ctx context.Context, password string, config *Config) (*PiNode, error) {
+	privateKey, _, err := LoadOrGenerateKeyPair(config.KeystorePath, password)
 	if err!= nil {
 		return nil, err
 	}
-	publicKey := &privateKey.PublicKey
-	peerInfo, err := peer.AddrInfoFromP2pAddr(multiaddr.StringCast("/ip4/127.0.0.1/tcp/0"))
+	return NewPiNodeWithConfig(ctx, privateKey, config)
+}
+
+// NewPiNodeWithConfig creates a new PiNode instance with the given configuration
+func NewPiNodeWithConfig(ctx context.Context, privateKey *ecdsa.PrivateKey, config *Config) (*PiNode, error) {
+	addressBook, err := NewAddressBook(config.AddressBookPath)
+	if err!= nil {
+		return nil, err
+	}
+	connManager := NewConnManager(config.MaxInboundPeers, config.MaxOutboundPeers, config.GracePeriod, addressBook)
+	opts, err := hostOptions(privateKey, config, connManager)
+	if err!= nil {
+		return nil, err
+	}
+	h, err := libp2p.New(opts...)
+	if err!= nil {
+		return nil, err
+	}
+	err = metrics.Default.TrackHost(h)
 	if err!= nil {
+		h.Close()
 		return nil, err
 	}
+	publicKey := &privateKey.PublicKey
 	return &PiNode{
-		Host:      h,
-		privateKey: privateKey,
-		publicKey:  publicKey,
-		peerInfo:  peerInfo,
+		Host:        h,
+		privateKey:  privateKey,
+		publicKey:   publicKey,
+		peerInfo:    peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()},
+		config:      config,
+		connManager: connManager,
+		addressBook: addressBook,
 	}, nil
 }
 
-// Start starts the PiNode
+// hostOptions translates a Config into libp2p host options
+func hostOptions(privateKey *ecdsa.PrivateKey, config *Config, connManager *ConnManager) ([]libp2p.Option, error) {
+	identity, _, err := libp2pcrypto.ECDSAKeyPairFromKey(privateKey)
+	if err!= nil {
+		return nil, err
+	}
+	listenAddrs := config.ListenAddrs
+	if len(listenAddrs) == 0 {
+		listenAddrs = DefaultListenAddrs
+	}
+	opts := []libp2p.Option{
+		libp2p.Identity(identity),
+		libp2p.ListenAddrStrings(listenAddrs...),
+		libp2p.Transport(tcp.NewTCPTransport),
+		libp2p.Transport(websocket.New),
+		libp2p.Transport(quic.NewTransport),
+		libp2p.ConnectionManager(connManager),
+		libp2p.BandwidthReporter(metrics.Default.Bandwidth),
+	}
+	if len(config.AnnounceAddrs) > 0 {
+		announce := make([]multiaddr.Multiaddr, 0, len(config.AnnounceAddrs))
+		for _, a := range config.AnnounceAddrs {
+			addr, err := multiaddr.NewMultiaddr(a)
+			if err!= nil {
+				return nil, fmt.Errorf("invalid announce address %q: %w", a, err)
+			}
+			announce = append(announce, addr)
+		}
+		opts = append(opts, libp2p.AddrsFactory(func([]multiaddr.Multiaddr) []multiaddr.Multiaddr {
+			return announce
+		}))
+	}
+	if config.EnableRelay {
+		opts = append(opts, libp2p.EnableRelay())
+	} else {
+		opts = append(opts, libp2p.DisableRelay())
+	}
+	if len(config.StaticRelays) > 0 {
+		relays := make([]peer.AddrInfo, 0, len(config.StaticRelays))
+		for _, r := range config.StaticRelays {
+			info, err := peer.AddrInfoFromString(r)
+			if err!= nil {
+				return nil, fmt.Errorf("invalid relay address %q: %w", r, err)
+			}
+			relays = append(relays, *info)
+		}
+		opts = append(opts, libp2p.EnableAutoRelay(), libp2p.StaticRelays(relays))
+	}
+	if config.EnableHolePunching {
+		opts = append(opts, libp2p.EnableHolePunching())
+	}
+	if config.EnableNATPortMap {
+		opts = append(opts, libp2p.NATPortMap())
+	}
+	return opts, nil
+}
+
+// Start starts the PiNode and dials the peers remembered in the address book
 func (n *PiNode) Start(ctx context.Context) error {
-	return n.Host.SetStreamHandler(protocol.ID("/pi/1.0.0"), n.handleStream)
+	n.Host.SetStreamHandler(protocol.ID("/pi/1.0.0"), n.handleStream)
+	go n.connectKnownPeers(ctx)
+	return nil
+}
+
+// Stop persists the address book and closes the node. The node is closed
+// even if the address book can't be saved.
+func (n *PiNode) Stop() error {
+	saveErr := n.addressBook.Save()
+	return errors.Join(saveErr, n.Close())
+}
+
+// Close stops exporting the node's metrics and closes the host
+func (n *PiNode) Close() error {
+	metrics.Default.UntrackHost(n.Host)
+	return n.Host.Close()
+}
+
+// connectKnownPeers dials peers from the address book until the outbound limit is reached
+func (n *PiNode) connectKnownPeers(ctx context.Context) {
+	for _, info := range n.addressBook.Peers() {
+		if n.config.MaxOutboundPeers > 0 {
+			_, outbound := n.connManager.PeerCounts()
+			if outbound >= n.config.MaxOutboundPeers {
+				return
+			}
+		}
+		if info.ID == n.ID() || n.Network().Connectedness(info.ID) == network.Connected {
+			continue
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		n.Connect(dialCtx, info)
+		cancel()
+	}
 }
 
 // handleStream handles incoming streams
@@ -77,6 +264,19 @@ func GenerateKeyPair() (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
 	return privateKey, publicKey, nil
 }
 
+// LoadOrGenerateKeyPair loads the node key from the encrypted keystore file at
+// path, creating it on first start. An empty path generates a throwaway key.
+func LoadOrGenerateKeyPair(path string, password string) (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
+	if path == "" {
+		return GenerateKeyPair()
+	}
+	privateKey, err := keystore.LoadOrCreate(path, password)
+	if err!= nil {
+		return nil, nil, err
+	}
+	return privateKey, &privateKey.PublicKey, nil
+}
+
 // MarshalJSON marshals the PiNode to JSON
 func (n *PiNode) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
@@ -2,6 +2,7 @@ package node
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 )
 
@@ -151,3 +152,39 @@ func TestHandleStream(t *testing.T) {
 	// Verify that the stream was handled correctly...
 }
 	
+
+func TestLoadOrGenerateKeyPair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.json")
+	privateKey, _, err := LoadOrGenerateKeyPair(path, "password")
+	if err!= nil {
+		t.Fatalf("Expected LoadOrGenerateKeyPair to succeed, but got error: %s", err)
+	}
+	loaded, publicKey, err := LoadOrGenerateKeyPair(path, "password")
+	if err!= nil {
+		t.Errorf("Expected LoadOrGenerateKeyPair to load the stored key, but got error: %s", err)
+	}
+	if!loaded.Equal(privateKey) ||!publicKey.Equal(&privateKey.PublicKey) {
+		t.Errorf("Expected the node key to survive a restart")
+	}
+}
+
+func TestNewPiNodeFromKeystore(t *testing.T) {
+	config := DefaultConfig()
+	config.ListenAddrs = []string{"/ip4/127.0.0.1/tcp/0"}
+	config.KeystorePath = filepath.Join(t.TempDir(), "node.json")
+	node, err := NewPiNodeFromKeystore(context.Background(), "password", config)
+	if err!= nil {
+		t.Fatalf("Expected NewPiNodeFromKeystore to succeed, but got error: %s", err)
+	}
+	id := node.Host.ID()
+	node.Close()
+
+	restarted, err := NewPiNodeFromKeystore(context.Background(), "password", config)
+	if err!= nil {
+		t.Fatalf("Expected NewPiNodeFromKeystore to succeed, but got error: %s", err)
+	}
+	defer restarted.Close()
+	if restarted.Host.ID()!= id {
+		t.Errorf("Expected the peer ID to survive a restart")
+	}
+}
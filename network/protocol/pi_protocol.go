@@ -1,8 +1,10 @@
 package protocol
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,12 +14,21 @@ import (
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multibase"
+
+	"pi/network/metrics"
 )
 
 const (
 	ProtocolID = "/pi/1.0.0"
+
+	// MaxMessageSize is the largest length prefix readMessage will accept
+	MaxMessageSize = 16 << 20
 )
 
+func init() {
+	metrics.Default.RegisterMessageTypes("hello", "data")
+}
+
 type PiProtocol struct {
 	peer.ID
 	privateKey *ecdsa.PrivateKey
@@ -38,6 +49,7 @@ func (p *PiProtocol) HandleStream(s network.Stream) {
 	msg, err := readMessage(s)
 	if err!= nil {
 		fmt.Println("Error reading message:", err)
+		metrics.Default.MessageError("unknown")
 		return
 	}
 	// Process message
@@ -53,8 +65,10 @@ func (p *PiProtocol) processMessage(msg []byte) {
 	err := json.Unmarshal(msg, &message)
 	if err!= nil {
 		fmt.Println("Error unmarshaling message:", err)
+		metrics.Default.MessageError("unknown")
 		return
 	}
+	metrics.Default.MessageReceived(message.Type)
 	// Handle message based on type
 	switch message.Type {
 	case "hello":
@@ -74,13 +88,26 @@ func (p *PiProtocol) processDataMessage(data []byte) {
 	//...
 }
 
-func readMessage(s network.Stream) ([]byte, error) {
+// ReadMessage reads a single length-prefixed message from r
+func ReadMessage(r io.Reader) ([]byte, error) {
+	return readMessage(r)
+}
+
+// WriteMessage writes msg to w as a single length-prefixed message
+func WriteMessage(w io.Writer, msg []byte) error {
+	return writeMessage(w, msg)
+}
+
+func readMessage(s io.Reader) ([]byte, error) {
 	// Read message length
 	var length uint32
 	err := binary.Read(s, binary.BigEndian, &length)
 	if err!= nil {
 		return nil, err
 	}
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("message too large: %d bytes", length)
+	}
 	// Read message data
 	msg := make([]byte, length)
 	_, err = io.ReadFull(s, msg)
@@ -99,12 +126,25 @@ func (p *PiProtocol) SendMessage(ctx context.Context, peerID peer.ID, msg []byte
 	// Write message to stream
 	err = writeMessage(s, msg)
 	if err!= nil {
+		metrics.Default.MessageError(messageType(msg))
 		return err
 	}
+	metrics.Default.MessageSent(messageType(msg))
 	return nil
 }
 
-func writeMessage(s network.Stream, msg []byte) error {
+// messageType returns the type field of a JSON message, for metrics labels
+func messageType(msg []byte) string {
+	var message struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(msg, &message)!= nil || message.Type == "" {
+		return "unknown"
+	}
+	return message.Type
+}
+
+func writeMessage(s io.Writer, msg []byte) error {
 	// Write message length
 	err := binary.Write(s, binary.BigEndian, uint32(len(msg)))
 	if err!= nil {
@@ -0,0 +1,374 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+
+	"pi/network/metrics"
+)
+
+const (
+	RPCProtocolID = "/pi/rpc/1.0.0"
+
+	// DefaultMaxConcurrentRequests is how many requests from one peer are
+	// served at once. Requests beyond it are rejected with ErrBusy.
+	DefaultMaxConcurrentRequests = 64
+)
+
+// Reply codes tell Call which errors came from the RPC layer rather than
+// from the remote handler
+const (
+	codeUnknownMethod = "unknown_method"
+	codeBusy          = "busy"
+)
+
+var (
+	// ErrTimeout is returned by Call when the context deadline passes before the reply arrives
+	ErrTimeout = errors.New("rpc: request timed out")
+
+	// ErrPeerGone is returned by Call when the stream to the peer is closed or cannot be opened
+	ErrPeerGone = errors.New("rpc: peer gone")
+
+	// ErrUnknownMethod is returned by Call when the remote side has no handler registered for the method
+	ErrUnknownMethod = errors.New("rpc: unknown method")
+
+	// ErrBusy is returned by Call when the remote side is already serving
+	// its maximum number of requests from us
+	ErrBusy = errors.New("rpc: too many concurrent requests")
+)
+
+// RemoteError is returned by Call when the remote handler returned an error
+type RemoteError struct {
+	Method  string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("rpc: remote error in %s: %s", e.Method, e.Message)
+}
+
+// RPCHandler handles a single request and returns a JSON-serializable result
+type RPCHandler func(ctx context.Context, from peer.ID, params json.RawMessage) (interface{}, error)
+
+// RPC is a request/response layer on top of length-prefixed streams. Calls to
+// the same peer are multiplexed over one stream and matched to their replies
+// by request ID.
+type RPC struct {
+	host host.Host
+
+	mu       sync.Mutex
+	handlers map[string]RPCHandler
+	sessions map[peer.ID]*rpcSession
+	// maxConcurrent bounds the requests served at once per session
+	maxConcurrent int
+}
+
+// rpcFrame is the envelope for both requests and responses on the wire
+type rpcFrame struct {
+	ID       uint64          `json:"id"`
+	Response bool            `json:"response,omitempty"`
+	Method   string          `json:"method,omitempty"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	// Code is set for errors of the RPC layer, as opposed to handler errors
+	Code string `json:"code,omitempty"`
+}
+
+// NewRPC creates a new RPC layer bound to the given host
+func NewRPC(h host.Host) *RPC {
+	return &RPC{
+		host:          h,
+		handlers:      make(map[string]RPCHandler),
+		sessions:      make(map[peer.ID]*rpcSession),
+		maxConcurrent: DefaultMaxConcurrentRequests,
+	}
+}
+
+// Start registers the RPC stream handler on the host
+func (r *RPC) Start() {
+	r.host.SetStreamHandler(protocol.ID(RPCProtocolID), r.handleStream)
+}
+
+// Register registers a handler for the given method name. Only methods that
+// are registered or called locally get their own metrics labels, requests
+// for other methods are counted as metrics.Unknown.
+func (r *RPC) Register(method string, handler RPCHandler) {
+	metrics.Default.RegisterMethods(method)
+	metrics.Default.RegisterMessageTypes("rpc." + method)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[method] = handler
+}
+
+// Call invokes method on the peer and decodes the reply into result, which may
+// be nil. It honours the context deadline and returns ErrTimeout, ErrPeerGone,
+// ErrUnknownMethod, ErrBusy or a *RemoteError as appropriate.
+func (r *RPC) Call(ctx context.Context, to peer.ID, method string, params interface{}, result interface{}) (err error) {
+	// Outbound method names come from our own code, not from peers, so they
+	// are safe to use as label values
+	metrics.Default.RegisterMethods(method)
+	metrics.Default.RegisterMessageTypes("rpc." + method)
+	start := time.Now()
+	defer func() {
+		metrics.Default.ObserveLatency(method, time.Since(start))
+		if err!= nil {
+			metrics.Default.MessageError("rpc." + method)
+		}
+	}()
+	data, err := json.Marshal(params)
+	if err!= nil {
+		return err
+	}
+	s, err := r.session(ctx, to)
+	if err!= nil {
+		return err
+	}
+	metrics.Default.MessageSent("rpc." + method)
+	reply, err := s.call(ctx, method, data)
+	if err!= nil {
+		return err
+	}
+	switch reply.Code {
+	case codeUnknownMethod:
+		return fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+	case codeBusy:
+		return fmt.Errorf("%w: %s", ErrBusy, method)
+	}
+	if reply.Error!= "" {
+		return &RemoteError{Method: method, Message: reply.Error}
+	}
+	if result == nil || len(reply.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// Close closes all open RPC sessions
+func (r *RPC) Close() error {
+	r.mu.Lock()
+	sessions := make([]*rpcSession, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	r.mu.Unlock()
+	for _, s := range sessions {
+		s.close(ErrPeerGone)
+	}
+	return nil
+}
+
+func (r *RPC) handleStream(s network.Stream) {
+	r.attach(s.Conn().RemotePeer(), s)
+}
+
+// session returns the open session to the peer, opening a new stream if needed
+func (r *RPC) session(ctx context.Context, to peer.ID) (*rpcSession, error) {
+	r.mu.Lock()
+	s, ok := r.sessions[to]
+	r.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	if r.host == nil {
+		return nil, ErrPeerGone
+	}
+	stream, err := r.host.NewStream(ctx, to, protocol.ID(RPCProtocolID))
+	if err!= nil {
+		return nil, fmt.Errorf("%w: %s", ErrPeerGone, err)
+	}
+	return r.attach(to, stream), nil
+}
+
+// attach starts serving conn as the session for the peer
+func (r *RPC) attach(from peer.ID, conn io.ReadWriteCloser) *rpcSession {
+	s := &rpcSession{
+		rpc:     r,
+		peer:    from,
+		conn:    conn,
+		pending: make(map[uint64]chan *rpcFrame),
+		closed:  make(chan struct{}),
+		serving: make(chan struct{}, r.maxConcurrent),
+	}
+	r.mu.Lock()
+	// An existing session keeps carrying our outgoing calls, the new one is
+	// still served so the remote side can use it
+	if _, ok := r.sessions[from];!ok {
+		r.sessions[from] = s
+	}
+	r.mu.Unlock()
+	go s.readLoop()
+	return s
+}
+
+func (r *RPC) detach(s *rpcSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions[s.peer] == s {
+		delete(r.sessions, s.peer)
+	}
+}
+
+func (r *RPC) handler(method string) (RPCHandler, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.handlers[method]
+	return h, ok
+}
+
+// rpcSession multiplexes requests and responses over a single stream
+type rpcSession struct {
+	rpc  *RPC
+	peer peer.ID
+	conn io.ReadWriteCloser
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *rpcFrame
+	closed  chan struct{}
+	err     error
+	// serving holds a token for each request being served
+	serving chan struct{}
+}
+
+func (s *rpcSession) call(ctx context.Context, method string, params json.RawMessage) (*rpcFrame, error) {
+	ch := make(chan *rpcFrame, 1)
+	s.mu.Lock()
+	if s.err!= nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	s.nextID++
+	id := s.nextID
+	s.pending[id] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+	}()
+
+	err := s.write(&rpcFrame{ID: id, Method: method, Params: params})
+	if err!= nil {
+		s.close(fmt.Errorf("%w: %s", ErrPeerGone, err))
+		return nil, ErrPeerGone
+	}
+
+	select {
+	case reply := <-ch:
+		return reply, nil
+	case <-s.closed:
+		return nil, s.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *rpcSession) write(frame *rpcFrame) error {
+	data, err := json.Marshal(frame)
+	if err!= nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return writeMessage(s.conn, data)
+}
+
+func (s *rpcSession) readLoop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for {
+		data, err := readMessage(s.conn)
+		if err!= nil {
+			s.close(ErrPeerGone)
+			return
+		}
+		var frame rpcFrame
+		if err := json.Unmarshal(data, &frame); err!= nil {
+			s.close(fmt.Errorf("%w: malformed frame: %s", ErrPeerGone, err))
+			return
+		}
+		if frame.Response {
+			s.mu.Lock()
+			ch, ok := s.pending[frame.ID]
+			s.mu.Unlock()
+			// The channel holds one reply, a duplicate response ID must not
+			// stall the loop
+			if ok {
+				select {
+				case ch <- &frame:
+				default:
+				}
+			}
+			continue
+		}
+		// Requests past the limit are rejected rather than queued: a queued
+		// request would stop the loop from reading the replies that the
+		// handlers being served may be waiting for
+		select {
+		case s.serving <- struct{}{}:
+			go func(req *rpcFrame) {
+				defer func() { <-s.serving }()
+				s.serve(ctx, req)
+			}(&frame)
+		default:
+			metrics.Default.MessageError("rpc." + frame.Method)
+			reply := &rpcFrame{ID: frame.ID, Response: true, Error: ErrBusy.Error(), Code: codeBusy}
+			if err := s.write(reply); err!= nil {
+				s.close(ErrPeerGone)
+				return
+			}
+		}
+	}
+}
+
+func (s *rpcSession) serve(ctx context.Context, req *rpcFrame) {
+	reply := &rpcFrame{ID: req.ID, Response: true}
+	metrics.Default.MessageReceived("rpc." + req.Method)
+	handler, ok := s.rpc.handler(req.Method)
+	if!ok {
+		reply.Error = ErrUnknownMethod.Error()
+		reply.Code = codeUnknownMethod
+	} else {
+		result, err := handler(ctx, s.peer, req.Params)
+		if err!= nil {
+			reply.Error = err.Error()
+		} else if result!= nil {
+			reply.Result, err = json.Marshal(result)
+			if err!= nil {
+				reply.Error = err.Error()
+			}
+		}
+	}
+	if err := s.write(reply); err!= nil {
+		s.close(ErrPeerGone)
+	}
+}
+
+func (s *rpcSession) close(err error) {
+	s.mu.Lock()
+	if s.err!= nil {
+		s.mu.Unlock()
+		return
+	}
+	s.err = err
+	close(s.closed)
+	s.mu.Unlock()
+	s.conn.Close()
+	s.rpc.detach(s)
+}
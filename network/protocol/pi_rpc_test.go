@@ -0,0 +1,222 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"pi/network/metrics"
+)
+
+func newRPCPair() (*RPC, *RPC) {
+	client := NewRPC(nil)
+	server := NewRPC(nil)
+	c1, c2 := net.Pipe()
+	client.attach(peer.ID("server"), c1)
+	server.attach(peer.ID("client"), c2)
+	return client, server
+}
+
+func TestRPCCall(t *testing.T) {
+	client, server := newRPCPair()
+	defer client.Close()
+	server.Register("echo", func(ctx context.Context, from peer.ID, params json.RawMessage) (interface{}, error) {
+		var msg string
+		if err := json.Unmarshal(params, &msg); err!= nil {
+			return nil, err
+		}
+		return fmt.Sprintf("%s from %s", msg, from), nil
+	})
+	var reply string
+	err := client.Call(context.Background(), peer.ID("server"), "echo", "hello", &reply)
+	if err!= nil {
+		t.Fatalf("Expected Call to succeed, but got error: %s", err)
+	}
+	if reply!= "hello from client" {
+		t.Errorf("Expected reply 'hello from client', but got %q", reply)
+	}
+}
+
+func TestRPCConcurrentCalls(t *testing.T) {
+	client, server := newRPCPair()
+	defer client.Close()
+	server.Register("double", func(ctx context.Context, from peer.ID, params json.RawMessage) (interface{}, error) {
+		var n int
+		if err := json.Unmarshal(params, &n); err!= nil {
+			return nil, err
+		}
+		// Reply out of order so responses have to be matched by ID
+		time.Sleep(time.Duration(50-n) * time.Millisecond)
+		return n * 2, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			var reply int
+			err := client.Call(context.Background(), peer.ID("server"), "double", n, &reply)
+			if err!= nil {
+				t.Errorf("Expected Call to succeed, but got error: %s", err)
+				return
+			}
+			if reply!= n*2 {
+				t.Errorf("Expected %d, but got %d", n*2, reply)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRPCTimeout(t *testing.T) {
+	client, server := newRPCPair()
+	defer client.Close()
+	server.Register("slow", func(ctx context.Context, from peer.ID, params json.RawMessage) (interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+		return nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := client.Call(ctx, peer.ID("server"), "slow", nil, nil)
+	if!errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, but got %v", err)
+	}
+}
+
+func TestRPCRemoteError(t *testing.T) {
+	client, server := newRPCPair()
+	defer client.Close()
+	server.Register("fail", func(ctx context.Context, from peer.ID, params json.RawMessage) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	err := client.Call(context.Background(), peer.ID("server"), "fail", nil, nil)
+	var remoteErr *RemoteError
+	if!errors.As(err, &remoteErr) {
+		t.Fatalf("Expected *RemoteError, but got %v", err)
+	}
+	if remoteErr.Message!= "boom" {
+		t.Errorf("Expected remote message 'boom', but got %q", remoteErr.Message)
+	}
+	err = client.Call(context.Background(), peer.ID("server"), "missing", nil, nil)
+	if!errors.Is(err, ErrUnknownMethod) {
+		t.Errorf("Expected ErrUnknownMethod, but got %v", err)
+	}
+
+	// A handler error that reads like an RPC error is still a remote error
+	server.Register("mimic", func(ctx context.Context, from peer.ID, params json.RawMessage) (interface{}, error) {
+		return nil, ErrUnknownMethod
+	})
+	err = client.Call(context.Background(), peer.ID("server"), "mimic", nil, nil)
+	if errors.Is(err, ErrUnknownMethod) ||!errors.As(err, &remoteErr) {
+		t.Errorf("Expected *RemoteError, but got %v", err)
+	}
+}
+
+func TestRPCBoundsConcurrentRequests(t *testing.T) {
+	client := NewRPC(nil)
+	server := NewRPC(nil)
+	server.maxConcurrent = 1
+	c1, c2 := net.Pipe()
+	client.attach(peer.ID("server"), c1)
+	server.attach(peer.ID("client"), c2)
+	defer client.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server.Register("block", func(ctx context.Context, from peer.ID, params json.RawMessage) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Call(context.Background(), peer.ID("server"), "block", nil, nil)
+	}()
+	<-started
+	if err := client.Call(context.Background(), peer.ID("server"), "block", nil, nil);!errors.Is(err, ErrBusy) {
+		t.Errorf("Expected ErrBusy while the server is at its limit, but got %v", err)
+	}
+	close(release)
+	if err := <-done; err!= nil {
+		t.Errorf("Expected the first call to succeed, but got error: %s", err)
+	}
+}
+
+func TestRPCDuplicateResponse(t *testing.T) {
+	c1, c2 := net.Pipe()
+	client := NewRPC(nil)
+	session := client.attach(peer.ID("server"), c1)
+	defer client.Close()
+
+	// A request whose reply channel is already full must not stall the loop
+	// when a misbehaving server answers it twice
+	full := make(chan *rpcFrame, 1)
+	session.mu.Lock()
+	session.pending[1000] = full
+	session.mu.Unlock()
+	go func() {
+		dup, _ := json.Marshal(&rpcFrame{ID: 1000, Response: true})
+		for i := 0; i < 2; i++ {
+			if err := writeMessage(c2, dup); err!= nil {
+				return
+			}
+		}
+		data, err := readMessage(c2)
+		if err!= nil {
+			return
+		}
+		var req rpcFrame
+		if err := json.Unmarshal(data, &req); err!= nil {
+			return
+		}
+		reply, _ := json.Marshal(&rpcFrame{ID: req.ID, Response: true, Result: json.RawMessage(`1`)})
+		writeMessage(c2, reply)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var reply int
+	if err := client.Call(ctx, peer.ID("server"), "one", nil, &reply); err!= nil {
+		t.Fatalf("Expected Call to succeed, but got error: %s", err)
+	}
+	if reply!= 1 {
+		t.Errorf("Expected reply 1, but got %d", reply)
+	}
+}
+
+func TestRPCLabelsOutboundMethods(t *testing.T) {
+	client, _ := newRPCPair()
+	defer client.Close()
+	// The server has no handler, so only the outbound call knows the method
+	client.Call(context.Background(), peer.ID("server"), "outbound.only", nil, nil)
+
+	families, err := metrics.Default.Gatherer().Gather()
+	if err!= nil {
+		t.Fatal(err)
+	}
+	var observed, sent bool
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			switch family.GetName() {
+			case "pi_network_request_duration_seconds":
+				observed = observed || (labels["method"] == "outbound.only" && metric.GetHistogram().GetSampleCount() > 0)
+			case "pi_network_messages_total":
+				sent = sent || (labels["type"] == "rpc.outbound.only" && labels["direction"] == metrics.DirectionOut)
+			}
+		}
+	}
+	if!observed ||!sent {
+		t.Errorf("Expected the call-only method to get its own labels, but got latency %v and sent %v", observed, sent)
+	}
+}
@@ -0,0 +1,558 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/flynn/noise"
+	"golang.org/x/crypto/hkdf"
+)
+
+// SecureMode selects the handshake used by a secure channel
+type SecureMode int
+
+const (
+	// SecureModeTLS uses mutual TLS 1.3 with self-signed node certificates
+	SecureModeTLS SecureMode = iota
+	// SecureModeNoise uses the Noise XX handshake with the node key signing the static key
+	SecureModeNoise
+)
+
+const (
+	DefaultCertValidity = 24 * time.Hour
+
+	noiseMaxMessage = 65535
+	noiseTagSize    = 16
+	noiseIdentity   = "pi-noise-identity"
+)
+
+var (
+	// ErrPeerKeyMismatch is returned when the remote node key doesn't match the pinned key
+	ErrPeerKeyMismatch = errors.New("secure channel: peer public key does not match pinned key")
+
+	// ErrNoPeerIdentity is returned when the remote side presented no usable node key
+	ErrNoPeerIdentity = errors.New("secure channel: peer presented no node identity")
+)
+
+// SecureConfig configures an authenticated, encrypted channel between nodes
+type SecureConfig struct {
+	// PrivateKey is the local node key. Certificates and Noise identities are derived from it.
+	PrivateKey *ecdsa.PrivateKey
+
+	// PeerPublicKey pins the expected remote node key. When nil any peer
+	// proving possession of a node key is accepted, and its key can be
+	// read with RemotePublicKey.
+	PeerPublicKey *ecdsa.PublicKey
+
+	// Mode selects TLS or Noise
+	Mode SecureMode
+
+	// Certificates issues the TLS certificates. When nil a manager with
+	// DefaultCertValidity is shared by every config with the same node key.
+	Certificates *CertificateManager
+}
+
+var (
+	defaultCertsMu sync.Mutex
+	defaultCerts   = make(map[*ecdsa.PrivateKey]*CertificateManager)
+)
+
+// defaultCertificates returns the shared certificate manager for a node key,
+// so configs without one don't issue a new certificate per handshake
+func defaultCertificates(privateKey *ecdsa.PrivateKey) *CertificateManager {
+	defaultCertsMu.Lock()
+	defer defaultCertsMu.Unlock()
+	certs, ok := defaultCerts[privateKey]
+	if!ok {
+		certs = NewCertificateManager(privateKey, DefaultCertValidity)
+		defaultCerts[privateKey] = certs
+	}
+	return certs
+}
+
+// CertificateManager issues self-signed certificates for the node key and
+// rotates them before they expire. The key stays the same across rotations,
+// so peers that pin the node key are not affected.
+type CertificateManager struct {
+	privateKey   *ecdsa.PrivateKey
+	validity     time.Duration
+	rotateBefore time.Duration
+	now          func() time.Time
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+}
+
+// NewCertificateManager creates a CertificateManager issuing certificates
+// valid for validity, rotated once less than a quarter of that remains
+func NewCertificateManager(privateKey *ecdsa.PrivateKey, validity time.Duration) *CertificateManager {
+	if validity <= 0 {
+		validity = DefaultCertValidity
+	}
+	return &CertificateManager{
+		privateKey:   privateKey,
+		validity:     validity,
+		rotateBefore: validity / 4,
+		now:          time.Now,
+	}
+}
+
+// Certificate returns the current certificate, issuing a new one if the
+// current one is missing or close to expiry
+func (m *CertificateManager) Certificate() (*tls.Certificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cert!= nil && m.now().Add(m.rotateBefore).Before(m.cert.Leaf.NotAfter) {
+		return m.cert, nil
+	}
+	cert, err := m.issue()
+	if err!= nil {
+		return nil, err
+	}
+	m.cert = cert
+	return cert, nil
+}
+
+// Rotate forces a new certificate to be issued
+func (m *CertificateManager) Rotate() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cert, err := m.issue()
+	if err!= nil {
+		return err
+	}
+	m.cert = cert
+	return nil
+}
+
+func (m *CertificateManager) issue() (*tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err!= nil {
+		return nil, err
+	}
+	now := m.now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: NodeKeyFingerprint(&m.privateKey.PublicKey)},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(m.validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &m.privateKey.PublicKey, m.privateKey)
+	if err!= nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err!= nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  m.privateKey,
+		Leaf:        leaf,
+	}, nil
+}
+
+// NodeKeyFingerprint returns the hex SHA-256 of the uncompressed node public key
+func NodeKeyFingerprint(publicKey *ecdsa.PublicKey) string {
+	sum := sha256.Sum256(elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y))
+	return fmt.Sprintf("%x", sum)
+}
+
+// NewMutualTLSConfig returns a TLS config that presents the node certificate
+// and requires the peer to present a valid self-signed certificate whose key
+// matches cfg.PeerPublicKey, if set
+func NewMutualTLSConfig(cfg *SecureConfig) *tls.Config {
+	certs := cfg.Certificates
+	if certs == nil {
+		certs = defaultCertificates(cfg.PrivateKey)
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		ClientAuth: tls.RequireAnyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs.Certificate()
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.Certificate()
+		},
+		// Node certificates are self-signed, so chain verification is
+		// replaced by checking the certificate against the node key
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, err := verifyNodeCertificate(rawCerts, cfg.PeerPublicKey)
+			return err
+		},
+	}
+}
+
+func verifyNodeCertificate(rawCerts [][]byte, pinned *ecdsa.PublicKey) (*ecdsa.PublicKey, error) {
+	if len(rawCerts) == 0 {
+		return nil, ErrNoPeerIdentity
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err!= nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, errors.New("secure channel: peer certificate expired or not yet valid")
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err!= nil {
+		return nil, fmt.Errorf("secure channel: peer certificate not self-signed: %w", err)
+	}
+	publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if!ok {
+		return nil, ErrNoPeerIdentity
+	}
+	if pinned!= nil &&!publicKey.Equal(pinned) {
+		return nil, ErrPeerKeyMismatch
+	}
+	return publicKey, nil
+}
+
+// SecureDial dials addr and runs the client side of the secure handshake
+func SecureDial(ctx context.Context, addr string, cfg *SecureConfig) (net.Conn, error) {
+	conn, err := DialContext(ctx, addr)
+	if err!= nil {
+		return nil, err
+	}
+	secure, err := SecureClient(ctx, conn, cfg)
+	if err!= nil {
+		conn.Close()
+		return nil, err
+	}
+	return secure, nil
+}
+
+// SecureClient runs the client side of the secure handshake over conn
+func SecureClient(ctx context.Context, conn net.Conn, cfg *SecureConfig) (net.Conn, error) {
+	if cfg.Mode == SecureModeNoise {
+		return noiseHandshake(ctx, conn, cfg, true)
+	}
+	tlsConn := tls.Client(conn, NewMutualTLSConfig(cfg))
+	err := tlsConn.HandshakeContext(ctx)
+	if err!= nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// SecureServer runs the server side of the secure handshake over conn
+func SecureServer(ctx context.Context, conn net.Conn, cfg *SecureConfig) (net.Conn, error) {
+	if cfg.Mode == SecureModeNoise {
+		return noiseHandshake(ctx, conn, cfg, false)
+	}
+	tlsConn := tls.Server(conn, NewMutualTLSConfig(cfg))
+	err := tlsConn.HandshakeContext(ctx)
+	if err!= nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// SecureListen listens on addr; connections returned by Accept have completed
+// the secure handshake. Handshakes run concurrently, so a peer that stalls
+// its handshake doesn't hold up other connections.
+func SecureListen(addr string, cfg *SecureConfig) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err!= nil {
+		return nil, err
+	}
+	sl := &secureListener{
+		Listener: l,
+		cfg:      cfg,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	go sl.acceptLoop()
+	return sl, nil
+}
+
+type secureListener struct {
+	net.Listener
+	cfg *SecureConfig
+
+	conns     chan net.Conn
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+}
+
+// acceptLoop accepts raw connections and hands each to its own handshake
+// goroutine until the listener fails or is closed
+func (l *secureListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err!= nil {
+			l.closeOnce.Do(func() {
+				l.err = err
+				close(l.done)
+			})
+			return
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake runs the server handshake on conn and queues it for Accept,
+// dropping it if the handshake fails or the listener closes first
+func (l *secureListener) handshake(conn net.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConnectTimeout)
+	defer cancel()
+	secure, err := SecureServer(ctx, conn, l.cfg)
+	if err!= nil {
+		conn.Close()
+		return
+	}
+	select {
+	case l.conns <- secure:
+	case <-l.done:
+		secure.Close()
+	}
+}
+
+// Accept waits for the next connection that completes the handshake
+func (l *secureListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Close stops the listener and drops connections still in their handshake
+func (l *secureListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.err = net.ErrClosed
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+// RemotePublicKey returns the authenticated node key of the remote side of a secure connection
+func RemotePublicKey(conn net.Conn) (*ecdsa.PublicKey, error) {
+	switch c := conn.(type) {
+	case *tls.Conn:
+		state := c.ConnectionState()
+		if len(state.PeerCertificates) == 0 {
+			return nil, ErrNoPeerIdentity
+		}
+		publicKey, ok := state.PeerCertificates[0].PublicKey.(*ecdsa.PublicKey)
+		if!ok {
+			return nil, ErrNoPeerIdentity
+		}
+		return publicKey, nil
+	case *noiseConn:
+		return c.remoteKey, nil
+	default:
+		return nil, errors.New("secure channel: not a secure connection")
+	}
+}
+
+// noiseStaticKey derives the Curve25519 static key used in Noise handshakes from the node key
+func noiseStaticKey(privateKey *ecdsa.PrivateKey) (noise.DHKey, error) {
+	seed := hkdf.New(sha256.New, privateKey.D.Bytes(), nil, []byte("pi-noise-static-key"))
+	return noise.DH25519.GenerateKeypair(seed)
+}
+
+// noiseIdentityPayload proves ownership of the node key by signing the Noise static key
+func noiseIdentityPayload(privateKey *ecdsa.PrivateKey, static []byte) ([]byte, error) {
+	digest := sha256.Sum256(append([]byte(noiseIdentity), static...))
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	if err!= nil {
+		return nil, err
+	}
+	publicKey := elliptic.Marshal(privateKey.Curve, privateKey.X, privateKey.Y)
+	payload := make([]byte, 2, 2+len(publicKey)+len(signature))
+	binary.BigEndian.PutUint16(payload, uint16(len(publicKey)))
+	payload = append(payload, publicKey...)
+	return append(payload, signature...), nil
+}
+
+func verifyNoiseIdentity(payload []byte, static []byte, pinned *ecdsa.PublicKey) (*ecdsa.PublicKey, error) {
+	if len(payload) < 2 {
+		return nil, ErrNoPeerIdentity
+	}
+	n := int(binary.BigEndian.Uint16(payload))
+	if len(payload) < 2+n {
+		return nil, ErrNoPeerIdentity
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), payload[2:2+n])
+	if x == nil {
+		return nil, ErrNoPeerIdentity
+	}
+	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	digest := sha256.Sum256(append([]byte(noiseIdentity), static...))
+	if!ecdsa.VerifyASN1(publicKey, digest[:], payload[2+n:]) {
+		return nil, errors.New("secure channel: invalid noise identity signature")
+	}
+	if pinned!= nil &&!publicKey.Equal(pinned) {
+		return nil, ErrPeerKeyMismatch
+	}
+	return publicKey, nil
+}
+
+// noiseHandshake runs Noise_XX_25519_ChaChaPoly_SHA256. The responder sends
+// its identity payload in the second message and the initiator in the third.
+func noiseHandshake(ctx context.Context, conn net.Conn, cfg *SecureConfig, initiator bool) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	static, err := noiseStaticKey(cfg.PrivateKey)
+	if err!= nil {
+		return nil, err
+	}
+	identity, err := noiseIdentityPayload(cfg.PrivateKey, static.Public)
+	if err!= nil {
+		return nil, err
+	}
+	hs, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:   noise.NewCipherSuite(noise.DH25519, noise.CipherChaChaPoly, noise.HashSHA256),
+		Random:        rand.Reader,
+		Pattern:       noise.HandshakeXX,
+		Initiator:     initiator,
+		StaticKeypair: static,
+	})
+	if err!= nil {
+		return nil, err
+	}
+
+	var (
+		send, recv *noise.CipherState
+		remotePay  []byte
+	)
+	// Messages alternate initiator -> responder -> initiator
+	for step := 0; step < 3; step++ {
+		writing := (step%2 == 0) == initiator
+		var cs1, cs2 *noise.CipherState
+		if writing {
+			var payload []byte
+			if step > 0 {
+				payload = identity
+			}
+			var msg []byte
+			msg, cs1, cs2, err = hs.WriteMessage(nil, payload)
+			if err!= nil {
+				return nil, err
+			}
+			err = writeNoiseFrame(conn, msg)
+		} else {
+			var msg []byte
+			msg, err = readNoiseFrame(conn)
+			if err!= nil {
+				return nil, err
+			}
+			var payload []byte
+			payload, cs1, cs2, err = hs.ReadMessage(nil, msg)
+			if step > 0 {
+				remotePay = payload
+			}
+		}
+		if err!= nil {
+			return nil, err
+		}
+		if cs1!= nil {
+			if initiator {
+				send, recv = cs1, cs2
+			} else {
+				send, recv = cs2, cs1
+			}
+		}
+	}
+	remoteKey, err := verifyNoiseIdentity(remotePay, hs.PeerStatic(), cfg.PeerPublicKey)
+	if err!= nil {
+		return nil, err
+	}
+	return &noiseConn{Conn: conn, send: send, recv: recv, remoteKey: remoteKey}, nil
+}
+
+func writeNoiseFrame(w io.Writer, msg []byte) error {
+	frame := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	copy(frame[2:], msg)
+	_, err := w.Write(frame)
+	return err
+}
+
+func readNoiseFrame(r io.Reader) ([]byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err!= nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r, msg); err!= nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// noiseConn encrypts traffic with the cipher states from a completed Noise handshake
+type noiseConn struct {
+	net.Conn
+	send      *noise.CipherState
+	recv      *noise.CipherState
+	remoteKey *ecdsa.PublicKey
+
+	readMu  sync.Mutex
+	readBuf bytes.Buffer
+	writeMu sync.Mutex
+}
+
+func (c *noiseConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for c.readBuf.Len() == 0 {
+		msg, err := readNoiseFrame(c.Conn)
+		if err!= nil {
+			return 0, err
+		}
+		plaintext, err := c.recv.Decrypt(nil, nil, msg)
+		if err!= nil {
+			return 0, err
+		}
+		c.readBuf.Write(plaintext)
+	}
+	return c.readBuf.Read(b)
+}
+
+func (c *noiseConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > noiseMaxMessage-noiseTagSize {
+			chunk = chunk[:noiseMaxMessage-noiseTagSize]
+		}
+		ciphertext, err := c.send.Encrypt(nil, nil, chunk)
+		if err!= nil {
+			return written, err
+		}
+		if err := writeNoiseFrame(c.Conn, ciphertext); err!= nil {
+			return written, err
+		}
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func generateNodeKey(t *testing.T) *ecdsa.PrivateKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err!= nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+// secureEcho starts a listener that echoes back whatever it reads on each accepted connection
+func secureEcho(t *testing.T, cfg *SecureConfig) (string, chan *ecdsa.PublicKey) {
+	l, err := SecureListen("127.0.0.1:0", cfg)
+	if err!= nil {
+		t.Fatalf("Expected SecureListen to succeed, but got error: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	peers := make(chan *ecdsa.PublicKey, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err!= nil {
+				return
+			}
+			key, _ := RemotePublicKey(conn)
+			peers <- key
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String(), peers
+}
+
+func testSecureRoundTrip(t *testing.T, mode SecureMode) {
+	serverKey := generateNodeKey(t)
+	clientKey := generateNodeKey(t)
+	addr, peers := secureEcho(t, &SecureConfig{PrivateKey: serverKey, PeerPublicKey: &clientKey.PublicKey, Mode: mode})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := SecureDial(ctx, addr, &SecureConfig{PrivateKey: clientKey, PeerPublicKey: &serverKey.PublicKey, Mode: mode})
+	if err!= nil {
+		t.Fatalf("Expected SecureDial to succeed, but got error: %s", err)
+	}
+	defer conn.Close()
+
+	remote, err := RemotePublicKey(conn)
+	if err!= nil {
+		t.Fatalf("Expected RemotePublicKey to succeed, but got error: %s", err)
+	}
+	if!remote.Equal(&serverKey.PublicKey) {
+		t.Errorf("Expected remote key to be the server node key")
+	}
+	if key := <-peers;!key.Equal(&clientKey.PublicKey) {
+		t.Errorf("Expected server to see the client node key")
+	}
+
+	message := bytes.Repeat([]byte("pi"), 100000)
+	go conn.Write(message)
+	echoed := make([]byte, len(message))
+	_, err = io.ReadFull(conn, echoed)
+	if err!= nil {
+		t.Fatalf("Expected to read the echoed message, but got error: %s", err)
+	}
+	if!bytes.Equal(echoed, message) {
+		t.Errorf("Expected echoed message to match the sent message")
+	}
+}
+
+func TestSecureChannelTLS(t *testing.T) {
+	testSecureRoundTrip(t, SecureModeTLS)
+}
+
+func TestSecureChannelNoise(t *testing.T) {
+	testSecureRoundTrip(t, SecureModeNoise)
+}
+
+func testSecurePinMismatch(t *testing.T, mode SecureMode) {
+	serverKey := generateNodeKey(t)
+	otherKey := generateNodeKey(t)
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	go SecureServer(context.Background(), c2, &SecureConfig{PrivateKey: serverKey, Mode: mode})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := SecureClient(ctx, c1, &SecureConfig{PrivateKey: generateNodeKey(t), PeerPublicKey: &otherKey.PublicKey, Mode: mode})
+	if err == nil {
+		t.Fatalf("Expected handshake with an unexpected server key to fail")
+	}
+	if mode == SecureModeNoise &&!errors.Is(err, ErrPeerKeyMismatch) {
+		t.Errorf("Expected ErrPeerKeyMismatch, but got %s", err)
+	}
+}
+
+func TestSecureChannelTLSPinMismatch(t *testing.T) {
+	testSecurePinMismatch(t, SecureModeTLS)
+}
+
+func TestSecureChannelNoisePinMismatch(t *testing.T) {
+	testSecurePinMismatch(t, SecureModeNoise)
+}
+
+func TestCertificateRotation(t *testing.T) {
+	privateKey := generateNodeKey(t)
+	manager := NewCertificateManager(privateKey, time.Hour)
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+
+	first, err := manager.Certificate()
+	if err!= nil {
+		t.Fatalf("Expected Certificate to succeed, but got error: %s", err)
+	}
+	again, _ := manager.Certificate()
+	if again!= first {
+		t.Errorf("Expected the certificate to be reused while fresh")
+	}
+
+	now = now.Add(50 * time.Minute)
+	rotated, err := manager.Certificate()
+	if err!= nil {
+		t.Fatalf("Expected Certificate to succeed, but got error: %s", err)
+	}
+	if rotated == first {
+		t.Errorf("Expected the certificate to be rotated close to expiry")
+	}
+	if rotated.Leaf.SerialNumber.Cmp(first.Leaf.SerialNumber) == 0 {
+		t.Errorf("Expected rotated certificate to have a new serial number")
+	}
+	if!rotated.Leaf.PublicKey.(*ecdsa.PublicKey).Equal(&privateKey.PublicKey) {
+		t.Errorf("Expected rotated certificate to keep the node key")
+	}
+	if rotated.Leaf.Subject.CommonName!= NodeKeyFingerprint(&privateKey.PublicKey) {
+		t.Errorf("Expected certificate subject to be the node key fingerprint")
+	}
+}
+
+func TestSecureListenerStalledHandshake(t *testing.T) {
+	serverKey := generateNodeKey(t)
+	addr, peers := secureEcho(t, &SecureConfig{PrivateKey: serverKey})
+
+	// A peer that connects and never starts its handshake must not hold up
+	// the next connection
+	stalled, err := net.Dial("tcp", addr)
+	if err!= nil {
+		t.Fatalf("Expected Dial to succeed, but got error: %s", err)
+	}
+	defer stalled.Close()
+
+	clientKey := generateNodeKey(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := SecureDial(ctx, addr, &SecureConfig{PrivateKey: clientKey})
+	if err!= nil {
+		t.Fatalf("Expected SecureDial to succeed, but got error: %s", err)
+	}
+	defer conn.Close()
+	select {
+	case key := <-peers:
+		if!key.Equal(&clientKey.PublicKey) {
+			t.Errorf("Expected the accepted connection to be the client's")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected Accept to return the completed handshake")
+	}
+}
+
+func TestSecureListenerClose(t *testing.T) {
+	l, err := SecureListen("127.0.0.1:0", &SecureConfig{PrivateKey: generateNodeKey(t)})
+	if err!= nil {
+		t.Fatalf("Expected SecureListen to succeed, but got error: %s", err)
+	}
+	l.Close()
+	if _, err := l.Accept();!errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed after Close, but got %v", err)
+	}
+}
+
+func TestDefaultCertificateReused(t *testing.T) {
+	cfg := &SecureConfig{PrivateKey: generateNodeKey(t)}
+	first, err := NewMutualTLSConfig(cfg).GetCertificate(nil)
+	if err!= nil {
+		t.Fatalf("Expected GetCertificate to succeed, but got error: %s", err)
+	}
+	second, _ := NewMutualTLSConfig(&SecureConfig{PrivateKey: cfg.PrivateKey}).GetCertificate(nil)
+	if second!= first {
+		t.Errorf("Expected configs without a certificate manager to share the node certificate")
+	}
+}